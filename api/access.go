@@ -0,0 +1,333 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// checkPermission returns AccessDeniedError unless a principal can do
+// something to a bucket. Nothing is checked if tokens aren't required.
+func checkPermission(store interfaces.AccessStore, principal, bucket string, permission models.Permission) error {
+	if principal == "" {
+		return nil
+	}
+	return store.CheckPermission(principal, bucket, permission)
+}
+
+// checkDestination makes sure a principal can put blobs into a bucket. If
+// the bucket doesn't exist yet, it's created on their behalf, so that they
+// get the default grants for its creator.
+func checkDestination(store interfaces.MetadataStore, principal, bucket string) error {
+	if principal == "" {
+		return nil
+	}
+	err := store.CheckPermission(principal, bucket, models.PermissionWrite)
+	if err != interfaces.NoSuchBucketError {
+		return err
+	}
+	_, err = store.CreateBucket(&models.Bucket{Name: bucket}, principal)
+	if err == interfaces.BucketExistsError {
+		// Someone else created it first, so it's their grants which count
+		return store.CheckPermission(principal, bucket, models.PermissionWrite)
+	}
+	return err
+}
+
+// canRead reports whether a principal can read a bucket's blobs.
+func canRead(store interfaces.AccessStore, principal, bucket string) (bool, error) {
+	err := checkPermission(store, principal, bucket, models.PermissionRead)
+	if err == interfaces.AccessDeniedError || err == interfaces.NoSuchBucketError {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// bucketOfBlobId looks up a blob's bucket, whether or not it's in the trash.
+func bucketOfBlobId(store interfaces.MetadataStore, id int64) (string, error) {
+	blob, err := store.RetrieveBlobById(id)
+	if err == interfaces.NoMatchingBlobsError {
+		blob, err = store.RetrieveTrashedBlob(id)
+	}
+	if err != nil {
+		return "", err
+	}
+	return blob.Bucket, nil
+}
+
+// bucketResolver works out which bucket a request is about.
+type bucketResolver func(store interfaces.MetadataStore, r *http.Request) (string, error)
+
+// bucketFromPath reads the bucket from the request's path.
+func bucketFromPath(store interfaces.MetadataStore, r *http.Request) (string, error) {
+	return mux.Vars(r)["bucket"], nil
+}
+
+// bucketOfBlob looks up the bucket of the blob in the request's path, which
+// may be in the trash, or may be identified by an alias.
+func bucketOfBlob(store interfaces.MetadataStore, r *http.Request) (string, error) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		alias, err := store.ResolveAlias(vars["id"])
+		if err != nil {
+			return "", err
+		}
+		id = alias.BlobId
+	}
+	return bucketOfBlobId(store, id)
+}
+
+// bucketOfAlias looks up the bucket of the blob an alias points at.
+func bucketOfAlias(store interfaces.MetadataStore, r *http.Request) (string, error) {
+	alias, err := store.ResolveAlias(mux.Vars(r)["name"])
+	if err != nil {
+		return "", err
+	}
+	return bucketOfBlobId(store, alias.BlobId)
+}
+
+// RequirePermission only runs a handler if the request's principal has a
+// permission on the bucket which the request is about. If the blob or alias
+// the bucket is worked out from doesn't exist, the handler is left to report
+// it; any other error stops the request.
+func RequirePermission(store interfaces.MetadataStore, permission models.Permission, resolve bucketResolver, next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		principal := utils.RequestPrincipal(r)
+		if principal != "" {
+			bucket, err := resolve(store, r)
+			if err == nil {
+				err = store.CheckPermission(principal, bucket, permission)
+			} else if err == interfaces.NoMatchingBlobsError || err == interfaces.NoSuchAliasError {
+				err = nil
+			}
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+}
+
+// RequireAdministrator only runs a handler if the request's principal is in
+// the admin group, or if tokens aren't required.
+func RequireAdministrator(store interfaces.AccessStore, next http.Handler) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		principal := utils.RequestPrincipal(r)
+		if principal != "" {
+			admin, err := store.IsAdministrator(principal)
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			} else if !admin {
+				writeError(w, r, http.StatusForbidden, interfaces.AccessDeniedError)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+}
+
+// writeJSON encodes a value as the response.
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(v)
+}
+
+// ListGrantsEndpointFactory returns the grants on a bucket.
+func ListGrantsEndpointFactory(store interfaces.AccessStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		grants, err := store.ListGrants(mux.Vars(r)["bucket"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, grants)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// decodeGrants reads and checks a list of grants from a request body.
+func decodeGrants(r *http.Request) ([]*models.Grant, error) {
+	defer r.Body.Close()
+	grants := make([]*models.Grant, 0)
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&grants)
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range grants {
+		err = grant.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return grants, nil
+}
+
+// SetGrantsEndpointFactory replaces the grants on a bucket.
+func SetGrantsEndpointFactory(store interfaces.AccessStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		grants, err := decodeGrants(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := store.SetGrants(mux.Vars(r)["bucket"], grants)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, updated)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// ListDefaultGrantsEndpointFactory returns the grants which new buckets start with.
+func ListDefaultGrantsEndpointFactory(store interfaces.AccessStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		grants, err := store.ListDefaultGrants()
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, grants)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// SetDefaultGrantsEndpointFactory replaces the grants which new buckets start with.
+func SetDefaultGrantsEndpointFactory(store interfaces.AccessStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		grants, err := decodeGrants(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := store.SetDefaultGrants(grants)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, updated)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// ListGroupsEndpointFactory returns the name of every group.
+func ListGroupsEndpointFactory(store interfaces.AccessStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		groups, err := store.ListGroups()
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, groups)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// ListGroupMembersEndpointFactory returns the members of a group.
+func ListGroupMembersEndpointFactory(store interfaces.AccessStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		members, err := store.ListGroupMembers(mux.Vars(r)["group"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, members)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// AddGroupMemberEndpointFactory adds a principal to a group.
+func AddGroupMemberEndpointFactory(store interfaces.AccessStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		err := store.AddGroupMember(vars["group"], vars["member"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+}
+
+// RemoveGroupMemberEndpointFactory removes a principal from a group.
+func RemoveGroupMemberEndpointFactory(store interfaces.AccessStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		err := store.RemoveGroupMember(vars["group"], vars["member"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// checkAliasTarget makes sure a principal can write to the bucket of the
+// blob an alias is being pointed at. Missing blobs are left to the AliasStore.
+func checkAliasTarget(store interfaces.MetadataStore, principal string, blobId int64) error {
+	bucket, err := bucketOfBlobId(store, blobId)
+	if err == interfaces.NoMatchingBlobsError {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return checkPermission(store, principal, bucket, models.PermissionWrite)
+}
+
+// ListAliasesEndpointFactory lists the aliases which point at blobs the caller can read.
+func ListAliasesEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		all, err := store.ListAliases()
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		aliases := make([]*models.Alias, 0, len(all))
+		for _, alias := range all {
+			bucket, err := bucketOfBlobId(store, alias.BlobId)
+			readable := err == interfaces.NoMatchingBlobsError
+			if err == nil {
+				readable, err = canRead(store, utils.RequestPrincipal(r), bucket)
+			}
+			if err != nil && err != interfaces.NoMatchingBlobsError {
+				writeStoreError(w, r, err)
+				return
+			} else if readable {
+				aliases = append(aliases, alias)
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(aliases)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// CreateAliasEndpointFactory creates a new alias, failing if it already exists.
+func CreateAliasEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		var alias models.Alias
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&alias)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = checkAliasTarget(store, utils.RequestPrincipal(r), alias.BlobId)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		none := int64(0)
+		created, err := store.SetAlias(alias.Name, alias.BlobId, &none)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(created)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// UpdateAliasEndpointFactory repoints an alias, creating it if needed. If the
+// update names an expected blob, the alias is only changed if it still points there.
+func UpdateAliasEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		vars := mux.Vars(r)
+		var update models.AliasUpdate
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&update)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = checkAliasTarget(store, utils.RequestPrincipal(r), update.BlobId)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		alias, err := store.SetAlias(vars["name"], update.BlobId, update.Expected)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(alias)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// ResolveAliasEndpointFactory returns the blob an alias points at.
+func ResolveAliasEndpointFactory(store interfaces.AliasStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		alias, err := store.ResolveAlias(vars["name"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(alias)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// AliasHistoryEndpointFactory lists every change made to an alias, newest first.
+func AliasHistoryEndpointFactory(store interfaces.AliasStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		history, err := store.AliasHistory(vars["name"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(history)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// DeleteAliasEndpointFactory removes an alias and its history, leaving the
+// blob it pointed at alone.
+func DeleteAliasEndpointFactory(store interfaces.AliasStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		err := store.DeleteAlias(vars["name"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// parseAuditQuery reads the actor, action, bucket, blob, since, until, after
+// and limit parameters from a request's query string. Times are RFC 3339.
+func parseAuditQuery(r *http.Request) (*models.AuditQuery, error) {
+	values := r.URL.Query()
+	qry := &models.AuditQuery{}
+
+	// An empty actor matches changes made without a token
+	if actor, ok := values["actor"]; ok {
+		qry.Actor = &actor[0]
+	}
+	if action := values.Get("action"); action != "" {
+		a := models.AuditAction(action)
+		qry.Action = &a
+	}
+	if bucket := values.Get("bucket"); bucket != "" {
+		qry.Bucket = &bucket
+	}
+	if blob := values.Get("blob"); blob != "" {
+		id, err := strconv.ParseInt(blob, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		qry.Blob = &id
+	}
+	if since := values.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return nil, err
+		}
+		qry.Since = &t
+	}
+	if until := values.Get("until"); until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return nil, err
+		}
+		qry.Until = &t
+	}
+	if after := values.Get("after"); after != "" {
+		id, err := strconv.ParseInt(after, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		qry.After = id
+	}
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, models.InvalidAuditLimitError
+		}
+		qry.Limit = l
+	}
+
+	return qry, qry.Validate()
+}
+
+// ListAuditEntriesEndpointFactory returns a page of the audit log, oldest
+// first, optionally filtered.
+func ListAuditEntriesEndpointFactory(store interfaces.AuditStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		qry, err := parseAuditQuery(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		page, err := store.ListAuditEntries(qry)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, page)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// ExportAuditEntriesEndpointFactory streams every audit entry matching the
+// filters as newline-delimited JSON, without holding them all in memory.
+func ExportAuditEntriesEndpointFactory(store interfaces.AuditStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		qry, err := parseAuditQuery(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// Read the entries from the store in the background
+		entries := make(chan *models.AuditEntry, exportFlushInterval)
+		done := make(chan struct{})
+		defer close(done)
+		result := make(chan error, 1)
+		go func() {
+			result <- store.StreamAuditEntries(qry, entries, done)
+		}()
+
+		// Once writing starts, the status code can't be changed, so errors
+		// can only be logged (and the client will see a truncated body)
+		w.Header().Add("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		flusher, canFlush := w.(http.Flusher)
+		written := 0
+		for entry := range entries {
+			err := encoder.Encode(entry)
+			if err != nil {
+				log.Printf("ExportAuditEntries: write error: %v", err)
+				return
+			}
+			written++
+			if written%exportFlushInterval == 0 && canFlush {
+				flusher.Flush()
+			}
+		}
+
+		if err = <-result; err != nil {
+			log.Printf("ExportAuditEntries: store error after %d entries: %v", written, err)
+		}
+	})
+
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strings"
+)
+
+// requestToken returns the API token from a request's Authorization header,
+// sent either as "Bearer <token>" or as the password for basic authentication.
+func requestToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	header := r.Header.Get("Authorization")
+	if strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+	return ""
+}
+
+// RequireTokenMiddleware rejects requests which don't carry a valid API token
+// in their Authorization header. The token's principal is passed on to the
+// handler, and can be retrieved with utils.RequestPrincipal. The challenge
+// is sent with 401 responses: browsers prompt for a password if it's "Basic".
+func RequireTokenMiddleware(store interfaces.TokenStore, challenge string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			token, err := store.AuthenticateToken(requestToken(r))
+			if err == interfaces.InvalidTokenError {
+				w.Header().Set("WWW-Authenticate", challenge+` realm="repositron"`)
+				writeError(w, r, http.StatusUnauthorized, err)
+				return
+			} else if err != nil {
+				writeStoreError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, utils.WithPrincipal(r, token.Principal))
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Sentimentron/repositron/content"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"net/http"
+)
+
+var batchRolledBackError = errors.New("not applied, because another operation in the batch failed")
+
+// prepareBlobChange works out the change a delete, patch or move operation
+// makes to a blob's record, checking that the principal is allowed to make it.
+// On failure, it returns the HTTP status to report.
+func prepareBlobChange(store interfaces.MetadataStore, principal string, op *models.BatchOperation) (models.BlobChange, int, error) {
+	switch op.Op {
+	case models.BatchDelete:
+		blob, err := store.RetrieveBlobById(op.Id)
+		if err != nil {
+			return models.BlobChange{}, statusForError(err), err
+		}
+		err = checkPermission(store, principal, blob.Bucket, models.PermissionDelete)
+		if err != nil {
+			return models.BlobChange{}, statusForError(err), err
+		}
+		if op.IfMatch != "" && op.IfMatch != "*" && op.IfMatch != blob.ETag() {
+			return models.BlobChange{}, http.StatusPreconditionFailed, interfaces.BlobRevisionMismatchError
+		}
+		return models.BlobChange{Trash: true, Blob: blob, Revision: blob.Revision}, http.StatusAccepted, nil
+	case models.BatchPatch, models.BatchMove:
+		patch := op.Patch
+		if op.Op == models.BatchMove {
+			patch = op.Destination.Patch()
+		}
+		blob, revision, status, err := preparePatch(store, principal, op.Id, patch, op.IfMatch)
+		if err != nil {
+			return models.BlobChange{}, status, err
+		}
+		return models.BlobChange{Blob: blob, Revision: revision}, http.StatusOK, nil
+	}
+	return models.BlobChange{}, http.StatusBadRequest, models.BatchNotAtomicError
+}
+
+// applyBlobChanges makes changes with ApplyBlobChanges, recording them in
+// the audit trail in the same transaction.
+func applyBlobChanges(audit *content.AuditTrail, changes []models.BlobChange) ([]*models.Blob, error) {
+	var updated []*models.Blob
+	err := audit.Change(func(tx *content.AuditedChanges) error {
+		before := make([]*models.Blob, len(changes))
+		for i, change := range changes {
+			var err error
+			before[i], err = tx.RetrieveBlobById(change.Blob.Id)
+			if err != nil {
+				return &interfaces.BlobChangeError{Index: i, Err: err}
+			}
+		}
+		var err error
+		updated, err = tx.ApplyBlobChanges(changes)
+		if err != nil {
+			return err
+		}
+		for i, change := range changes {
+			if change.Trash {
+				err = tx.Record(models.AuditDelete, before[i], nil)
+			} else {
+				err = tx.Record(models.AuditUpdate, before[i], updated[i])
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// runBatchOperation runs a single operation on its own.
+func runBatchOperation(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, principal string, audit *content.AuditTrail, op *models.BatchOperation) models.BatchResult {
+	if op.Op == models.BatchCopy {
+		created, status, err := copyBlob(metadataStore, contentStore, principal, audit, op.Id, op.Destination)
+		if err != nil {
+			return models.BatchResult{Status: status, Error: err.Error()}
+		}
+		return models.BatchResult{Status: status, Blob: created}
+	}
+
+	change, status, err := prepareBlobChange(metadataStore, principal, op)
+	if err != nil {
+		return models.BatchResult{Status: status, Error: err.Error()}
+	}
+	updated, err := applyBlobChanges(audit, []models.BlobChange{change})
+	if err != nil {
+		return models.BatchResult{Status: statusForError(err), Error: err.Error()}
+	}
+	return models.BatchResult{Status: status, Blob: updated[0]}
+}
+
+// runAtomicBatch runs delete, patch and move operations in a single
+// transaction. If any of them fail, none of them are applied.
+func runAtomicBatch(store interfaces.MetadataStore, principal string, audit *content.AuditTrail, ops []models.BatchOperation) []models.BatchResult {
+	results := make([]models.BatchResult, len(ops))
+	changes := make([]models.BlobChange, len(ops))
+
+	// Reports the operation which failed, and that nothing else was applied
+	fail := func(index, status int, err error) []models.BatchResult {
+		for i := range results {
+			results[i] = models.BatchResult{Status: http.StatusFailedDependency, Error: batchRolledBackError.Error()}
+		}
+		results[index] = models.BatchResult{Status: status, Error: err.Error()}
+		return results
+	}
+
+	for i := range ops {
+		change, status, err := prepareBlobChange(store, principal, &ops[i])
+		if err != nil {
+			return fail(i, status, err)
+		}
+		changes[i] = change
+		results[i].Status = status
+	}
+
+	updated, err := applyBlobChanges(audit, changes)
+	var changeErr *interfaces.BlobChangeError
+	if errors.As(err, &changeErr) {
+		return fail(changeErr.Index, statusForError(err), changeErr.Err)
+	} else if err != nil {
+		for i := range results {
+			results[i] = models.BatchResult{Status: statusForError(err), Error: err.Error()}
+		}
+		return results
+	}
+
+	for i := range results {
+		results[i].Blob = updated[i]
+	}
+	return results
+}
+
+// BatchEndpointFactory runs a list of delete, patch, copy and move operations
+// in order, reporting the outcome of each. Atomic batches either succeed or
+// fail together; otherwise each operation succeeds or fails independently.
+func BatchEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		var batch models.BatchRequest
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&batch)
+		if err == nil {
+			err = batch.Validate()
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var response models.BatchResponse
+		principal := utils.RequestPrincipal(r)
+		audit := content.RequestAuditTrail(metadataStore, r)
+		if batch.Atomic {
+			response.Results = runAtomicBatch(metadataStore, principal, audit, batch.Operations)
+		} else {
+			response.Results = make([]models.BatchResult, 0, len(batch.Operations))
+			for i := range batch.Operations {
+				response.Results = append(response.Results, runBatchOperation(metadataStore, contentStore, principal, audit, &batch.Operations[i]))
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(response)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// applyBucketPolicy fills in the defaults of the blob's bucket and checks
+// that the blob is allowed in it. Buckets which don't exist yet impose no policy.
+func applyBucketPolicy(store interfaces.BucketStore, blob *models.Blob) error {
+	bucket, err := store.RetrieveBucket(blob.Bucket)
+	if err == interfaces.NoSuchBucketError {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	bucket.ApplyDefaults(blob)
+	return bucket.CheckBlob(blob)
+}
+
+// ListBucketsEndpointFactory describes the buckets which the caller can read.
+func ListBucketsEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		all, err := store.DescribeAllBuckets()
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		buckets := make([]*models.BucketDescription, 0, len(all))
+		for _, bucket := range all {
+			readable, err := canRead(store, utils.RequestPrincipal(r), bucket.Name)
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			} else if readable {
+				buckets = append(buckets, bucket)
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(buckets)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+func CreateBucketEndpointFactory(store interfaces.BucketStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Parse the bucket description
+		defer r.Body.Close()
+		var bucket models.Bucket
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&bucket)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = bucket.Validate()
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		created, err := store.CreateBucket(&bucket, utils.RequestPrincipal(r))
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(created)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+func DescribeBucketEndpointFactory(store interfaces.BucketStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		description, err := store.DescribeBucket(vars["bucket"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(description)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+func ConfigureBucketEndpointFactory(store interfaces.BucketStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Parse the new settings
+		defer r.Body.Close()
+		vars := mux.Vars(r)
+		bucket := models.Bucket{Name: vars["bucket"]}
+
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&bucket.BucketSettings)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = bucket.Validate()
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		updated, err := store.UpdateBucket(&bucket)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(updated)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+func DeleteBucketEndpointFactory(store interfaces.BucketStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		err := store.DeleteBucket(vars["bucket"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/content"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// parseBlobDestination reads the blob id and destination of a copy or move.
+func parseBlobDestination(r *http.Request) (int64, *models.BlobDestination, error) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var dest models.BlobDestination
+	decoder := json.NewDecoder(r.Body)
+	err = decoder.Decode(&dest)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return id, &dest, dest.Validate()
+}
+
+// copyBlob creates a new blob with the same content as an existing one,
+// discarding it if the content can't be copied. The principal must be able
+// to read the original and write to the copy's bucket. On failure, it returns
+// the HTTP status to report. The copy is recorded in the audit trail.
+func copyBlob(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, principal string, audit *content.AuditTrail, id int64, dest *models.BlobDestination) (*models.Blob, int, error) {
+
+	src, err := metadataStore.RetrieveBlobById(id)
+	if err == interfaces.NoMatchingBlobsError {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, statusForError(err), err
+	}
+	err = checkPermission(metadataStore, principal, src.Bucket, models.PermissionRead)
+	if err == nil {
+		err = checkDestination(metadataStore, principal, dest.Bucket)
+	}
+	if err != nil {
+		return nil, statusForError(err), err
+	}
+
+	// Blobs still being uploaded can't be copied
+	if src.Checksum == "" {
+		return nil, http.StatusConflict, interfaces.BlobContentNotFoundError
+	}
+
+	// Describe the copy, and check it's allowed in its bucket
+	blob := *src
+	blob.Id = 0
+	blob.Checksum = ""
+	blob.Date = time.Now()
+	blob.Bucket = dest.Bucket
+	if dest.Name != "" {
+		blob.Name = dest.Name
+	}
+	err = applyBucketPolicy(metadataStore, &blob)
+	if err != nil {
+		return nil, statusForError(err), err
+	}
+	err = checkQuotas(contentStore, &blob, blob.Size, 1)
+	if err != nil {
+		return nil, statusForError(err), err
+	}
+
+	created, err := metadataStore.StoreBlobRecord(&blob)
+	if err != nil {
+		return nil, statusForError(err), err
+	}
+
+	// Duplicate the content, and discard the new blob if that fails
+	intent, err := metadataStore.RecordIntent(created.Id, models.IntentCopy)
+	if err != nil {
+		if deleteErr := metadataStore.DeleteBlobById(created.Id); deleteErr != nil {
+			log.Printf("CopyBlob: failed to remove blob %d: %v", created.Id, deleteErr)
+		}
+		return nil, statusForError(err), err
+	}
+	var finalized *models.Blob
+	copied, err := content.CopyBlobContent(contentStore, src, created)
+	if err == nil {
+		copied.Checksum = src.Checksum
+		err = audit.Change(func(tx *content.AuditedChanges) error {
+			finalized, err = tx.FinalizeBlobRecord(copied)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditCreate, nil, finalized)
+		})
+	}
+	content.FinishIntent(metadataStore, contentStore, intent, err == nil)
+	if err != nil {
+		return nil, statusForError(err), err
+	}
+
+	pruneVersions(metadataStore, contentStore, audit, finalized)
+	return finalized, http.StatusCreated, nil
+}
+
+// CopyBlobEndpointFactory creates a new blob with the same content as an
+// existing one, without the content passing through the client.
+func CopyBlobEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		id, dest, err := parseBlobDestination(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		created, status, err := copyBlob(metadataStore, contentStore, utils.RequestPrincipal(r), content.RequestAuditTrail(metadataStore, r), id, dest)
+		if err != nil {
+			writeError(w, r, status, err)
+			return
+		}
+
+		err = writeBlob(w, created, status)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// MoveBlobEndpointFactory puts an existing blob into another bucket and
+// optionally renames it. The content stays where it is.
+func MoveBlobEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		id, dest, err := parseBlobDestination(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		updated, status, err := patchBlob(store, utils.RequestPrincipal(r), content.RequestAuditTrail(store, r), id, dest.Patch(), r.Header.Get("If-Match"))
+		if err != nil {
+			writeError(w, r, status, err)
+			return
+		}
+
+		err = writeBlob(w, updated, http.StatusOK)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
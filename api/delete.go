@@ -1,14 +1,17 @@
 package api
 
 import (
-	"fmt"
+	"github.com/Sentimentron/repositron/content"
 	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
 )
 
-func DeleteBlobByIdEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+// DeleteBlobByIdEndpointFactory moves a blob into the trash. Its content is
+// only removed once it's been purged, or the trash's grace period is over.
+func DeleteBlobByIdEndpointFactory(metadataStore interfaces.MetadataStore) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -16,32 +19,22 @@ func DeleteBlobByIdEndpointFactory(metadataStore interfaces.MetadataStore, conte
 		vars := mux.Vars(r)
 		id, err := strconv.ParseInt(vars["id"], 10, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeError(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		// Retrieve the blob
 		blob, err := metadataStore.RetrieveBlobById(id)
-		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusNotFound)
-			return
+		if err == nil {
+			err = content.RequestAuditTrail(metadataStore, r).Change(func(tx *content.AuditedChanges) error {
+				err := tx.TrashBlobById(id)
+				if err != nil {
+					return err
+				}
+				return tx.Record(models.AuditDelete, blob, nil)
+			})
 		}
-
-		// Remove the blob from the filesystem
-		err = contentStore.DeleteBlobContent(blob)
-		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		// Remove the blob from the metadataStore
-		err = metadataStore.DeleteBlobById(id)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 
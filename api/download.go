@@ -1,21 +1,55 @@
 package api
 
 import (
-	"fmt"
 	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
 	"github.com/gorilla/mux"
 	"net/http"
+	"strconv"
+	"time"
 )
 
-func GetBlobContentEndpointFactory(store interfaces.MetadataStore) http.Handler {
+// contentRedirectExpiry is how long the signed URLs which downloads are
+// redirected to last. They only need to last long enough to be followed.
+const contentRedirectExpiry = time.Minute
+
+// GetBlobContentEndpointFactory redirects to a signed URL for a blob's
+// content. The blob can be identified by its id, or by an alias which
+// points at it.
+func GetBlobContentEndpointFactory(store interfaces.MetadataStore, contentStore interfaces.ContentStore, router *mux.Router) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		vars := mux.Vars(r)
-		id := vars["id"]
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			alias, err := store.ResolveAlias(vars["id"])
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			}
+			id = alias.BlobId
+		}
+
+		// Blobs in the trash can't be downloaded
+		blob, err := store.RetrieveBlobById(id)
+		if err == interfaces.NoMatchingBlobsError {
+			writeError(w, r, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
 
-		redirectString := fmt.Sprintf("/static/%s", id)
-		http.Redirect(w, r, redirectString, 308)
+		// The URL expires, so the redirect mustn't be cached
+		scope := &models.URLScope{Method: http.MethodGet, Expires: time.Now().Add(contentRedirectExpiry)}
+		url, err := contentStore.RetrieveURLForBlobContent(blob, scope, router)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 
 	})
 
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Sentimentron/repositron/api/httpstatus"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"gopkg.in/go-playground/validator.v9"
+	"log"
+	"net/http"
+	"strings"
+)
+
+var NoSuchRouteError = errors.New("no such route")
+var MethodNotAllowedError = errors.New("method not allowed")
+
+// statusForError picks the HTTP status for any error a handler runs into, the
+// same way the UI does.
+var statusForError = httpstatus.ForError
+
+// errorCodeForStatus classifies an error response by its status.
+func errorCodeForStatus(status int) models.ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return models.ErrorBadRequest
+	case http.StatusUnauthorized:
+		return models.ErrorUnauthorized
+	case http.StatusForbidden:
+		return models.ErrorForbidden
+	case http.StatusNotFound:
+		return models.ErrorNotFound
+	case http.StatusMethodNotAllowed:
+		return models.ErrorMethodNotAllowed
+	case http.StatusConflict:
+		return models.ErrorConflict
+	case http.StatusPreconditionFailed:
+		return models.ErrorPreconditionFailed
+	case http.StatusRequestEntityTooLarge:
+		return models.ErrorTooLarge
+	case http.StatusRequestedRangeNotSatisfiable:
+		return models.ErrorRangeNotSatisfiable
+	case http.StatusTooManyRequests:
+		return models.ErrorTooManyRequests
+	case http.StatusNotImplemented:
+		return models.ErrorNotImplemented
+	case http.StatusServiceUnavailable:
+		return models.ErrorUnavailable
+	case http.StatusInsufficientStorage:
+		return models.ErrorInsufficientStorage
+	}
+	if status < http.StatusInternalServerError {
+		return models.ErrorBadRequest
+	}
+	return models.ErrorInternal
+}
+
+// errorDetails adds what's known about an error beyond its message.
+func errorDetails(apiErr *models.APIError, err error) {
+	var changeErr *interfaces.BlobChangeError
+	if errors.As(err, &changeErr) {
+		apiErr.Details = map[string]int{"index": changeErr.Index}
+		errorDetails(apiErr, changeErr.Err)
+		return
+	}
+	var validationErrs validator.ValidationErrors
+	var quotaErr *models.QuotaExceededError
+	switch {
+	case errors.As(err, &validationErrs):
+		apiErr.Code = models.ErrorValidationFailed
+		failures := make([]*models.ValidationFailure, len(validationErrs))
+		fields := make([]string, len(validationErrs))
+		for i, fieldErr := range validationErrs {
+			failures[i] = &models.ValidationFailure{Field: fieldErr.Namespace(), Rule: fieldErr.Tag(), Param: fieldErr.Param()}
+			fields[i] = fieldErr.Namespace()
+		}
+		apiErr.Message = "validation failed for " + strings.Join(fields, ", ")
+		apiErr.Details = failures
+	case errors.As(err, &quotaErr):
+		apiErr.Details = quotaErr.Quota
+	}
+}
+
+// writeError responds with an APIError describing err. Server errors are
+// logged, since their messages may not mean much to the client.
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	apiErr := &models.APIError{
+		Code:      errorCodeForStatus(status),
+		Message:   err.Error(),
+		RequestId: utils.RequestId(r),
+	}
+	errorDetails(apiErr, err)
+	if status >= http.StatusInternalServerError {
+		log.Printf("%s %s (request %s): %v", r.Method, r.URL.Path, apiErr.RequestId, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.Encode(apiErr)
+}
+
+// writeStoreError responds with the status statusForError picks for err.
+func writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, statusForError(err), err)
+}
+
+// logResponseError notes an error which happened after the response had
+// started, when it's too late to tell the client.
+func logResponseError(r *http.Request, err error) {
+	log.Printf("%s %s (request %s): unable to finish the response: %v", r.Method, r.URL.Path, utils.RequestId(r), err)
+}
+
+// RequestIdMiddleware gives every request an id, which is sent back in the
+// X-Request-Id header and included in errors.
+func RequestIdMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, id := utils.WithRequestId(r)
+		w.Header().Set(utils.RequestIdHeader, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NotFoundEndpoint responds to requests which don't match any route.
+func NotFoundEndpoint() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, NoSuchRouteError)
+	})
+}
+
+// MethodNotAllowedEndpoint responds to requests which match a route, but not its methods.
+func MethodNotAllowedEndpoint() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusMethodNotAllowed, MethodNotAllowedError)
+	})
+}
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// eventPollInterval is how often the event stream checks for new events.
+	eventPollInterval = 500 * time.Millisecond
+	// eventKeepAliveInterval is how often a comment is sent when nothing's
+	// happening, so that proxies don't close the connection.
+	eventKeepAliveInterval = 15 * time.Second
+	// eventBatchSize is the most events read from the store at once.
+	eventBatchSize = 100
+)
+
+var StreamingNotSupportedError = errors.New("the connection doesn't support streaming")
+
+// eventFilter picks the events a client has asked for, and is allowed to see.
+type eventFilter struct {
+	store     interfaces.AccessStore
+	principal string
+	types     models.EventTypeList
+	bucket    string
+	// readable remembers which buckets the principal can read
+	readable map[string]bool
+}
+
+// parseEventFilter reads the type and bucket parameters from a request's
+// query string. Types can be repeated or separated by commas.
+func parseEventFilter(store interfaces.AccessStore, r *http.Request) (*eventFilter, error) {
+	ret := &eventFilter{
+		store:     store,
+		principal: utils.RequestPrincipal(r),
+		bucket:    r.URL.Query().Get("bucket"),
+		readable:  make(map[string]bool),
+	}
+	for _, value := range r.URL.Query()["type"] {
+		for _, t := range strings.Split(value, ",") {
+			eventType := models.EventType(t)
+			err := eventType.Validate()
+			if err != nil {
+				return nil, err
+			}
+			ret.types = append(ret.types, eventType)
+		}
+	}
+	return ret, nil
+}
+
+// wants returns whether an event should be sent to the client.
+func (f *eventFilter) wants(e *models.Event) (bool, error) {
+	if !f.types.Contains(e.Type) || (f.bucket != "" && e.Blob.Bucket != f.bucket) {
+		return false, nil
+	}
+	readable, ok := f.readable[e.Blob.Bucket]
+	if !ok {
+		var err error
+		readable, err = canRead(f.store, f.principal, e.Blob.Bucket)
+		if err != nil {
+			return false, err
+		}
+		f.readable[e.Blob.Bucket] = readable
+	}
+	return readable, nil
+}
+
+// eventStreamStart works out where a client's stream starts: after the
+// Last-Event-ID it's reconnecting with, or the after parameter, or otherwise
+// after the newest event.
+func eventStreamStart(store interfaces.EventStore, r *http.Request) (int64, error) {
+	start := r.Header.Get("Last-Event-ID")
+	if start == "" {
+		start = r.URL.Query().Get("after")
+	}
+	if start == "" {
+		return store.LatestEventId()
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
+
+// StreamEventsEndpointFactory sends events about the blobs the caller can
+// read as Server-Sent Events, until the client disconnects. Each event's id
+// can be given back in the Last-Event-ID header to carry on where it left off.
+func StreamEventsEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeStoreError(w, r, StreamingNotSupportedError)
+			return
+		}
+
+		filter, err := parseEventFilter(store, r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		lastId, err := eventStreamStart(store, r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		// Once the stream has started, errors can only be logged
+		poll := time.NewTicker(eventPollInterval)
+		defer poll.Stop()
+		lastSent := time.Now()
+		for {
+			events, err := store.ListEvents(lastId, eventBatchSize)
+			if err != nil {
+				log.Printf("StreamEvents: %v", err)
+				return
+			}
+			for _, e := range events {
+				lastId = e.Id
+				wanted, err := filter.wants(e)
+				if err != nil {
+					log.Printf("StreamEvents: %v", err)
+					return
+				} else if !wanted {
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					log.Printf("StreamEvents: %v", err)
+					return
+				}
+				_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Id, e.Type, data)
+				if err != nil {
+					return
+				}
+				lastSent = time.Now()
+			}
+			if len(events) == eventBatchSize {
+				flusher.Flush()
+				continue
+			}
+
+			if time.Since(lastSent) >= eventKeepAliveInterval {
+				_, err = fmt.Fprintf(w, ": keep-alive\n\n")
+				if err != nil {
+					return
+				}
+				lastSent = time.Now()
+			}
+			flusher.Flush()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-poll.C:
+			}
+		}
+	})
+
+}
+
+// ListWebhooksEndpointFactory returns every webhook, without their secrets.
+func ListWebhooksEndpointFactory(store interfaces.EventStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		webhooks, err := store.ListWebhooks()
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, webhooks)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// CreateWebhookEndpointFactory starts sending events to a URL. The response
+// is the only time the webhook's secret is shown.
+func CreateWebhookEndpointFactory(store interfaces.EventStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		webhook := &models.Webhook{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(webhook)
+		if err == nil {
+			err = webhook.Validate()
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		webhook, err = store.CreateWebhook(webhook)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(webhook)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// DeleteWebhookEndpointFactory stops sending events to a webhook.
+func DeleteWebhookEndpointFactory(store interfaces.EventStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = store.DeleteWebhook(id)
+		if err == interfaces.NoSuchWebhookError {
+			writeError(w, r, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+}
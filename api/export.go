@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+)
+
+// exportFlushInterval is how many records are written between flushes.
+const exportFlushInterval = 1000
+
+var exportCSVHeader = []string{"id", "name", "bucket", "uploaded", "type", "sha1", "owner", "size", "metadata"}
+
+// blobExporter writes one blob at a time in a particular format.
+type blobExporter interface {
+	Write(*models.Blob) error
+	Flush() error
+}
+
+type ndjsonExporter struct {
+	encoder *json.Encoder
+}
+
+func (e *ndjsonExporter) Write(b *models.Blob) error {
+	return e.encoder.Encode(b)
+}
+
+func (e *ndjsonExporter) Flush() error {
+	return nil
+}
+
+type csvExporter struct {
+	writer *csv.Writer
+}
+
+func (e *csvExporter) Write(b *models.Blob) error {
+	metadata, err := json.Marshal(b.Metadata)
+	if err != nil {
+		return err
+	}
+	return e.writer.Write([]string{
+		strconv.FormatInt(b.Id, 10),
+		b.Name,
+		b.Bucket,
+		b.Date.Format(time.RFC3339Nano),
+		string(b.Class),
+		b.Checksum,
+		b.Uploader,
+		strconv.FormatInt(b.Size, 10),
+		string(metadata),
+	})
+}
+
+func (e *csvExporter) Flush() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// ExportBlobsEndpointFactory streams every blob record as newline-delimited
+// JSON (the default) or CSV, without holding the whole listing in memory.
+func ExportBlobsEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Optionally restrict the export to a single bucket, and always to
+		// the buckets the caller can read
+		qry := &models.BlobSearch{}
+		if bucket := r.URL.Query().Get("bucket"); bucket != "" {
+			qry.Bucket = &bucket
+		}
+		if principal := utils.RequestPrincipal(r); principal != "" {
+			qry.VisibleTo = &principal
+		}
+
+		var exporter blobExporter
+		switch format := r.URL.Query().Get("format"); format {
+		case "", ExportFormatNDJSON:
+			w.Header().Add("Content-Type", "application/x-ndjson")
+			exporter = &ndjsonExporter{json.NewEncoder(w)}
+		case ExportFormatCSV:
+			w.Header().Add("Content-Type", "text/csv")
+			writer := csv.NewWriter(w)
+			exporter = &csvExporter{writer}
+			err := writer.Write(exportCSVHeader)
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			}
+		default:
+			writeError(w, r, http.StatusBadRequest, fmt.Errorf("unsupported format '%s'", format))
+			return
+		}
+
+		// Read the blobs from the store in the background
+		blobs := make(chan *models.Blob, exportFlushInterval)
+		done := make(chan struct{})
+		defer close(done)
+		result := make(chan error, 1)
+		go func() {
+			result <- store.StreamBlobs(qry, blobs, done)
+		}()
+
+		// Once writing starts, the status code can't be changed, so errors
+		// can only be logged (and the client will see a truncated body)
+		flusher, canFlush := w.(http.Flusher)
+		written := 0
+		for b := range blobs {
+			err := exporter.Write(b)
+			if err != nil {
+				log.Printf("ExportBlobs: write error: %v", err)
+				return
+			}
+			written++
+			if written%exportFlushInterval == 0 {
+				err = exporter.Flush()
+				if err != nil {
+					log.Printf("ExportBlobs: write error: %v", err)
+					return
+				}
+				if canFlush {
+					flusher.Flush()
+				}
+			}
+		}
+
+		err := exporter.Flush()
+		if err != nil {
+			log.Printf("ExportBlobs: write error: %v", err)
+			return
+		}
+		if err = <-result; err != nil {
+			log.Printf("ExportBlobs: store error after %d record(s): %v", written, err)
+		}
+	})
+
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout is how long a check can take before it's failed, so
+// that a stuck store doesn't hang the load balancer's probes.
+const healthCheckTimeout = 5 * time.Second
+
+var HealthCheckTimeoutError = errors.New("check timed out")
+
+// healthCheck checks one thing, returning some detail or an error.
+type healthCheck struct {
+	name  string
+	check func() (string, error)
+}
+
+// runHealthChecks runs every check at once, and reports on them in order.
+func runHealthChecks(checks []healthCheck) *models.HealthReport {
+	type outcome struct {
+		message  string
+		err      error
+		duration time.Duration
+	}
+
+	outcomes := make([]chan outcome, len(checks))
+	for i, c := range checks {
+		outcomes[i] = make(chan outcome, 1)
+		go func(c healthCheck, out chan outcome) {
+			started := time.Now()
+			message, err := c.check()
+			out <- outcome{message, err, time.Since(started)}
+		}(c, outcomes[i])
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	ret := &models.HealthReport{Status: models.HealthOK, Checks: make([]*models.HealthCheck, len(checks))}
+	for i, c := range checks {
+		var o outcome
+		select {
+		case o = <-outcomes[i]:
+		case <-ctx.Done():
+			o = outcome{err: HealthCheckTimeoutError, duration: healthCheckTimeout}
+		}
+
+		result := &models.HealthCheck{Name: c.name, Status: models.HealthOK, Message: o.message, Duration: o.duration.Seconds()}
+		if o.err == interfaces.MethodNotSupportedError {
+			result.Status = models.HealthSkipped
+		} else if o.err != nil {
+			result.Status = models.HealthFailing
+			result.Message = o.err.Error()
+			ret.Status = models.HealthFailing
+		}
+		ret.Checks[i] = result
+	}
+	return ret
+}
+
+// databaseHealthChecks check that the metadata store is usable.
+func databaseHealthChecks(store interfaces.HealthStore) []healthCheck {
+	return []healthCheck{
+		{"database", func() (string, error) { return "", store.Ping() }},
+		{"schema", func() (string, error) { return "", store.CheckSchemaVersion() }},
+	}
+}
+
+// contentHealthChecks check that content can be written, and that there's
+// at least minFreeSpace bytes to write it to.
+func contentHealthChecks(store interfaces.ContentStore, minFreeSpace int64) []healthCheck {
+	checkable, ok := store.(interfaces.CheckableContentStore)
+	if !ok {
+		unsupported := func() (string, error) { return "", interfaces.MethodNotSupportedError }
+		return []healthCheck{{"content", unsupported}, {"disk", unsupported}}
+	}
+	return []healthCheck{
+		{"content", func() (string, error) { return "", checkable.CheckWritable() }},
+		{"disk", func() (string, error) {
+			free, err := checkable.FreeSpace()
+			if err != nil {
+				return "", err
+			}
+			if free < minFreeSpace {
+				return "", fmt.Errorf("%d bytes free, needs at least %d", free, minFreeSpace)
+			}
+			return fmt.Sprintf("%d bytes free", free), nil
+		}},
+	}
+}
+
+// writeHealthReport responds 200 if every check passed, or 503 otherwise.
+func writeHealthReport(w http.ResponseWriter, r *http.Request, report *models.HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if report.Status == models.HealthOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	encoder := json.NewEncoder(w)
+	err := encoder.Encode(report)
+	if err != nil {
+		logResponseError(r, err)
+	}
+}
+
+// HealthEndpointFactory reports whether the server is alive: that it's
+// serving requests and its database answers.
+func HealthEndpointFactory(metadataStore interfaces.MetadataStore) http.Handler {
+
+	checks := databaseHealthChecks(metadataStore)[:1]
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, r, runHealthChecks(checks))
+	})
+
+}
+
+// ReadinessEndpointFactory reports whether the server is usable: that its
+// database answers and has the right schema, that content can be written,
+// and that there's at least minFreeSpace bytes to write it to.
+func ReadinessEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, minFreeSpace int64) http.Handler {
+
+	checks := append(databaseHealthChecks(metadataStore), contentHealthChecks(contentStore, minFreeSpace)...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealthReport(w, r, runHealthChecks(checks))
+	})
+
+}
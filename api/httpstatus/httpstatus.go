@@ -0,0 +1,74 @@
+// Package httpstatus picks the HTTP status to respond with for an error, so
+// that the API and the UI report the same errors in the same way.
+package httpstatus
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Sentimentron/repositron/content"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"strconv"
+)
+
+// statuses maps errors onto the status they're reported with. Errors are
+// matched with errors.Is, so they can be wrapped.
+var statuses = []struct {
+	status int
+	errs   []error
+}{
+	{http.StatusNotFound, []error{
+		interfaces.NoMatchingBlobsError, interfaces.BlobContentNotFoundError,
+		interfaces.NoSuchBucketError, interfaces.NoSuchAliasError, interfaces.NoSuchQuotaError,
+		interfaces.NoSuchTokenError, interfaces.NoSuchWebhookError, interfaces.NoSuchGroupMemberError,
+	}},
+	{http.StatusConflict, []error{
+		interfaces.BucketExistsError, interfaces.BucketNotEmptyError, interfaces.AliasConflictError, interfaces.BlobAliasedError,
+		interfaces.BlobImmutableError, interfaces.BlobLegalHoldError, interfaces.WriteOnceSettingError,
+	}},
+	{http.StatusPreconditionFailed, []error{interfaces.BlobRevisionMismatchError}},
+	{http.StatusForbidden, []error{
+		interfaces.AccessDeniedError, models.UploaderNotAllowedError,
+		content.InvalidSignatureError, content.ExpiredSignatureError,
+	}},
+	{http.StatusUnauthorized, []error{interfaces.InvalidTokenError}},
+	{http.StatusRequestEntityTooLarge, []error{models.BlobTooLargeError}},
+	{http.StatusNotImplemented, []error{interfaces.MethodNotSupportedError}},
+	{http.StatusBadRequest, []error{
+		interfaces.InvalidGroupError, models.InvalidGranteeError, models.InvalidAliasNameError,
+		models.EmptySearchError, models.InvalidSearchModeError, models.InvalidSearchRangeError, models.InvalidSearchTextError,
+		models.InvalidMetadataKeyError, models.InvalidMetadataOperatorError, models.InvalidMetadataValueError,
+		models.InvalidByteRangeError, models.RangeNotDownloadableError, models.SignedURLExpiryError,
+		models.BatchNotAtomicError, models.ImmutableFieldError, models.InvalidPatchValueError, models.InvalidMetadataPatchError,
+		models.InvalidEventTypeError, models.InvalidSortError, models.InvalidSortOrderError,
+		models.InvalidPageLimitError, models.InvalidCursorError, models.InvalidFieldError,
+		models.InvalidAuditActionError, models.InvalidAuditLimitError,
+	}},
+}
+
+// ForError picks the HTTP status for any error a handler runs into. Errors it
+// doesn't recognise are the server's fault.
+func ForError(err error) int {
+	var quotaErr *models.QuotaExceededError
+	var validationErrs validator.ValidationErrors
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var numErr *strconv.NumError
+	switch {
+	case errors.As(err, &quotaErr):
+		return http.StatusInsufficientStorage
+	case errors.As(err, &validationErrs), errors.As(err, &syntaxErr), errors.As(err, &typeErr), errors.As(err, &numErr):
+		return http.StatusBadRequest
+	}
+
+	for _, s := range statuses {
+		for _, e := range s.errs {
+			if errors.Is(err, e) {
+				return s.status
+			}
+		}
+	}
+	return http.StatusInternalServerError
+}
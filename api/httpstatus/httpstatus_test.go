@@ -0,0 +1,33 @@
+package httpstatus
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestForError(t *testing.T) {
+	Convey("Should pick statuses for known errors...", t, func() {
+		So(ForError(interfaces.NoSuchBucketError), ShouldEqual, http.StatusNotFound)
+		So(ForError(interfaces.BlobImmutableError), ShouldEqual, http.StatusConflict)
+		So(ForError(models.ImmutableFieldError), ShouldEqual, http.StatusBadRequest)
+		So(ForError(&models.QuotaExceededError{}), ShouldEqual, http.StatusInsufficientStorage)
+		_, err := strconv.ParseInt("x", 10, 64)
+		So(ForError(err), ShouldEqual, http.StatusBadRequest)
+	})
+
+	Convey("Should see through wrapped errors...", t, func() {
+		So(ForError(fmt.Errorf("checksum stage: %w", interfaces.AccessDeniedError)), ShouldEqual, http.StatusForbidden)
+		So(ForError(&interfaces.BlobChangeError{Index: 1, Err: interfaces.BlobRevisionMismatchError}), ShouldEqual, http.StatusPreconditionFailed)
+		So(ForError(fmt.Errorf("size record stage: %w", &models.QuotaExceededError{})), ShouldEqual, http.StatusInsufficientStorage)
+	})
+
+	Convey("Should blame the server for anything else...", t, func() {
+		So(ForError(errors.New("disk on fire")), ShouldEqual, http.StatusInternalServerError)
+	})
+}
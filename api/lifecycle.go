@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/content"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+// evaluateLifecycleRules works out which blobs each of a bucket's lifecycle
+// rules applies to, applying the rules too unless dryRun is set. Rules are
+// evaluated in order, so a blob deleted by one rule won't match any later ones.
+// Each rule is applied along with its entries in the audit trail.
+func evaluateLifecycleRules(store interfaces.LifecycleStore, audit *content.AuditTrail, bucket *models.Bucket, now time.Time, dryRun bool) ([]*models.LifecycleMatch, error) {
+	ret := make([]*models.LifecycleMatch, 0)
+	for _, rule := range bucket.ActiveLifecycleRules() {
+		var blobs []*models.Blob
+		var err error
+		if dryRun {
+			blobs, err = store.MatchLifecycleRule(bucket.Name, &rule, now)
+		} else {
+			err = audit.Change(func(tx *content.AuditedChanges) error {
+				blobs, err = tx.ApplyLifecycleRule(bucket.Name, &rule, now)
+				if err != nil {
+					return err
+				}
+				return recordLifecycleMatches(tx, &rule, blobs)
+			})
+		}
+		if err != nil {
+			return ret, err
+		}
+		for _, b := range blobs {
+			ret = append(ret, &models.LifecycleMatch{Bucket: bucket.Name, Rule: rule, Blob: b})
+		}
+	}
+	return ret, nil
+}
+
+// recordLifecycleMatches notes the changes a lifecycle rule made in the audit
+// log. Blobs are as they were before the rule was applied.
+func recordLifecycleMatches(tx *content.AuditedChanges, rule *models.LifecycleRule, blobs []*models.Blob) error {
+	for _, b := range blobs {
+		var err error
+		switch rule.Action {
+		case models.LifecycleDelete:
+			err = tx.Record(models.AuditDelete, b, nil)
+		case models.LifecycleMakePermanent:
+			after := *b
+			after.Class = models.PermanentBlob
+			err = tx.Record(models.AuditUpdate, b, &after)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunLifecycleRules applies every bucket's lifecycle rules, returning the
+// blobs they applied to. If dryRun is set, nothing is changed; otherwise,
+// the changes are recorded in the audit log.
+func RunLifecycleRules(store interfaces.MetadataStore, now time.Time, dryRun bool) ([]*models.LifecycleMatch, error) {
+	buckets, err := store.DescribeAllBuckets()
+	if err != nil {
+		return nil, err
+	}
+
+	audit := content.CreateAuditTrail(store, models.LifecycleActor, "")
+	ret := make([]*models.LifecycleMatch, 0)
+	for _, b := range buckets {
+		matches, err := evaluateLifecycleRules(store, audit, &b.Bucket, now, dryRun)
+		ret = append(ret, matches...)
+		if err != nil {
+			// Carry on, so that one bad rule doesn't hold up every other bucket
+			log.Printf("RunLifecycleRules: bucket '%s': %v", b.Name, err)
+		}
+	}
+	return ret, nil
+}
+
+// PreviewLifecycleEndpointFactory lists the blobs which lifecycle rules would
+// apply to if they ran now, optionally restricted to one bucket.
+func PreviewLifecycleEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var matches []*models.LifecycleMatch
+		var err error
+		if name := r.URL.Query().Get("bucket"); name != "" {
+			var bucket *models.Bucket
+			bucket, err = store.RetrieveBucket(name)
+			if err == nil {
+				matches, err = evaluateLifecycleRules(store, nil, bucket, time.Now(), true)
+			}
+		} else {
+			matches, err = RunLifecycleRules(store, time.Now(), true)
+		}
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		// Only preview the buckets the caller can read
+		visible := make([]*models.LifecycleMatch, 0, len(matches))
+		for _, match := range matches {
+			readable, err := canRead(store, utils.RequestPrincipal(r), match.Bucket)
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			} else if readable {
+				visible = append(visible, match)
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(visible)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
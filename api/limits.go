@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TooManyRequestsError is reported when a client has to slow down.
+var TooManyRequestsError = errors.New("too many requests, try again later")
+
+// TooManyTransfersError is reported when every upload or download slot is in use.
+var TooManyTransfersError = errors.New("too many transfers in progress, try again later")
+
+// requestClient identifies who a request is from for rate limiting: its
+// token's principal if it has one, otherwise its address.
+func requestClient(r *http.Request) string {
+	if principal := utils.RequestPrincipal(r); principal != "" {
+		return "principal:" + principal
+	}
+	return requestAddressClient(r)
+}
+
+// requestAddressClient identifies who a request is from by its address alone.
+func requestAddressClient(r *http.Request) string {
+	return "address:" + utils.RequestAddress(r)
+}
+
+// writeTooManyRequests asks the client to come back after wait.
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration, err error) {
+	seconds := int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	writeError(w, r, http.StatusTooManyRequests, err)
+}
+
+// RateLimitMiddleware rejects requests from clients which are making them
+// too quickly, telling them how long to wait in the Retry-After header.
+// It has to run after RequireTokenMiddleware to limit by principal.
+func RateLimitMiddleware(limiter interfaces.RateLimiter) mux.MiddlewareFunc {
+	return rateLimitMiddleware(limiter, requestClient)
+}
+
+// AddressRateLimitMiddleware limits by address, but only counts requests
+// which fail authentication, so that clients sharing an address don't use up
+// each other's requests. It runs before RequireTokenMiddleware, so that tokens
+// can't be guessed any faster than RateLimitMiddleware allows requests.
+func AddressRateLimitMiddleware(limiter interfaces.RateLimiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := requestAddressClient(r)
+			if wait := limiter.Wait(client); wait > 0 {
+				writeTooManyRequests(w, r, wait, TooManyRequestsError)
+				return
+			}
+			recorder := &statusRecorder{w, http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			if recorder.status == http.StatusUnauthorized {
+				limiter.Allow(client)
+			}
+		})
+	}
+}
+
+func rateLimitMiddleware(limiter interfaces.RateLimiter, client func(*http.Request) string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ok, wait := limiter.Allow(client(r)); !ok {
+				writeTooManyRequests(w, r, wait, TooManyRequestsError)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// throttledReader waits for bandwidth for everything read through it.
+type throttledReader struct {
+	io.ReadCloser
+	limiter interfaces.TransferLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.limiter.WaitForBandwidth(n)
+	}
+	return n, err
+}
+
+// throttledWriter waits for bandwidth before anything's written through it.
+type throttledWriter struct {
+	http.ResponseWriter
+	limiter interfaces.TransferLimiter
+}
+
+func (t *throttledWriter) Write(p []byte) (int, error) {
+	t.limiter.WaitForBandwidth(len(p))
+	return t.ResponseWriter.Write(p)
+}
+
+// TransferLimitMiddleware counts requests which move content against the
+// limits on concurrent uploads or downloads, rejecting them if there's no
+// room, and throttles them to share out the available bandwidth. Requests
+// which send a body are uploads, and everything else is a download.
+func TransferLimitMiddleware(limiter interfaces.TransferLimiter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+			kind := interfaces.Download
+			if r.Method == http.MethodPut || r.Method == http.MethodPost {
+				kind = interfaces.Upload
+			}
+			if !limiter.StartTransfer(kind) {
+				writeTooManyRequests(w, r, time.Second, TooManyTransfersError)
+				return
+			}
+			defer limiter.FinishTransfer(kind)
+
+			if kind == interfaces.Upload {
+				r.Body = &throttledReader{r.Body, limiter}
+			} else {
+				w = &throttledWriter{w, limiter}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,9 +2,10 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
+	"github.com/Sentimentron/repositron/content"
 	"github.com/Sentimentron/repositron/interfaces"
 	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
 	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
@@ -14,40 +15,27 @@ func ListAllBlobsEndpointFactory(store interfaces.MetadataStore) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		buckets, err := store.GetAllBuckets()
+		// Work out which page is being requested
+		page, err := parsePageRequest(r)
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		allBlobs := make([]*models.Blob, 0)
-
-		for _, b := range buckets {
-			ids, err := store.GetBlobIdsMatchingBucket(b)
-			if err != nil {
-				fmt.Fprintf(w, "Error: %v", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-
-			for _, v := range ids {
-				cur, err := store.RetrieveBlobById(v)
-				if err != nil {
-					fmt.Fprintf(w, "Error: %v", err)
-					w.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-				allBlobs = append(allBlobs, cur)
-			}
+		// Retrieve that page of blobs, from the buckets the caller can read
+		qry := &models.BlobSearch{}
+		if principal := utils.RequestPrincipal(r); principal != "" {
+			qry.VisibleTo = &principal
+		}
+		blobs, err := store.ListBlobs(qry, page)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
 		}
 
-		w.Header().Add("Content-Type", "application/json")
-		jsonMarshaller := json.NewEncoder(w)
-		err = jsonMarshaller.Encode(allBlobs)
+		err = writeBlobPage(w, blobs, page)
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			logResponseError(r, err)
 			return
 		}
 	})
@@ -61,24 +49,147 @@ func GetBlobDescriptionByIdEndpointFactory(store interfaces.MetadataStore) http.
 		vars := mux.Vars(r)
 		id, err := strconv.ParseInt(vars["id"], 10, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeError(w, r, http.StatusBadRequest, err)
 			return
 		}
 
 		blob, err := store.RetrieveBlobById(id)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 
 		w.Header().Add("Content-Type", "application/json")
+		w.Header().Set("ETag", blob.ETag())
 		jsonMarshaller := json.NewEncoder(w)
 		err = jsonMarshaller.Encode(blob)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// preparePatch retrieves a blob and applies a merge patch to it, without
+// storing the result. The blob's ETag must match ifMatch (unless ifMatch is
+// empty or "*"), and the principal must be able to write to its bucket (and
+// the bucket it's moving to). It returns the patched blob with the revision
+// it was patched from or, on failure, the HTTP status to report.
+func preparePatch(store interfaces.MetadataStore, principal string, id int64, patch models.BlobPatch, ifMatch string) (*models.Blob, int64, int, error) {
+
+	blob, err := store.RetrieveBlobById(id)
+	if err == interfaces.NoMatchingBlobsError {
+		return nil, 0, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, 0, statusForError(err), err
+	}
+	err = checkPermission(store, principal, blob.Bucket, models.PermissionWrite)
+	if err != nil {
+		return nil, 0, statusForError(err), err
+	}
+
+	// Check the client is patching the version it thinks it is
+	if ifMatch != "" && ifMatch != "*" && ifMatch != blob.ETag() {
+		return nil, 0, http.StatusPreconditionFailed, interfaces.BlobRevisionMismatchError
+	}
+
+	revision := blob.Revision
+	bucket := blob.Bucket
+	err = patch.Apply(blob)
+	if err == nil {
+		err = blob.Validate()
+	}
+	if err != nil {
+		return nil, 0, http.StatusBadRequest, err
+	}
+
+	// Moving a blob must respect the new bucket's grants and policy
+	if blob.Bucket != bucket {
+		err = checkDestination(store, principal, blob.Bucket)
+		if err != nil {
+			return nil, 0, statusForError(err), err
+		}
+		err = applyBucketPolicy(store, blob)
+		if err != nil {
+			return nil, 0, statusForError(err), err
+		}
+	}
+
+	return blob, revision, http.StatusOK, nil
+}
+
+// patchBlob applies a merge patch to a blob, provided its ETag matches ifMatch
+// (unless ifMatch is empty or "*"). On failure, it returns the HTTP status to report.
+// The change is recorded in the audit trail.
+func patchBlob(store interfaces.MetadataStore, principal string, audit *content.AuditTrail, id int64, patch models.BlobPatch, ifMatch string) (*models.Blob, int, error) {
+
+	blob, revision, status, err := preparePatch(store, principal, id, patch, ifMatch)
+	if err != nil {
+		return nil, status, err
+	}
+
+	var updated *models.Blob
+	err = audit.Change(func(tx *content.AuditedChanges) error {
+		before, err := tx.RetrieveBlobById(blob.Id)
+		if err != nil {
+			return err
+		}
+		updated, err = tx.UpdateBlobRecord(blob, revision)
+		if err != nil {
+			return err
+		}
+		return tx.Record(models.AuditUpdate, before, updated)
+	})
+	if err != nil {
+		return nil, statusForError(err), err
+	}
+
+	return updated, http.StatusOK, nil
+}
+
+// writeBlob encodes a blob along with its ETag.
+func writeBlob(w http.ResponseWriter, blob *models.Blob, status int) error {
+	w.Header().Add("Content-Type", "application/json")
+	w.Header().Set("ETag", blob.ETag())
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	return encoder.Encode(blob)
+}
+
+// PatchBlobEndpointFactory applies a JSON merge patch to a blob's name, bucket
+// and metadata. If the request has an If-Match header, it must match the blob's
+// current ETag.
+func PatchBlobEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// Parse the patch
+		var patch models.BlobPatch
+		decoder := json.NewDecoder(r.Body)
+		err = decoder.Decode(&patch)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		updated, status, err := patchBlob(store, utils.RequestPrincipal(r), content.RequestAuditTrail(store, r), id, patch, r.Header.Get("If-Match"))
+		if err != nil {
+			writeError(w, r, status, err)
+			return
+		}
+
+		err = writeBlob(w, updated, http.StatusOK)
+		if err != nil {
+			logResponseError(r, err)
 			return
 		}
 	})
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/metrics"
+	"github.com/gorilla/mux"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec("repositron_http_requests_total",
+		"Requests handled, by route and status.", "method", "route", "status")
+	requestDuration = metrics.NewHistogramVec("repositron_http_request_duration_seconds",
+		"How long requests took to handle, by route.", metrics.DefaultDurationBuckets, "method", "route")
+	transferredBytes = metrics.NewCounterVec("repositron_transferred_bytes_total",
+		"Bytes of content uploaded or downloaded.", "direction")
+	activeTransfers = metrics.NewGaugeVec("repositron_active_transfers",
+		"Uploads or downloads in progress.", "direction")
+)
+
+// statusRecorder remembers the status written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Flush lets streaming responses through, if the underlying writer can.
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// MetricsMiddleware counts and times requests by the route they matched,
+// so that blobs' ids don't each get their own series.
+func MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		started := time.Now()
+		recorder := &statusRecorder{w, http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		requestsTotal.With(r.Method, route, strconv.Itoa(recorder.status)).Inc()
+		requestDuration.With(r.Method, route).Observe(time.Since(started).Seconds())
+	})
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.ReadCloser
+	counter *metrics.Counter
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.counter.Add(float64(n))
+	return n, err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	http.ResponseWriter
+	counter *metrics.Counter
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.ResponseWriter.Write(p)
+	c.counter.Add(float64(n))
+	return n, err
+}
+
+// MeterTransferMiddleware counts the bytes moved by requests which upload or
+// download content, and how many of them are in progress. Like
+// TransferLimitMiddleware, requests which send a body are uploads.
+func MeterTransferMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		direction := "download"
+		if r.Method == http.MethodPut || r.Method == http.MethodPost {
+			direction = "upload"
+		}
+		active := activeTransfers.With(direction)
+		active.Inc()
+		defer active.Dec()
+
+		counter := transferredBytes.With(direction)
+		if direction == "upload" {
+			r.Body = &countingReader{r.Body, counter}
+		} else {
+			w = &countingWriter{w, counter}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// BucketMetricsCollector reports how much each bucket is storing, asking the
+// store each time metrics are collected.
+func BucketMetricsCollector(store interfaces.BucketStore) metrics.Collector {
+	registry := metrics.CreateRegistry()
+	storedBytes := registry.GaugeVec("repositron_bucket_stored_bytes",
+		"Bytes of content stored in each bucket.", "bucket")
+	blobs := registry.GaugeVec("repositron_bucket_blobs",
+		"Blobs stored in each bucket.", "bucket")
+
+	var lock sync.Mutex
+
+	return metrics.CollectorFunc(func(w io.Writer) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		buckets, err := store.DescribeAllBuckets()
+		if err != nil {
+			return err
+		}
+
+		// Buckets which have been removed shouldn't linger
+		storedBytes.Reset()
+		blobs.Reset()
+		for _, b := range buckets {
+			storedBytes.With(b.Name).Set(float64(b.TotalSize))
+			blobs.With(b.Name).Set(float64(b.BlobCount))
+		}
+		return registry.Write(w)
+	})
+}
+
+// MetricsEndpointFactory exposes every metric for Prometheus to scrape.
+func MetricsEndpointFactory(store interfaces.BucketStore) http.Handler {
+
+	buckets := BucketMetricsCollector(store)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var buf bytes.Buffer
+		err := metrics.DefaultRegistry.Write(&buf)
+		if err == nil {
+			err = buckets.Collect(&buf)
+		}
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", metrics.ContentType)
+		buf.WriteTo(w)
+	})
+
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// parsePageRequest reads the limit, cursor, sort, order and fields
+// parameters from a request's query string.
+func parsePageRequest(r *http.Request) (*models.PageRequest, error) {
+	values := r.URL.Query()
+	page := &models.PageRequest{
+		Cursor: values.Get("cursor"),
+		Sort:   models.SortField(values.Get("sort")),
+		Order:  models.SortOrder(values.Get("order")),
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, models.InvalidPageLimitError
+		}
+		page.Limit = l
+	}
+
+	if fields := values.Get("fields"); fields != "" {
+		page.Fields = strings.Split(fields, ",")
+	}
+
+	return page, page.Normalize()
+}
+
+// writeBlobPage encodes a page of blobs, keeping only the requested fields.
+func writeBlobPage(w http.ResponseWriter, page *models.BlobPage, req *models.PageRequest) error {
+	w.Header().Add("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if len(req.Fields) == 0 {
+		return encoder.Encode(page)
+	}
+
+	projected, err := page.Project(req.Fields)
+	if err != nil {
+		return err
+	}
+	return encoder.Encode(projected)
+}
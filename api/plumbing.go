@@ -2,39 +2,148 @@ package api
 
 import (
 	"github.com/gorilla/mux"
+	"github.com/Sentimentron/repositron/content"
 	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
 	"github.com/Sentimentron/repositron/server/ui"
 	"net/http"
 )
 
 // AttachAPIMethods lets you attach Repositron methods to an existing HTTP router.
 func AttachAPIMethods(syncStore interfaces.SynchronizationStore,
-	contentStore interfaces.ContentStore, metadataStore interfaces.MetadataStore, uiDir string, staticDir string,
-	shouldAttachDebugInterface bool, r *mux.Router) {
+	contentStore interfaces.ContentStore, metadataStore interfaces.MetadataStore, uiDir string, signer *content.URLSigner,
+	rateLimiter interfaces.RateLimiter, transferLimiter interfaces.TransferLimiter, minFreeSpace int64,
+	shouldAttachDebugInterface bool, shouldRequireTokens bool, r *mux.Router) {
+
+	// Every request is given an id, counted and timed
+	r.Use(RequestIdMiddleware)
+	r.Use(MetricsMiddleware)
 
 	// Machine-readable APIs are versioned on a separate prefix
 	s := r.PathPrefix("/v1").Subrouter()
+	s.NotFoundHandler = RequestIdMiddleware(NotFoundEndpoint())
+	s.MethodNotAllowedHandler = RequestIdMiddleware(MethodNotAllowedEndpoint())
+	// Clients are limited by principal once their token's been checked.
+	// Requests which fail authentication are counted against their address.
+	limited := func(h http.Handler) http.Handler { return h }
+	if rateLimiter != nil {
+		limited = RateLimitMiddleware(rateLimiter)
+		if shouldRequireTokens {
+			s.Use(AddressRateLimitMiddleware(rateLimiter))
+		}
+	}
+	if shouldRequireTokens {
+		s.Use(RequireTokenMiddleware(metadataStore, "Bearer"))
+	}
+	if rateLimiter != nil {
+		s.Use(limited)
+	}
+	// Requests which move content are metered, capped and throttled
+	transfer := MeterTransferMiddleware
+	if transferLimiter != nil {
+		transfer = func(h http.Handler) http.Handler {
+			return TransferLimitMiddleware(transferLimiter)(MeterTransferMiddleware(h))
+		}
+	}
 
 	if shouldAttachDebugInterface {
-		r.Handle("/", ui.IndexEndpointFactory(metadataStore, uiDir))
-		r.Handle("/upload", ui.UploadEndpointFactory(uiDir))
-		r.Handle("/delete/{id:[0-9]+}", ui.DeleteConfirmEndpointFactory(metadataStore, uiDir))
-		r.Handle("/del/{id:[0-9]+}", ui.DeleteEndpointFactory(metadataStore, contentStore))
-		r.Handle("/upload/process", ui.ProcessUploadEndpointFactory(metadataStore, contentStore))
-	}
-
-	s.Handle("/blobs/byId/{id:[0-9]+}", GetBlobDescriptionByIdEndpointFactory(metadataStore)).Methods("GET")
-	s.Handle("/blobs/byId/{id:[0-9]+}", DeleteBlobByIdEndpointFactory(metadataStore, contentStore)).Methods("DELETE")
-	s.Handle("/blobs/byId/{id:[0-9]+}/content", GetBlobContentEndpointFactory(metadataStore)).Methods("GET")
-	s.Handle("/blobs/byId/{id:[0-9]+}/content", UploadContentEndpointFactory(metadataStore, contentStore)).Methods("PUT").Name("ContentUpload")
-	s.Handle("/blobs/byId/{id:[0-9]+}/content/append", AppendContentEndpointFactory(metadataStore, contentStore, syncStore))
+		// Browsers prompt for the token, which is entered as the password
+		u := func(h http.Handler) http.Handler {
+			if shouldRequireTokens {
+				return RequireTokenMiddleware(metadataStore, "Basic")(h)
+			}
+			return h
+		}
+		r.Handle("/", u(ui.IndexEndpointFactory(metadataStore, uiDir)))
+		r.Handle("/upload", u(ui.UploadEndpointFactory(uiDir)))
+		r.Handle("/delete/{id:[0-9]+}", u(ui.DeleteConfirmEndpointFactory(metadataStore, uiDir)))
+		r.Handle("/del/{id:[0-9]+}", u(ui.DeleteEndpointFactory(metadataStore)))
+		r.Handle("/trash", u(ui.TrashEndpointFactory(metadataStore, uiDir)))
+		r.Handle("/trash/restore/{id:[0-9]+}", u(ui.RestoreEndpointFactory(metadataStore)))
+		r.Handle("/trash/purge/{id:[0-9]+}", u(ui.PurgeEndpointFactory(metadataStore, contentStore)))
+		r.Handle("/upload/process", u(transfer(ui.ProcessUploadEndpointFactory(metadataStore, contentStore, syncStore))))
+	}
+
+	// Requests about a particular blob, bucket or alias are checked against the bucket's grants
+	blob := func(permission models.Permission, h http.Handler) http.Handler {
+		return RequirePermission(metadataStore, permission, bucketOfBlob, h)
+	}
+	bucket := func(permission models.Permission, h http.Handler) http.Handler {
+		return RequirePermission(metadataStore, permission, bucketFromPath, h)
+	}
+	alias := func(permission models.Permission, h http.Handler) http.Handler {
+		return RequirePermission(metadataStore, permission, bucketOfAlias, h)
+	}
+	admin := func(h http.Handler) http.Handler {
+		return RequireAdministrator(metadataStore, h)
+	}
+
+	s.Handle("/blobs/byId/{id:[0-9]+}", blob(models.PermissionRead, GetBlobDescriptionByIdEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/blobs/byId/{id:[0-9]+}", blob(models.PermissionWrite, PatchBlobEndpointFactory(metadataStore))).Methods("PATCH")
+	s.Handle("/blobs/byId/{id:[0-9]+}", blob(models.PermissionDelete, DeleteBlobByIdEndpointFactory(metadataStore))).Methods("DELETE")
+	s.Handle("/blobs/byId/{id:.+}/content", blob(models.PermissionRead, GetBlobContentEndpointFactory(metadataStore, contentStore, r))).Methods("GET")
+	s.Handle("/blobs/byId/{id:[0-9]+}/content", blob(models.PermissionWrite, transfer(UploadContentEndpointFactory(metadataStore, contentStore, syncStore)))).Methods("PUT").Name("ContentUpload")
+	s.Handle("/blobs/byId/{id:[0-9]+}/content/append", blob(models.PermissionAppend, transfer(AppendContentEndpointFactory(metadataStore, contentStore, syncStore))))
+	s.Handle("/blobs/byId/{id:[0-9]+}/url", blob(models.PermissionRead, CreateSignedURLEndpointFactory(metadataStore, contentStore, r))).Methods("POST")
+	s.Handle("/blobs/byId/{id:[0-9]+}/copy", blob(models.PermissionRead, CopyBlobEndpointFactory(metadataStore, contentStore))).Methods("POST")
+	s.Handle("/blobs/byId/{id:[0-9]+}/move", blob(models.PermissionWrite, MoveBlobEndpointFactory(metadataStore))).Methods("POST")
+	s.Handle("/blobs/byId/{id:[0-9]+}/protection", blob(models.PermissionAdmin, SetBlobProtectionEndpointFactory(metadataStore))).Methods("PUT")
 	s.Handle("/blobs/search", SearchBlobEndpointFactory(metadataStore)).Methods("POST")
+	s.Handle("/blobs/export", ExportBlobsEndpointFactory(metadataStore)).Methods("GET")
 	s.Handle("/blobs", ListAllBlobsEndpointFactory(metadataStore)).Methods("GET")
-	s.Handle("/blobs", UploadDescriptionEndpointFactory(metadataStore, s)).Methods("PUT")
+	s.Handle("/blobs", UploadDescriptionEndpointFactory(metadataStore, contentStore, s)).Methods("PUT")
+	s.Handle("/batch", BatchEndpointFactory(metadataStore, contentStore)).Methods("POST")
+	s.Handle("/buckets", ListBucketsEndpointFactory(metadataStore)).Methods("GET")
+	s.Handle("/buckets", CreateBucketEndpointFactory(metadataStore)).Methods("POST")
+	s.Handle("/buckets/{bucket}", bucket(models.PermissionRead, DescribeBucketEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/buckets/{bucket}", bucket(models.PermissionAdmin, ConfigureBucketEndpointFactory(metadataStore))).Methods("PUT")
+	s.Handle("/buckets/{bucket}", bucket(models.PermissionAdmin, DeleteBucketEndpointFactory(metadataStore))).Methods("DELETE")
+	s.Handle("/buckets/{bucket}/acl", bucket(models.PermissionAdmin, ListGrantsEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/buckets/{bucket}/acl", bucket(models.PermissionAdmin, SetGrantsEndpointFactory(metadataStore))).Methods("PUT")
+	s.Handle("/buckets/{bucket}/objects/{name:.+}/versions/{version:[0-9]+}", bucket(models.PermissionRead, GetBlobVersionEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/buckets/{bucket}/objects/{name:.+}/versions", bucket(models.PermissionRead, ListBlobVersionsEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/buckets/{bucket}/objects/{name:.+}", bucket(models.PermissionRead, GetLatestBlobEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/acl/default", admin(ListDefaultGrantsEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/acl/default", admin(SetDefaultGrantsEndpointFactory(metadataStore))).Methods("PUT")
+	s.Handle("/groups", admin(ListGroupsEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/groups/{group}", admin(ListGroupMembersEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/groups/{group}/members/{member}", admin(AddGroupMemberEndpointFactory(metadataStore))).Methods("PUT")
+	s.Handle("/groups/{group}/members/{member}", admin(RemoveGroupMemberEndpointFactory(metadataStore))).Methods("DELETE")
+	s.Handle("/quotas", admin(ListQuotasEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/quotas/{scope:uploader|bucket}/{name}", RetrieveQuotaUsageEndpointFactory(metadataStore, contentStore)).Methods("GET")
+	s.Handle("/quotas/{scope:uploader|bucket}/{name}", admin(SetQuotaEndpointFactory(metadataStore))).Methods("PUT")
+	s.Handle("/quotas/{scope:uploader|bucket}/{name}", admin(DeleteQuotaEndpointFactory(metadataStore))).Methods("DELETE")
+	s.Handle("/audit", admin(ListAuditEntriesEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/audit/export", admin(ExportAuditEntriesEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/events", StreamEventsEndpointFactory(metadataStore)).Methods("GET")
+	s.Handle("/webhooks", admin(ListWebhooksEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/webhooks", admin(CreateWebhookEndpointFactory(metadataStore))).Methods("POST")
+	s.Handle("/webhooks/{id:[0-9]+}", admin(DeleteWebhookEndpointFactory(metadataStore))).Methods("DELETE")
+	s.Handle("/aliases", ListAliasesEndpointFactory(metadataStore)).Methods("GET")
+	s.Handle("/aliases", CreateAliasEndpointFactory(metadataStore)).Methods("POST")
+	s.Handle("/aliases/{name:.+}/history", alias(models.PermissionRead, AliasHistoryEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/aliases/{name:.+}", alias(models.PermissionRead, ResolveAliasEndpointFactory(metadataStore))).Methods("GET")
+	s.Handle("/aliases/{name:.+}", alias(models.PermissionWrite, UpdateAliasEndpointFactory(metadataStore))).Methods("PUT")
+	s.Handle("/aliases/{name:.+}", alias(models.PermissionWrite, DeleteAliasEndpointFactory(metadataStore))).Methods("DELETE")
+	s.Handle("/lifecycle/preview", PreviewLifecycleEndpointFactory(metadataStore)).Methods("GET")
+	s.Handle("/trash", ListTrashEndpointFactory(metadataStore)).Methods("GET")
+	s.Handle("/trash/{id:[0-9]+}/restore", blob(models.PermissionDelete, RestoreBlobEndpointFactory(metadataStore))).Methods("POST")
+	s.Handle("/trash/{id:[0-9]+}", blob(models.PermissionDelete, PurgeBlobEndpointFactory(metadataStore, contentStore))).Methods("DELETE")
 	s.Handle("/info", DescribeEndpoint()).Methods("GET")
 
-	// Set up a URL which will serve static files
-	r.PathPrefix("/static").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir))))
+	// Load balancers check these without a token
+	r.Handle("/healthz", HealthEndpointFactory(metadataStore)).Methods("GET")
+	r.Handle("/readyz", ReadinessEndpointFactory(metadataStore, contentStore, minFreeSpace)).Methods("GET")
+
+	// Metrics are for administrators, since they name every bucket
+	metricsHandler := admin(MetricsEndpointFactory(metadataStore))
+	if shouldRequireTokens {
+		metricsHandler = RequireTokenMiddleware(metadataStore, "Bearer")(metricsHandler)
+	}
+	r.Handle("/metrics", metricsHandler).Methods("GET")
+
+	// Signed URLs carry their own authorization, so they're outside the /v1 API
+	r.Handle("/signed/blobs/{id:[0-9]+}/content", limited(transfer(SignedContentEndpointFactory(metadataStore, contentStore, syncStore, signer)))).Methods("GET", "PUT").Name("SignedContent")
 
 
 }
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/content"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// SetBlobProtectionEndpointFactory changes whether a blob is write-once or under legal hold.
+func SetBlobProtectionEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var protection models.BlobProtection
+		decoder := json.NewDecoder(r.Body)
+		err = decoder.Decode(&protection)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var blob *models.Blob
+		err = content.RequestAuditTrail(store, r).Change(func(tx *content.AuditedChanges) error {
+			before, err := tx.RetrieveBlobById(id)
+			if err != nil {
+				return err
+			}
+			blob, err = tx.SetBlobProtection(id, &protection)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditProtect, before, blob)
+		})
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeBlob(w, blob, http.StatusOK)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
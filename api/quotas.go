@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// checkQuotas makes sure there's room for size more bytes in count more
+// blobs for a blob's uploader and bucket. Nothing is checked if the content
+// store doesn't keep track of usage.
+func checkQuotas(contentStore interfaces.ContentStore, blob *models.Blob, size int64, count int64) error {
+	accountable, ok := contentStore.(interfaces.AccountableContentStore)
+	if !ok {
+		return nil
+	}
+	return accountable.CheckQuotas(blob, size, count)
+}
+
+// retrieveUsage reports how much an uploader or bucket is storing. If the
+// content store doesn't keep track, writes in progress are left out.
+func retrieveUsage(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, scope models.QuotaScope, name string) (*models.QuotaUsage, error) {
+	if accountable, ok := contentStore.(interfaces.AccountableContentStore); ok {
+		return accountable.RetrieveUsage(scope, name)
+	}
+	usage, err := metadataStore.RetrieveUsage(scope, name)
+	if err != nil {
+		return nil, err
+	}
+	usage.Quota, err = metadataStore.RetrieveQuota(scope, name)
+	return usage, err
+}
+
+// ListQuotasEndpointFactory returns every quota.
+func ListQuotasEndpointFactory(store interfaces.QuotaStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		quotas, err := store.ListQuotas()
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, quotas)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// RetrieveQuotaUsageEndpointFactory reports how much an uploader or bucket
+// is storing, and the quota which applies to it. Uploaders can see their
+// own usage, and anyone who can read a bucket can see its usage.
+func RetrieveQuotaUsageEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		scope := models.QuotaScope(vars["scope"])
+		name := vars["name"]
+
+		principal := utils.RequestPrincipal(r)
+		var err error
+		if scope == models.QuotaBucket {
+			err = checkPermission(metadataStore, principal, name, models.PermissionRead)
+		} else if principal != "" && principal != name {
+			var admin bool
+			admin, err = metadataStore.IsAdministrator(principal)
+			if err == nil && !admin {
+				err = interfaces.AccessDeniedError
+			}
+		}
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		usage, err := retrieveUsage(metadataStore, contentStore, scope, name)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, usage)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// SetQuotaEndpointFactory creates or replaces the quota on an uploader or a
+// bucket. The name '*' sets the default for every uploader or bucket without
+// a quota of its own.
+func SetQuotaEndpointFactory(store interfaces.QuotaStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		quota := &models.Quota{}
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(quota)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// The path says what the quota applies to
+		vars := mux.Vars(r)
+		quota.Scope = models.QuotaScope(vars["scope"])
+		quota.Name = vars["name"]
+		err = quota.Validate()
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		quota, err = store.SetQuota(quota)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, quota)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// DeleteQuotaEndpointFactory removes the quota on an uploader or a bucket.
+func DeleteQuotaEndpointFactory(store interfaces.QuotaStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		err := store.DeleteQuota(models.QuotaScope(vars["scope"]), vars["name"])
+		if err == interfaces.NoSuchQuotaError {
+			writeError(w, r, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+}
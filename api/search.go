@@ -2,9 +2,9 @@ package api
 
 import (
 	"encoding/json"
-	"fmt"
 	"github.com/Sentimentron/repositron/interfaces"
 	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
 	"net/http"
 )
 
@@ -19,79 +19,37 @@ func SearchBlobEndpointFactory(store interfaces.MetadataStore) http.Handler {
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(&qry)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeError(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		// Specify that something must be matched
-		if qry.Name == nil && qry.Checksum == nil && qry.Bucket == nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "name, checksum, bucket, not specified")
+		// Specify that something must be matched, and that it makes sense
+		err = qry.Validate()
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
 			return
 		}
 
-		// This set will contain all matching results
-		matchingSet := make(map[int64]struct{})
-		// Search for matching names
-		if qry.Name != nil {
-			ids, err := store.GetBlobIdsMatchingName(*qry.Name)
-			if err != nil {
-				if err != interfaces.NoMatchingBlobsError {
-					w.WriteHeader(http.StatusInternalServerError)
-					fmt.Fprintf(w, "Error: %v", err)
-					return
-				}
-			} else {
-				for _, v := range ids {
-					matchingSet[v] = struct{}{}
-				}
-			}
-		}
-		// Search for matching buckets
-		if qry.Bucket != nil {
-			ids, err := store.GetBlobIdsMatchingBucket(*qry.Bucket)
-			if err != nil {
-				if err != interfaces.NoMatchingBlobsError {
-					w.WriteHeader(http.StatusInternalServerError)
-					fmt.Fprintf(w, "Error: %v", err)
-					return
-				}
-			} else {
-				for _, v := range ids {
-					matchingSet[v] = struct{}{}
-				}
-			}
-		}
-		// Search for matching checksums
-		if qry.Checksum != nil {
-			ids, err := store.GetBlobIdsMatchingChecksum(*qry.Checksum)
-			if err != nil {
-				if err != interfaces.NoMatchingBlobsError {
-					w.WriteHeader(http.StatusInternalServerError)
-					fmt.Fprintf(w, "Error: %v", err)
-					return
-				}
-			} else {
-				for _, v := range ids {
-					matchingSet[v] = struct{}{}
-				}
-			}
+		// Work out which page of results is being requested
+		page, err := parsePageRequest(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
 		}
 
-		// Format a list of results
-		ret := make([]string, 0)
-		for v := range matchingSet {
-			ret = append(ret, fmt.Sprintf("%d", v))
+		// Run the search inside the store, over the buckets the searcher can read
+		if principal := utils.RequestPrincipal(r); principal != "" {
+			qry.VisibleTo = &principal
+		}
+		blobs, err := store.ListBlobs(&qry, page)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
 		}
 
-		// Encode the list to JSON
-		w.Header().Add("Content-Type", "application/json")
-		encoder := json.NewEncoder(w)
-		err = encoder.Encode(ret)
+		err = writeBlobPage(w, blobs, page)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			logResponseError(r, err)
 			return
 		}
 
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/content"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// errRangeWritten stops content being read once the requested range has been sent.
+var errRangeWritten = errors.New("range written")
+
+// rangeWriter passes on only the bytes of a range.
+type rangeWriter struct {
+	w         http.ResponseWriter
+	skip      int64
+	remaining int64
+}
+
+func (r *rangeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if r.skip >= int64(len(p)) {
+		r.skip -= int64(len(p))
+		return n, nil
+	}
+	p = p[r.skip:]
+	r.skip = 0
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	written, err := r.w.Write(p)
+	r.remaining -= int64(written)
+	if err != nil {
+		return written, err
+	} else if r.remaining == 0 {
+		return n, errRangeWritten
+	}
+	return n, nil
+}
+
+// CreateSignedURLEndpointFactory hands out URLs which download or upload a
+// blob's content without an API token, until they expire. Upload URLs need
+// write permission on the blob's bucket.
+func CreateSignedURLEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, router *mux.Router) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		defer r.Body.Close()
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		var req models.SignedURLRequest
+		decoder := json.NewDecoder(r.Body)
+		err = decoder.Decode(&req)
+		if err == nil {
+			err = req.Validate()
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		blob, err := metadataStore.RetrieveBlobById(id)
+		if err == interfaces.NoMatchingBlobsError {
+			writeError(w, r, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		if req.Method == http.MethodPut {
+			err = checkPermission(metadataStore, utils.RequestPrincipal(r), blob.Bucket, models.PermissionWrite)
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			}
+		}
+		if req.Range != nil && req.Range.Start >= blob.Size {
+			writeError(w, r, http.StatusRequestedRangeNotSatisfiable, fmt.Errorf("the blob is only %d byte(s) long", blob.Size))
+			return
+		}
+
+		scope := req.Scope(time.Now())
+		url, err := contentStore.RetrieveURLForBlobContent(blob, scope, router)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeJSON(w, &models.SignedURL{URL: url, Method: scope.Method, Expires: scope.Expires, Range: scope.Range})
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// SignedContentEndpointFactory serves requests made with signed URLs. Nothing
+// is checked apart from the signature, which covers the blob, the method,
+// the expiry and any byte range. Uploads are handled just like those made
+// with an API token.
+func SignedContentEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, synchronizationStore interfaces.SynchronizationStore, signer *content.URLSigner) http.Handler {
+
+	upload := UploadContentEndpointFactory(metadataStore, contentStore, synchronizationStore)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		scope, err := signer.VerifyRequest(r, time.Now())
+		if err != nil {
+			writeError(w, r, http.StatusForbidden, err)
+			return
+		}
+		if scope.Method == http.MethodPut {
+			upload.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// Blobs in the trash, or still being uploaded, can't be downloaded
+		blob, err := metadataStore.RetrieveBlobById(id)
+		if err == nil && blob.Checksum == "" {
+			err = interfaces.BlobContentNotFoundError
+		}
+		if err == interfaces.NoMatchingBlobsError || err == interfaces.BlobContentNotFoundError {
+			writeError(w, r, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if scope.Range == nil {
+			w.Header().Set("Content-Length", strconv.FormatInt(blob.Size, 10))
+			w.WriteHeader(http.StatusOK)
+			contentStore.RetrieveBlobContent(blob, w)
+			return
+		}
+
+		// The blob may have shrunk since the URL was signed
+		if scope.Range.Start >= blob.Size {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", blob.Size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		byteRange := *scope.Range
+		if byteRange.End >= blob.Size {
+			byteRange.End = blob.Size - 1
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", byteRange.Start, byteRange.End, blob.Size))
+		w.Header().Set("Content-Length", strconv.FormatInt(byteRange.Length(), 10))
+		w.WriteHeader(http.StatusPartialContent)
+		contentStore.RetrieveBlobContent(blob, &rangeWriter{w, byteRange.Start, byteRange.Length()})
+	})
+
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/content"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ReapTrash purges every blob which has been in the trash for longer than
+// gracePeriod, returning how many were purged.
+func ReapTrash(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, gracePeriod time.Duration) (int, error) {
+	expired, err := metadataStore.ListExpiredTrash(time.Now().Add(-gracePeriod))
+	if err != nil {
+		return 0, err
+	}
+
+	audit := content.CreateAuditTrail(metadataStore, models.TrashActor, "")
+	purged := 0
+	for _, b := range expired {
+		err = content.PurgeBlob(metadataStore, contentStore, audit, b)
+		if err != nil {
+			log.Printf("ReapTrash: failed to purge blob %d: %v", b.Id, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// parseTrashedBlob retrieves the trashed blob named in a request's URL.
+func parseTrashedBlob(store interfaces.TrashStore, r *http.Request) (*models.Blob, int, error) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	blob, err := store.RetrieveTrashedBlob(id)
+	if err == interfaces.NoMatchingBlobsError {
+		return nil, http.StatusNotFound, err
+	} else if err != nil {
+		return nil, statusForError(err), err
+	}
+	return blob, http.StatusOK, nil
+}
+
+// ListTrashEndpointFactory lists the blobs in the trash, most recently deleted first.
+func ListTrashEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		trash, err := store.ListTrash()
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		// Only list the blobs the caller could have seen before they were deleted
+		blobs := make([]*models.Blob, 0, len(trash))
+		for _, blob := range trash {
+			readable, err := canRead(store, utils.RequestPrincipal(r), blob.Bucket)
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			} else if readable {
+				blobs = append(blobs, blob)
+			}
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(blobs)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// RestoreBlobEndpointFactory moves a blob out of the trash.
+func RestoreBlobEndpointFactory(store interfaces.MetadataStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		blob, status, err := parseTrashedBlob(store, r)
+		if err != nil {
+			writeError(w, r, status, err)
+			return
+		}
+
+		var restored *models.Blob
+		err = content.RequestAuditTrail(store, r).Change(func(tx *content.AuditedChanges) error {
+			restored, err = tx.RestoreBlobById(blob.Id)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditRestore, blob, restored)
+		})
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeBlob(w, restored, http.StatusOK)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// PurgeBlobEndpointFactory removes a blob in the trash for good, without
+// waiting for the grace period to end.
+func PurgeBlobEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		blob, status, err := parseTrashedBlob(metadataStore, r)
+		if err != nil {
+			writeError(w, r, status, err)
+			return
+		}
+
+		err = content.PurgeBlob(metadataStore, contentStore, content.RequestAuditTrail(metadataStore, r), blob)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+}
@@ -3,16 +3,22 @@ package api
 import (
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/Sentimentron/repositron/content"
 	"github.com/Sentimentron/repositron/interfaces"
 	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
 	"github.com/gorilla/mux"
 	"io"
 	"net/http"
 	"strconv"
 )
 
-func UploadDescriptionEndpointFactory(store interfaces.MetadataStore, router *mux.Router) http.Handler {
+// NoDataError is reported when an append has no content.
+var NoDataError = errors.New("no data provided")
+
+func UploadDescriptionEndpointFactory(store interfaces.MetadataStore, contentStore interfaces.ContentStore, router *mux.Router) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// Parse the upload content
@@ -22,37 +28,65 @@ func UploadDescriptionEndpointFactory(store interfaces.MetadataStore, router *mu
 		decoder := json.NewDecoder(r.Body)
 		err := decoder.Decode(upload)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// Blobs are uploaded by whoever the token belongs to
+		if principal := utils.RequestPrincipal(r); principal != "" {
+			upload.Uploader = principal
+		}
+
+		// Apply the bucket's defaults and restrictions
+		err = applyBucketPolicy(store, upload)
+		if err != nil {
+			writeStoreError(w, r, err)
 			return
 		}
 
 		// Check the upload content
 		err = upload.Validate()
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// Check the uploader can write to the bucket
+		err = checkDestination(store, utils.RequestPrincipal(r), upload.Bucket)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		// Check there's room for the declared size
+		err = checkQuotas(contentStore, upload, upload.Size, 1)
+		if err != nil {
+			writeStoreError(w, r, err)
 			return
 		}
 
 		// Send the upload description to the store
-		blob, err := store.StoreBlobRecord(upload)
+		var blob *models.Blob
+		err = content.RequestAuditTrail(store, r).Change(func(tx *content.AuditedChanges) error {
+			blob, err = tx.StoreBlobRecord(upload)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditCreate, nil, blob)
+		})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 
 		// Generate a redirect for processing the actual upload
 		redirectURL, err := router.Get("ContentUpload").URL("id", fmt.Sprintf("%d", blob.Id))
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 		if len(redirectURL.String()) == 0 {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", "cannot determine upload")
+			writeStoreError(w, r, errors.New("cannot determine upload"))
 			return
 		}
 
@@ -62,8 +96,7 @@ func UploadDescriptionEndpointFactory(store interfaces.MetadataStore, router *mu
 		enc := json.NewEncoder(w)
 		err = enc.Encode(response)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			logResponseError(r, err)
 			return
 		}
 	})
@@ -77,21 +110,18 @@ func AppendContentEndpointFactory(store interfaces.MetadataStore, contentStore i
 		vars := mux.Vars(r)
 		id, err := strconv.ParseInt(vars["id"], 10, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeError(w, r, http.StatusBadRequest, err)
 			return
 		}
 
 		if r.ContentLength == 0 {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Error: No data provided")
+			writeError(w, r, http.StatusBadRequest, NoDataError)
 			return
 		}
 
 		err = synchronizationStore.Lock(id)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 		defer synchronizationStore.Unlock(id)
@@ -99,32 +129,55 @@ func AppendContentEndpointFactory(store interfaces.MetadataStore, contentStore i
 		// Retrieve the blob and lock it
 		blob, err := store.RetrieveBlobById(id)
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 
 		// Write the content to the end of the blob
+		before := *blob
 		expectedSize := blob.Size + r.ContentLength
+		resized := *blob
+		resized.Size = expectedSize
+		err = applyBucketPolicy(store, &resized)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		// Refuse appends which are declared too large, rather than cutting them off
+		if r.ContentLength > 0 {
+			err = checkQuotas(contentStore, blob, r.ContentLength, 0)
+			if err != nil {
+				writeStoreError(w, r, err)
+				return
+			}
+		}
+		// Anything left half-written is rolled back if the append fails
+		intent, err := store.RecordIntent(blob.Id, models.IntentAppend)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		succeeded := false
+		defer func() {
+			content.FinishIntent(store, contentStore, intent, succeeded)
+		}()
+
 		blob, err = contentStore.AppendBlobContent(blob, r.Body)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 		if blob.Size < expectedSize {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: did not write enough (expected %d, got %d)", expectedSize, blob.Size)
+			writeStoreError(w, r, fmt.Errorf("did not write enough (expected %d, got %d)", expectedSize, blob.Size))
 			return
 		}
-		blob.Checksum = "<recalculating>"
+		blob.Checksum = models.RecalculatingChecksum
 
 		// Must commit at this stage, otherwise we may experience corruption
 		// if we fail to update the checksum.
 		blob, err = store.FinalizeBlobRecord(blob)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error (size record stage): %v, bytesWritten=%d", err, blob.Size)
+			writeStoreError(w, r, fmt.Errorf("size record stage: %w, bytesWritten=%d", err, blob.Size))
 			return
 		}
 
@@ -132,38 +185,41 @@ func AppendContentEndpointFactory(store interfaces.MetadataStore, contentStore i
 		h := sha256.New()
 		bytesRead, err := contentStore.RetrieveBlobContent(blob, h)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 		if bytesRead == 0 {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: did not read enough: 0 size")
+			writeStoreError(w, r, fmt.Errorf("did not read enough: 0 size"))
 			return
 		}
 		if bytesRead != blob.Size {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: did not read enough: expected %d, got %d", blob.Size, bytesRead)
+			writeStoreError(w, r, fmt.Errorf("did not read enough: expected %d, got %d", blob.Size, bytesRead))
 			return
 		}
 
 		blob.Checksum = fmt.Sprintf("%x", h.Sum(nil))
 		// Finalize the append
-		blob, err = store.FinalizeBlobRecord(blob)
+		audit := content.RequestAuditTrail(store, r)
+		err = audit.Change(func(tx *content.AuditedChanges) error {
+			blob, err = tx.FinalizeBlobRecord(blob)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditAppend, &before, blob)
+		})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error (checksum stage): %v", err)
+			writeStoreError(w, r, fmt.Errorf("checksum stage: %w", err))
 			return
 		}
+		succeeded = true
+		pruneVersions(store, contentStore, audit, blob)
 
-		// TODO: cleanup these duplicate statuses
-		w.WriteHeader(http.StatusAccepted)
 		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
 		enc := json.NewEncoder(w)
 		err = enc.Encode(blob)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			logResponseError(r, err)
 			return
 		}
 
@@ -171,7 +227,7 @@ func AppendContentEndpointFactory(store interfaces.MetadataStore, contentStore i
 
 }
 
-func UploadContentEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+func UploadContentEndpointFactory(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, synchronizationStore interfaces.SynchronizationStore) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -180,38 +236,82 @@ func UploadContentEndpointFactory(metadataStore interfaces.MetadataStore, conten
 		vars := mux.Vars(r)
 		id, err := strconv.ParseInt(vars["id"], 10, 64)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		err = synchronizationStore.Lock(id)
+		if err != nil {
+			writeStoreError(w, r, err)
 			return
 		}
+		defer synchronizationStore.Unlock(id)
 
 		// Retrieve the blob
 		blob, err := metadataStore.RetrieveBlobById(id)
 		if err != nil {
-			w.WriteHeader(http.StatusNotFound)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
 
+		// Check the bucket allows content of this size
+		before := *blob
+		resized := *blob
+		resized.Size = r.ContentLength
+		err = applyBucketPolicy(metadataStore, &resized)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		// The new content is staged, and only replaces the old content once
+		// the upload has been recorded. Anything left behind is rolled back
+		// if the upload fails.
+		intent, err := metadataStore.RecordIntent(blob.Id, models.IntentUpload)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		succeeded := false
+		defer func() {
+			content.FinishIntent(metadataStore, contentStore, intent, succeeded)
+		}()
+
 		// Create a teereader so we can stream the content out to disk and compute the checksum simulatenously
 		h := sha256.New()
 		tee := io.TeeReader(r.Body, h)
-		blob, err = contentStore.WriteBlobContent(blob, tee)
+		blob, err = content.StageBlobContent(contentStore, blob, tee)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
 		if blob.Size != r.ContentLength {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", "didn't write enough")
+			writeStoreError(w, r, errors.New("didn't write enough"))
 			return
 		}
 		blob.Checksum = fmt.Sprintf("%x", h.Sum(nil))
 		blob.Size = r.ContentLength
 
 		// Finalize the upload
-		_, err = metadataStore.FinalizeBlobRecord(blob)
+		audit := content.RequestAuditTrail(metadataStore, r)
+		err = audit.Change(func(tx *content.AuditedChanges) error {
+			blob, err = tx.FinalizeBlobRecord(blob)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditWrite, &before, blob)
+		})
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+		err = content.CommitStagedContent(contentStore, blob)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintf(w, "Error: %v", err)
+			writeStoreError(w, r, err)
 			return
 		}
+		succeeded = true
+		pruneVersions(metadataStore, contentStore, audit, blob)
 
 		w.WriteHeader(http.StatusAccepted)
 
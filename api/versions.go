@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/content"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// pruneVersions enforces the version limit of a blob's bucket once a new
+// version has been stored. Failures are logged rather than reported, since
+// the new version itself was stored successfully. Pruned versions are
+// recorded in the audit trail of whoever stored the new one, and purged like
+// any other blob, so a purge which fails part-way through is finished off
+// by RecoverIntents.
+func pruneVersions(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, audit *content.AuditTrail, blob *models.Blob) {
+	bucket, err := metadataStore.RetrieveBucket(blob.Bucket)
+	if err != nil {
+		log.Printf("pruneVersions: %v", err)
+		return
+	}
+	if !bucket.Versioning || bucket.MaxVersions == 0 {
+		return
+	}
+
+	prunable, err := metadataStore.ListPrunableBlobVersions(blob.Bucket, blob.Name, bucket.MaxVersions)
+	if err != nil {
+		log.Printf("pruneVersions: %v", err)
+		return
+	}
+	for _, b := range prunable {
+		err = content.PurgeBlob(metadataStore, contentStore, audit, b)
+		if err != nil {
+			log.Printf("pruneVersions: failed to purge blob %d: %v", b.Id, err)
+		}
+	}
+}
+
+// GetLatestBlobEndpointFactory describes the newest blob with a given name in a bucket.
+func GetLatestBlobEndpointFactory(store interfaces.VersionStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		blob, err := store.RetrieveLatestBlob(vars["bucket"], vars["name"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeBlob(w, blob, http.StatusOK)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// GetBlobVersionEndpointFactory describes a specific version of a blob.
+func GetBlobVersionEndpointFactory(store interfaces.VersionStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		version, err := strconv.ParseInt(vars["version"], 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		blob, err := store.RetrieveBlobVersion(vars["bucket"], vars["name"], version)
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		err = writeBlob(w, blob, http.StatusOK)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
+
+// ListBlobVersionsEndpointFactory describes every version of a blob, newest first.
+func ListBlobVersionsEndpointFactory(store interfaces.VersionStore) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		vars := mux.Vars(r)
+		blobs, err := store.ListBlobVersions(vars["bucket"], vars["name"])
+		if err != nil {
+			writeStoreError(w, r, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(blobs)
+		if err != nil {
+			logResponseError(r, err)
+			return
+		}
+	})
+
+}
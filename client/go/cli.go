@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/Sentimentron/repositron/client/go/repoclient"
+	"github.com/Sentimentron/repositron/models"
 	"github.com/urfave/cli"
 	"gopkg.in/AlecAivazis/survey.v1"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var qs = []*survey.Question{
@@ -24,6 +31,154 @@ var qs = []*survey.Question{
 			Default: "http://localhost:8000",
 		},
 	},
+	{
+		Name: "token",
+		Prompt: &survey.Password{
+			Message: "What's your API token?",
+			Help:    "Issued by the server's administrator with -issue-token",
+		},
+	},
+}
+
+// connect opens a connection to the server named in the configuration file.
+func connect(c *cli.Context) (*repoclient.RepositronConnection, error) {
+	config := repoclient.ReadClientConfiguration(c.GlobalString("config"))
+	return repoclient.ConnectWithToken(config.BaseURL, config.Token)
+}
+
+// grantFlags name who a grant is for.
+var grantFlags = []cli.Flag{
+	cli.StringFlag{Name: "user", Usage: "Grant to a user"},
+	cli.StringFlag{Name: "group", Usage: "Grant to a group ('*' is everyone)"},
+}
+
+// changeGrant adds or removes one of a bucket's grants.
+func changeGrant(c *cli.Context, add bool) error {
+	bucket := c.Args().Get(0)
+	grant := &models.Grant{User: c.String("user"), Group: c.String("group"), Permission: models.Permission(c.Args().Get(1))}
+	err := grant.Validate()
+	if err != nil {
+		return err
+	}
+
+	conn, err := connect(c)
+	if err != nil {
+		return err
+	}
+	current, err := conn.ListGrants(bucket)
+	if err != nil {
+		return err
+	}
+
+	grants := make([]*models.Grant, 0, len(current)+1)
+	for _, g := range current {
+		if g.User != grant.User || g.Group != grant.Group || g.Permission != grant.Permission {
+			grants = append(grants, g)
+		}
+	}
+	if add {
+		grants = append(grants, grant)
+	}
+
+	updated, err := conn.SetGrants(bucket, grants)
+	if err != nil {
+		return err
+	}
+	return printJSON(updated)
+}
+
+// printJSON writes a value to stdout as indented JSON.
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// parseMetadataValue interprets a value as JSON if possible, or as a string otherwise.
+func parseMetadataValue(value string) interface{} {
+	var ret interface{}
+	if err := json.Unmarshal([]byte(value), &ret); err != nil {
+		return value
+	}
+	return ret
+}
+
+// buildPatch turns the patch command's flags into a merge patch.
+func buildPatch(c *cli.Context) (models.BlobPatch, error) {
+	patch := models.BlobPatch{}
+	if c.IsSet("name") {
+		patch["name"] = c.String("name")
+	}
+	if c.IsSet("bucket") {
+		patch["bucket"] = c.String("bucket")
+	}
+
+	metadata := make(map[string]interface{})
+	for _, kv := range c.StringSlice("set") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("metadata must be given as key=value, not '%s'", kv)
+		}
+		metadata[parts[0]] = parseMetadataValue(parts[1])
+	}
+	for _, key := range c.StringSlice("unset") {
+		metadata[key] = nil
+	}
+	if len(metadata) > 0 {
+		patch["metadata"] = metadata
+	}
+
+	return patch, nil
+}
+
+// buildAuditQuery turns the audit command's flags into a query.
+func buildAuditQuery(c *cli.Context) (*models.AuditQuery, error) {
+	qry := &models.AuditQuery{After: c.Int64("after"), Limit: c.Int("limit")}
+	if c.IsSet("actor") {
+		actor := c.String("actor")
+		qry.Actor = &actor
+	}
+	if c.IsSet("action") {
+		action := models.AuditAction(c.String("action"))
+		qry.Action = &action
+	}
+	if c.IsSet("bucket") {
+		bucket := c.String("bucket")
+		qry.Bucket = &bucket
+	}
+	if c.IsSet("blob") {
+		blob := c.Int64("blob")
+		qry.Blob = &blob
+	}
+	if c.IsSet("since") {
+		since, err := time.Parse(time.RFC3339, c.String("since"))
+		if err != nil {
+			return nil, err
+		}
+		qry.Since = &since
+	}
+	if c.IsSet("until") {
+		until, err := time.Parse(time.RFC3339, c.String("until"))
+		if err != nil {
+			return nil, err
+		}
+		qry.Until = &until
+	}
+	return qry, qry.Validate()
+}
+
+// eventTypes reads the event types given with --type.
+func eventTypes(c *cli.Context) ([]models.EventType, error) {
+	ret := make([]models.EventType, 0)
+	for _, t := range c.StringSlice("type") {
+		eventType := models.EventType(t)
+		err := eventType.Validate()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, eventType)
+	}
+	return ret, nil
 }
 
 func main() {
@@ -51,18 +206,451 @@ func main() {
 				answers := struct {
 					ConfigPath string `survey:"location"`
 					BaseURL    string `survey:"URL"`
+					Token      string `survey:"token"`
 				}{}
 				err := survey.Ask(qs, &answers)
 				if err != nil {
 					return err
 				}
 
-				config := repoclient.ClientConfiguration{answers.BaseURL, "1"}
+				config := repoclient.ClientConfiguration{BaseURL: answers.BaseURL, ConfigVersion: "1", Token: answers.Token}
 				repoclient.WriteClientConfiguration(&config, answers.ConfigPath)
 				log.Printf("Successfully wrote configuration to %s", answers.ConfigPath)
 				return nil
 			},
 		},
+		{
+			Name:      "patch",
+			Usage:     "Rename, move or edit the metadata of a blob",
+			ArgsUsage: "BLOB_ID",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name", Usage: "Rename the blob"},
+				cli.StringFlag{Name: "bucket", Usage: "Move the blob to another bucket"},
+				cli.StringSliceFlag{Name: "set", Usage: "Set a metadata key (key=value, where value may be JSON)"},
+				cli.StringSliceFlag{Name: "unset", Usage: "Remove a metadata key"},
+			},
+			Action: func(c *cli.Context) error {
+				id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+				if err != nil {
+					return fmt.Errorf("a blob id is required: %v", err)
+				}
+
+				patch, err := buildPatch(c)
+				if err != nil {
+					return err
+				}
+
+				conn, err := connect(c)
+				if err != nil {
+					return err
+				}
+
+				// Only change the blob if nobody else does in the meantime
+				blob, err := conn.QueryById(id)
+				if err != nil {
+					return err
+				}
+				blob, err = conn.Patch(id, patch, blob.ETag())
+				if err != nil {
+					return err
+				}
+
+				return printJSON(blob)
+			},
+		},
+		{
+			Name:      "url",
+			Usage:     "Create a URL which downloads or uploads a blob's content without a token",
+			ArgsUsage: "BLOB_ID",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "upload", Usage: "Allow the content to be replaced, rather than downloaded"},
+				cli.DurationFlag{Name: "expiry", Usage: "How long the URL lasts for", Value: models.DefaultSignedURLExpiry},
+				cli.StringFlag{Name: "range", Usage: "Only allow part of the content to be downloaded (start-end, inclusive)"},
+			},
+			Action: func(c *cli.Context) error {
+				id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+				if err != nil {
+					return fmt.Errorf("a blob id is required: %v", err)
+				}
+
+				req := &models.SignedURLRequest{Method: "GET", Expiry: int64(c.Duration("expiry").Seconds())}
+				if c.Bool("upload") {
+					req.Method = "PUT"
+				}
+				if c.String("range") != "" {
+					req.Range, err = models.ParseByteRange(c.String("range"))
+					if err != nil {
+						return err
+					}
+				}
+
+				conn, err := connect(c)
+				if err != nil {
+					return err
+				}
+				signed, err := conn.SignURL(id, req)
+				if err != nil {
+					return err
+				}
+				return printJSON(signed)
+			},
+		},
+		{
+			Name:  "lifecycle",
+			Usage: "Inspect buckets' lifecycle rules",
+			Subcommands: []cli.Command{
+				{
+					Name:      "preview",
+					Usage:     "List the blobs which lifecycle rules would apply to now",
+					ArgsUsage: "[BUCKET]",
+					Action: func(c *cli.Context) error {
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						matches, err := conn.PreviewLifecycle(c.Args().First())
+						if err != nil {
+							return err
+						}
+						return printJSON(matches)
+					},
+				},
+			},
+		},
+		{
+			Name:  "trash",
+			Usage: "List, restore or purge deleted blobs",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "List the blobs in the trash",
+					Action: func(c *cli.Context) error {
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						trash, err := conn.ListTrash()
+						if err != nil {
+							return err
+						}
+						return printJSON(trash)
+					},
+				},
+				{
+					Name:      "restore",
+					Usage:     "Move a blob out of the trash",
+					ArgsUsage: "BLOB_ID",
+					Action: func(c *cli.Context) error {
+						id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+						if err != nil {
+							return fmt.Errorf("a blob id is required: %v", err)
+						}
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						blob, err := conn.Restore(id)
+						if err != nil {
+							return err
+						}
+						return printJSON(blob)
+					},
+				},
+				{
+					Name:      "purge",
+					Usage:     "Remove a blob in the trash for good",
+					ArgsUsage: "BLOB_ID",
+					Action: func(c *cli.Context) error {
+						id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+						if err != nil {
+							return fmt.Errorf("a blob id is required: %v", err)
+						}
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						return conn.Purge(id)
+					},
+				},
+			},
+		},
+		{
+			Name:  "acl",
+			Usage: "Show or change who can access a bucket",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					Usage:     "List the grants on a bucket",
+					ArgsUsage: "BUCKET",
+					Action: func(c *cli.Context) error {
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						grants, err := conn.ListGrants(c.Args().First())
+						if err != nil {
+							return err
+						}
+						return printJSON(grants)
+					},
+				},
+				{
+					Name:      "grant",
+					Usage:     "Give a user or group a permission (read, write, append, delete or admin) on a bucket",
+					ArgsUsage: "BUCKET PERMISSION",
+					Flags:     grantFlags,
+					Action: func(c *cli.Context) error {
+						return changeGrant(c, true)
+					},
+				},
+				{
+					Name:      "revoke",
+					Usage:     "Take a permission on a bucket away from a user or group",
+					ArgsUsage: "BUCKET PERMISSION",
+					Flags:     grantFlags,
+					Action: func(c *cli.Context) error {
+						return changeGrant(c, false)
+					},
+				},
+			},
+		},
+		{
+			Name:  "quota",
+			Usage: "Show or change how much uploaders and buckets can store",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "List every quota",
+					Action: func(c *cli.Context) error {
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						quotas, err := conn.ListQuotas()
+						if err != nil {
+							return err
+						}
+						return printJSON(quotas)
+					},
+				},
+				{
+					Name:      "show",
+					Usage:     "Show how much an uploader or bucket is storing, and its quota",
+					ArgsUsage: "uploader|bucket NAME",
+					Action: func(c *cli.Context) error {
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						usage, err := conn.RetrieveUsage(models.QuotaScope(c.Args().Get(0)), c.Args().Get(1))
+						if err != nil {
+							return err
+						}
+						return printJSON(usage)
+					},
+				},
+				{
+					Name:      "set",
+					Usage:     "Limit what an uploader or bucket can store ('*' sets the default)",
+					ArgsUsage: "uploader|bucket NAME",
+					Flags: []cli.Flag{
+						cli.Int64Flag{Name: "max-bytes", Usage: "The most content which can be stored, or 0 for no limit"},
+						cli.Int64Flag{Name: "max-blobs", Usage: "The most blobs which can be stored, or 0 for no limit"},
+					},
+					Action: func(c *cli.Context) error {
+						quota := &models.Quota{
+							Scope:    models.QuotaScope(c.Args().Get(0)),
+							Name:     c.Args().Get(1),
+							MaxBytes: c.Int64("max-bytes"),
+							MaxBlobs: c.Int64("max-blobs"),
+						}
+						err := quota.Validate()
+						if err != nil {
+							return err
+						}
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						quota, err = conn.SetQuota(quota)
+						if err != nil {
+							return err
+						}
+						return printJSON(quota)
+					},
+				},
+				{
+					Name:      "remove",
+					Usage:     "Remove the quota on an uploader or bucket",
+					ArgsUsage: "uploader|bucket NAME",
+					Action: func(c *cli.Context) error {
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						return conn.DeleteQuota(models.QuotaScope(c.Args().Get(0)), c.Args().Get(1))
+					},
+				},
+			},
+		},
+		{
+			Name:  "health",
+			Usage: "Show whether the server is alive, or with --ready, whether it's usable",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "ready", Usage: "Also check the content directory and free space"},
+			},
+			Action: func(c *cli.Context) error {
+				conn, err := connect(c)
+				if err != nil {
+					return err
+				}
+				check := conn.CheckHealth
+				if c.Bool("ready") {
+					check = conn.CheckReadiness
+				}
+				report, checkErr := check()
+				if report != nil {
+					err = printJSON(report)
+					if err != nil {
+						return err
+					}
+				}
+				return checkErr
+			},
+		},
+		{
+			Name:  "webhook",
+			Usage: "Show or change where events are sent (administrators only)",
+			Subcommands: []cli.Command{
+				{
+					Name:  "list",
+					Usage: "List every webhook",
+					Action: func(c *cli.Context) error {
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						webhooks, err := conn.ListWebhooks()
+						if err != nil {
+							return err
+						}
+						return printJSON(webhooks)
+					},
+				},
+				{
+					Name:      "create",
+					Usage:     "Send events to a URL, signed with a secret which is only shown now",
+					ArgsUsage: "URL",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{Name: "type", Usage: "Only send this type of event (repeatable)"},
+						cli.StringFlag{Name: "bucket", Usage: "Only send events about blobs in this bucket"},
+						cli.StringFlag{Name: "secret", Usage: "Sign events with this secret, rather than a generated one"},
+					},
+					Action: func(c *cli.Context) error {
+						types, err := eventTypes(c)
+						if err != nil {
+							return err
+						}
+						webhook := &models.Webhook{
+							URL:    c.Args().First(),
+							Secret: c.String("secret"),
+							Events: types,
+							Bucket: c.String("bucket"),
+						}
+						err = webhook.Validate()
+						if err != nil {
+							return err
+						}
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						webhook, err = conn.CreateWebhook(webhook)
+						if err != nil {
+							return err
+						}
+						return printJSON(webhook)
+					},
+				},
+				{
+					Name:      "delete",
+					Usage:     "Stop sending events to a webhook",
+					ArgsUsage: "ID",
+					Action: func(c *cli.Context) error {
+						id, err := strconv.ParseInt(c.Args().First(), 10, 64)
+						if err != nil {
+							return err
+						}
+						conn, err := connect(c)
+						if err != nil {
+							return err
+						}
+						return conn.DeleteWebhook(id)
+					},
+				},
+			},
+		},
+		{
+			Name:  "events",
+			Usage: "Show events about blobs as they happen, as newline-delimited JSON",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{Name: "type", Usage: "Only show this type of event (repeatable)"},
+				cli.StringFlag{Name: "bucket", Usage: "Only show events about blobs in this bucket"},
+				cli.Int64Flag{Name: "after", Usage: "Start after this event, rather than with the next one"},
+			},
+			Action: func(c *cli.Context) error {
+				types, err := eventTypes(c)
+				if err != nil {
+					return err
+				}
+				conn, err := connect(c)
+				if err != nil {
+					return err
+				}
+				sub := &repoclient.EventSubscription{
+					After:  c.Int64("after"),
+					Types:  types,
+					Bucket: c.String("bucket"),
+				}
+				enc := json.NewEncoder(os.Stdout)
+				return conn.SubscribeEvents(context.Background(), sub, func(e *models.Event) error {
+					return enc.Encode(e)
+				})
+			},
+		},
+		{
+			Name:  "audit",
+			Usage: "Show who changed which blobs, oldest first (administrators only)",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "actor", Usage: "Only show changes made by this principal"},
+				cli.StringFlag{Name: "action", Usage: "Only show create, write, append, update, protect, delete, restore or purge"},
+				cli.StringFlag{Name: "bucket", Usage: "Only show changes to blobs in this bucket"},
+				cli.Int64Flag{Name: "blob", Usage: "Only show changes to this blob"},
+				cli.StringFlag{Name: "since", Usage: "Only show changes made at or after this time (RFC 3339)"},
+				cli.StringFlag{Name: "until", Usage: "Only show changes made before this time (RFC 3339)"},
+				cli.Int64Flag{Name: "after", Usage: "Skip changes up to and including this entry, to show the next page"},
+				cli.IntFlag{Name: "limit", Usage: "The most changes to show"},
+				cli.BoolFlag{Name: "export", Usage: "Show every matching change as newline-delimited JSON"},
+			},
+			Action: func(c *cli.Context) error {
+				qry, err := buildAuditQuery(c)
+				if err != nil {
+					return err
+				}
+				conn, err := connect(c)
+				if err != nil {
+					return err
+				}
+				if c.Bool("export") {
+					return conn.ExportAuditEntries(qry, os.Stdout)
+				}
+				page, err := conn.ListAuditEntries(qry)
+				if err != nil {
+					return err
+				}
+				return printJSON(page)
+			},
+		},
 	}
 
 	err := app.Run(os.Args)
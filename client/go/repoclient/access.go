@@ -0,0 +1,57 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+	"net/url"
+)
+
+// ListGrants returns the grants on a bucket.
+func (c *RepositronConnection) ListGrants(bucket string) ([]*models.Grant, error) {
+	ret := make([]*models.Grant, 0)
+	err := c.sendBucketRequest("GET", bucketURL(bucket)+"/acl", nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// SetGrants replaces the grants on a bucket.
+func (c *RepositronConnection) SetGrants(bucket string, grants []*models.Grant) ([]*models.Grant, error) {
+	ret := make([]*models.Grant, 0)
+	err := c.sendBucketRequest("PUT", bucketURL(bucket)+"/acl", grants, http.StatusOK, &ret)
+	return ret, err
+}
+
+// ListDefaultGrants returns the grants which new buckets start with.
+func (c *RepositronConnection) ListDefaultGrants() ([]*models.Grant, error) {
+	ret := make([]*models.Grant, 0)
+	err := c.sendBucketRequest("GET", "v1/acl/default", nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// SetDefaultGrants replaces the grants which new buckets start with.
+func (c *RepositronConnection) SetDefaultGrants(grants []*models.Grant) ([]*models.Grant, error) {
+	ret := make([]*models.Grant, 0)
+	err := c.sendBucketRequest("PUT", "v1/acl/default", grants, http.StatusOK, &ret)
+	return ret, err
+}
+
+func groupMemberURL(group, member string) string {
+	return fmt.Sprintf("v1/groups/%s/members/%s", url.PathEscape(group), url.PathEscape(member))
+}
+
+// ListGroupMembers returns the members of a group.
+func (c *RepositronConnection) ListGroupMembers(group string) ([]string, error) {
+	ret := make([]string, 0)
+	err := c.sendBucketRequest("GET", "v1/groups/"+url.PathEscape(group), nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// AddGroupMember adds a principal to a group.
+func (c *RepositronConnection) AddGroupMember(group, member string) error {
+	return c.sendBucketRequest("PUT", groupMemberURL(group, member), nil, http.StatusAccepted, nil)
+}
+
+// RemoveGroupMember removes a principal from a group.
+func (c *RepositronConnection) RemoveGroupMember(group, member string) error {
+	return c.sendBucketRequest("DELETE", groupMemberURL(group, member), nil, http.StatusAccepted, nil)
+}
@@ -0,0 +1,84 @@
+package repoclient
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"testing"
+	"time"
+)
+
+// globalTestOtherToken is an API token for a second principal, which the
+// tests don't grant anything to up front.
+var globalTestOtherToken = os.Getenv("REPOSITRON_TEST_OTHER_TOKEN")
+
+func TestRepositronConnection_Grants(t *testing.T) {
+	if globalTestOtherToken == "" {
+		t.Skip("no token for a second principal")
+	}
+	Convey("Given a bucket which another principal can't access...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		other, err := ConnectWithToken(globalTestURL, globalTestOtherToken)
+		So(err, ShouldBeNil)
+
+		name := fmt.Sprintf("__testing_acl_%d", time.Now().UnixNano())
+		_, err = c.CreateBucket(name, models.BucketSettings{})
+		So(err, ShouldBeNil)
+		defer c.DeleteBucket(name)
+
+		grants, err := c.ListGrants(name)
+		So(err, ShouldBeNil)
+		So(len(grants), ShouldBeGreaterThan, 0)
+
+		Convey("The other principal shouldn't be able to see it...", func() {
+			_, err := other.DescribeBucket(name)
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+			_, err = other.ListGrants(name)
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+
+			all, err := other.ListBuckets()
+			So(err, ShouldBeNil)
+			for _, b := range all {
+				So(b.Name, ShouldNotEqual, name)
+			}
+		})
+
+		Convey("The other principal shouldn't be able to change the default grants...", func() {
+			_, err := other.SetDefaultGrants([]*models.Grant{})
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+		})
+
+		Convey("Should be able to give the other principal read access...", func() {
+			grants = append(grants, &models.Grant{Group: models.EveryoneGroup, Permission: models.PermissionRead})
+			updated, err := c.SetGrants(name, grants)
+			So(err, ShouldBeNil)
+			So(len(updated), ShouldEqual, len(grants))
+
+			described, err := other.DescribeBucket(name)
+			So(err, ShouldBeNil)
+			So(described.Name, ShouldEqual, name)
+
+			_, err = other.ConfigureBucket(name, models.BucketSettings{})
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+			err = other.DeleteBucket(name)
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+		})
+
+		Convey("The other principal shouldn't be able to claim a bucket before it's created...", func() {
+			unclaimed := name + "_unclaimed"
+			_, err := other.SetGrants(unclaimed, []*models.Grant{{User: "__other", Permission: models.PermissionAdmin}})
+			So(errors.Is(err, NotFoundError), ShouldBeTrue)
+			_, err = other.ListGrants(unclaimed)
+			So(errors.Is(err, NotFoundError), ShouldBeTrue)
+		})
+
+		Convey("Should not be able to set invalid grants...", func() {
+			_, err := c.SetGrants(name, []*models.Grant{{Permission: models.PermissionRead}})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,87 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"io"
+	"net/http"
+)
+
+func aliasURL(name string) string {
+	return fmt.Sprintf("v1/aliases/%s", name)
+}
+
+// ListAliases returns every alias, ordered by name.
+func (c *RepositronConnection) ListAliases() ([]*models.Alias, error) {
+	ret := make([]*models.Alias, 0)
+	err := c.sendBucketRequest("GET", "v1/aliases", nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// CreateAlias points a new alias at a blob, failing if the alias already exists.
+func (c *RepositronConnection) CreateAlias(name string, blobId int64) (*models.Alias, error) {
+	var ret models.Alias
+	alias := models.Alias{Name: name, BlobId: blobId}
+	err := c.sendBucketRequest("POST", "v1/aliases", &alias, http.StatusCreated, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// SetAlias points an alias at a blob, whatever it pointed at before.
+func (c *RepositronConnection) SetAlias(name string, blobId int64) (*models.Alias, error) {
+	return c.updateAlias(name, models.AliasUpdate{BlobId: blobId})
+}
+
+// SwapAlias points an alias at a blob, provided it still points at expected.
+func (c *RepositronConnection) SwapAlias(name string, blobId, expected int64) (*models.Alias, error) {
+	return c.updateAlias(name, models.AliasUpdate{BlobId: blobId, Expected: &expected})
+}
+
+func (c *RepositronConnection) updateAlias(name string, update models.AliasUpdate) (*models.Alias, error) {
+	var ret models.Alias
+	err := c.sendBucketRequest("PUT", aliasURL(name), &update, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ResolveAlias returns the blob an alias points at.
+func (c *RepositronConnection) ResolveAlias(name string) (*models.Alias, error) {
+	var ret models.Alias
+	err := c.sendBucketRequest("GET", aliasURL(name), nil, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// AliasHistory returns every change made to an alias, newest first.
+func (c *RepositronConnection) AliasHistory(name string) ([]*models.AliasChange, error) {
+	ret := make([]*models.AliasChange, 0)
+	err := c.sendBucketRequest("GET", aliasURL(name)+"/history", nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// DeleteAlias removes an alias and its history.
+func (c *RepositronConnection) DeleteAlias(name string) error {
+	return c.sendBucketRequest("DELETE", aliasURL(name), nil, http.StatusAccepted, nil)
+}
+
+// DownloadAlias writes the content of the blob an alias points at.
+func (c *RepositronConnection) DownloadAlias(name string, w io.Writer) (int64, error) {
+	resp, err := c.httpClient().Get(c.GetURL(fmt.Sprintf("v1/blobs/byId/%s/content", name)))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp, http.StatusOK)
+	if err != nil {
+		return 0, err
+	}
+
+	return io.Copy(w, resp.Body)
+}
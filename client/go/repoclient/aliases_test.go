@@ -0,0 +1,89 @@
+package repoclient
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Aliases(t *testing.T) {
+	Convey("Should be able to alias blobs...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		upload := func(content string) *models.Blob {
+			info := models.Blob{
+				Bucket:   "__testing",
+				Date:     time.Now(),
+				Class:    "temp",
+				Uploader: "__tester",
+				Metadata: models.MetadataMap{"key": "value"},
+				Size:     int64(len(content)),
+				Name:     "__test_alias_file",
+			}
+			uploaded, err := c.Upload(&info, strings.NewReader(content), false)
+			So(err, ShouldBeNil)
+			return uploaded
+		}
+
+		first := upload("first")
+		second := upload("second")
+		defer c.Delete(first.Id)
+		defer c.Delete(second.Id)
+
+		name := fmt.Sprintf("__testing/%d/stable", time.Now().UnixNano())
+		_, err = c.CreateAlias(name, first.Id)
+		So(err, ShouldBeNil)
+		defer c.DeleteAlias(name)
+
+		Convey("Should not be able to create it twice...", func() {
+			_, err := c.CreateAlias(name, second.Id)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should be able to download through it...", func() {
+			var buf bytes.Buffer
+			_, err := c.DownloadAlias(name, &buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "first")
+		})
+
+		Convey("Should be able to swap it...", func() {
+			_, err := c.SwapAlias(name, second.Id, first.Id)
+			So(err, ShouldBeNil)
+
+			_, err = c.SwapAlias(name, first.Id, first.Id)
+			So(err, ShouldNotBeNil)
+
+			resolved, err := c.ResolveAlias(name)
+			So(err, ShouldBeNil)
+			So(resolved.BlobId, ShouldEqual, second.Id)
+
+			var buf bytes.Buffer
+			_, err = c.DownloadAlias(name, &buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "second")
+
+			history, err := c.AliasHistory(name)
+			So(err, ShouldBeNil)
+			So(len(history), ShouldEqual, 2)
+			So(history[0].BlobId, ShouldEqual, second.Id)
+		})
+
+		Convey("Should be able to list it...", func() {
+			aliases, err := c.ListAliases()
+			So(err, ShouldBeNil)
+			names := make([]string, 0)
+			for _, a := range aliases {
+				names = append(names, a.Name)
+			}
+			So(name, ShouldBeIn, names)
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package repoclient
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/models"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// auditQueryString encodes an audit query's filters for the URL.
+func auditQueryString(qry *models.AuditQuery) string {
+	values := url.Values{}
+	if qry.Actor != nil {
+		values.Set("actor", *qry.Actor)
+	}
+	if qry.Action != nil {
+		values.Set("action", string(*qry.Action))
+	}
+	if qry.Bucket != nil {
+		values.Set("bucket", *qry.Bucket)
+	}
+	if qry.Blob != nil {
+		values.Set("blob", strconv.FormatInt(*qry.Blob, 10))
+	}
+	if qry.Since != nil {
+		values.Set("since", qry.Since.Format(time.RFC3339))
+	}
+	if qry.Until != nil {
+		values.Set("until", qry.Until.Format(time.RFC3339))
+	}
+	if qry.After != 0 {
+		values.Set("after", strconv.FormatInt(qry.After, 10))
+	}
+	if qry.Limit != 0 {
+		values.Set("limit", strconv.Itoa(qry.Limit))
+	}
+	return values.Encode()
+}
+
+// ListAuditEntries returns a page of the audit log, oldest first. Pass the
+// page's After back in the query to retrieve the next one.
+func (c *RepositronConnection) ListAuditEntries(qry *models.AuditQuery) (*models.AuditPage, error) {
+	var ret models.AuditPage
+	err := c.sendBucketRequest("GET", "v1/audit?"+auditQueryString(qry), nil, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// exportAuditEntries starts streaming the audit entries matching a query.
+func (c *RepositronConnection) exportAuditEntries(qry *models.AuditQuery) (io.ReadCloser, error) {
+	response, err := c.httpClient().Get(c.GetURL("v1/audit/export?" + auditQueryString(qry)))
+	if err != nil {
+		return nil, err
+	}
+
+	// Check for errors
+	err = checkResponse(response, http.StatusOK)
+	if err != nil {
+		response.Body.Close()
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+// ExportAuditEntries writes every audit entry matching a query to w, as
+// newline-delimited JSON. The query's After and Limit are ignored.
+func (c *RepositronConnection) ExportAuditEntries(qry *models.AuditQuery, w io.Writer) error {
+	body, err := c.exportAuditEntries(qry)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	_, err = io.Copy(w, body)
+	return err
+}
+
+// ForEachAuditEntry calls fn with every audit entry matching a query, oldest
+// first, using a single request.
+func (c *RepositronConnection) ForEachAuditEntry(qry *models.AuditQuery, fn func(*models.AuditEntry) error) error {
+	body, err := c.exportAuditEntries(qry)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	for {
+		var entry models.AuditEntry
+		err = dec.Decode(&entry)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		err = fn(&entry)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package repoclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Audit(t *testing.T) {
+	if globalTestAdminToken == "" {
+		t.Skip("no token for an administrator")
+	}
+	Convey("Given a blob which has been changed and deleted...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		admin, err := ConnectWithToken(globalTestURL, globalTestAdminToken)
+		So(err, ShouldBeNil)
+
+		info := models.Blob{
+			Bucket:   fmt.Sprintf("__testing_audit_%d", time.Now().UnixNano()),
+			Date:     time.Now(),
+			Class:    models.TemporaryBlob,
+			Metadata: models.MetadataMap{},
+			Size:     int64(len("audited")),
+			Name:     "__test_audit_file",
+		}
+		blob, err := c.Upload(&info, strings.NewReader("audited"), false)
+		So(err, ShouldBeNil)
+		_, err = c.Patch(blob.Id, models.BlobPatch{"metadata": map[string]interface{}{"audited": true}}, "")
+		So(err, ShouldBeNil)
+		err = c.Delete(blob.Id)
+		So(err, ShouldBeNil)
+
+		qry := &models.AuditQuery{Blob: &blob.Id}
+
+		Convey("Should record who did what...", func() {
+			page, err := admin.ListAuditEntries(qry)
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 4)
+
+			actions := make([]models.AuditAction, 0)
+			for _, entry := range page.Entries {
+				actions = append(actions, entry.Action)
+				So(entry.Actor, ShouldEqual, "__tester")
+				So(entry.Bucket, ShouldEqual, info.Bucket)
+				So(entry.Address, ShouldNotBeEmpty)
+			}
+			So(actions, ShouldResemble, []models.AuditAction{
+				models.AuditCreate, models.AuditWrite, models.AuditUpdate, models.AuditDelete,
+			})
+
+			write := page.Entries[1]
+			// Nothing had been uploaded before the write
+			So(*write.OldChecksum, ShouldBeEmpty)
+			So(*write.NewSize, ShouldEqual, len("audited"))
+			So(*write.NewChecksum, ShouldEqual, fmt.Sprintf("%x", sha256.Sum256([]byte("audited"))))
+			So(page.Entries[3].NewChecksum, ShouldBeNil)
+		})
+
+		Convey("Should page through the log...", func() {
+			page, err := admin.ListAuditEntries(&models.AuditQuery{Blob: &blob.Id, Limit: 3})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 3)
+			So(page.After, ShouldNotEqual, 0)
+
+			page, err = admin.ListAuditEntries(&models.AuditQuery{Blob: &blob.Id, Limit: 3, After: page.After})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 1)
+			So(page.Entries[0].Action, ShouldEqual, models.AuditDelete)
+		})
+
+		Convey("Should export the log as newline-delimited JSON...", func() {
+			var buf bytes.Buffer
+			err := admin.ExportAuditEntries(qry, &buf)
+			So(err, ShouldBeNil)
+			So(strings.Count(buf.String(), "\n"), ShouldEqual, 4)
+
+			count := 0
+			err = admin.ForEachAuditEntry(qry, func(entry *models.AuditEntry) error {
+				So(entry.Blob, ShouldEqual, blob.Id)
+				count++
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 4)
+		})
+
+		Convey("Should only let administrators read the log...", func() {
+			_, err := c.ListAuditEntries(qry)
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+			err = c.ExportAuditEntries(qry, &bytes.Buffer{})
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+		})
+	})
+}
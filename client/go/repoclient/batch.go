@@ -0,0 +1,26 @@
+package repoclient
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+)
+
+// Batch runs a list of delete, patch, copy and move operations in order,
+// returning the outcome of each. If atomic is set, either every operation
+// succeeds or none of them are applied; only delete, patch and move
+// operations can be run atomically.
+func (c *RepositronConnection) Batch(operations []models.BatchOperation, atomic bool) ([]models.BatchResult, error) {
+	var ret models.BatchResponse
+	batch := models.BatchRequest{Atomic: atomic, Operations: operations}
+	err := c.sendBucketRequest("POST", "v1/batch", &batch, http.StatusOK, &ret)
+	return ret.Results, err
+}
+
+// DeleteAll moves several blobs into the trash, returning the outcome for each.
+func (c *RepositronConnection) DeleteAll(blobIds []int64) ([]models.BatchResult, error) {
+	operations := make([]models.BatchOperation, 0, len(blobIds))
+	for _, id := range blobIds {
+		operations = append(operations, models.BatchOperation{Op: models.BatchDelete, Id: id})
+	}
+	return c.Batch(operations, false)
+}
@@ -0,0 +1,75 @@
+package repoclient
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Batch(t *testing.T) {
+	Convey("Given some uploaded blobs...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		ids := make([]int64, 0)
+		for _, name := range []string{"__test_batch_1", "__test_batch_2"} {
+			fixedContent := "batch content"
+			info := models.Blob{
+				Bucket:   "__testing",
+				Date:     time.Now(),
+				Class:    "temp",
+				Uploader: "__tester",
+				Metadata: models.MetadataMap{"key": "value"},
+				Size:     int64(len(fixedContent)),
+				Name:     name,
+			}
+			uploaded, err := c.Upload(&info, strings.NewReader(fixedContent), false)
+			So(err, ShouldBeNil)
+			ids = append(ids, uploaded.Id)
+		}
+
+		Convey("Should be able to run several operations...", func() {
+			results, err := c.Batch([]models.BatchOperation{
+				{Op: models.BatchPatch, Id: ids[0], Patch: models.BlobPatch{"metadata": map[string]interface{}{"batch": true}}},
+				{Op: models.BatchCopy, Id: ids[1], Destination: &models.BlobDestination{Bucket: "__testing_batch"}},
+				{Op: models.BatchDelete, Id: -1},
+			}, false)
+			So(err, ShouldBeNil)
+			So(len(results), ShouldEqual, 3)
+			So(results[0].Status, ShouldEqual, http.StatusOK)
+			So(results[0].Blob.Metadata["batch"], ShouldEqual, true)
+			So(results[1].Status, ShouldEqual, http.StatusCreated)
+			So(results[1].Blob.Bucket, ShouldEqual, "__testing_batch")
+			So(results[2].Status, ShouldEqual, http.StatusNotFound)
+
+			ids = append(ids, results[1].Blob.Id)
+		})
+
+		Convey("Atomic batches should fail together...", func() {
+			results, err := c.Batch([]models.BatchOperation{
+				{Op: models.BatchMove, Id: ids[0], Destination: &models.BlobDestination{Bucket: "__testing_batch"}},
+				{Op: models.BatchDelete, Id: ids[1], IfMatch: `"12345"`},
+			}, true)
+			So(err, ShouldBeNil)
+			So(results[0].Status, ShouldEqual, http.StatusFailedDependency)
+			So(results[1].Status, ShouldEqual, http.StatusPreconditionFailed)
+
+			blob, err := c.QueryById(ids[0])
+			So(err, ShouldBeNil)
+			So(blob.Bucket, ShouldEqual, "__testing")
+		})
+
+		Reset(func() {
+			results, err := c.DeleteAll(ids)
+			So(err, ShouldBeNil)
+			for _, r := range results {
+				So(r.Status, ShouldEqual, http.StatusAccepted)
+			}
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package repoclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+	"net/url"
+)
+
+func (c *RepositronConnection) sendBucketRequest(method, sub string, body interface{}, expectedStatus int, out interface{}) error {
+	client := c.httpClient()
+
+	// Form the request body
+	var buf bytes.Buffer
+	if body != nil {
+		enc := json.NewEncoder(&buf)
+		err := enc.Encode(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.GetURL(sub), &buf)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Check for errors
+	err = checkResponse(resp, expectedStatus)
+	if err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+	dec := json.NewDecoder(resp.Body)
+	return dec.Decode(out)
+}
+
+func bucketURL(name string) string {
+	return fmt.Sprintf("v1/buckets/%s", url.PathEscape(name))
+}
+
+// ListBuckets describes every bucket.
+func (c *RepositronConnection) ListBuckets() ([]*models.BucketDescription, error) {
+	ret := make([]*models.BucketDescription, 0)
+	err := c.sendBucketRequest("GET", "v1/buckets", nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// CreateBucket creates a new, empty bucket with the given settings.
+func (c *RepositronConnection) CreateBucket(name string, settings models.BucketSettings) (*models.Bucket, error) {
+	var ret models.Bucket
+	bucket := models.Bucket{Name: name, BucketSettings: settings}
+	err := c.sendBucketRequest("POST", "v1/buckets", &bucket, http.StatusCreated, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DescribeBucket returns a bucket's settings, blob count, total size and last upload.
+func (c *RepositronConnection) DescribeBucket(name string) (*models.BucketDescription, error) {
+	var ret models.BucketDescription
+	err := c.sendBucketRequest("GET", bucketURL(name), nil, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ConfigureBucket replaces a bucket's settings.
+func (c *RepositronConnection) ConfigureBucket(name string, settings models.BucketSettings) (*models.Bucket, error) {
+	var ret models.Bucket
+	err := c.sendBucketRequest("PUT", bucketURL(name), &settings, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DeleteBucket removes an empty bucket.
+func (c *RepositronConnection) DeleteBucket(name string) error {
+	return c.sendBucketRequest("DELETE", bucketURL(name), nil, http.StatusAccepted, nil)
+}
@@ -0,0 +1,89 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Buckets(t *testing.T) {
+	Convey("Should be able to manage buckets...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		name := fmt.Sprintf("__testing_bucket_%d", time.Now().UnixNano())
+		settings := models.BucketSettings{
+			DefaultClass: models.TemporaryBlob,
+			MaxBlobSize:  16,
+		}
+
+		Convey("Should be able to create a bucket...", func() {
+			created, err := c.CreateBucket(name, settings)
+			So(err, ShouldBeNil)
+			So(created.Name, ShouldEqual, name)
+			So(created.MaxBlobSize, ShouldEqual, 16)
+
+			_, err = c.CreateBucket(name, settings)
+			So(err, ShouldNotBeNil)
+
+			Convey("Should be able to list it...", func() {
+				all, err := c.ListBuckets()
+				So(err, ShouldBeNil)
+				names := make([]string, 0)
+				for _, b := range all {
+					names = append(names, b.Name)
+				}
+				So(name, ShouldBeIn, names)
+			})
+
+			Convey("Should not be able to upload more than the maximum size...", func() {
+				fixedContent := "this content is longer than sixteen bytes"
+				info := models.Blob{
+					Bucket:   name,
+					Date:     time.Now(),
+					Uploader: "__tester",
+					Metadata: models.MetadataMap{"key": "value"},
+					Size:     int64(len(fixedContent)),
+					Name:     "__test_upload_file",
+				}
+				_, err := c.Upload(&info, strings.NewReader(fixedContent), false)
+				So(err, ShouldNotBeNil)
+
+				Convey("But should be able to upload smaller content with the default type...", func() {
+					fixedContent = "short"
+					info.Size = int64(len(fixedContent))
+					uploaded, err := c.Upload(&info, strings.NewReader(fixedContent), false)
+					So(err, ShouldBeNil)
+					So(uploaded.Class, ShouldEqual, models.TemporaryBlob)
+
+					description, err := c.DescribeBucket(name)
+					So(err, ShouldBeNil)
+					So(description.BlobCount, ShouldEqual, 1)
+					So(description.TotalSize, ShouldEqual, len(fixedContent))
+
+					err = c.DeleteBucket(name)
+					So(err, ShouldNotBeNil)
+				})
+			})
+
+			Convey("Should be able to reconfigure it...", func() {
+				settings.MaxBlobSize = 0
+				updated, err := c.ConfigureBucket(name, settings)
+				So(err, ShouldBeNil)
+				So(updated.MaxBlobSize, ShouldEqual, 0)
+			})
+
+			Convey("Should be able to delete it while empty...", func() {
+				err := c.DeleteBucket(name)
+				So(err, ShouldBeNil)
+				_, err = c.DescribeBucket(name)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
@@ -12,6 +12,7 @@ import (
 type ClientConfiguration struct {
 	BaseURL       string `json:"baseURL"`
 	ConfigVersion string `json:"configVersion"`
+	Token         string `json:"token,omitempty"`
 }
 
 func BuildDefaultClientConfigurationPath() string {
@@ -64,7 +65,8 @@ func ReadClientConfiguration(path string) *ClientConfiguration {
 
 func WriteClientConfiguration(c *ClientConfiguration, path string) {
 
-	f, err := os.Create(path)
+	// The configuration holds an API token, so keep it private
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		log.Printf("client error: could not create configuration at %s", path)
 		log.Fatal(err)
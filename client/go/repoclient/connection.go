@@ -12,9 +12,33 @@ import (
 const SupportedAPIVersion = "1"
 
 var UnsupportedAPIVersionError = errors.New("unsupported api verson")
+var UnauthorizedError = errors.New("the server needs a valid api token")
+var ForbiddenError = errors.New("the api token isn't allowed to do that")
 
 type RepositronConnection struct {
 	BaseURL string
+	// Token is sent with every request, if it's set.
+	Token string
+}
+
+// tokenTransport adds an API token to each request.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(r)
+}
+
+// httpClient returns a client which authenticates with the connection's token.
+func (c *RepositronConnection) httpClient() *http.Client {
+	if c.Token == "" {
+		return &http.Client{}
+	}
+	return &http.Client{Transport: &tokenTransport{c.Token, http.DefaultTransport}}
 }
 
 func (c *RepositronConnection) GetURL(sub string) string {
@@ -25,17 +49,26 @@ func (c *RepositronConnection) GetRawURL(sub string) string {
 }
 
 func Connect(baseURL string) (*RepositronConnection, error) {
+	return ConnectWithToken(baseURL, "")
+}
+
+// ConnectWithToken connects to a server which requires an API token.
+func ConnectWithToken(baseURL, token string) (*RepositronConnection, error) {
 
 	var desc models.APIDescription
 
-	ret := &RepositronConnection{baseURL}
+	ret := &RepositronConnection{BaseURL: baseURL, Token: token}
 
 	// Request the information
-	resp, err := http.Get(ret.GetURL("v1/info"))
+	resp, err := ret.httpClient().Get(ret.GetURL("v1/info"))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	err = checkResponse(resp, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
 
 	// Decode the description
 	dec := json.NewDecoder(resp.Body)
@@ -1,18 +1,38 @@
 package repoclient
 
 import (
+	"errors"
 	. "github.com/smartystreets/goconvey/convey"
+	"os"
 	"testing"
 )
 
 const globalTestURL = "http://localhost:8000"
 
+// globalTestToken is the API token for the test server, if it requires one.
+var globalTestToken = os.Getenv("REPOSITRON_TEST_TOKEN")
+
 func TestConnect(t *testing.T) {
 	Convey("Should be able to connect...", t, func() {
 
-		_, err := Connect(globalTestURL)
+		_, err := ConnectWithToken(globalTestURL, globalTestToken)
 		So(err, ShouldBeNil)
 
 	})
 
 }
+
+func TestConnectWithBadToken(t *testing.T) {
+	if globalTestToken == "" {
+		t.Skip("the test server doesn't require a token")
+	}
+	Convey("Should not be able to connect with a bad token...", t, func() {
+
+		_, err := ConnectWithToken(globalTestURL, "not"+globalTestToken)
+		So(errors.Is(err, UnauthorizedError), ShouldBeTrue)
+
+		_, err = Connect(globalTestURL)
+		So(errors.Is(err, UnauthorizedError), ShouldBeTrue)
+
+	})
+}
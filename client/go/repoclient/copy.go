@@ -0,0 +1,19 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+)
+
+// Copy creates a new blob in another bucket with the same content as b,
+// without downloading it. If name is empty, the copy keeps b's name.
+func (c *RepositronConnection) Copy(b *models.Blob, bucket, name string) (*models.Blob, error) {
+	var ret models.Blob
+	dest := models.BlobDestination{Bucket: bucket, Name: name}
+	err := c.sendBucketRequest("POST", fmt.Sprintf("v1/blobs/byId/%d/copy", b.Id), &dest, http.StatusCreated, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
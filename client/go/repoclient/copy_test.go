@@ -0,0 +1,68 @@
+package repoclient
+
+import (
+	"bytes"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Copy(t *testing.T) {
+	Convey("Should be able to copy...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		fixedContent := "<html><body>hi</body></html>"
+		content := strings.NewReader(fixedContent)
+		info := models.Blob{
+			Bucket:   "__testing_staging",
+			Date:     time.Now(),
+			Class:    "temp",
+			Uploader: "__tester",
+			Metadata: models.MetadataMap{"key": "value"},
+			Size:     int64(len(fixedContent)),
+			Name:     "__test_copy_file",
+		}
+
+		uploaded, err := c.Upload(&info, content, false)
+		So(err, ShouldBeNil)
+		defer c.Delete(uploaded.Id)
+		original, err := c.QueryById(uploaded.Id)
+		So(err, ShouldBeNil)
+
+		Convey("Should be able to copy it into another bucket...", func() {
+			copied, err := c.Copy(original, "__testing_release", "")
+			So(err, ShouldBeNil)
+			defer c.Delete(copied.Id)
+			So(copied.Id, ShouldNotEqual, original.Id)
+			So(copied.Bucket, ShouldEqual, "__testing_release")
+			So(copied.Name, ShouldEqual, original.Name)
+			So(copied.Checksum, ShouldEqual, original.Checksum)
+			So(copied.Size, ShouldEqual, original.Size)
+			So(copied.Metadata, ShouldResemble, original.Metadata)
+
+			Convey("Which should have the same content...", func() {
+				var buf bytes.Buffer
+				err := c.Download(copied, &buf, false)
+				So(err, ShouldBeNil)
+				So(buf.String(), ShouldEqual, fixedContent)
+			})
+		})
+
+		Convey("Should be able to copy it under a new name...", func() {
+			copied, err := c.Copy(original, "__testing_staging", "__test_copied_file")
+			So(err, ShouldBeNil)
+			defer c.Delete(copied.Id)
+			So(copied.Name, ShouldEqual, "__test_copied_file")
+		})
+
+		Convey("Should not be able to copy it without a bucket...", func() {
+			_, err := c.Copy(original, "", "")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -7,7 +7,7 @@ import (
 
 func (c *RepositronConnection) Delete(blobId int64) error {
 
-	client := &http.Client{}
+	client := c.httpClient()
 
 	contentUrl := c.GetURL(fmt.Sprintf("v1/blobs/byId/%d", blobId))
 
@@ -18,10 +18,6 @@ func (c *RepositronConnection) Delete(blobId int64) error {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("Bad status code: expected %d, got %d", 202, resp.StatusCode)
-	}
-
-	return nil
+	return checkResponse(resp, http.StatusAccepted)
 
 }
@@ -12,7 +12,7 @@ import (
 func TestRepositronConnection_Delete(t *testing.T) {
 	Convey("Should be able to delete...", t, func() {
 
-		c, err := Connect(globalTestURL)
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
 		So(err, ShouldBeNil)
 		So(c, ShouldNotBeNil)
 
@@ -55,11 +55,15 @@ func (c *RepositronConnection) Download(b *models.Blob, w io.Writer, verbose boo
 	if verbose {
 		log.Printf("Downloading from: %s", contentUrl)
 	}
-	resp, err := http.Get(contentUrl)
+	resp, err := c.httpClient().Get(contentUrl)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	err = checkResponse(resp, http.StatusOK)
+	if err != nil {
+		return err
+	}
 
 	// Create a teewriter so we can verify the checksum
 	h := sha256.New()
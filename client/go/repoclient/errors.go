@@ -0,0 +1,84 @@
+package repoclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var BadRequestError = errors.New("the server rejected the request as invalid")
+var NotFoundError = errors.New("the server couldn't find that")
+var ConflictError = errors.New("the request conflicts with what's on the server")
+var TooLargeError = errors.New("the blob is too large for its bucket")
+var QuotaExceededError = errors.New("the request would go over a quota")
+var TooManyRequestsError = errors.New("the server is rate limiting this client")
+var ServerError = errors.New("the server couldn't handle the request")
+
+// Error is an error response from the server. Use errors.Is with one of the
+// errors above, e.g. NotFoundError, to check what kind of error it is.
+type Error struct {
+	StatusCode int
+	models.APIError
+}
+
+func (e *Error) Error() string {
+	ret := fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+	if e.RequestId != "" {
+		ret += fmt.Sprintf(" (request %s)", e.RequestId)
+	}
+	return ret
+}
+
+// Unwrap returns the error for the response's status, if there is one.
+func (e *Error) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusBadRequest:
+		return BadRequestError
+	case http.StatusUnauthorized:
+		return UnauthorizedError
+	case http.StatusForbidden:
+		return ForbiddenError
+	case http.StatusNotFound:
+		return NotFoundError
+	case http.StatusConflict:
+		return ConflictError
+	case http.StatusPreconditionFailed:
+		return PreconditionFailedError
+	case http.StatusRequestEntityTooLarge:
+		return TooLargeError
+	case http.StatusTooManyRequests:
+		return TooManyRequestsError
+	case http.StatusInsufficientStorage:
+		return QuotaExceededError
+	}
+	if e.StatusCode >= http.StatusInternalServerError {
+		return ServerError
+	}
+	return nil
+}
+
+// checkResponse returns an *Error unless the response has one of the
+// expected statuses. Bodies which aren't an APIError, e.g. from a proxy,
+// become the error's message.
+func checkResponse(resp *http.Response, expected ...int) error {
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+
+	ret := &Error{StatusCode: resp.StatusCode}
+	body, _ := ioutil.ReadAll(resp.Body)
+	err := json.Unmarshal(body, &ret.APIError)
+	if err != nil || ret.Code == "" {
+		ret.APIError = models.APIError{Message: strings.TrimSpace(string(body))}
+	}
+	if ret.Message == "" {
+		ret.Message = http.StatusText(resp.StatusCode)
+	}
+	return ret
+}
@@ -0,0 +1,52 @@
+package repoclient
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	Convey("Should get structured errors from the server...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+
+		Convey("Should say when a blob doesn't exist...", func() {
+			_, err := c.QueryById(1 << 40)
+			So(errors.Is(err, NotFoundError), ShouldBeTrue)
+
+			var apiErr *Error
+			So(errors.As(err, &apiErr), ShouldBeTrue)
+			So(apiErr.StatusCode, ShouldEqual, 404)
+			So(apiErr.Code, ShouldEqual, models.ErrorNotFound)
+			So(apiErr.Message, ShouldNotBeEmpty)
+			So(apiErr.RequestId, ShouldNotBeEmpty)
+			So(err.Error(), ShouldContainSubstring, apiErr.RequestId)
+		})
+
+		Convey("Should say which fields are invalid...", func() {
+			info := models.Blob{
+				Bucket:   "__testing",
+				Date:     time.Now(),
+				Class:    "bogus",
+				Uploader: "__tester",
+				Metadata: models.MetadataMap{},
+				Size:     2,
+				Name:     "__test_invalid_blob",
+			}
+			_, err := c.Upload(&info, strings.NewReader("hi"), false)
+			So(errors.Is(err, BadRequestError), ShouldBeTrue)
+
+			var apiErr *Error
+			So(errors.As(err, &apiErr), ShouldBeTrue)
+			So(apiErr.Code, ShouldEqual, models.ErrorValidationFailed)
+			So(apiErr.Message, ShouldContainSubstring, "Class")
+			So(apiErr.Details, ShouldNotBeNil)
+		})
+
+	})
+}
@@ -0,0 +1,148 @@
+package repoclient
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var InvalidWebhookSignatureError = errors.New("the webhook's signature doesn't match its body")
+var StaleWebhookError = errors.New("the webhook's timestamp is too old")
+
+// EventSubscription picks which events SubscribeEvents receives.
+type EventSubscription struct {
+	// After is the id of the last event seen, or 0 to only receive new events.
+	After int64
+	// Types are the events wanted, or empty for every type.
+	Types []models.EventType
+	// Bucket only receives events about the bucket's blobs, if it's set.
+	Bucket string
+}
+
+func (s *EventSubscription) queryString() string {
+	values := url.Values{}
+	if s.After != 0 {
+		values.Set("after", strconv.FormatInt(s.After, 10))
+	}
+	for _, t := range s.Types {
+		values.Add("type", string(t))
+	}
+	if s.Bucket != "" {
+		values.Set("bucket", s.Bucket)
+	}
+	return values.Encode()
+}
+
+// SubscribeEvents calls fn with each event the server publishes, until ctx
+// is cancelled, fn returns an error or the server closes the stream. Every
+// event's id is stored in sub.After, so calling it again resumes the stream.
+func (c *RepositronConnection) SubscribeEvents(ctx context.Context, sub *EventSubscription, fn func(*models.Event) error) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.GetURL("v1/events?"+sub.queryString()), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	response, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Check for errors
+	err = checkResponse(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	// Each event ends with a blank line; anything else is ignored
+	var data strings.Builder
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			continue
+		} else if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		var event models.Event
+		err = json.Unmarshal([]byte(data.String()), &event)
+		if err != nil {
+			return err
+		}
+		data.Reset()
+		sub.After = event.Id
+		err = fn(&event)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = scanner.Err()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// ListWebhooks describes every webhook, without their secrets.
+func (c *RepositronConnection) ListWebhooks() ([]*models.Webhook, error) {
+	ret := make([]*models.Webhook, 0)
+	err := c.sendBucketRequest("GET", "v1/webhooks", nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// CreateWebhook starts sending events to a URL. A secret is generated if the
+// webhook doesn't have one; the returned webhook is the only place it's shown.
+func (c *RepositronConnection) CreateWebhook(webhook *models.Webhook) (*models.Webhook, error) {
+	var ret models.Webhook
+	err := c.sendBucketRequest("POST", "v1/webhooks", webhook, http.StatusCreated, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DeleteWebhook stops sending events to a webhook.
+func (c *RepositronConnection) DeleteWebhook(id int64) error {
+	return c.sendBucketRequest("DELETE", fmt.Sprintf("v1/webhooks/%d", id), nil, http.StatusAccepted, nil)
+}
+
+// VerifyWebhook checks that a request received by a webhook was signed with
+// its secret, no more than maxAge ago, and returns the event it carries.
+func VerifyWebhook(secret string, r *http.Request, maxAge time.Duration) (*models.Event, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	timestamp, err := strconv.ParseInt(r.Header.Get(models.WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return nil, InvalidWebhookSignatureError
+	}
+
+	expected := models.SignWebhookPayload(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(models.WebhookSignatureHeader))) {
+		return nil, InvalidWebhookSignatureError
+	}
+	if time.Since(time.Unix(timestamp, 0)) > maxAge {
+		return nil, StaleWebhookError
+	}
+
+	var ret models.Event
+	err = json.Unmarshal(body, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
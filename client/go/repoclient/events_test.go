@@ -0,0 +1,110 @@
+package repoclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Events(t *testing.T) {
+	if globalTestAdminToken == "" {
+		t.Skip("no token for an administrator")
+	}
+	Convey("Given a webhook and a subscription to a bucket's events...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		admin, err := ConnectWithToken(globalTestURL, globalTestAdminToken)
+		So(err, ShouldBeNil)
+		bucket := fmt.Sprintf("__testing_events_%d", time.Now().UnixNano())
+
+		received := make(chan *models.Event, 10)
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			event, err := VerifyWebhook("shh", r, time.Minute)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			received <- event
+		}))
+		defer receiver.Close()
+
+		webhook, err := admin.CreateWebhook(&models.Webhook{URL: receiver.URL, Secret: "shh", Bucket: bucket})
+		So(err, ShouldBeNil)
+		defer admin.DeleteWebhook(webhook.Id)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		streamed := make(chan *models.Event, 10)
+		go c.SubscribeEvents(ctx, &EventSubscription{Bucket: bucket}, func(e *models.Event) error {
+			streamed <- e
+			return nil
+		})
+		// Give the subscription time to connect
+		time.Sleep(500 * time.Millisecond)
+
+		info := models.Blob{
+			Bucket:   bucket,
+			Date:     time.Now(),
+			Class:    models.TemporaryBlob,
+			Metadata: models.MetadataMap{},
+			Size:     int64(len("evented")),
+			Name:     "__test_events_file",
+		}
+		blob, err := c.Upload(&info, strings.NewReader("evented"), false)
+		So(err, ShouldBeNil)
+		err = c.Delete(blob.Id)
+		So(err, ShouldBeNil)
+
+		expected := []models.EventType{models.BlobCreated, models.BlobFinalized, models.BlobDeleted}
+		collect := func(events chan *models.Event) []models.EventType {
+			ret := make([]models.EventType, 0)
+			for len(ret) < len(expected) {
+				select {
+				case e := <-events:
+					So(e.Blob.Id, ShouldEqual, blob.Id)
+					ret = append(ret, e.Type)
+				case <-time.After(10 * time.Second):
+					return ret
+				}
+			}
+			return ret
+		}
+
+		Convey("Should stream the blob's events...", func() {
+			So(collect(streamed), ShouldResemble, expected)
+		})
+
+		Convey("Should send the blob's events to the webhook...", func() {
+			So(collect(received), ShouldResemble, expected)
+		})
+
+		Convey("Should list the webhook without its secret...", func() {
+			webhooks, err := admin.ListWebhooks()
+			So(err, ShouldBeNil)
+			found := false
+			for _, w := range webhooks {
+				if w.Id == webhook.Id {
+					found = true
+					So(w.Secret, ShouldBeEmpty)
+					So(w.Bucket, ShouldEqual, bucket)
+				}
+			}
+			So(found, ShouldBeTrue)
+		})
+
+		Convey("Should only let administrators manage webhooks...", func() {
+			_, err := c.CreateWebhook(&models.Webhook{URL: receiver.URL})
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+			err = c.DeleteWebhook(webhook.Id)
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package repoclient
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+)
+
+var UnhealthyError = errors.New("the server reported a failing health check")
+
+// checkHealth retrieves a health report from one of the server's probes.
+func (c *RepositronConnection) checkHealth(sub string) (*models.HealthReport, error) {
+	response, err := c.httpClient().Get(c.GetRawURL(sub))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	err = checkResponse(response, http.StatusOK, http.StatusServiceUnavailable)
+	if err != nil {
+		return nil, err
+	}
+	var ret models.HealthReport
+	dec := json.NewDecoder(response.Body)
+	err = dec.Decode(&ret)
+	if err != nil {
+		return nil, err
+	}
+	if ret.Status != models.HealthOK {
+		return &ret, UnhealthyError
+	}
+	return &ret, nil
+}
+
+// CheckHealth reports whether the server is alive. If it isn't, the report
+// is returned alongside UnhealthyError.
+func (c *RepositronConnection) CheckHealth() (*models.HealthReport, error) {
+	return c.checkHealth("/healthz")
+}
+
+// CheckReadiness reports whether the server is usable, checking its
+// database, content directory and free space. If it isn't, the report is
+// returned alongside UnhealthyError.
+func (c *RepositronConnection) CheckReadiness() (*models.HealthReport, error) {
+	return c.checkHealth("/readyz")
+}
@@ -0,0 +1,42 @@
+package repoclient
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRepositronConnection_Health(t *testing.T) {
+	Convey("Given a connection to the server...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+
+		Convey("Should report that it's alive...", func() {
+			report, err := c.CheckHealth()
+			So(err, ShouldBeNil)
+			So(report.Status, ShouldEqual, models.HealthOK)
+			So(report.Checks, ShouldHaveLength, 1)
+			So(report.Checks[0].Name, ShouldEqual, "database")
+		})
+
+		Convey("Should report that it's ready...", func() {
+			report, err := c.CheckReadiness()
+			So(err, ShouldBeNil)
+			So(report.Status, ShouldEqual, models.HealthOK)
+
+			names := make([]string, 0)
+			for _, check := range report.Checks {
+				names = append(names, check.Name)
+				So(check.Status, ShouldNotEqual, models.HealthFailing)
+			}
+			So(names, ShouldResemble, []string{"database", "schema", "content", "disk"})
+		})
+
+		Convey("Shouldn't need a token...", func() {
+			anonymous := &RepositronConnection{BaseURL: globalTestURL}
+			_, err := anonymous.CheckReadiness()
+			So(err, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,19 @@
+package repoclient
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+	"net/url"
+)
+
+// PreviewLifecycle lists the blobs which lifecycle rules would apply to if
+// they ran now. If bucket is empty, every bucket is previewed.
+func (c *RepositronConnection) PreviewLifecycle(bucket string) ([]*models.LifecycleMatch, error) {
+	sub := "v1/lifecycle/preview"
+	if bucket != "" {
+		sub += "?bucket=" + url.QueryEscape(bucket)
+	}
+	ret := make([]*models.LifecycleMatch, 0)
+	err := c.sendBucketRequest("GET", sub, nil, http.StatusOK, &ret)
+	return ret, err
+}
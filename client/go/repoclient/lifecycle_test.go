@@ -0,0 +1,55 @@
+package repoclient
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_PreviewLifecycle(t *testing.T) {
+	Convey("Given a bucket with a lifecycle rule...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		bucket := "__testing_lifecycle"
+		_, err = c.CreateBucket(bucket, models.BucketSettings{
+			Lifecycle: models.LifecycleRules{{Action: models.LifecycleMakePermanent, HasMetadata: "promote"}},
+		})
+		So(err, ShouldBeNil)
+
+		fixedContent := "promote me"
+		info := models.Blob{
+			Bucket:   bucket,
+			Date:     time.Now(),
+			Class:    "temp",
+			Uploader: "__tester",
+			Metadata: models.MetadataMap{"promote": true},
+			Size:     int64(len(fixedContent)),
+			Name:     "__test_lifecycle_file",
+		}
+		uploaded, err := c.Upload(&info, strings.NewReader(fixedContent), false)
+		So(err, ShouldBeNil)
+
+		Convey("Should be able to preview what it would do...", func() {
+			matches, err := c.PreviewLifecycle(bucket)
+			So(err, ShouldBeNil)
+			So(len(matches), ShouldEqual, 1)
+			So(matches[0].Blob.Id, ShouldEqual, uploaded.Id)
+			So(matches[0].Rule.Action, ShouldEqual, models.LifecycleMakePermanent)
+
+			blob, err := c.QueryById(uploaded.Id)
+			So(err, ShouldBeNil)
+			So(blob.Class, ShouldEqual, models.TemporaryBlob)
+		})
+
+		Reset(func() {
+			c.Delete(uploaded.Id)
+			c.Purge(uploaded.Id)
+			c.DeleteBucket(bucket)
+		})
+	})
+}
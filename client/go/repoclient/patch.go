@@ -0,0 +1,77 @@
+package repoclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+)
+
+var PreconditionFailedError = errors.New("blob has been modified since it was retrieved")
+
+// Patch applies a JSON merge patch to a blob's name, bucket and metadata.
+// If etag isn't empty, the patch only succeeds if the blob hasn't changed
+// since that ETag was issued.
+func (c *RepositronConnection) Patch(blobId int64, patch models.BlobPatch, etag string) (*models.Blob, error) {
+
+	client := c.httpClient()
+
+	contentUrl := c.GetURL(fmt.Sprintf("v1/blobs/byId/%d", blobId))
+
+	// Form the request body
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	err := enc.Encode(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("PATCH", contentUrl, &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	if etag != "" {
+		req.Header.Set("If-Match", etag)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Check for errors
+	err = checkResponse(resp, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decode the response
+	var ret models.Blob
+	dec := json.NewDecoder(resp.Body)
+	err = dec.Decode(&ret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+// Rename changes a blob's name, provided it hasn't changed since b was retrieved.
+func (c *RepositronConnection) Rename(b *models.Blob, name string) (*models.Blob, error) {
+	return c.Patch(b.Id, models.BlobPatch{"name": name}, b.ETag())
+}
+
+// Move puts a blob into another bucket, provided it hasn't changed since b was retrieved.
+func (c *RepositronConnection) Move(b *models.Blob, bucket string) (*models.Blob, error) {
+	return c.Patch(b.Id, models.BlobPatch{"bucket": bucket}, b.ETag())
+}
+
+// UpdateMetadata merges changes into a blob's metadata: keys set to nil are
+// removed, and everything else is added or replaced.
+func (c *RepositronConnection) UpdateMetadata(b *models.Blob, changes map[string]interface{}) (*models.Blob, error) {
+	return c.Patch(b.Id, models.BlobPatch{"metadata": changes}, b.ETag())
+}
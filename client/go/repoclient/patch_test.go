@@ -0,0 +1,90 @@
+package repoclient
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Patch(t *testing.T) {
+	Convey("Should be able to patch...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		metadata := models.MetadataMap{}
+		metadata["key"] = "value"
+		metadata["other"] = "value"
+
+		fixedContent := "<html><body>hi</body></html>"
+		content := strings.NewReader(fixedContent)
+		info := models.Blob{
+			Bucket:   "__testing",
+			Date:     time.Now(),
+			Class:    "temp",
+			Uploader: "__tester",
+			Metadata: metadata,
+			Size:     int64(len(fixedContent)),
+			Name:     "__test_patch_file",
+		}
+
+		uploaded, err := c.Upload(&info, content, false)
+		So(err, ShouldBeNil)
+		So(uploaded, ShouldNotBeNil)
+		defer c.Delete(uploaded.Id)
+
+		// Uploading the content changes the blob, so fetch its latest revision
+		newInfo, err := c.QueryById(uploaded.Id)
+		So(err, ShouldBeNil)
+
+		Convey("Should be able to rename it...", func() {
+			renamed, err := c.Rename(newInfo, "__test_patched_file")
+			So(err, ShouldBeNil)
+			So(renamed.Name, ShouldEqual, "__test_patched_file")
+			So(renamed.Checksum, ShouldEqual, newInfo.Checksum)
+			So(renamed.Revision, ShouldBeGreaterThan, newInfo.Revision)
+
+			Convey("But not with a stale ETag...", func() {
+				_, err := c.Move(newInfo, "__testing_2")
+				So(errors.Is(err, PreconditionFailedError), ShouldBeTrue)
+			})
+
+			Convey("Should be able to move it...", func() {
+				moved, err := c.Move(renamed, "__testing_2")
+				So(err, ShouldBeNil)
+				So(moved.Bucket, ShouldEqual, "__testing_2")
+				So(moved.Name, ShouldEqual, "__test_patched_file")
+			})
+		})
+
+		Convey("Should be able to merge metadata...", func() {
+			updated, err := c.UpdateMetadata(newInfo, map[string]interface{}{
+				"key":   nil,
+				"added": map[string]interface{}{"nested": "value"},
+			})
+			So(err, ShouldBeNil)
+			So(updated.Metadata, ShouldResemble, models.MetadataMap{
+				"other": "value",
+				"added": map[string]interface{}{"nested": "value"},
+			})
+		})
+
+		Convey("Should not be able to patch the checksum...", func() {
+			_, err := c.Patch(newInfo.Id, models.BlobPatch{"sha1": "nope"}, "")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should not be able to replace the metadata with something other than an object...", func() {
+			_, err := c.Patch(newInfo.Id, models.BlobPatch{"metadata": 5}, "")
+			So(errors.Is(err, BadRequestError), ShouldBeTrue)
+
+			current, err := c.QueryById(newInfo.Id)
+			So(err, ShouldBeNil)
+			So(current.Metadata, ShouldResemble, newInfo.Metadata)
+		})
+	})
+}
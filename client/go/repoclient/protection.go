@@ -0,0 +1,18 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+)
+
+// Protect changes whether a blob is write-once or under legal hold. Once a
+// blob is write-once, it can't be made writable again.
+func (c *RepositronConnection) Protect(blobId int64, protection models.BlobProtection) (*models.Blob, error) {
+	var ret models.Blob
+	err := c.sendBucketRequest("PUT", fmt.Sprintf("v1/blobs/byId/%d/protection", blobId), &protection, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
@@ -0,0 +1,58 @@
+package repoclient
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Protect(t *testing.T) {
+	Convey("Given an uploaded blob...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		fixedContent := "release notes"
+		info := models.Blob{
+			Bucket:   "__testing",
+			Date:     time.Now(),
+			Class:    "temp",
+			Uploader: "__tester",
+			Metadata: models.MetadataMap{"key": "value"},
+			Size:     int64(len(fixedContent)),
+			Name:     "__test_protected_file",
+		}
+		uploaded, err := c.Upload(&info, strings.NewReader(fixedContent), false)
+		So(err, ShouldBeNil)
+
+		Convey("Write-once blobs shouldn't accept more content...", func() {
+			blob, err := c.Protect(uploaded.Id, models.BlobProtection{Immutable: true})
+			So(err, ShouldBeNil)
+			So(blob.Immutable, ShouldBeTrue)
+
+			_, err = c.Append(blob, 4, strings.NewReader("more"), false)
+			So(err, ShouldNotBeNil)
+
+			_, err = c.Rename(blob, "__test_protected_file_2")
+			So(err, ShouldNotBeNil)
+
+			_, err = c.Protect(uploaded.Id, models.BlobProtection{})
+			So(err, ShouldNotBeNil)
+
+			So(c.Delete(blob.Id), ShouldBeNil)
+		})
+
+		Convey("Blobs under legal hold shouldn't be deleted...", func() {
+			_, err := c.Protect(uploaded.Id, models.BlobProtection{LegalHold: true})
+			So(err, ShouldBeNil)
+			So(c.Delete(uploaded.Id), ShouldNotBeNil)
+
+			_, err = c.Protect(uploaded.Id, models.BlobProtection{})
+			So(err, ShouldBeNil)
+			So(c.Delete(uploaded.Id), ShouldBeNil)
+		})
+	})
+}
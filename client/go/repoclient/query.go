@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/Sentimentron/repositron/models"
+	"io"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 )
 
 func (c *RepositronConnection) QueryById(blobId int64) (*models.Blob, error) {
@@ -14,15 +17,16 @@ func (c *RepositronConnection) QueryById(blobId int64) (*models.Blob, error) {
 	contentUrl := c.GetURL(fmt.Sprintf("v1/blobs/byId/%d", blobId))
 
 	// Request the object
-	resp, err := http.Get(contentUrl)
+	resp, err := c.httpClient().Get(contentUrl)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// Check for errors
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("bad status code, expected %d, got %d", 200, resp.StatusCode)
+	err = checkResponse(resp, http.StatusOK)
+	if err != nil {
+		return nil, err
 	}
 
 	// Decode the response
@@ -36,39 +40,179 @@ func (c *RepositronConnection) QueryById(blobId int64) (*models.Blob, error) {
 	return &blobResponse, nil
 }
 
-func (c *RepositronConnection) query(qry *models.BlobSearch) ([]int64, error) {
+// Search returns the ids of blobs matching every criterion in qry
+// (or any of them, if qry.Mode is models.MatchAny).
+func (c *RepositronConnection) Search(qry *models.BlobSearch) ([]int64, error) {
+	return c.query(qry)
+}
 
-	contentUrl := c.GetURL("v1/blobs/search")
+func encodePageRequest(page *models.PageRequest) string {
+	values := url.Values{}
+	if page.Limit != 0 {
+		values.Set("limit", strconv.Itoa(page.Limit))
+	}
+	if page.Cursor != "" {
+		values.Set("cursor", page.Cursor)
+	}
+	if page.Sort != "" {
+		values.Set("sort", string(page.Sort))
+	}
+	if page.Order != "" {
+		values.Set("order", string(page.Order))
+	}
+	if len(page.Fields) > 0 {
+		values.Set("fields", strings.Join(page.Fields, ","))
+	}
+	return values.Encode()
+}
+
+// ListPage retrieves a single page of every blob stored.
+func (c *RepositronConnection) ListPage(page *models.PageRequest) (*models.BlobPage, error) {
+	return c.retrievePage(nil, page)
+}
+
+// SearchPage retrieves a single page of the blobs matching qry.
+func (c *RepositronConnection) SearchPage(qry *models.BlobSearch, page *models.PageRequest) (*models.BlobPage, error) {
+	return c.retrievePage(qry, page)
+}
+
+func (c *RepositronConnection) retrievePage(qry *models.BlobSearch, page *models.PageRequest) (*models.BlobPage, error) {
+
+	var response *http.Response
+	var err error
+	if qry == nil {
+		contentUrl := c.GetURL("v1/blobs?" + encodePageRequest(page))
+		response, err = c.httpClient().Get(contentUrl)
+	} else {
+		contentUrl := c.GetURL("v1/blobs/search?" + encodePageRequest(page))
+
+		// Form the request body
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		err = enc.Encode(qry)
+		if err != nil {
+			return nil, err
+		}
 
-	// Form the request body
-	var buf bytes.Buffer
-	enc := json.NewEncoder(&buf)
-	err := enc.Encode(qry)
+		// Post the query
+		response, err = c.httpClient().Post(contentUrl, "application/json", &buf)
+	}
 	if err != nil {
 		return nil, err
 	}
+	defer response.Body.Close()
 
-	// Post the query
-	response, err := http.Post(contentUrl, "application/json", &buf)
+	// Check for errors
+	err = checkResponse(response, http.StatusOK)
 	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
 
-	// Decode the list of identifiers
-	var ids []string
+	// Decode the page
+	var ret models.BlobPage
 	dec := json.NewDecoder(response.Body)
-	err = dec.Decode(&ids)
+	err = dec.Decode(&ret)
+	if err != nil {
+		return nil, err
+	}
 
-	ret := make([]int64, 0)
-	for _, v := range ids {
-		id, err := strconv.ParseInt(v, 10, 64)
+	return &ret, nil
+}
+
+// ForEachBlob calls fn with every blob matching qry (or every blob, if qry is
+// nil), retrieving further pages as needed. If page specifies some fields,
+// only those are filled in. Iteration stops at the first error.
+func (c *RepositronConnection) ForEachBlob(qry *models.BlobSearch, page *models.PageRequest, fn func(*models.Blob) error) error {
+	cur := models.PageRequest{}
+	if page != nil {
+		cur = *page
+	}
+
+	for {
+		blobs, err := c.retrievePage(qry, &cur)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		for _, b := range blobs.Blobs {
+			err = fn(b)
+			if err != nil {
+				return err
+			}
+		}
+		if blobs.NextCursor == "" {
+			return nil
+		}
+		cur.Cursor = blobs.NextCursor
+	}
+}
+
+// ListAll retrieves every blob stored, one page at a time.
+func (c *RepositronConnection) ListAll() ([]*models.Blob, error) {
+	ret := make([]*models.Blob, 0)
+	err := c.ForEachBlob(nil, nil, func(b *models.Blob) error {
+		ret = append(ret, b)
+		return nil
+	})
+	return ret, err
+}
+
+// Export streams every blob record to w, either as newline-delimited JSON
+// ("ndjson") or as "csv".
+func (c *RepositronConnection) Export(format string, w io.Writer) error {
+	response, err := c.httpClient().Get(c.GetURL("v1/blobs/export?format=" + url.QueryEscape(format)))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Check for errors
+	err = checkResponse(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+// ForEachExportedBlob streams every blob record, calling fn with each one.
+// Unlike ForEachBlob, it only makes a single request.
+func (c *RepositronConnection) ForEachExportedBlob(fn func(*models.Blob) error) error {
+	response, err := c.httpClient().Get(c.GetURL("v1/blobs/export?format=ndjson"))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// Check for errors
+	err = checkResponse(response, http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(response.Body)
+	for {
+		var b models.Blob
+		err = dec.Decode(&b)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		err = fn(&b)
+		if err != nil {
+			return err
 		}
-		ret = append(ret, id)
 	}
+}
 
+func (c *RepositronConnection) query(qry *models.BlobSearch) ([]int64, error) {
+	ret := make([]int64, 0)
+	page := &models.PageRequest{Limit: models.MaximumPageLimit, Fields: []string{"id"}}
+	err := c.ForEachBlob(qry, page, func(b *models.Blob) error {
+		ret = append(ret, b.Id)
+		return nil
+	})
 	return ret, err
 }
 
@@ -80,6 +224,29 @@ func (c *RepositronConnection) QueryByName(name string) ([]int64, error) {
 	return c.query(&models.BlobSearch{Name: &name})
 }
 
+func (c *RepositronConnection) QueryByNamePrefix(prefix string) ([]int64, error) {
+	return c.query(&models.BlobSearch{NamePrefix: &prefix})
+}
+
+// QueryByNameGlob matches names against a glob, e.g. "release-2026-*.tar.gz".
+func (c *RepositronConnection) QueryByNameGlob(glob string) ([]int64, error) {
+	return c.query(&models.BlobSearch{NameGlob: &glob})
+}
+
+// QueryByText runs a full-text search over blob names and metadata values.
+func (c *RepositronConnection) QueryByText(text string) ([]int64, error) {
+	return c.query(&models.BlobSearch{Text: &text})
+}
+
 func (c *RepositronConnection) QueryByChecksum(checksum string) ([]int64, error) {
 	return c.query(&models.BlobSearch{Checksum: &checksum})
 }
+
+func (c *RepositronConnection) QueryByNameInBucket(name, bucket string) ([]int64, error) {
+	return c.query(&models.BlobSearch{Name: &name, Bucket: &bucket})
+}
+
+func (c *RepositronConnection) QueryByMetadata(key string, value interface{}) ([]int64, error) {
+	predicate := models.MetadataPredicate{Key: key, Op: models.MetadataEquals, Value: value}
+	return c.query(&models.BlobSearch{Metadata: []models.MetadataPredicate{predicate}})
+}
@@ -1,6 +1,8 @@
 package repoclient
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/Sentimentron/repositron/models"
 	. "github.com/smartystreets/goconvey/convey"
 	"strings"
@@ -12,12 +14,13 @@ import (
 func TestRepositronConnection_Query(t *testing.T) {
 	Convey("Should be able to query stuff...", t, func() {
 
-		c, err := Connect(globalTestURL)
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
 		So(err, ShouldBeNil)
 		So(c, ShouldNotBeNil)
 
 		metadata := models.MetadataMap{}
 		metadata["key"] = "value"
+		metadata["commit"] = fmt.Sprintf("%x", time.Now().UnixNano())
 
 		fixedContent1 := "<html><body>hi</body></html>"
 		content1 := strings.NewReader(fixedContent1)
@@ -74,6 +77,69 @@ func TestRepositronConnection_Query(t *testing.T) {
 					So(newerInfo1.Id, ShouldBeIn, ids)
 					So(newerInfo2.Id, ShouldNotBeIn, ids)
 				})
+				Convey("Should be able to search by name within a bucket...", func() {
+					ids, err := c.QueryByNameInBucket("__test_upload_file", "__testing")
+					So(err, ShouldBeNil)
+					So(newerInfo1.Id, ShouldBeIn, ids)
+					So(newerInfo2.Id, ShouldNotBeIn, ids)
+
+					ids, err = c.QueryByNameInBucket("__test_upload_file", "__not_testing")
+					So(err, ShouldBeNil)
+					So(newerInfo1.Id, ShouldNotBeIn, ids)
+				})
+				Convey("Should be able to search by name prefix and glob...", func() {
+					ids, err := c.QueryByNamePrefix("__test_upload_file_")
+					So(err, ShouldBeNil)
+					So(newerInfo1.Id, ShouldNotBeIn, ids)
+					So(newerInfo2.Id, ShouldBeIn, ids)
+
+					ids, err = c.QueryByNameGlob("__test_upload_*")
+					So(err, ShouldBeNil)
+					So(newerInfo1.Id, ShouldBeIn, ids)
+					So(newerInfo2.Id, ShouldBeIn, ids)
+				})
+				Convey("Should be able to search by text...", func() {
+					ids, err := c.QueryByText(metadata["commit"].(string))
+					So(err, ShouldBeNil)
+					So(ids, ShouldResemble, []int64{newerInfo1.Id, newerInfo2.Id})
+				})
+				Convey("Should be able to search by metadata...", func() {
+					ids, err := c.QueryByMetadata("commit", metadata["commit"])
+					So(err, ShouldBeNil)
+					So(ids, ShouldResemble, []int64{newerInfo1.Id, newerInfo2.Id})
+				})
+				Convey("Should be able to page through everything...", func() {
+					seen := make([]int64, 0)
+					page := &models.PageRequest{Limit: 1, Sort: models.SortById, Order: models.Descending}
+					err := c.ForEachBlob(nil, page, func(b *models.Blob) error {
+						seen = append(seen, b.Id)
+						return nil
+					})
+					So(err, ShouldBeNil)
+					So(newerInfo1.Id, ShouldBeIn, seen)
+					So(newerInfo2.Id, ShouldBeIn, seen)
+					So(seen[0], ShouldBeGreaterThan, seen[len(seen)-1])
+
+					all, err := c.ListAll()
+					So(err, ShouldBeNil)
+					So(len(all), ShouldEqual, len(seen))
+				})
+				Convey("Should be able to export everything...", func() {
+					seen := make([]int64, 0)
+					err := c.ForEachExportedBlob(func(b *models.Blob) error {
+						seen = append(seen, b.Id)
+						return nil
+					})
+					So(err, ShouldBeNil)
+					So(newerInfo1.Id, ShouldBeIn, seen)
+					So(newerInfo2.Id, ShouldBeIn, seen)
+
+					var buf bytes.Buffer
+					err = c.Export("csv", &buf)
+					So(err, ShouldBeNil)
+					So(buf.String(), ShouldStartWith, "id,name,bucket,")
+					So(buf.String(), ShouldContainSubstring, "__test_upload_file_2")
+				})
 				Convey("Should be able to search by checksum...", func() {
 					ids, err := c.QueryByChecksum("95d70659530e385bfae5d6eefe689d95ac463cb0c58235f19eef71bdaa725126")
 					So(err, ShouldBeNil)
@@ -0,0 +1,45 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+	"net/url"
+)
+
+func quotaURL(scope models.QuotaScope, name string) string {
+	return fmt.Sprintf("v1/quotas/%s/%s", scope, url.PathEscape(name))
+}
+
+// ListQuotas returns every quota on uploaders and buckets.
+func (c *RepositronConnection) ListQuotas() ([]*models.Quota, error) {
+	ret := make([]*models.Quota, 0)
+	err := c.sendBucketRequest("GET", "v1/quotas", nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// RetrieveUsage reports how much an uploader or bucket is storing, and the
+// quota which applies to it.
+func (c *RepositronConnection) RetrieveUsage(scope models.QuotaScope, name string) (*models.QuotaUsage, error) {
+	var ret models.QuotaUsage
+	err := c.sendBucketRequest("GET", quotaURL(scope, name), nil, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// SetQuota creates or replaces the quota on an uploader or bucket.
+func (c *RepositronConnection) SetQuota(quota *models.Quota) (*models.Quota, error) {
+	var ret models.Quota
+	err := c.sendBucketRequest("PUT", quotaURL(quota.Scope, quota.Name), quota, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// DeleteQuota removes the quota on an uploader or bucket.
+func (c *RepositronConnection) DeleteQuota(scope models.QuotaScope, name string) error {
+	return c.sendBucketRequest("DELETE", quotaURL(scope, name), nil, http.StatusAccepted, nil)
+}
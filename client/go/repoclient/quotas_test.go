@@ -0,0 +1,102 @@
+package repoclient
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// globalTestAdminToken is an API token for a member of the admins group.
+var globalTestAdminToken = os.Getenv("REPOSITRON_TEST_ADMIN_TOKEN")
+
+func TestRepositronConnection_Quotas(t *testing.T) {
+	if globalTestAdminToken == "" {
+		t.Skip("no token for an administrator")
+	}
+	Convey("Given a bucket with a quota...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		admin, err := ConnectWithToken(globalTestURL, globalTestAdminToken)
+		So(err, ShouldBeNil)
+
+		name := fmt.Sprintf("__testing_quota_%d", time.Now().UnixNano())
+		_, err = c.CreateBucket(name, models.BucketSettings{})
+		So(err, ShouldBeNil)
+		_, err = admin.SetQuota(&models.Quota{Scope: models.QuotaBucket, Name: name, MaxBytes: 10, MaxBlobs: 2})
+		So(err, ShouldBeNil)
+		defer admin.DeleteQuota(models.QuotaBucket, name)
+
+		upload := func(content string) (*models.Blob, error) {
+			info := models.Blob{
+				Bucket:   name,
+				Date:     time.Now(),
+				Class:    models.TemporaryBlob,
+				Metadata: models.MetadataMap{},
+				Size:     int64(len(content)),
+				Name:     "__test_quota_file",
+			}
+			return c.Upload(&info, strings.NewReader(content), false)
+		}
+
+		first, err := upload("12345")
+		So(err, ShouldBeNil)
+
+		Convey("Should refuse uploads declared too large...", func() {
+			_, err := upload(strings.Repeat("x", 20))
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, QuotaExceededError), ShouldBeTrue)
+		})
+
+		Convey("Should refuse too many blobs...", func() {
+			_, err := upload("1234")
+			So(err, ShouldBeNil)
+			_, err = upload("1")
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, QuotaExceededError), ShouldBeTrue)
+		})
+
+		Convey("Should cut off appends which go over...", func() {
+			_, err := c.Append(first, 6, strings.NewReader("678901"), false)
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, QuotaExceededError), ShouldBeTrue)
+
+			// Appends of unknown length are stopped once they've gone over
+			_, err = c.Append(first, -1, strings.NewReader("678901"), false)
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, QuotaExceededError), ShouldBeTrue)
+
+			unchanged, err := c.QueryById(first.Id)
+			So(err, ShouldBeNil)
+			So(unchanged.Size, ShouldEqual, 5)
+		})
+
+		Convey("Should be able to see the bucket's usage...", func() {
+			usage, err := c.RetrieveUsage(models.QuotaBucket, name)
+			So(err, ShouldBeNil)
+			So(usage.Bytes, ShouldEqual, 5)
+			So(usage.Blobs, ShouldEqual, 1)
+			So(usage.Quota.MaxBytes, ShouldEqual, 10)
+		})
+
+		Convey("Only administrators should be able to manage quotas...", func() {
+			_, err := c.SetQuota(&models.Quota{Scope: models.QuotaBucket, Name: name})
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+			_, err = c.ListQuotas()
+			So(errors.Is(err, ForbiddenError), ShouldBeTrue)
+
+			quotas, err := admin.ListQuotas()
+			So(err, ShouldBeNil)
+			found := false
+			for _, q := range quotas {
+				found = found || q.Name == name
+			}
+			So(found, ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,23 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+	"strings"
+)
+
+// SignURL asks for a URL which anyone can use to download or upload a blob's
+// content, without an API token, until it expires.
+func (c *RepositronConnection) SignURL(id int64, req *models.SignedURLRequest) (*models.SignedURL, error) {
+	var ret models.SignedURL
+	err := c.sendBucketRequest("POST", fmt.Sprintf("v1/blobs/byId/%d/url", id), req, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	// The server hands out paths, which are relative to the connection
+	if strings.HasPrefix(ret.URL, "/") {
+		ret.URL = c.GetRawURL(ret.URL)
+	}
+	return &ret, nil
+}
@@ -0,0 +1,98 @@
+package repoclient
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_SignURL(t *testing.T) {
+	Convey("Given a blob...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+
+		fixedContent := "signed content"
+		info := models.Blob{
+			Bucket:   "__testing",
+			Date:     time.Now(),
+			Class:    models.TemporaryBlob,
+			Uploader: "__tester",
+			Metadata: models.MetadataMap{},
+			Size:     int64(len(fixedContent)),
+			Name:     "__test_signed_file",
+		}
+		blob, err := c.Upload(&info, strings.NewReader(fixedContent), false)
+		So(err, ShouldBeNil)
+
+		get := func(url string) (int, string) {
+			resp, err := http.Get(url)
+			So(err, ShouldBeNil)
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			So(err, ShouldBeNil)
+			return resp.StatusCode, string(body)
+		}
+
+		Convey("Should be able to download it without a token...", func() {
+			signed, err := c.SignURL(blob.Id, &models.SignedURLRequest{Expiry: 60})
+			So(err, ShouldBeNil)
+			So(signed.Method, ShouldEqual, http.MethodGet)
+			So(signed.Expires, ShouldHappenAfter, time.Now())
+
+			status, body := get(signed.URL)
+			So(status, ShouldEqual, http.StatusOK)
+			So(body, ShouldEqual, fixedContent)
+
+			Convey("Shouldn't be able to change what it allows...", func() {
+				status, _ := get(strings.Replace(signed.URL, "expires=", "expires=1", 1))
+				So(status, ShouldEqual, http.StatusForbidden)
+
+				req, err := http.NewRequest(http.MethodPut, signed.URL, strings.NewReader("changed"))
+				So(err, ShouldBeNil)
+				resp, err := http.DefaultClient.Do(req)
+				So(err, ShouldBeNil)
+				resp.Body.Close()
+				So(resp.StatusCode, ShouldEqual, http.StatusForbidden)
+			})
+		})
+
+		Convey("Should be able to download part of it...", func() {
+			signed, err := c.SignURL(blob.Id, &models.SignedURLRequest{Range: &models.ByteRange{Start: 7, End: 100}})
+			So(err, ShouldBeNil)
+
+			status, body := get(signed.URL)
+			So(status, ShouldEqual, http.StatusPartialContent)
+			So(body, ShouldEqual, "content")
+		})
+
+		Convey("Should be able to upload without a token...", func() {
+			signed, err := c.SignURL(blob.Id, &models.SignedURLRequest{Method: http.MethodPut})
+			So(err, ShouldBeNil)
+
+			req, err := http.NewRequest(http.MethodPut, signed.URL, strings.NewReader("replaced"))
+			So(err, ShouldBeNil)
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusAccepted)
+
+			updated, err := c.QueryById(blob.Id)
+			So(err, ShouldBeNil)
+			So(updated.Size, ShouldEqual, len("replaced"))
+		})
+
+		Convey("Shouldn't be able to ask for invalid URLs...", func() {
+			_, err := c.SignURL(blob.Id, &models.SignedURLRequest{Method: http.MethodPut, Range: &models.ByteRange{Start: 0, End: 1}})
+			So(err, ShouldNotBeNil)
+			_, err = c.SignURL(blob.Id, &models.SignedURLRequest{Expiry: 365 * 24 * 3600})
+			So(err, ShouldNotBeNil)
+			_, err = c.SignURL(blob.Id, &models.SignedURLRequest{Method: http.MethodDelete})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
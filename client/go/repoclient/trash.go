@@ -0,0 +1,29 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+)
+
+// ListTrash returns every blob in the trash, most recently deleted first.
+func (c *RepositronConnection) ListTrash() ([]*models.Blob, error) {
+	ret := make([]*models.Blob, 0)
+	err := c.sendBucketRequest("GET", "v1/trash", nil, http.StatusOK, &ret)
+	return ret, err
+}
+
+// Restore moves a deleted blob out of the trash.
+func (c *RepositronConnection) Restore(blobId int64) (*models.Blob, error) {
+	var ret models.Blob
+	err := c.sendBucketRequest("POST", fmt.Sprintf("v1/trash/%d/restore", blobId), nil, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// Purge removes a deleted blob for good, without waiting for the trash to be emptied.
+func (c *RepositronConnection) Purge(blobId int64) error {
+	return c.sendBucketRequest("DELETE", fmt.Sprintf("v1/trash/%d", blobId), nil, http.StatusAccepted, nil)
+}
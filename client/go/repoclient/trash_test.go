@@ -0,0 +1,72 @@
+package repoclient
+
+import (
+	"bytes"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Trash(t *testing.T) {
+	Convey("Deleted blobs should go into the trash...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		fixedContent := "<html><body>hi</body></html>"
+		info := models.Blob{
+			Bucket:   "__testing",
+			Date:     time.Now(),
+			Class:    "temp",
+			Uploader: "__tester",
+			Metadata: models.MetadataMap{"key": "value"},
+			Size:     int64(len(fixedContent)),
+			Name:     "__test_trash_file",
+		}
+		uploaded, err := c.Upload(&info, strings.NewReader(fixedContent), false)
+		So(err, ShouldBeNil)
+		blob, err := c.QueryById(uploaded.Id)
+		So(err, ShouldBeNil)
+
+		err = c.Delete(blob.Id)
+		So(err, ShouldBeNil)
+
+		Convey("Should be hidden, but listed in the trash...", func() {
+			_, err := c.QueryById(blob.Id)
+			So(err, ShouldNotBeNil)
+
+			trash, err := c.ListTrash()
+			So(err, ShouldBeNil)
+			ids := make([]int64, 0)
+			for _, b := range trash {
+				ids = append(ids, b.Id)
+			}
+			So(blob.Id, ShouldBeIn, ids)
+		})
+
+		Convey("Should be able to restore it...", func() {
+			restored, err := c.Restore(blob.Id)
+			So(err, ShouldBeNil)
+			So(restored.Deleted, ShouldBeNil)
+
+			var buf bytes.Buffer
+			err = c.Download(restored, &buf, false)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, fixedContent)
+
+			err = c.Delete(blob.Id)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Should be able to purge it...", func() {
+			err := c.Purge(blob.Id)
+			So(err, ShouldBeNil)
+
+			_, err = c.Restore(blob.Id)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/Sentimentron/repositron/models"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -50,7 +49,7 @@ func (u *UploadReader) reportProgress() {
 }
 
 func (c *RepositronConnection) Append(b *models.Blob, sz int64, r io.Reader, verbose bool) (*models.Blob, error) {
-	client := &http.Client{}
+	client := c.httpClient()
 
 	// Form the upload URL
 	appendURL := c.GetURL(fmt.Sprintf("v1/blobs/byId/%d/content/append", b.Id))
@@ -64,9 +63,9 @@ func (c *RepositronConnection) Append(b *models.Blob, sz int64, r io.Reader, ver
 		return nil, err
 	} else {
 		defer response.Body.Close()
-		if response.StatusCode != 202 {
-			bytes, _ := ioutil.ReadAll(response.Body)
-			return nil, fmt.Errorf("bad status code: expected 202, got: %d (%s)", response.StatusCode, bytes)
+		err = checkResponse(response, http.StatusAccepted)
+		if err != nil {
+			return nil, err
 		}
 
 		// Retrieve the updated blob record
@@ -81,7 +80,7 @@ func (c *RepositronConnection) Append(b *models.Blob, sz int64, r io.Reader, ver
 }
 
 func (c *RepositronConnection) Upload(b *models.Blob, r io.Reader, verbose bool) (*models.Blob, error) {
-	client := &http.Client{}
+	client := c.httpClient()
 
 	if verbose {
 		r = NewUploadReader(r, b.Size)
@@ -109,6 +108,10 @@ func (c *RepositronConnection) Upload(b *models.Blob, r io.Reader, verbose bool)
 		return nil, err
 	}
 	defer metadataResponse.Body.Close()
+	err = checkResponse(metadataResponse, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
 
 	// Decode the response
 	var uploadResponse models.BlobUploadResponse
@@ -136,9 +139,9 @@ func (c *RepositronConnection) Upload(b *models.Blob, r io.Reader, verbose bool)
 		return nil, err
 	} else {
 		defer response.Body.Close()
-		if response.StatusCode != 202 {
-			bytes, _ := ioutil.ReadAll(response.Body)
-			return nil, fmt.Errorf("bad status code: expected 202, got: %d (%s)", response.StatusCode, bytes)
+		err = checkResponse(response, http.StatusAccepted)
+		if err != nil {
+			return nil, err
 		}
 	}
 
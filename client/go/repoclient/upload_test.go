@@ -11,7 +11,7 @@ import (
 func TestRepositronConnection_Upload(t *testing.T) {
 	Convey("Should be able to upload...", t, func() {
 
-		c, err := Connect(globalTestURL)
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
 		So(err, ShouldBeNil)
 		So(c, ShouldNotBeNil)
 
@@ -51,7 +51,7 @@ func TestRepositronConnection_Upload(t *testing.T) {
 func TestRepositronConnection_AppendDidNotExistBefore(t *testing.T) {
 	Convey("Should be able to append to a file which we have a description of, but no data", t, func() {
 
-		c, err := Connect(globalTestURL)
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
 		So(err, ShouldBeNil)
 		So(c, ShouldNotBeNil)
 
@@ -0,0 +1,40 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"net/http"
+	"net/url"
+)
+
+func objectURL(bucket, name string) string {
+	return fmt.Sprintf("%s/objects/%s", bucketURL(bucket), url.PathEscape(name))
+}
+
+// QueryLatest describes the newest blob with a given name in a bucket.
+func (c *RepositronConnection) QueryLatest(bucket, name string) (*models.Blob, error) {
+	var ret models.Blob
+	err := c.sendBucketRequest("GET", objectURL(bucket, name), nil, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// QueryVersion describes a specific version of a blob in a versioned bucket.
+func (c *RepositronConnection) QueryVersion(bucket, name string, version int64) (*models.Blob, error) {
+	var ret models.Blob
+	sub := fmt.Sprintf("%s/versions/%d", objectURL(bucket, name), version)
+	err := c.sendBucketRequest("GET", sub, nil, http.StatusOK, &ret)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListVersions describes every version of a blob, newest first.
+func (c *RepositronConnection) ListVersions(bucket, name string) ([]*models.Blob, error) {
+	ret := make([]*models.Blob, 0)
+	err := c.sendBucketRequest("GET", objectURL(bucket, name)+"/versions", nil, http.StatusOK, &ret)
+	return ret, err
+}
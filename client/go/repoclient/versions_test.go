@@ -0,0 +1,73 @@
+package repoclient
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRepositronConnection_Versions(t *testing.T) {
+	Convey("Should be able to keep versions of a blob...", t, func() {
+
+		c, err := ConnectWithToken(globalTestURL, globalTestToken)
+		So(err, ShouldBeNil)
+		So(c, ShouldNotBeNil)
+
+		bucket := fmt.Sprintf("__testing_versions_%d", time.Now().UnixNano())
+		_, err = c.CreateBucket(bucket, models.BucketSettings{Versioning: true, MaxVersions: 2})
+		So(err, ShouldBeNil)
+
+		upload := func(content string) *models.Blob {
+			info := models.Blob{
+				Bucket:   bucket,
+				Date:     time.Now(),
+				Class:    "temp",
+				Uploader: "__tester",
+				Metadata: models.MetadataMap{"key": "value"},
+				Size:     int64(len(content)),
+				Name:     "dir/config.json",
+			}
+			uploaded, err := c.Upload(&info, strings.NewReader(content), false)
+			So(err, ShouldBeNil)
+			return uploaded
+		}
+
+		first := upload("first")
+		second := upload("second")
+		So(first.Version, ShouldEqual, 1)
+		So(second.Version, ShouldEqual, 2)
+
+		Convey("Should retrieve the latest version by name...", func() {
+			latest, err := c.QueryLatest(bucket, "dir/config.json")
+			So(err, ShouldBeNil)
+			So(latest.Id, ShouldEqual, second.Id)
+			So(latest.Version, ShouldEqual, 2)
+
+			older, err := c.QueryVersion(bucket, "dir/config.json", 1)
+			So(err, ShouldBeNil)
+			So(older.Id, ShouldEqual, first.Id)
+		})
+
+		Convey("Should only keep the newest versions...", func() {
+			third := upload("third")
+			So(third.Version, ShouldEqual, 3)
+
+			versions, err := c.ListVersions(bucket, "dir/config.json")
+			So(err, ShouldBeNil)
+			So(len(versions), ShouldEqual, 2)
+			So(versions[0].Id, ShouldEqual, third.Id)
+			So(versions[1].Id, ShouldEqual, second.Id)
+
+			_, err = c.QueryVersion(bucket, "dir/config.json", 1)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Should not find names which don't exist...", func() {
+			_, err := c.QueryLatest(bucket, "missing.json")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -3,41 +3,187 @@ package content
 import (
 	"github.com/Sentimentron/repositron/interfaces"
 	"github.com/Sentimentron/repositron/models"
+	"github.com/gorilla/mux"
 	"io"
 	"sync"
 	"sync/atomic"
 )
 
+// usageKey identifies an uploader or a bucket.
+type usageKey struct {
+	scope models.QuotaScope
+	name  string
+}
+
+// usageKeys returns the uploader and bucket which a blob counts against.
+func usageKeys(b *models.Blob) []usageKey {
+	return []usageKey{{models.QuotaUploader, b.Uploader}, {models.QuotaBucket, b.Bucket}}
+}
+
 // AccountingContentStore wraps another ContentStore, but adds tracking so that
-// you can determine how much is stored there.
+// you can determine how much is stored there, and by whom. Writes which would
+// take an uploader or a bucket over its quota are cut off.
 type AccountingContentStore struct {
-	store  interfaces.EstimatableContentStore
+	store  interfaces.ContentStore
+	quotas interfaces.QuotaStore
 	lock   sync.Mutex
 	stored int64
+	// pending counts the bytes being written for each uploader and bucket,
+	// which the quota store can't know about until they're finalized.
+	pending map[usageKey]int64
+	// staged holds how much each blob's staged content changed stored by,
+	// so that it can be taken off again if it's discarded.
+	staged map[int64]int64
 }
 
-// CreateAccountingBlobStore returns a new AccountingBlobStore.
+// CreateAccountingContentStore returns a new AccountingContentStore.
 //
 // To track the amount of content stored, it needs to know how much is already
-// present in the store, so it uses a contentStores's EstimateSizeOfManagedContent
+// present in the store, so it uses the metadata store's EstimateSizeOfManagedContent
 // method to work that out. If an error occurs whilst calling this method,
 // the size estimate is set to zero and the error is returned, alongside a
 // functioning AccountingContentStore.
-func CreateAccountingContentStore(underlyingStore interfaces.EstimatableContentStore) (*AccountingContentStore, error) {
+func CreateAccountingContentStore(underlyingStore interfaces.ContentStore, metadataStore interfaces.MetadataStore) (*AccountingContentStore, error) {
 
 	// Estimate the size of the content using the metadata store.
-	storedSizeEstimate, err := underlyingStore.EstimateSizeOfManagedContent()
+	storedSizeEstimate, err := metadataStore.EstimateSizeOfManagedContent()
 	if err != nil {
 		storedSizeEstimate = 0
 	}
 
 	return &AccountingContentStore{
-		store:  underlyingStore,
-		lock:   sync.Mutex{},
-		stored: storedSizeEstimate,
+		store:   underlyingStore,
+		quotas:  metadataStore,
+		lock:    sync.Mutex{},
+		stored:  storedSizeEstimate,
+		pending: make(map[usageKey]int64),
+		staged:  make(map[int64]int64),
 	}, err
 }
 
+// addPending records that delta more bytes are being written for each key.
+func (a *AccountingContentStore) addPending(keys []usageKey, delta int64) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for _, k := range keys {
+		a.pending[k] += delta
+		if a.pending[k] == 0 {
+			delete(a.pending, k)
+		}
+	}
+}
+
+// pendingFor returns the bytes being written for a key.
+func (a *AccountingContentStore) pendingFor(k usageKey) int64 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.pending[k]
+}
+
+// RetrieveUsage returns how much an uploader or bucket is storing, including
+// anything being written right now, and its quota.
+func (a *AccountingContentStore) RetrieveUsage(scope models.QuotaScope, name string) (*models.QuotaUsage, error) {
+	usage, err := a.quotas.RetrieveUsage(scope, name)
+	if err != nil {
+		return nil, err
+	}
+	usage.Bytes += a.pendingFor(usageKey{scope, name})
+	usage.Quota, err = a.quotas.RetrieveQuota(scope, name)
+	return usage, err
+}
+
+// CheckQuotas returns a *models.QuotaExceededError if storing another size
+// bytes in count more blobs would exceed the quota of b's uploader or bucket.
+func (a *AccountingContentStore) CheckQuotas(b *models.Blob, size int64, count int64) error {
+	for _, k := range usageKeys(b) {
+		usage, err := a.RetrieveUsage(k.scope, k.name)
+		if err != nil {
+			return err
+		}
+		if usage.Quota != nil && usage.Quota.Exceeds(usage.Bytes+size, usage.Blobs+count) {
+			return &models.QuotaExceededError{Quota: usage.Quota, Name: k.name}
+		}
+	}
+	return nil
+}
+
+// meteredLimit is a quota which a write is being checked against.
+type meteredLimit struct {
+	key   usageKey
+	quota *models.Quota
+	// stored is how much was stored before the write started, leaving out
+	// anything the write replaces.
+	stored int64
+}
+
+// meteredReader counts the bytes read through it as pending against a blob's
+// uploader and bucket, and fails as soon as either goes over its quota.
+type meteredReader struct {
+	r        io.Reader
+	a        *AccountingContentStore
+	keys     []usageKey
+	limits   []meteredLimit
+	read     int64
+	exceeded error
+}
+
+// meter wraps a reader which is about to be written to a blob. replaced is
+// the number of bytes which the write discards. The returned reader must be
+// released once the write is over.
+func (a *AccountingContentStore) meter(b *models.Blob, r io.Reader, replaced int64) (*meteredReader, error) {
+	ret := &meteredReader{r: r, a: a, keys: usageKeys(b)}
+	for _, k := range ret.keys {
+		quota, err := a.quotas.RetrieveQuota(k.scope, k.name)
+		if err != nil {
+			return nil, err
+		} else if quota == nil || quota.MaxBytes == 0 {
+			continue
+		}
+		usage, err := a.quotas.RetrieveUsage(k.scope, k.name)
+		if err != nil {
+			return nil, err
+		}
+		ret.limits = append(ret.limits, meteredLimit{k, quota, usage.Bytes - replaced})
+	}
+	return ret, nil
+}
+
+func (m *meteredReader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	if n > 0 {
+		m.a.addPending(m.keys, int64(n))
+		m.read += int64(n)
+		for _, l := range m.limits {
+			if l.stored+m.a.pendingFor(l.key) > l.quota.MaxBytes {
+				m.exceeded = &models.QuotaExceededError{Quota: l.quota, Name: l.key.name}
+				return n, m.exceeded
+			}
+		}
+	}
+	return n, err
+}
+
+// release stops counting what was read as pending.
+func (m *meteredReader) release() {
+	m.a.addPending(m.keys, -m.read)
+}
+
+// write runs a write through a metered reader, reporting the quota which was
+// exceeded if it was cut off.
+func (a *AccountingContentStore) write(b *models.Blob, r io.Reader, replaced int64, write func(io.Reader) (*models.Blob, error)) (*models.Blob, error) {
+	metered, err := a.meter(b, r, replaced)
+	if err != nil {
+		return nil, err
+	}
+	defer metered.release()
+
+	written, err := write(metered)
+	if metered.exceeded != nil {
+		return nil, metered.exceeded
+	}
+	return written, err
+}
+
 // ContainsBlob returns whether the wrapped store contains this item.
 func (a *AccountingContentStore) ContainsBlob(b *models.Blob) (bool, error) {
 	return a.store.ContainsBlob(b)
@@ -59,7 +205,9 @@ func (a *AccountingContentStore) DeleteBlobContent(b *models.Blob) error {
 
 // WriteBlobContent replaces or overwites the content of a given blob.
 func (a *AccountingContentStore) WriteBlobContent(b *models.Blob, r io.Reader) (*models.Blob, error) {
-	written, err := a.store.WriteBlobContent(b, r)
+	written, err := a.write(b, r, b.Size, func(metered io.Reader) (*models.Blob, error) {
+		return a.store.WriteBlobContent(b, metered)
+	})
 	if err != nil {
 		return written, err
 	}
@@ -69,10 +217,67 @@ func (a *AccountingContentStore) WriteBlobContent(b *models.Blob, r io.Reader) (
 	return written, nil
 }
 
+// StageBlobContent stages new content for a blob in the underlying store. It's
+// counted as though it had replaced the blob's current content.
+func (a *AccountingContentStore) StageBlobContent(b *models.Blob, r io.Reader) (*models.Blob, error) {
+	staging, ok := a.store.(interfaces.StagingContentStore)
+	if !ok {
+		return nil, interfaces.MethodNotSupportedError
+	}
+	written, err := a.write(b, r, b.Size, func(metered io.Reader) (*models.Blob, error) {
+		return staging.StageBlobContent(b, metered)
+	})
+	if err != nil {
+		return written, err
+	}
+	delta := written.Size - b.Size
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	atomic.AddInt64(&a.stored, delta-a.staged[b.Id])
+	a.staged[b.Id] = delta
+	return written, nil
+}
+
+// CommitStagedContent swaps in a blob's staged content in the underlying store.
+func (a *AccountingContentStore) CommitStagedContent(b *models.Blob) error {
+	staging, ok := a.store.(interfaces.StagingContentStore)
+	if !ok {
+		return interfaces.MethodNotSupportedError
+	}
+	err := staging.CommitStagedContent(b)
+	if err != nil {
+		return err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.staged, b.Id)
+	return nil
+}
+
+// DiscardStagedContent removes a blob's staged content from the underlying
+// store, and stops counting it.
+func (a *AccountingContentStore) DiscardStagedContent(b *models.Blob) error {
+	staging, ok := a.store.(interfaces.StagingContentStore)
+	if !ok {
+		return interfaces.MethodNotSupportedError
+	}
+	err := staging.DiscardStagedContent(b)
+	if err != nil {
+		return err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	atomic.AddInt64(&a.stored, -a.staged[b.Id])
+	delete(a.staged, b.Id)
+	return nil
+}
+
 // AppendBlobContent appends content to a given Blob, if possible.
 func (a *AccountingContentStore) AppendBlobContent(b *models.Blob, r io.Reader) (*models.Blob, error) {
 	// Do the underlying store thing
-	written, err := a.store.AppendBlobContent(b, r)
+	written, err := a.write(b, r, 0, func(metered io.Reader) (*models.Blob, error) {
+		return a.store.AppendBlobContent(b, metered)
+	})
 	if err != nil {
 		return written, err
 	}
@@ -82,7 +287,9 @@ func (a *AccountingContentStore) AppendBlobContent(b *models.Blob, r io.Reader)
 
 // InsertBlobContent inserts content at an arbitrary offset.
 func (a *AccountingContentStore) InsertBlobContent(b *models.Blob, position int64, r io.Reader) (*models.Blob, error) {
-	written, err := a.store.InsertBlobContent(b, position, r)
+	written, err := a.write(b, r, 0, func(metered io.Reader) (*models.Blob, error) {
+		return a.store.InsertBlobContent(b, position, metered)
+	})
 	if err != nil {
 		return written, err
 	}
@@ -92,9 +299,34 @@ func (a *AccountingContentStore) InsertBlobContent(b *models.Blob, position int6
 	return written, nil
 }
 
+// CopyBlobContent overwrites dst with the content of src. Copies have their
+// quotas checked when they're described, since their size is known up front.
+func (a *AccountingContentStore) CopyBlobContent(src *models.Blob, dst *models.Blob) (*models.Blob, error) {
+	written, err := CopyBlobContent(a.store, src, dst)
+	if err != nil {
+		return written, err
+	}
+	atomic.AddInt64(&a.stored, written.Size-dst.Size)
+	return written, nil
+}
+
+// TruncateBlobContent cuts a blob's content short in the underlying store.
+func (a *AccountingContentStore) TruncateBlobContent(b *models.Blob, size int64) error {
+	truncatable, ok := a.store.(interfaces.TruncatableContentStore)
+	if !ok {
+		return interfaces.MethodNotSupportedError
+	}
+	err := truncatable.TruncateBlobContent(b, size)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&a.stored, size-b.Size)
+	return nil
+}
+
 // RetrieveURLForBlobContent retrieves a URL from the underlying store.
-func (a *AccountingContentStore) RetrieveURLForBlobContent(b *models.Blob) (string, error) {
-	return a.RetrieveURLForBlobContent(b)
+func (a *AccountingContentStore) RetrieveURLForBlobContent(b *models.Blob, scope *models.URLScope, r *mux.Router) (string, error) {
+	return a.store.RetrieveURLForBlobContent(b, scope, r)
 }
 
 // RetrieveBlobContent retrieves the content of a Blob.
@@ -102,7 +334,25 @@ func (a *AccountingContentStore) RetrieveBlobContent(m *models.Blob, w io.Writer
 	return a.store.RetrieveBlobContent(m, w)
 }
 
-// EstimatedSizeOfManagedContent - return the estimate.
-func (a *AccountingContentStore) EstimatedSizeOfManagedContent() (int64, error) {
-	return a.stored, nil
+// EstimateSizeOfManagedContent - return the estimate.
+func (a *AccountingContentStore) EstimateSizeOfManagedContent() (int64, error) {
+	return atomic.LoadInt64(&a.stored), nil
+}
+
+// CheckWritable checks that the underlying store can be written to.
+func (a *AccountingContentStore) CheckWritable() error {
+	checkable, ok := a.store.(interfaces.CheckableContentStore)
+	if !ok {
+		return interfaces.MethodNotSupportedError
+	}
+	return checkable.CheckWritable()
+}
+
+// FreeSpace returns the space left in the underlying store.
+func (a *AccountingContentStore) FreeSpace() (int64, error) {
+	checkable, ok := a.store.(interfaces.CheckableContentStore)
+	if !ok {
+		return 0, interfaces.MethodNotSupportedError
+	}
+	return checkable.FreeSpace()
 }
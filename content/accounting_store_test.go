@@ -0,0 +1,143 @@
+package content
+
+import (
+	"github.com/Sentimentron/repositron/database"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountingContentStore(t *testing.T) {
+	Convey("Given a blob in an accounting store...", t, func() {
+
+		metadataStore, err := database.CreateStore(":memory:")
+		So(err, ShouldBeNil)
+		diskStore := getStoreForTesting()
+		blob := storeBlobForTesting(metadataStore, diskStore, "some content")
+
+		store, err := CreateAccountingContentStore(diskStore, metadataStore)
+		So(err, ShouldBeNil)
+		estimate, err := store.EstimateSizeOfManagedContent()
+		So(err, ShouldBeNil)
+		So(estimate, ShouldEqual, len("some content"))
+
+		Convey("Should report usage without any quotas...", func() {
+			usage, err := store.RetrieveUsage(models.QuotaUploader, "alice")
+			So(err, ShouldBeNil)
+			So(usage.Bytes, ShouldEqual, len("some content"))
+			So(usage.Blobs, ShouldEqual, 1)
+			So(usage.Quota, ShouldBeNil)
+
+			So(store.CheckQuotas(blob, 1000000, 100), ShouldBeNil)
+		})
+
+		Convey("Should refuse blobs which would go over a bucket's quota...", func() {
+			_, err := metadataStore.SetQuota(&models.Quota{Scope: models.QuotaBucket, Name: "bucket", MaxBlobs: 1})
+			So(err, ShouldBeNil)
+
+			other := &models.Blob{Bucket: "bucket", Uploader: "bob"}
+			err = store.CheckQuotas(other, 0, 1)
+			So(err, ShouldNotBeNil)
+			exceeded, ok := err.(*models.QuotaExceededError)
+			So(ok, ShouldBeTrue)
+			So(exceeded.Name, ShouldEqual, "bucket")
+
+			other.Bucket = "elsewhere"
+			So(store.CheckQuotas(other, 0, 1), ShouldBeNil)
+		})
+
+		Convey("Given a quota on the uploader...", func() {
+			_, err := metadataStore.SetQuota(&models.Quota{Scope: models.QuotaUploader, Name: "alice", MaxBytes: 20})
+			So(err, ShouldBeNil)
+
+			Convey("Should refuse content declared too large...", func() {
+				err := store.CheckQuotas(blob, 9, 0)
+				So(err, ShouldHaveSameTypeAs, &models.QuotaExceededError{})
+				So(store.CheckQuotas(blob, 8, 0), ShouldBeNil)
+			})
+
+			Convey("Should allow appends which fit...", func() {
+				written, err := store.AppendBlobContent(blob, strings.NewReader(" and"))
+				So(err, ShouldBeNil)
+				So(written.Size, ShouldEqual, len("some content and"))
+			})
+
+			Convey("Should cut off appends which don't fit...", func() {
+				_, err := store.AppendBlobContent(blob, strings.NewReader(" and much, much more"))
+				So(err, ShouldHaveSameTypeAs, &models.QuotaExceededError{})
+
+				// Nothing should be left pending
+				usage, err := store.RetrieveUsage(models.QuotaUploader, "alice")
+				So(err, ShouldBeNil)
+				So(usage.Bytes, ShouldEqual, len("some content"))
+				So(usage.Quota.MaxBytes, ShouldEqual, 20)
+			})
+
+			Convey("Should only count what a write replaces once...", func() {
+				written, err := store.WriteBlobContent(blob, strings.NewReader(strings.Repeat("x", 20)))
+				So(err, ShouldBeNil)
+				So(written.Size, ShouldEqual, 20)
+
+				_, err = store.WriteBlobContent(blob, strings.NewReader(strings.Repeat("x", 21)))
+				So(err, ShouldHaveSameTypeAs, &models.QuotaExceededError{})
+			})
+		})
+
+		Convey("Should keep track of deleted content...", func() {
+			err := store.DeleteBlobContent(blob)
+			So(err, ShouldBeNil)
+			estimate, err := store.EstimateSizeOfManagedContent()
+			So(err, ShouldBeNil)
+			So(estimate, ShouldEqual, 0)
+		})
+
+		Convey("Should keep track of staged content...", func() {
+			_, err := store.StageBlobContent(blob, strings.NewReader("other"))
+			So(err, ShouldBeNil)
+			estimate, err := store.EstimateSizeOfManagedContent()
+			So(err, ShouldBeNil)
+			So(estimate, ShouldEqual, len("other"))
+
+			Convey("Should stop counting it once it's discarded...", func() {
+				So(store.DiscardStagedContent(blob), ShouldBeNil)
+				estimate, err := store.EstimateSizeOfManagedContent()
+				So(err, ShouldBeNil)
+				So(estimate, ShouldEqual, len("some content"))
+			})
+
+			Convey("Should keep counting it once it's committed...", func() {
+				So(store.CommitStagedContent(blob), ShouldBeNil)
+				So(store.DiscardStagedContent(blob), ShouldBeNil)
+				estimate, err := store.EstimateSizeOfManagedContent()
+				So(err, ShouldBeNil)
+				So(estimate, ShouldEqual, len("other"))
+			})
+		})
+
+		Convey("Should keep track of content which is written at the same time...", func() {
+			_, err := metadataStore.SetQuota(&models.Quota{Scope: models.QuotaBucket, Name: "bucket", MaxBytes: 100})
+			So(err, ShouldBeNil)
+
+			other, err := metadataStore.StoreBlobRecord(&models.Blob{
+				Name: "other", Bucket: "bucket", Date: time.Now(), Class: models.PermanentBlob,
+				Uploader: "bob", Metadata: models.MetadataMap{},
+			})
+			So(err, ShouldBeNil)
+			metered, err := store.meter(other, strings.NewReader(strings.Repeat("y", 50)), 0)
+			So(err, ShouldBeNil)
+			buf := make([]byte, 50)
+			_, err = metered.Read(buf)
+			So(err, ShouldBeNil)
+
+			usage, err := store.RetrieveUsage(models.QuotaBucket, "bucket")
+			So(err, ShouldBeNil)
+			So(usage.Bytes, ShouldEqual, len("some content")+50)
+			So(store.CheckQuotas(blob, 40, 0), ShouldHaveSameTypeAs, &models.QuotaExceededError{})
+
+			metered.release()
+			So(store.CheckQuotas(blob, 40, 0), ShouldBeNil)
+		})
+	})
+}
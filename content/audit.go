@@ -0,0 +1,92 @@
+package content
+
+import (
+	"fmt"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	"net/http"
+)
+
+// AuditTrail records changes to blobs in the audit log, against whoever
+// made them, and publishes the events which the changes cause.
+type AuditTrail struct {
+	store   interfaces.AuditStore
+	actor   string
+	address string
+}
+
+// CreateAuditTrail records changes against an actor, made from an address
+// (which is empty for changes the server makes itself).
+func CreateAuditTrail(store interfaces.AuditStore, actor string, address string) *AuditTrail {
+	return &AuditTrail{store, actor, address}
+}
+
+// RequestAuditTrail records changes against a request's principal and the
+// address it came from.
+func RequestAuditTrail(store interfaces.AuditStore, r *http.Request) *AuditTrail {
+	return CreateAuditTrail(store, utils.RequestPrincipal(r), utils.RequestAddress(r))
+}
+
+// eventsForChange returns the events which a change to a blob publishes.
+func eventsForChange(action models.AuditAction, before *models.Blob, after *models.Blob) []models.EventType {
+	switch action {
+	case models.AuditCreate:
+		// Copies are created with their content
+		if after.Checksum != "" {
+			return []models.EventType{models.BlobCreated, models.BlobFinalized}
+		}
+		return []models.EventType{models.BlobCreated}
+	case models.AuditWrite:
+		return []models.EventType{models.BlobFinalized}
+	case models.AuditAppend:
+		return []models.EventType{models.BlobAppended}
+	case models.AuditDelete:
+		return []models.EventType{models.BlobDeleted}
+	case models.AuditPurge:
+		// Blobs purged from the trash were deleted when they went in
+		if before.Deleted == nil {
+			return []models.EventType{models.BlobDeleted}
+		}
+	}
+	return nil
+}
+
+// AuditedChanges changes blobs inside a transaction, recording each change
+// in the audit log and publishing its events alongside it.
+type AuditedChanges struct {
+	interfaces.BlobChanges
+	trail *AuditTrail
+}
+
+// Record notes a change to a blob, given how it looked before and after.
+// before is nil if the blob was just created, and after is nil if it was
+// deleted. If the entry can't be recorded or its events can't be published,
+// the change should be abandoned.
+func (c *AuditedChanges) Record(action models.AuditAction, before *models.Blob, after *models.Blob) error {
+	entry := models.NewAuditEntry(c.trail.actor, c.trail.address, action, before, after)
+	err := c.RecordAuditEntry(entry)
+	if err != nil {
+		return fmt.Errorf("failed to record %s of blob %d: %w", action, entry.Blob, err)
+	}
+
+	blob := after
+	if blob == nil {
+		blob = before
+	}
+	for _, t := range eventsForChange(action, before, after) {
+		err = c.PublishEvent(&models.Event{Type: t, Date: entry.Date, Blob: blob})
+		if err != nil {
+			return fmt.Errorf("failed to publish %s for blob %d: %w", t, entry.Blob, err)
+		}
+	}
+	return nil
+}
+
+// Change calls fn to change blobs inside a transaction, which is only
+// committed if fn and everything it records succeed.
+func (a *AuditTrail) Change(fn func(tx *AuditedChanges) error) error {
+	return a.store.ChangeBlobs(func(changes interfaces.BlobChanges) error {
+		return fn(&AuditedChanges{BlobChanges: changes, trail: a})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/metrics"
 	"github.com/Sentimentron/repositron/models"
 	"github.com/gorilla/mux"
 	"io"
@@ -15,6 +16,10 @@ import (
 
 var NotCachedError = errors.New("not in cache")
 
+// cacheRequests counts reads from the cache, by whether the content was there.
+var cacheRequests = metrics.NewCounterVec("repositron_content_cache_requests_total",
+	"Reads from the buffered content store, by whether they were served from its cache.", "result")
+
 type BufferedRequestType int
 
 type cacheRecord struct {
@@ -86,10 +91,9 @@ func (r *ReadHeavyBufferedContentStore) InsertBlobContent(m *models.Blob, pos in
 	return r.underlyingStore.InsertBlobContent(m, pos, ri)
 }
 
-// RetrieveURLForBlobContent update the last accessed time and generates a link.
-func (r *ReadHeavyBufferedContentStore) RetrieveURLForBlobContent(m *models.Blob, route *mux.Router) (string, error) {
-	// TODO: fix me
-	return "", nil
+// RetrieveURLForBlobContent generates a link from the underlying store.
+func (r *ReadHeavyBufferedContentStore) RetrieveURLForBlobContent(m *models.Blob, scope *models.URLScope, route *mux.Router) (string, error) {
+	return r.underlyingStore.RetrieveURLForBlobContent(m, scope, route)
 }
 
 // RetrieveBlobContent updates the last accessed time and generates a link.
@@ -111,7 +115,10 @@ func (r *ReadHeavyBufferedContentStore) RetrieveBlobContent(m *models.Blob, w io
 	}
 
 	read, err := checkCacheForContent()
-	if err == NotCachedError {
+	if err == nil {
+		cacheRequests.With("hit").Inc()
+	} else if err == NotCachedError {
+		cacheRequests.With("miss").Inc()
 		newReader := &bytes.Buffer{}
 		read, err = r.underlyingStore.RetrieveBlobContent(m, newReader)
 		if err == nil {
@@ -0,0 +1,27 @@
+package content
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"io"
+)
+
+// CopyBlobContent makes the content of dst identical to src. Stores which
+// implement interfaces.CopyableContentStore do this themselves, otherwise the
+// content is streamed out of src and back into dst.
+func CopyBlobContent(store interfaces.ContentStore, src *models.Blob, dst *models.Blob) (*models.Blob, error) {
+	if copyable, ok := store.(interfaces.CopyableContentStore); ok {
+		return copyable.CopyBlobContent(src, dst)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		_, err := store.RetrieveBlobContent(src, w)
+		w.CloseWithError(err)
+	}()
+
+	written, err := store.WriteBlobContent(dst, r)
+	// Unblock the reader if the write stopped early
+	r.CloseWithError(io.ErrClosedPipe)
+	return written, err
+}
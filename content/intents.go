@@ -0,0 +1,223 @@
+package content
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"log"
+	"os"
+)
+
+// retrieveIntentBlob finds the blob an intent refers to, whether or not it's in the trash.
+func retrieveIntentBlob(metadataStore interfaces.MetadataStore, id int64) (*models.Blob, error) {
+	blob, err := metadataStore.RetrieveBlobById(id)
+	if err == interfaces.NoMatchingBlobsError {
+		blob, err = metadataStore.RetrieveTrashedBlob(id)
+	}
+	return blob, err
+}
+
+// deleteBlobContent removes a blob's content, if there is any.
+func deleteBlobContent(contentStore interfaces.ContentStore, blob *models.Blob) error {
+	err := contentStore.DeleteBlobContent(blob)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// contentMatchesRecord checks whether a blob's content has the size and
+// checksum its record says it should.
+func contentMatchesRecord(contentStore interfaces.ContentStore, blob *models.Blob) (bool, error) {
+	if blob.Checksum == "" {
+		return false, nil
+	}
+	h := sha256.New()
+	size, err := contentStore.RetrieveBlobContent(blob, h)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return size == blob.Size && fmt.Sprintf("%x", h.Sum(nil)) == blob.Checksum, nil
+}
+
+// resolveStagedUpload throws away an upload's staged content, unless the
+// blob's record was finalized before it could be swapped in, in which case
+// it's swapped in now.
+func resolveStagedUpload(contentStore interfaces.ContentStore, blob *models.Blob) error {
+	consistent, err := contentMatchesRecord(contentStore, blob)
+	if err != nil {
+		return err
+	}
+	if !consistent && blob.Checksum != "" {
+		err = CommitStagedContent(contentStore, blob)
+		if err == nil || !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return DiscardStagedContent(contentStore, blob)
+}
+
+// ResolveIntent brings a blob whose content operation didn't finish back into
+// line with its record. Purges are finished off, and so are appends whose
+// content was written but whose checksum wasn't, and uploads whose record
+// was finalized but whose staged content wasn't swapped in. Other staged
+// uploads are thrown away. Otherwise, content which doesn't match the blob's
+// record is rolled back: appends are truncated where possible, copies are
+// removed, and anything else has to be uploaded again.
+func ResolveIntent(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, intent *models.Intent) error {
+
+	blob, err := retrieveIntentBlob(metadataStore, intent.BlobId)
+	if err == interfaces.NoMatchingBlobsError {
+		// Content without a record can't be reached, so remove it
+		orphan := &models.Blob{Id: intent.BlobId}
+		err = DiscardStagedContent(contentStore, orphan)
+		if err != nil {
+			return err
+		}
+		return deleteBlobContent(contentStore, orphan)
+	} else if err != nil {
+		return err
+	}
+
+	switch intent.Operation {
+	case models.IntentPurge:
+		err = deleteBlobContent(contentStore, blob)
+		if err != nil {
+			return err
+		}
+		return metadataStore.DeleteBlobById(blob.Id)
+
+	case models.IntentCopy:
+		consistent, err := contentMatchesRecord(contentStore, blob)
+		if err != nil || consistent {
+			return err
+		}
+		err = deleteBlobContent(contentStore, blob)
+		if err != nil {
+			return err
+		}
+		return metadataStore.DeleteBlobById(blob.Id)
+	}
+
+	// The content was written, but its checksum wasn't: finish the job
+	if blob.Checksum == models.RecalculatingChecksum {
+		h := sha256.New()
+		blob.Size, err = contentStore.RetrieveBlobContent(blob, h)
+		if err != nil {
+			return err
+		}
+		blob.Checksum = fmt.Sprintf("%x", h.Sum(nil))
+		_, err = metadataStore.FinalizeBlobRecord(blob)
+		return err
+	}
+
+	if intent.Operation == models.IntentUpload {
+		err = resolveStagedUpload(contentStore, blob)
+		if err != nil {
+			return err
+		}
+	}
+
+	consistent, err := contentMatchesRecord(contentStore, blob)
+	if err != nil || consistent {
+		return err
+	}
+
+	// Cut off whatever was appended
+	if truncatable, ok := contentStore.(interfaces.TruncatableContentStore); ok && intent.Operation == models.IntentAppend && blob.Checksum != "" {
+		err = truncatable.TruncateBlobContent(blob, blob.Size)
+		if err == nil {
+			consistent, err = contentMatchesRecord(contentStore, blob)
+		}
+		if err != nil || consistent {
+			return err
+		}
+	}
+
+	// Otherwise, the content can't be trusted
+	err = deleteBlobContent(contentStore, blob)
+	if err != nil || blob.Checksum == "" {
+		return err
+	}
+	return metadataStore.MarkBlobIncomplete(blob.Id)
+}
+
+// FinishIntent completes an intent once its operation has succeeded, or
+// resolves it straight away if it failed. Intents which can't be resolved
+// are left for RecoverIntents.
+func FinishIntent(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, intent *models.Intent, succeeded bool) {
+	if !succeeded {
+		err := ResolveIntent(metadataStore, contentStore, intent)
+		if err != nil {
+			log.Printf("FinishIntent: unable to resolve %s of blob %d: %v", intent.Operation, intent.BlobId, err)
+			return
+		}
+	}
+	err := metadataStore.CompleteIntent(intent.Id)
+	if err != nil {
+		log.Printf("FinishIntent: %v", err)
+	}
+}
+
+// RecoverIntents resolves every intent left over from operations which were
+// interrupted, e.g. by a crash, returning how many were resolved. Intents
+// which can't be resolved are logged and left for next time.
+func RecoverIntents(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore) (int, error) {
+	intents, err := metadataStore.ListIntents()
+	if err != nil {
+		return 0, err
+	}
+
+	resolved := 0
+	for _, intent := range intents {
+		err = ResolveIntent(metadataStore, contentStore, intent)
+		if err == nil {
+			err = metadataStore.CompleteIntent(intent.Id)
+		}
+		if err != nil {
+			log.Printf("RecoverIntents: unable to resolve %s of blob %d: %v", intent.Operation, intent.BlobId, err)
+			continue
+		}
+		resolved++
+	}
+	return resolved, nil
+}
+
+// PurgeBlob removes a blob's content and then its record, unless it's under
+// legal hold or an alias points at it. Content which is already missing (e.g. because the upload never
+// finished) isn't an error. The record is removed along with its entry in the
+// audit trail. If the purge fails part-way through, it's finished off by
+// RecoverIntents.
+func PurgeBlob(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, audit *AuditTrail, blob *models.Blob) error {
+	err := metadataStore.CheckBlobDeletable(blob.Id)
+	if err != nil {
+		return err
+	}
+	err = metadataStore.CheckBlobUnaliased(blob.Id)
+	if err != nil {
+		return err
+	}
+
+	intent, err := metadataStore.RecordIntent(blob.Id, models.IntentPurge)
+	if err != nil {
+		return err
+	}
+	err = deleteBlobContent(contentStore, blob)
+	if err != nil {
+		return err
+	}
+	err = audit.Change(func(tx *AuditedChanges) error {
+		err := tx.DeleteBlobById(blob.Id)
+		if err != nil {
+			return err
+		}
+		return tx.Record(models.AuditPurge, blob, nil)
+	})
+	if err != nil {
+		return err
+	}
+	return metadataStore.CompleteIntent(intent.Id)
+}
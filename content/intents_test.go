@@ -0,0 +1,199 @@
+package content
+
+import (
+	"bytes"
+	"github.com/Sentimentron/repositron/database"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/Sentimentron/repositron/utils"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeBlobForTesting writes a complete blob into both stores.
+func storeBlobForTesting(metadataStore *database.Store, contentStore *FileSystemContentStore, content string) *models.Blob {
+	blob, err := metadataStore.StoreBlobRecord(&models.Blob{
+		Name:     "blob",
+		Bucket:   "bucket",
+		Date:     time.Now(),
+		Class:    models.PermanentBlob,
+		Uploader: "alice",
+		Metadata: models.MetadataMap{},
+	})
+	So(err, ShouldBeNil)
+
+	_, err = contentStore.WriteBlobContent(blob, strings.NewReader(content))
+	So(err, ShouldBeNil)
+	blob.Size = int64(len(content))
+	blob.Checksum = utils.ComputeSHA256Checksum(strings.NewReader(content))
+	blob, err = metadataStore.FinalizeBlobRecord(blob)
+	So(err, ShouldBeNil)
+	return blob
+}
+
+func TestRecoverIntents(t *testing.T) {
+	Convey("Given a blob with some content...", t, func() {
+
+		metadataStore, err := database.CreateStore(":memory:")
+		So(err, ShouldBeNil)
+		contentStore := getStoreForTesting()
+		blob := storeBlobForTesting(metadataStore, contentStore, "some content")
+
+		recover := func() {
+			recovered, err := RecoverIntents(metadataStore, contentStore)
+			So(err, ShouldBeNil)
+			So(recovered, ShouldEqual, 1)
+
+			intents, err := metadataStore.ListIntents()
+			So(err, ShouldBeNil)
+			So(len(intents), ShouldEqual, 0)
+		}
+
+		Convey("An interrupted append should be cut off...", func() {
+			_, err := metadataStore.RecordIntent(blob.Id, models.IntentAppend)
+			So(err, ShouldBeNil)
+			_, err = contentStore.AppendBlobContent(blob, strings.NewReader(" and more"))
+			So(err, ShouldBeNil)
+
+			recover()
+
+			buf := new(bytes.Buffer)
+			_, err = contentStore.RetrieveBlobContent(blob, buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "some content")
+
+			b, err := metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			So(b.Checksum, ShouldEqual, blob.Checksum)
+		})
+
+		Convey("An append interrupted before its checksum should be finished off...", func() {
+			_, err := metadataStore.RecordIntent(blob.Id, models.IntentAppend)
+			So(err, ShouldBeNil)
+			_, err = contentStore.AppendBlobContent(blob, strings.NewReader(" and more"))
+			So(err, ShouldBeNil)
+			b := *blob
+			b.Checksum = models.RecalculatingChecksum
+			_, err = metadataStore.FinalizeBlobRecord(&b)
+			So(err, ShouldBeNil)
+
+			recover()
+
+			updated, err := metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			So(updated.Size, ShouldEqual, len("some content and more"))
+			So(updated.Checksum, ShouldEqual, utils.ComputeSHA256Checksum(strings.NewReader("some content and more")))
+		})
+
+		Convey("An interrupted upload should have to be uploaded again...", func() {
+			_, err := metadataStore.RecordIntent(blob.Id, models.IntentUpload)
+			So(err, ShouldBeNil)
+			_, err = contentStore.WriteBlobContent(blob, strings.NewReader("other"))
+			So(err, ShouldBeNil)
+
+			recover()
+
+			_, err = contentStore.RetrieveBlobContent(blob, new(bytes.Buffer))
+			So(os.IsNotExist(err), ShouldBeTrue)
+
+			b, err := metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			So(b.Checksum, ShouldEqual, "")
+		})
+
+		Convey("A staged upload which failed should leave the content alone...", func() {
+			_, err := metadataStore.RecordIntent(blob.Id, models.IntentUpload)
+			So(err, ShouldBeNil)
+			_, err = contentStore.StageBlobContent(blob, strings.NewReader("other"))
+			So(err, ShouldBeNil)
+
+			recover()
+
+			buf := new(bytes.Buffer)
+			_, err = contentStore.RetrieveBlobContent(blob, buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "some content")
+			So(contentStore.CommitStagedContent(blob), ShouldNotBeNil)
+
+			b, err := metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			So(b.Checksum, ShouldEqual, blob.Checksum)
+		})
+
+		Convey("A staged upload whose record was finalized should be swapped in...", func() {
+			_, err := metadataStore.RecordIntent(blob.Id, models.IntentUpload)
+			So(err, ShouldBeNil)
+			staged, err := contentStore.StageBlobContent(blob, strings.NewReader("other"))
+			So(err, ShouldBeNil)
+			staged.Checksum = utils.ComputeSHA256Checksum(strings.NewReader("other"))
+			_, err = metadataStore.FinalizeBlobRecord(staged)
+			So(err, ShouldBeNil)
+
+			recover()
+
+			buf := new(bytes.Buffer)
+			_, err = contentStore.RetrieveBlobContent(blob, buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "other")
+
+			b, err := metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			So(b.Checksum, ShouldEqual, staged.Checksum)
+		})
+
+		Convey("A completed upload should be left alone...", func() {
+			_, err := metadataStore.RecordIntent(blob.Id, models.IntentUpload)
+			So(err, ShouldBeNil)
+
+			recover()
+
+			b, err := metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			So(b.Checksum, ShouldEqual, blob.Checksum)
+		})
+
+		Convey("An interrupted purge should be finished off...", func() {
+			_, err := metadataStore.RecordIntent(blob.Id, models.IntentPurge)
+			So(err, ShouldBeNil)
+
+			recover()
+
+			_, err = metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+			_, err = contentStore.RetrieveBlobContent(blob, new(bytes.Buffer))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("Should not purge a blob which an alias points at...", func() {
+			_, err := metadataStore.SetAlias("blob/stable", blob.Id, nil)
+			So(err, ShouldBeNil)
+
+			err = PurgeBlob(metadataStore, contentStore, CreateAuditTrail(metadataStore, models.TrashActor, ""), blob)
+			So(err, ShouldEqual, interfaces.BlobAliasedError)
+
+			_, err = metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			_, err = contentStore.RetrieveBlobContent(blob, new(bytes.Buffer))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Should be able to purge a blob...", func() {
+			err := PurgeBlob(metadataStore, contentStore, CreateAuditTrail(metadataStore, models.TrashActor, ""), blob)
+			So(err, ShouldBeNil)
+
+			_, err = metadataStore.RetrieveBlobById(blob.Id)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+			intents, err := metadataStore.ListIntents()
+			So(err, ShouldBeNil)
+			So(len(intents), ShouldEqual, 0)
+
+			page, err := metadataStore.ListAuditEntries(&models.AuditQuery{Blob: &blob.Id, Limit: 10})
+			So(err, ShouldBeNil)
+			So(len(page.Entries), ShouldEqual, 1)
+			So(page.Entries[0].Action, ShouldEqual, models.AuditPurge)
+		})
+	})
+}
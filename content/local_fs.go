@@ -8,6 +8,7 @@ import (
 	"github.com/Sentimentron/repositron/utils"
 	"github.com/gorilla/mux"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 )
@@ -15,6 +16,9 @@ import (
 // FileSystemContentStore lives in a local directory on this machine.
 type FileSystemContentStore struct {
 	PrefixPath string
+	// Signer signs the URLs handed out for content. Without one, no URLs
+	// can be handed out.
+	Signer *URLSigner
 }
 
 func CreateStore(staticDir string) (*FileSystemContentStore, error) {
@@ -22,7 +26,7 @@ func CreateStore(staticDir string) (*FileSystemContentStore, error) {
 		return nil, interfaces.BlobContentConfigError
 	}
 
-	return &FileSystemContentStore{staticDir}, nil
+	return &FileSystemContentStore{PrefixPath: staticDir}, nil
 }
 
 func (s *FileSystemContentStore) getPathForId(id int64) (string, error) {
@@ -32,18 +36,31 @@ func (s *FileSystemContentStore) getPathForId(id int64) (string, error) {
 	return path.Join(s.PrefixPath, fmt.Sprintf("%d", id)), nil
 }
 
-func (s *FileSystemContentStore) RetrieveURLForBlobContent(m *models.Blob, r *mux.Router) (string, error) {
-	url, err := r.Get("static").URL()
-	return fmt.Sprintf("%s/%d", url, m.Id), err
+// RetrieveURLForBlobContent signs a link to the SignedContent route, which
+// serves content from this store.
+func (s *FileSystemContentStore) RetrieveURLForBlobContent(m *models.Blob, scope *models.URLScope, r *mux.Router) (string, error) {
+	if s.Signer == nil {
+		return "", interfaces.MethodNotSupportedError
+	}
+	url, err := r.Get("SignedContent").URLPath("id", fmt.Sprintf("%d", m.Id))
+	if err != nil {
+		return "", err
+	}
+	return s.Signer.SignURL(url.String(), scope), nil
 }
 
-func (s *FileSystemContentStore) WriteBlobContent(m *models.Blob, r io.Reader) (*models.Blob, error) {
-
-	// Generate filesystem path
-	p, err := s.getPathForId(m.Id)
+// getStagingPathForId returns where content is staged for a blob. Its name
+// can't be mistaken for a blob's, since those are only digits.
+func (s *FileSystemContentStore) getStagingPathForId(id int64) (string, error) {
+	p, err := s.getPathForId(id)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return p + ".staging", nil
+}
+
+// writeFile creates or overwrites the file at p with a blob's content.
+func writeFile(p string, m *models.Blob, r io.Reader) (*models.Blob, error) {
 
 	// Open the file on disk
 	f, err := os.Create(p)
@@ -64,6 +81,56 @@ func (s *FileSystemContentStore) WriteBlobContent(m *models.Blob, r io.Reader) (
 	return &ret, err
 }
 
+func (s *FileSystemContentStore) WriteBlobContent(m *models.Blob, r io.Reader) (*models.Blob, error) {
+
+	// Generate filesystem path
+	p, err := s.getPathForId(m.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeFile(p, m, r)
+}
+
+// StageBlobContent writes a blob's new content into a file next to its
+// current one.
+func (s *FileSystemContentStore) StageBlobContent(m *models.Blob, r io.Reader) (*models.Blob, error) {
+	p, err := s.getStagingPathForId(m.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return writeFile(p, m, r)
+}
+
+// CommitStagedContent renames a blob's staged file over its current one.
+func (s *FileSystemContentStore) CommitStagedContent(m *models.Blob) error {
+	staged, err := s.getStagingPathForId(m.Id)
+	if err != nil {
+		return err
+	}
+	p, err := s.getPathForId(m.Id)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(staged, p)
+}
+
+// DiscardStagedContent removes a blob's staged file, if there is one.
+func (s *FileSystemContentStore) DiscardStagedContent(m *models.Blob) error {
+	p, err := s.getStagingPathForId(m.Id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
 func (s *FileSystemContentStore) DeleteBlobContent(m *models.Blob) error {
 	p, err := s.getPathForId(m.Id)
 	if err != nil {
@@ -193,3 +260,84 @@ func (s *FileSystemContentStore) RetrieveBlobContent(m *models.Blob, w io.Writer
 	defer f.Close()
 	return io.Copy(w, f)
 }
+
+// CopyBlobContent duplicates a blob's file. Where the filesystem supports it,
+// the copy is a reflink which shares storage with the original until either is
+// changed. Hard links aren't used, since content can be appended to later.
+func (s *FileSystemContentStore) CopyBlobContent(src *models.Blob, dst *models.Blob) (*models.Blob, error) {
+
+	// Generate filesystem paths
+	srcPath, err := s.getPathForId(src.Id)
+	if err != nil {
+		return nil, err
+	}
+	dstPath, err := s.getPathForId(dst.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	in, err := os.Open(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dstPath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	// Fall back to copying the bytes if the filesystem can't clone them
+	var written int64
+	if err = reflink(out, in); err == nil {
+		info, err := out.Stat()
+		if err != nil {
+			return nil, err
+		}
+		written = info.Size()
+	} else {
+		written, err = io.Copy(out, in)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ret := *dst
+	ret.Size = written
+	return &ret, nil
+}
+
+// TruncateBlobContent cuts a blob's file down to a given size.
+func (s *FileSystemContentStore) TruncateBlobContent(m *models.Blob, size int64) error {
+	p, err := s.getPathForId(m.Id)
+	if err != nil {
+		return err
+	}
+	return os.Truncate(p, size)
+}
+
+// CheckWritable creates and removes a file in the store's directory. Its name
+// can't be mistaken for a blob's, since those are only digits.
+func (s *FileSystemContentStore) CheckWritable() error {
+	f, err := ioutil.TempFile(s.PrefixPath, ".healthcheck-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write([]byte("ok"))
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// FreeSpace returns the space left on the filesystem holding the store's directory.
+func (s *FileSystemContentStore) FreeSpace() (int64, error) {
+	return freeSpace(s.PrefixPath)
+}
@@ -0,0 +1,29 @@
+package content
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl, which shares the extents of one file with another.
+const ficlone = 0x40049409
+
+// reflink makes dst a copy-on-write clone of src, on filesystems which support it.
+func reflink(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// freeSpace returns how many bytes an unprivileged user can still write to
+// the filesystem containing path.
+func freeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	err := syscall.Statfs(path, &stat)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package content
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/interfaces"
+	"os"
+)
+
+// reflink isn't supported outside of Linux, so content is always copied.
+func reflink(dst, src *os.File) error {
+	return errors.New("reflink not supported on this platform")
+}
+
+// freeSpace isn't supported outside of Linux.
+func freeSpace(path string) (int64, error) {
+	return 0, interfaces.MethodNotSupportedError
+}
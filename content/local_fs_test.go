@@ -201,3 +201,111 @@ func TestFileSystemContentStore_AppendBlobContent(t *testing.T) {
 		})
 	})
 }
+
+func TestFileSystemContentStore_CopyBlobContent(t *testing.T) {
+	Convey("Should be able to copy content within the store...", t, func() {
+		store := getStoreForTesting()
+		src := &models.Blob{Id: 1}
+		dst := &models.Blob{Id: 2}
+
+		_, err := store.WriteBlobContent(src, strings.NewReader("some content"))
+		So(err, ShouldBeNil)
+
+		copied, err := CopyBlobContent(store, src, dst)
+		So(err, ShouldBeNil)
+		So(copied.Id, ShouldEqual, 2)
+		So(copied.Size, ShouldEqual, len("some content"))
+
+		var buf bytes.Buffer
+		_, err = store.RetrieveBlobContent(dst, &buf)
+		So(err, ShouldBeNil)
+		So(buf.String(), ShouldEqual, "some content")
+
+		Convey("And the copy should be independent of the original...", func() {
+			_, err := store.AppendBlobContent(dst, strings.NewReader(" and more"))
+			So(err, ShouldBeNil)
+
+			var buf bytes.Buffer
+			_, err = store.RetrieveBlobContent(src, &buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "some content")
+		})
+
+		Convey("Should also be able to stream a copy...", func() {
+			// Hide CopyBlobContent so that the generic fallback is used
+			generic := struct{ interfaces.ContentStore }{store}
+			copied, err := CopyBlobContent(generic, src, &models.Blob{Id: 3})
+			So(err, ShouldBeNil)
+			So(copied.Size, ShouldEqual, len("some content"))
+
+			var buf bytes.Buffer
+			_, err = store.RetrieveBlobContent(copied, &buf)
+			So(err, ShouldBeNil)
+			So(buf.String(), ShouldEqual, "some content")
+		})
+	})
+}
+
+func TestFileSystemContentStore_StageBlobContent(t *testing.T) {
+	Convey("Given a blob with some content...", t, func() {
+		store := getStoreForTesting()
+		blob := &models.Blob{Id: 1}
+
+		_, err := store.WriteBlobContent(blob, strings.NewReader("some content"))
+		So(err, ShouldBeNil)
+
+		staged, err := store.StageBlobContent(blob, strings.NewReader("other"))
+		So(err, ShouldBeNil)
+		So(staged.Size, ShouldEqual, len("other"))
+
+		read := func() string {
+			var buf bytes.Buffer
+			_, err := store.RetrieveBlobContent(blob, &buf)
+			So(err, ShouldBeNil)
+			return buf.String()
+		}
+
+		Convey("Staged content shouldn't replace the content yet...", func() {
+			So(read(), ShouldEqual, "some content")
+		})
+
+		Convey("Should replace the content once it's committed...", func() {
+			So(store.CommitStagedContent(blob), ShouldBeNil)
+			So(read(), ShouldEqual, "other")
+			So(store.DiscardStagedContent(blob), ShouldBeNil)
+		})
+
+		Convey("Should leave the content alone once it's discarded...", func() {
+			So(store.DiscardStagedContent(blob), ShouldBeNil)
+			So(store.CommitStagedContent(blob), ShouldNotBeNil)
+			So(read(), ShouldEqual, "some content")
+		})
+	})
+}
+
+func TestFileSystemContentStore_Health(t *testing.T) {
+	Convey("Given a FileSystemContentStore...", t, func() {
+		store := getStoreForTesting()
+
+		Convey("Should be writable, leaving nothing behind...", func() {
+			So(store.CheckWritable(), ShouldBeNil)
+			files, err := ioutil.ReadDir(store.PrefixPath)
+			So(err, ShouldBeNil)
+			So(files, ShouldBeEmpty)
+		})
+
+		Convey("Should report some free space...", func() {
+			free, err := store.FreeSpace()
+			if err == interfaces.MethodNotSupportedError {
+				return
+			}
+			So(err, ShouldBeNil)
+			So(free, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("Should fail when its directory is gone...", func() {
+			So(os.RemoveAll(store.PrefixPath), ShouldBeNil)
+			So(store.CheckWritable(), ShouldNotBeNil)
+		})
+	})
+}
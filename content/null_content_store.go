@@ -32,7 +32,7 @@ func (n *NullContentStore) InsertBlobContent(*models.Blob, int64, io.Reader) (*m
 	return nil, nil
 }
 
-func (n *NullContentStore) RetrieveURLForBlobContent(*models.Blob, *mux.Router) (string, error) {
+func (n *NullContentStore) RetrieveURLForBlobContent(*models.Blob, *models.URLScope, *mux.Router) (string, error) {
 	return "", interfaces.MethodNotSupportedError
 }
 
@@ -19,6 +19,7 @@ func TestNullContentStore_ConformsToInterface(t *testing.T) {
 
 		Convey("Should be able to create it...", func() {
 			contentStore = new(NullContentStore)
+			So(contentStore, ShouldNotBeNil)
 		})
 
 	})
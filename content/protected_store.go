@@ -0,0 +1,157 @@
+package content
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/gorilla/mux"
+	"io"
+)
+
+// ProtectedContentStore wraps another ContentStore, refusing to change the
+// content of write-once blobs or to delete the content of blobs under legal
+// hold. Everything which writes content goes through here, so the API and the
+// UI can't get around it.
+type ProtectedContentStore struct {
+	store      interfaces.ContentStore
+	protection interfaces.ProtectionStore
+}
+
+// CreateProtectedContentStore returns a new ProtectedContentStore, which asks
+// protection whether each blob can be changed.
+func CreateProtectedContentStore(underlyingStore interfaces.ContentStore, protection interfaces.ProtectionStore) *ProtectedContentStore {
+	return &ProtectedContentStore{underlyingStore, protection}
+}
+
+// checkModifiable lets the content of blobs without a record be changed,
+// since nothing can have been published yet.
+func (p *ProtectedContentStore) checkModifiable(b *models.Blob) error {
+	err := p.protection.CheckBlobModifiable(b.Id)
+	if err == interfaces.NoMatchingBlobsError {
+		return nil
+	}
+	return err
+}
+
+// ContainsBlob returns whether the wrapped store contains this item.
+func (p *ProtectedContentStore) ContainsBlob(b *models.Blob) (bool, error) {
+	return p.store.ContainsBlob(b)
+}
+
+// DeleteBlobContent removes the content, unless the blob is under legal hold.
+// Content whose record has already gone (e.g. pruned versions) can always be removed.
+func (p *ProtectedContentStore) DeleteBlobContent(b *models.Blob) error {
+	err := p.protection.CheckBlobDeletable(b.Id)
+	if err != nil && err != interfaces.NoMatchingBlobsError {
+		return err
+	}
+	return p.store.DeleteBlobContent(b)
+}
+
+// WriteBlobContent replaces a blob's content, unless it's write-once.
+func (p *ProtectedContentStore) WriteBlobContent(b *models.Blob, r io.Reader) (*models.Blob, error) {
+	err := p.checkModifiable(b)
+	if err != nil {
+		return nil, err
+	}
+	return p.store.WriteBlobContent(b, r)
+}
+
+// AppendBlobContent adds to the end of a blob's content, unless it's write-once.
+func (p *ProtectedContentStore) AppendBlobContent(b *models.Blob, r io.Reader) (*models.Blob, error) {
+	err := p.checkModifiable(b)
+	if err != nil {
+		return nil, err
+	}
+	return p.store.AppendBlobContent(b, r)
+}
+
+// InsertBlobContent inserts content into a blob, unless it's write-once.
+func (p *ProtectedContentStore) InsertBlobContent(b *models.Blob, position int64, r io.Reader) (*models.Blob, error) {
+	err := p.checkModifiable(b)
+	if err != nil {
+		return nil, err
+	}
+	return p.store.InsertBlobContent(b, position, r)
+}
+
+// CopyBlobContent overwrites dst with the content of src, unless dst is write-once.
+func (p *ProtectedContentStore) CopyBlobContent(src *models.Blob, dst *models.Blob) (*models.Blob, error) {
+	err := p.checkModifiable(dst)
+	if err != nil {
+		return nil, err
+	}
+	return CopyBlobContent(p.store, src, dst)
+}
+
+// TruncateBlobContent cuts a blob's content short, unless it's write-once.
+func (p *ProtectedContentStore) TruncateBlobContent(b *models.Blob, size int64) error {
+	truncatable, ok := p.store.(interfaces.TruncatableContentStore)
+	if !ok {
+		return interfaces.MethodNotSupportedError
+	}
+	err := p.checkModifiable(b)
+	if err != nil {
+		return err
+	}
+	return truncatable.TruncateBlobContent(b, size)
+}
+
+// StageBlobContent stages new content for a blob, unless it's write-once.
+func (p *ProtectedContentStore) StageBlobContent(b *models.Blob, r io.Reader) (*models.Blob, error) {
+	staging, ok := p.store.(interfaces.StagingContentStore)
+	if !ok {
+		return nil, interfaces.MethodNotSupportedError
+	}
+	err := p.checkModifiable(b)
+	if err != nil {
+		return nil, err
+	}
+	return staging.StageBlobContent(b, r)
+}
+
+// CommitStagedContent swaps in a blob's staged content. It was checked when
+// it was staged, and the blob may have been finalized since.
+func (p *ProtectedContentStore) CommitStagedContent(b *models.Blob) error {
+	staging, ok := p.store.(interfaces.StagingContentStore)
+	if !ok {
+		return interfaces.MethodNotSupportedError
+	}
+	return staging.CommitStagedContent(b)
+}
+
+// DiscardStagedContent removes a blob's staged content in the underlying store.
+func (p *ProtectedContentStore) DiscardStagedContent(b *models.Blob) error {
+	staging, ok := p.store.(interfaces.StagingContentStore)
+	if !ok {
+		return interfaces.MethodNotSupportedError
+	}
+	return staging.DiscardStagedContent(b)
+}
+
+// RetrieveURLForBlobContent retrieves a URL from the underlying store.
+func (p *ProtectedContentStore) RetrieveURLForBlobContent(b *models.Blob, scope *models.URLScope, r *mux.Router) (string, error) {
+	return p.store.RetrieveURLForBlobContent(b, scope, r)
+}
+
+// RetrieveBlobContent retrieves the content of a Blob.
+func (p *ProtectedContentStore) RetrieveBlobContent(b *models.Blob, w io.Writer) (int64, error) {
+	return p.store.RetrieveBlobContent(b, w)
+}
+
+// CheckWritable checks that the underlying store can be written to.
+func (p *ProtectedContentStore) CheckWritable() error {
+	checkable, ok := p.store.(interfaces.CheckableContentStore)
+	if !ok {
+		return interfaces.MethodNotSupportedError
+	}
+	return checkable.CheckWritable()
+}
+
+// FreeSpace returns the space left in the underlying store.
+func (p *ProtectedContentStore) FreeSpace() (int64, error) {
+	checkable, ok := p.store.(interfaces.CheckableContentStore)
+	if !ok {
+		return 0, interfaces.MethodNotSupportedError
+	}
+	return checkable.FreeSpace()
+}
@@ -0,0 +1,121 @@
+package content
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Sentimentron/repositron/models"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var InvalidSignatureError = errors.New("the url's signature doesn't match")
+var ExpiredSignatureError = errors.New("the url has expired")
+var SigningKeyError = errors.New("the signing key must be at least 32 bytes")
+
+// URLSigner signs URLs with a secret key, so that anyone holding one can do
+// what its scope allows until it expires, without needing an API token.
+type URLSigner struct {
+	key []byte
+}
+
+// CreateURLSigner returns a URLSigner which signs with key.
+func CreateURLSigner(key []byte) (*URLSigner, error) {
+	if len(key) < 32 {
+		return nil, SigningKeyError
+	}
+	return &URLSigner{key}, nil
+}
+
+// LoadURLSigner reads a hex-encoded signing key from a file, generating
+// one if the file doesn't exist yet. URLs signed with the same file stay
+// valid across restarts.
+func LoadURLSigner(path string) (*URLSigner, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key := make([]byte, 32)
+		_, err = rand.Read(key)
+		if err != nil {
+			return nil, err
+		}
+		encoded = []byte(hex.EncodeToString(key))
+		err = ioutil.WriteFile(path, encoded, 0600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := hex.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the signing key in %s: %w", path, err)
+	}
+	return CreateURLSigner(key)
+}
+
+// signature covers everything about a URL which mustn't be changed.
+func (s *URLSigner) signature(path string, method string, expires string, byteRange string) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s", method, path, expires, byteRange)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignURL appends the scope and a signature to a path.
+func (s *URLSigner) SignURL(path string, scope *models.URLScope) string {
+	expires := strconv.FormatInt(scope.Expires.Unix(), 10)
+	byteRange := ""
+	if scope.Range != nil {
+		byteRange = scope.Range.String()
+	}
+
+	params := url.Values{}
+	params.Set("method", scope.Method)
+	params.Set("expires", expires)
+	if byteRange != "" {
+		params.Set("range", byteRange)
+	}
+	params.Set("signature", s.signature(path, scope.Method, expires, byteRange))
+	return path + "?" + params.Encode()
+}
+
+// VerifyRequest checks a request against the URL's signature, and returns
+// what the URL allows. The request has to use the signed method, and arrive
+// before the URL expires.
+func (s *URLSigner) VerifyRequest(r *http.Request, now time.Time) (*models.URLScope, error) {
+	params := r.URL.Query()
+	method := params.Get("method")
+	expires := params.Get("expires")
+	byteRange := params.Get("range")
+
+	expected := s.signature(r.URL.EscapedPath(), method, expires, byteRange)
+	if !hmac.Equal([]byte(expected), []byte(params.Get("signature"))) {
+		return nil, InvalidSignatureError
+	}
+	if method != r.Method {
+		return nil, InvalidSignatureError
+	}
+
+	// Nothing below can have been tampered with
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, InvalidSignatureError
+	}
+	scope := &models.URLScope{Method: method, Expires: time.Unix(unix, 0)}
+	if !now.Before(scope.Expires) {
+		return nil, ExpiredSignatureError
+	}
+	if byteRange != "" {
+		scope.Range, err = models.ParseByteRange(byteRange)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
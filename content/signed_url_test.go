@@ -0,0 +1,104 @@
+package content
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner(t *testing.T) {
+	Convey("Given a URL signer...", t, func() {
+
+		signer, err := CreateURLSigner([]byte(strings.Repeat("k", 32)))
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		scope := &models.URLScope{Method: "GET", Expires: now.Add(time.Minute).Truncate(time.Second)}
+		signed := signer.SignURL("/signed/blobs/1/content", scope)
+
+		Convey("Should accept what it signed...", func() {
+			verified, err := signer.VerifyRequest(httptest.NewRequest("GET", signed, nil), now)
+			So(err, ShouldBeNil)
+			So(verified.Method, ShouldEqual, "GET")
+			So(verified.Expires.Equal(scope.Expires), ShouldBeTrue)
+			So(verified.Range, ShouldBeNil)
+		})
+
+		Convey("Should reject URLs which have expired...", func() {
+			_, err := signer.VerifyRequest(httptest.NewRequest("GET", signed, nil), now.Add(time.Hour))
+			So(err, ShouldEqual, ExpiredSignatureError)
+		})
+
+		Convey("Should reject other methods...", func() {
+			_, err := signer.VerifyRequest(httptest.NewRequest("PUT", signed, nil), now)
+			So(err, ShouldEqual, InvalidSignatureError)
+		})
+
+		Convey("Should reject other blobs...", func() {
+			other := strings.Replace(signed, "/1/", "/2/", 1)
+			_, err := signer.VerifyRequest(httptest.NewRequest("GET", other, nil), now)
+			So(err, ShouldEqual, InvalidSignatureError)
+		})
+
+		Convey("Should reject URLs which have been changed...", func() {
+			extended := strings.Replace(signed, "method=GET", "method=GET&range=0-1", 1)
+			_, err := signer.VerifyRequest(httptest.NewRequest("GET", extended, nil), now)
+			So(err, ShouldEqual, InvalidSignatureError)
+		})
+
+		Convey("Should reject URLs signed with another key...", func() {
+			other, err := CreateURLSigner([]byte(strings.Repeat("o", 32)))
+			So(err, ShouldBeNil)
+			_, err = other.VerifyRequest(httptest.NewRequest("GET", signed, nil), now)
+			So(err, ShouldEqual, InvalidSignatureError)
+		})
+
+		Convey("Should sign byte ranges...", func() {
+			scope.Range = &models.ByteRange{Start: 10, End: 19}
+			signed := signer.SignURL("/signed/blobs/1/content", scope)
+
+			verified, err := signer.VerifyRequest(httptest.NewRequest("GET", signed, nil), now)
+			So(err, ShouldBeNil)
+			So(verified.Range, ShouldResemble, &models.ByteRange{Start: 10, End: 19})
+
+			widened := strings.Replace(signed, "range=10-19", "range=0-19", 1)
+			_, err = signer.VerifyRequest(httptest.NewRequest("GET", widened, nil), now)
+			So(err, ShouldEqual, InvalidSignatureError)
+		})
+
+		Convey("Should refuse short keys...", func() {
+			_, err := CreateURLSigner([]byte("short"))
+			So(err, ShouldEqual, SigningKeyError)
+		})
+	})
+}
+
+func TestLoadURLSigner(t *testing.T) {
+	Convey("Should generate a signing key which is kept...", t, func() {
+
+		tmpDir, err := ioutil.TempDir(os.TempDir(), "repoTest-")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(tmpDir)
+		keyPath := path.Join(tmpDir, "signing.key")
+
+		signer, err := LoadURLSigner(keyPath)
+		So(err, ShouldBeNil)
+		info, err := os.Stat(keyPath)
+		So(err, ShouldBeNil)
+		So(info.Mode().Perm(), ShouldEqual, os.FileMode(0600))
+
+		// URLs should still be valid once the key is loaded again
+		now := time.Now()
+		signed := signer.SignURL("/signed/blobs/1/content", &models.URLScope{Method: "GET", Expires: now.Add(time.Minute)})
+		reloaded, err := LoadURLSigner(keyPath)
+		So(err, ShouldBeNil)
+		_, err = reloaded.VerifyRequest(httptest.NewRequest("GET", signed, nil), now)
+		So(err, ShouldBeNil)
+	})
+}
@@ -0,0 +1,43 @@
+package content
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"io"
+)
+
+// StageBlobContent writes new content for a blob. Stores which implement
+// interfaces.StagingContentStore keep it apart from the blob's current content
+// until CommitStagedContent is called, otherwise it's written straight over.
+func StageBlobContent(store interfaces.ContentStore, blob *models.Blob, r io.Reader) (*models.Blob, error) {
+	if staging, ok := store.(interfaces.StagingContentStore); ok {
+		written, err := staging.StageBlobContent(blob, r)
+		if err != interfaces.MethodNotSupportedError {
+			return written, err
+		}
+	}
+	return store.WriteBlobContent(blob, r)
+}
+
+// CommitStagedContent replaces a blob's content with what StageBlobContent
+// wrote, if that was staged.
+func CommitStagedContent(store interfaces.ContentStore, blob *models.Blob) error {
+	if staging, ok := store.(interfaces.StagingContentStore); ok {
+		err := staging.CommitStagedContent(blob)
+		if err != interfaces.MethodNotSupportedError {
+			return err
+		}
+	}
+	return nil
+}
+
+// DiscardStagedContent throws away whatever was staged for a blob.
+func DiscardStagedContent(store interfaces.ContentStore, blob *models.Blob) error {
+	if staging, ok := store.(interfaces.StagingContentStore); ok {
+		err := staging.DiscardStagedContent(blob)
+		if err != interfaces.MethodNotSupportedError {
+			return err
+		}
+	}
+	return nil
+}
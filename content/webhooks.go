@@ -0,0 +1,89 @@
+package content
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// webhookBatchSize is the most deliveries attempted in one go.
+const webhookBatchSize = 100
+
+// webhookErrorLength is how much of a receiver's response is kept when a
+// delivery fails.
+const webhookErrorLength = 512
+
+// sendWebhook makes a single delivery, returning an error unless the receiver
+// responds with a 2xx status.
+func sendWebhook(client *http.Client, delivery *models.WebhookDelivery, now time.Time) error {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", delivery.Webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(models.WebhookEventHeader, string(delivery.Event.Type))
+	req.Header.Set(models.WebhookDeliveryHeader, strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set(models.WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(models.WebhookSignatureHeader, models.SignWebhookPayload(delivery.Webhook.Secret, timestamp, body))
+
+	response, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		reason, _ := ioutil.ReadAll(io.LimitReader(response.Body, webhookErrorLength))
+		return fmt.Errorf("receiver responded with %d: %s", response.StatusCode, reason)
+	}
+	return nil
+}
+
+// DeliverWebhooks makes every delivery in the outbox which is due, returning
+// how many succeeded. Failed deliveries are retried with exponential backoff,
+// until they've been tried MaxWebhookAttempts times.
+func DeliverWebhooks(store interfaces.EventStore, client *http.Client, now time.Time) (int, error) {
+	deliveries, err := store.ListDueDeliveries(now, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, d := range deliveries {
+		err = sendWebhook(client, d, now)
+		if err == nil {
+			err = store.CompleteDelivery(d.Id)
+			if err != nil {
+				return delivered, err
+			}
+			delivered++
+			continue
+		}
+
+		attempts := d.Attempts + 1
+		if attempts >= models.MaxWebhookAttempts {
+			log.Printf("DeliverWebhooks: giving up on delivery %d to %s: %v", d.Id, d.Webhook.URL, err)
+			err = store.AbandonDelivery(d.Id, err.Error())
+		} else {
+			err = store.RetryDelivery(d.Id, now.Add(models.WebhookRetryDelay(attempts)), err.Error())
+		}
+		if err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
@@ -0,0 +1,130 @@
+package content
+
+import (
+	"encoding/json"
+	"github.com/Sentimentron/repositron/database"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// receivedWebhook is a delivery seen by the test receiver.
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	Convey("Given a webhook pointing at a local receiver...", t, func() {
+
+		status := http.StatusOK
+		received := make([]receivedWebhook, 0)
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received = append(received, receivedWebhook{r.Header, body})
+			w.WriteHeader(status)
+		}))
+		defer receiver.Close()
+
+		metadataStore, err := database.CreateStore(":memory:")
+		So(err, ShouldBeNil)
+		webhook, err := metadataStore.CreateWebhook(&models.Webhook{URL: receiver.URL, Secret: "shh"})
+		So(err, ShouldBeNil)
+
+		trail := CreateAuditTrail(metadataStore, "alice", "")
+		blob := &models.Blob{Id: 1, Name: "blob", Bucket: "bucket", Checksum: "abc"}
+		err = trail.Change(func(tx *AuditedChanges) error {
+			return tx.Record(models.AuditCreate, nil, blob)
+		})
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		client := &http.Client{Timeout: time.Second}
+
+		Convey("Should deliver signed events...", func() {
+			delivered, err := DeliverWebhooks(metadataStore, client, now)
+			So(err, ShouldBeNil)
+			So(delivered, ShouldEqual, 2)
+			So(received, ShouldHaveLength, 2)
+
+			for i, eventType := range []models.EventType{models.BlobCreated, models.BlobFinalized} {
+				header := received[i].header
+				So(header.Get(models.WebhookEventHeader), ShouldEqual, string(eventType))
+				timestamp, err := strconv.ParseInt(header.Get(models.WebhookTimestampHeader), 10, 64)
+				So(err, ShouldBeNil)
+				So(header.Get(models.WebhookSignatureHeader), ShouldEqual, models.SignWebhookPayload("shh", timestamp, received[i].body))
+
+				event := &models.Event{}
+				So(json.Unmarshal(received[i].body, event), ShouldBeNil)
+				So(event.Type, ShouldEqual, eventType)
+				So(event.Blob.Name, ShouldEqual, "blob")
+			}
+
+			delivered, err = DeliverWebhooks(metadataStore, client, now)
+			So(err, ShouldBeNil)
+			So(delivered, ShouldEqual, 0)
+		})
+
+		Convey("Should retry failed deliveries with backoff...", func() {
+			status = http.StatusInternalServerError
+			delivered, err := DeliverWebhooks(metadataStore, client, now)
+			So(err, ShouldBeNil)
+			So(delivered, ShouldEqual, 0)
+			So(received, ShouldHaveLength, 2)
+
+			// Nothing's due until the first retry delay has passed
+			delivered, err = DeliverWebhooks(metadataStore, client, now)
+			So(err, ShouldBeNil)
+			So(received, ShouldHaveLength, 2)
+
+			status = http.StatusOK
+			delivered, err = DeliverWebhooks(metadataStore, client, now.Add(models.WebhookRetryDelay(1)))
+			So(err, ShouldBeNil)
+			So(delivered, ShouldEqual, 2)
+			So(received, ShouldHaveLength, 4)
+		})
+
+		Convey("Should give up after too many attempts...", func() {
+			status = http.StatusInternalServerError
+			at := now
+			for i := 1; i <= models.MaxWebhookAttempts; i++ {
+				_, err := DeliverWebhooks(metadataStore, client, at)
+				So(err, ShouldBeNil)
+				at = at.Add(models.WebhookRetryDelay(i))
+			}
+			So(received, ShouldHaveLength, 2*models.MaxWebhookAttempts)
+
+			due, err := metadataStore.ListDueDeliveries(at.Add(24*time.Hour), 10)
+			So(err, ShouldBeNil)
+			So(due, ShouldBeEmpty)
+		})
+
+		Convey("Should only deliver the events a webhook wants...", func() {
+			So(metadataStore.DeleteWebhook(webhook.Id), ShouldBeNil)
+			_, err := metadataStore.CreateWebhook(&models.Webhook{
+				URL:    receiver.URL,
+				Events: models.EventTypeList{models.BlobDeleted},
+			})
+			So(err, ShouldBeNil)
+
+			err = trail.Change(func(tx *AuditedChanges) error {
+				err := tx.Record(models.AuditWrite, blob, blob)
+				if err != nil {
+					return err
+				}
+				return tx.Record(models.AuditDelete, blob, blob)
+			})
+			So(err, ShouldBeNil)
+			// These events were published after now
+			delivered, err := DeliverWebhooks(metadataStore, client, time.Now())
+			So(err, ShouldBeNil)
+			So(delivered, ShouldEqual, 1)
+			So(received[0].header.Get(models.WebhookEventHeader), ShouldEqual, string(models.BlobDeleted))
+		})
+	})
+}
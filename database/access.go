@@ -0,0 +1,241 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const grantColumns = `bucket, user_name, group_name, permission`
+
+// administratorSql counts whether the principal (?) is in the admin group.
+const administratorSql = `SELECT COUNT(*) FROM group_members WHERE name = '` + models.AdminGroup + `' AND member = ?`
+
+// grantCondition matches grants of p (or a permission which implies it) to
+// the principal given twice as arguments, directly or through a group.
+func grantCondition(p models.Permission) string {
+	permissions := make([]string, 0)
+	for _, permission := range models.PermissionsImplying(p) {
+		permissions = append(permissions, "'"+string(permission)+"'")
+	}
+	return `permission IN (` + strings.Join(permissions, ", ") + `) AND (
+		user_name = ? OR group_name = '` + models.EveryoneGroup + `' OR
+		group_name IN (SELECT name FROM group_members WHERE member = ?))`
+}
+
+// readableBlobsCondition restricts a query on blobs to those in buckets
+// which a principal can read, returning the condition and its arguments.
+func readableBlobsCondition(principal string) (string, []interface{}) {
+	return `(bucket IN (SELECT bucket FROM grants WHERE ` + grantCondition(models.PermissionRead) + `) OR
+		(` + administratorSql + `) > 0)`, []interface{}{principal, principal, principal}
+}
+
+// applyDefaultGrants copies the default grants onto a new bucket. Grants to
+// models.CreatorUser go to its creator, if there is one. Must be called with
+// the lock held.
+func applyDefaultGrants(e sqlx.Execer, bucket, creator string) error {
+	_, err := e.Exec(`
+		INSERT OR IGNORE INTO grants (`+grantColumns+`)
+		SELECT ?, CASE WHEN user_name = ? THEN ? ELSE user_name END, group_name, permission
+		FROM default_grants
+		WHERE user_name <> ? OR ? <> ''
+	`, bucket, models.CreatorUser, creator, models.CreatorUser, creator)
+	return err
+}
+
+func isAdministrator(q sqlx.Queryer, principal string) (bool, error) {
+	count := 0
+	err := sqlx.Get(q, &count, administratorSql, principal)
+	return count > 0, err
+}
+
+// IsAdministrator reports whether a principal is in the admin group.
+func (s *Store) IsAdministrator(principal string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return isAdministrator(s.handle, principal)
+}
+
+// CheckPermission returns AccessDeniedError unless a principal can do
+// something to a bucket. Only admins can do anything to a bucket which
+// doesn't exist yet, so that nobody can claim another's bucket before it's
+// created.
+func (s *Store) CheckPermission(principal, bucket string, permission models.Permission) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	admin, err := isAdministrator(s.handle, principal)
+	if err != nil || admin {
+		return err
+	}
+
+	count := 0
+	err = s.handle.Get(&count, `SELECT COUNT(*) FROM buckets WHERE name = ?`, bucket)
+	if err != nil {
+		return err
+	} else if count == 0 {
+		return interfaces.NoSuchBucketError
+	}
+
+	err = s.handle.Get(&count, `SELECT COUNT(*) FROM grants WHERE bucket = ? AND `+grantCondition(permission), bucket, principal, principal)
+	if err != nil {
+		return err
+	} else if count == 0 {
+		return interfaces.AccessDeniedError
+	}
+	return nil
+}
+
+// ListGrants returns the grants on a bucket.
+func (s *Store) ListGrants(bucket string) ([]*models.Grant, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.retrieveBucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*models.Grant, 0)
+	err = s.handle.Select(&ret, `
+		SELECT `+grantColumns+` FROM grants WHERE bucket = ?
+		ORDER BY group_name, user_name, permission`, bucket)
+	return ret, err
+}
+
+// SetGrants replaces the grants on a bucket.
+func (s *Store) SetGrants(bucket string, grants []*models.Grant) ([]*models.Grant, error) {
+	for _, grant := range grants {
+		err := grant.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.lock.Lock()
+	_, err := s.retrieveBucket(bucket)
+	if err != nil {
+		s.lock.Unlock()
+		return nil, err
+	}
+	err = replaceGrants(s.handle, bucket, grants)
+	s.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.ListGrants(bucket)
+}
+
+// replaceGrants swaps the grants on a bucket (or, if bucket is empty, the
+// default grants) in a single transaction. Must be called with the lock held.
+func replaceGrants(db *sqlx.DB, bucket string, grants []*models.Grant) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if bucket == "" {
+		_, err = tx.Exec(`DELETE FROM default_grants`)
+	} else {
+		_, err = tx.Exec(`DELETE FROM grants WHERE bucket = ?`, bucket)
+	}
+	if err != nil {
+		return err
+	}
+	for _, grant := range grants {
+		if bucket == "" {
+			_, err = tx.Exec(`INSERT OR IGNORE INTO default_grants (user_name, group_name, permission) VALUES (?, ?, ?)`,
+				grant.User, grant.Group, grant.Permission)
+		} else {
+			_, err = tx.Exec(`INSERT OR IGNORE INTO grants (`+grantColumns+`) VALUES (?, ?, ?, ?)`,
+				bucket, grant.User, grant.Group, grant.Permission)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ListDefaultGrants returns the grants copied onto new buckets.
+func (s *Store) ListDefaultGrants() ([]*models.Grant, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Grant, 0)
+	err := s.handle.Select(&ret, `
+		SELECT user_name, group_name, permission FROM default_grants
+		ORDER BY group_name, user_name, permission`)
+	return ret, err
+}
+
+// SetDefaultGrants replaces the grants copied onto new buckets.
+func (s *Store) SetDefaultGrants(grants []*models.Grant) ([]*models.Grant, error) {
+	for _, grant := range grants {
+		err := grant.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.lock.Lock()
+	err := replaceGrants(s.handle, "", grants)
+	s.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return s.ListDefaultGrants()
+}
+
+// ListGroups returns the name of every group with at least one member.
+func (s *Store) ListGroups() ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]string, 0)
+	err := s.handle.Select(&ret, `SELECT DISTINCT name FROM group_members ORDER BY name`)
+	return ret, err
+}
+
+// ListGroupMembers returns the members of a group.
+func (s *Store) ListGroupMembers(group string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]string, 0)
+	err := s.handle.Select(&ret, `SELECT member FROM group_members WHERE name = ? ORDER BY member`, group)
+	return ret, err
+}
+
+// AddGroupMember adds a principal to a group.
+func (s *Store) AddGroupMember(group, member string) error {
+	if group == "" || group == models.EveryoneGroup || member == "" {
+		return interfaces.InvalidGroupError
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.handle.Exec(`INSERT OR IGNORE INTO group_members (name, member) VALUES (?, ?)`, group, member)
+	return err
+}
+
+// RemoveGroupMember removes a principal from a group.
+func (s *Store) RemoveGroupMember(group, member string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result, err := s.handle.Exec(`DELETE FROM group_members WHERE name = ? AND member = ?`, group, member)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return interfaces.NoSuchGroupMemberError
+	}
+	return nil
+}
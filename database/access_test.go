@@ -0,0 +1,153 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Access(t *testing.T) {
+	Convey("Given a bucket created by alice...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		insertBlobForTesting(handle, "secret", "private", "alice", models.PermanentBlob, 10, time.Now())
+
+		Convey("Its creator should be its admin...", func() {
+			grants, err := handle.ListGrants("private")
+			So(err, ShouldBeNil)
+			So(grants, ShouldResemble, []*models.Grant{{Bucket: "private", User: "alice", Permission: models.PermissionAdmin}})
+
+			So(handle.CheckPermission("alice", "private", models.PermissionRead), ShouldBeNil)
+			So(handle.CheckPermission("alice", "private", models.PermissionDelete), ShouldBeNil)
+			So(handle.CheckPermission("bob", "private", models.PermissionRead), ShouldEqual, interfaces.AccessDeniedError)
+		})
+
+		Convey("Nobody but admins should have permissions on buckets which don't exist yet...", func() {
+			So(handle.CheckPermission("bob", "new", models.PermissionWrite), ShouldEqual, interfaces.NoSuchBucketError)
+			So(handle.CheckPermission("bob", "new", models.PermissionAdmin), ShouldEqual, interfaces.NoSuchBucketError)
+
+			err := handle.AddGroupMember(models.AdminGroup, "carol")
+			So(err, ShouldBeNil)
+			So(handle.CheckPermission("carol", "new", models.PermissionAdmin), ShouldBeNil)
+		})
+
+		Convey("Should be able to grant permissions to users...", func() {
+			_, err := handle.SetGrants("private", []*models.Grant{
+				{User: "alice", Permission: models.PermissionAdmin},
+				{User: "bob", Permission: models.PermissionWrite},
+			})
+			So(err, ShouldBeNil)
+
+			So(handle.CheckPermission("bob", "private", models.PermissionWrite), ShouldBeNil)
+			So(handle.CheckPermission("bob", "private", models.PermissionAppend), ShouldBeNil)
+			So(handle.CheckPermission("bob", "private", models.PermissionRead), ShouldEqual, interfaces.AccessDeniedError)
+			So(handle.CheckPermission("bob", "private", models.PermissionDelete), ShouldEqual, interfaces.AccessDeniedError)
+		})
+
+		Convey("Should be able to grant permissions to groups...", func() {
+			_, err := handle.SetGrants("private", []*models.Grant{{Group: "readers", Permission: models.PermissionRead}})
+			So(err, ShouldBeNil)
+			So(handle.CheckPermission("bob", "private", models.PermissionRead), ShouldEqual, interfaces.AccessDeniedError)
+
+			err = handle.AddGroupMember("readers", "bob")
+			So(err, ShouldBeNil)
+			So(handle.CheckPermission("bob", "private", models.PermissionRead), ShouldBeNil)
+
+			members, err := handle.ListGroupMembers("readers")
+			So(err, ShouldBeNil)
+			So(members, ShouldResemble, []string{"bob"})
+			groups, err := handle.ListGroups()
+			So(err, ShouldBeNil)
+			So(groups, ShouldResemble, []string{"readers"})
+
+			err = handle.RemoveGroupMember("readers", "bob")
+			So(err, ShouldBeNil)
+			So(handle.CheckPermission("bob", "private", models.PermissionRead), ShouldEqual, interfaces.AccessDeniedError)
+			err = handle.RemoveGroupMember("readers", "bob")
+			So(err, ShouldEqual, interfaces.NoSuchGroupMemberError)
+		})
+
+		Convey("Everyone should be in the '*' group...", func() {
+			_, err := handle.SetGrants("private", []*models.Grant{{Group: models.EveryoneGroup, Permission: models.PermissionRead}})
+			So(err, ShouldBeNil)
+			So(handle.CheckPermission("carol", "private", models.PermissionRead), ShouldBeNil)
+
+			err = handle.AddGroupMember(models.EveryoneGroup, "carol")
+			So(err, ShouldEqual, interfaces.InvalidGroupError)
+		})
+
+		Convey("Administrators should be able to do anything...", func() {
+			err := handle.AddGroupMember(models.AdminGroup, "root")
+			So(err, ShouldBeNil)
+
+			admin, err := handle.IsAdministrator("root")
+			So(err, ShouldBeNil)
+			So(admin, ShouldBeTrue)
+			So(handle.CheckPermission("root", "private", models.PermissionAdmin), ShouldBeNil)
+		})
+
+		Convey("Should not be able to store invalid grants...", func() {
+			_, err := handle.SetGrants("private", []*models.Grant{{Permission: models.PermissionRead}})
+			So(err, ShouldEqual, models.InvalidGranteeError)
+			_, err = handle.SetGrants("private", []*models.Grant{{User: "bob", Permission: "everything"}})
+			So(err, ShouldNotBeNil)
+			_, err = handle.SetGrants("missing", []*models.Grant{})
+			So(err, ShouldEqual, interfaces.NoSuchBucketError)
+		})
+
+		Convey("New buckets should get the default grants...", func() {
+			_, err := handle.SetDefaultGrants([]*models.Grant{
+				{User: models.CreatorUser, Permission: models.PermissionWrite},
+				{Group: "auditors", Permission: models.PermissionRead},
+			})
+			So(err, ShouldBeNil)
+
+			_, err = handle.CreateBucket(&models.Bucket{Name: "shared"}, "bob")
+			So(err, ShouldBeNil)
+			grants, err := handle.ListGrants("shared")
+			So(err, ShouldBeNil)
+			So(grants, ShouldResemble, []*models.Grant{
+				{Bucket: "shared", User: "bob", Permission: models.PermissionWrite},
+				{Bucket: "shared", Group: "auditors", Permission: models.PermissionRead},
+			})
+
+			// Grants to the creator are dropped if nobody created the bucket
+			_, err = handle.CreateBucket(&models.Bucket{Name: "anonymous"}, "")
+			So(err, ShouldBeNil)
+			grants, err = handle.ListGrants("anonymous")
+			So(err, ShouldBeNil)
+			So(len(grants), ShouldEqual, 1)
+			So(grants[0].Group, ShouldEqual, "auditors")
+		})
+
+		Convey("Deleting a bucket should remove its grants...", func() {
+			_, err := handle.CreateBucket(&models.Bucket{Name: "empty"}, "alice")
+			So(err, ShouldBeNil)
+			err = handle.DeleteBucket("empty")
+			So(err, ShouldBeNil)
+			_, err = handle.CreateBucket(&models.Bucket{Name: "empty"}, "bob")
+			So(err, ShouldBeNil)
+			So(handle.CheckPermission("alice", "empty", models.PermissionRead), ShouldEqual, interfaces.AccessDeniedError)
+		})
+
+		Convey("Searches should only match buckets which can be read...", func() {
+			insertBlobForTesting(handle, "public", "open", "bob", models.PermanentBlob, 10, time.Now())
+
+			bob := "bob"
+			page, err := handle.ListBlobs(&models.BlobSearch{VisibleTo: &bob}, &models.PageRequest{Limit: 10})
+			So(err, ShouldBeNil)
+			So(page.Total, ShouldEqual, 1)
+			So(page.Blobs[0].Name, ShouldEqual, "public")
+
+			err = handle.AddGroupMember(models.AdminGroup, "bob")
+			So(err, ShouldBeNil)
+			page, err = handle.ListBlobs(&models.BlobSearch{VisibleTo: &bob}, &models.PageRequest{Limit: 10})
+			So(err, ShouldBeNil)
+			So(page.Total, ShouldEqual, 2)
+		})
+	})
+}
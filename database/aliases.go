@@ -0,0 +1,150 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+)
+
+// unaliasedBlobsCondition excludes blobs which an alias points at.
+const unaliasedBlobsCondition = `id NOT IN (SELECT blob FROM aliases)`
+
+// SetAlias points an alias at a blob, creating the alias if needed. The
+// comparison with expected and the change happen in one transaction.
+func (s *Store) SetAlias(name string, blobId int64, expected *int64) (*models.Alias, error) {
+	err := models.ValidateAliasName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, err := s.handle.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Aliases can only point at blobs which exist
+	count := 0
+	err = tx.Get(&count, "SELECT COUNT(*) FROM blobs WHERE id = ? AND "+liveBlobsCondition, blobId)
+	if err != nil {
+		return nil, err
+	} else if count == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	}
+
+	var previous *int64
+	var current int64
+	err = tx.Get(&current, "SELECT blob FROM aliases WHERE name = ?", name)
+	if err == nil {
+		previous = &current
+	} else if err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if expected != nil {
+		if (previous == nil && *expected != 0) || (previous != nil && *previous != *expected) {
+			return nil, interfaces.AliasConflictError
+		}
+	}
+
+	alias := models.Alias{Name: name, BlobId: blobId, Updated: time.Now()}
+	_, err = tx.NamedExec(`
+		INSERT INTO aliases (name, blob, updated) VALUES (:name, :blob, :updated)
+		ON CONFLICT(name) DO UPDATE SET blob = excluded.blob, updated = excluded.updated
+	`, &alias)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO alias_history (alias, previous, blob, date) VALUES (?, ?, ?, ?)`,
+		name, previous, blobId, alias.Updated)
+	if err != nil {
+		return nil, err
+	}
+
+	return &alias, tx.Commit()
+}
+
+// ResolveAlias returns the blob an alias points at.
+func (s *Store) ResolveAlias(name string) (*models.Alias, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]models.Alias, 0)
+	err := s.handle.Select(&ret, "SELECT name, blob, updated FROM aliases WHERE name = ?", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoSuchAliasError
+	}
+	return &ret[0], nil
+}
+
+// ListAliases returns every alias, ordered by name.
+func (s *Store) ListAliases() ([]*models.Alias, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Alias, 0)
+	err := s.handle.Select(&ret, "SELECT name, blob, updated FROM aliases ORDER BY name")
+	return ret, err
+}
+
+// AliasHistory returns every change made to an alias, newest first.
+func (s *Store) AliasHistory(name string) ([]*models.AliasChange, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.AliasChange, 0)
+	err := s.handle.Select(&ret, `
+		SELECT alias, previous, blob, date FROM alias_history
+		WHERE alias = ? ORDER BY id DESC`, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoSuchAliasError
+	}
+	return ret, nil
+}
+
+// DeleteAlias removes an alias and its history.
+func (s *Store) DeleteAlias(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result, err := s.handle.Exec("DELETE FROM aliases WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return interfaces.NoSuchAliasError
+	}
+
+	_, err = s.handle.Exec("DELETE FROM alias_history WHERE alias = ?", name)
+	return err
+}
+
+// CheckBlobUnaliased returns BlobAliasedError if an alias points at a blob.
+func (s *Store) CheckBlobUnaliased(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+	err := s.handle.Get(&count, "SELECT COUNT(*) FROM aliases WHERE blob = ?", id)
+	if err != nil {
+		return err
+	} else if count > 0 {
+		return interfaces.BlobAliasedError
+	}
+	return nil
+}
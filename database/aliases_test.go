@@ -0,0 +1,103 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Aliases(t *testing.T) {
+	Convey("Given a store with some blobs...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		b1 := insertBlobForTesting(handle, "myapp-1.0", "releases", "alice", models.PermanentBlob, 10, now)
+		b2 := insertBlobForTesting(handle, "myapp-1.1", "releases", "alice", models.PermanentBlob, 10, now)
+
+		Convey("Should be able to create an alias...", func() {
+			alias, err := handle.SetAlias("myapp/stable", b1.Id, nil)
+			So(err, ShouldBeNil)
+			So(alias.BlobId, ShouldEqual, b1.Id)
+
+			resolved, err := handle.ResolveAlias("myapp/stable")
+			So(err, ShouldBeNil)
+			So(resolved.BlobId, ShouldEqual, b1.Id)
+
+			Convey("Should be able to swap it if it points where expected...", func() {
+				_, err := handle.SetAlias("myapp/stable", b2.Id, &b1.Id)
+				So(err, ShouldBeNil)
+
+				_, err = handle.SetAlias("myapp/stable", b1.Id, &b1.Id)
+				So(err, ShouldEqual, interfaces.AliasConflictError)
+
+				resolved, err := handle.ResolveAlias("myapp/stable")
+				So(err, ShouldBeNil)
+				So(resolved.BlobId, ShouldEqual, b2.Id)
+
+				Convey("And the history should record each repoint...", func() {
+					history, err := handle.AliasHistory("myapp/stable")
+					So(err, ShouldBeNil)
+					So(len(history), ShouldEqual, 2)
+					So(history[0].BlobId, ShouldEqual, b2.Id)
+					So(*history[0].Previous, ShouldEqual, b1.Id)
+					So(history[1].BlobId, ShouldEqual, b1.Id)
+					So(history[1].Previous, ShouldBeNil)
+				})
+			})
+
+			Convey("Should not be able to create it again if it must be new...", func() {
+				none := int64(0)
+				_, err := handle.SetAlias("myapp/stable", b2.Id, &none)
+				So(err, ShouldEqual, interfaces.AliasConflictError)
+			})
+
+			Convey("Should be able to list and delete it...", func() {
+				aliases, err := handle.ListAliases()
+				So(err, ShouldBeNil)
+				So(len(aliases), ShouldEqual, 1)
+
+				err = handle.DeleteAlias("myapp/stable")
+				So(err, ShouldBeNil)
+				_, err = handle.ResolveAlias("myapp/stable")
+				So(err, ShouldEqual, interfaces.NoSuchAliasError)
+			})
+		})
+
+		Convey("Should not be able to alias a missing blob...", func() {
+			_, err := handle.SetAlias("myapp/canary", b2.Id+100, nil)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+		})
+
+		Convey("Should not be able to use a numeric alias...", func() {
+			_, err := handle.SetAlias("1234", b1.Id, nil)
+			So(err, ShouldEqual, models.InvalidAliasNameError)
+		})
+
+		Convey("Should not be able to use an alias which looks like a history...", func() {
+			_, err := handle.SetAlias("myapp/history", b1.Id, nil)
+			So(err, ShouldEqual, models.InvalidAliasNameError)
+
+			_, err = handle.SetAlias("history", b1.Id, nil)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Blobs which an alias points at shouldn't be purged...", func() {
+			_, err := handle.SetAlias("myapp/stable", b1.Id, nil)
+			So(err, ShouldBeNil)
+
+			So(handle.CheckBlobUnaliased(b1.Id), ShouldEqual, interfaces.BlobAliasedError)
+			So(handle.CheckBlobUnaliased(b2.Id), ShouldBeNil)
+
+			So(handle.TrashBlobById(b1.Id), ShouldBeNil)
+			So(handle.TrashBlobById(b2.Id), ShouldBeNil)
+			expired, err := handle.ListExpiredTrash(time.Now().Add(time.Hour))
+			So(err, ShouldBeNil)
+			So(len(expired), ShouldEqual, 1)
+			So(expired[0].Id, ShouldEqual, b2.Id)
+		})
+	})
+}
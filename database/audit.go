@@ -0,0 +1,120 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const auditColumns = `id, date, actor, address, action, blob, bucket, old_bucket, old_sha1, old_size, new_sha1, new_size`
+
+// recordAuditEntry appends an entry to the audit log. Must be called with the
+// lock held.
+func recordAuditEntry(e sqlx.Ext, entry *models.AuditEntry) error {
+	result, err := sqlx.NamedExec(e, `
+		INSERT INTO audit (date, actor, address, action, blob, bucket, old_bucket, old_sha1, old_size, new_sha1, new_size)
+		VALUES (:date, :actor, :address, :action, :blob, :bucket, :old_bucket, :old_sha1, :old_size, :new_sha1, :new_size)
+	`, entry)
+	if err != nil {
+		return err
+	}
+	entry.Id, err = result.LastInsertId()
+	return err
+}
+
+// RecordAuditEntry appends an entry to the audit log.
+func (s *Store) RecordAuditEntry(entry *models.AuditEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return recordAuditEntry(s.handle, entry)
+}
+
+// buildAuditClause converts an AuditQuery into a SQL WHERE clause (without
+// the WHERE keyword) and its positional arguments.
+func buildAuditClause(qry *models.AuditQuery) (string, []interface{}) {
+	c := &searchClause{}
+	c.add("id > ?", qry.After)
+	if qry.Actor != nil {
+		c.add("actor = ?", *qry.Actor)
+	}
+	if qry.Action != nil {
+		c.add("action = ?", string(*qry.Action))
+	}
+	if qry.Bucket != nil {
+		c.add("(bucket = ? OR old_bucket = ?)", *qry.Bucket, *qry.Bucket)
+	}
+	if qry.Blob != nil {
+		c.add("blob = ?", *qry.Blob)
+	}
+	if qry.Since != nil {
+		c.add("julianday(date) >= julianday(?)", *qry.Since)
+	}
+	if qry.Until != nil {
+		c.add("julianday(date) < julianday(?)", *qry.Until)
+	}
+	return strings.Join(c.conditions, " AND "), c.args
+}
+
+// ListAuditEntries returns a page of the entries matching a query, oldest first.
+func (s *Store) ListAuditEntries(qry *models.AuditQuery) (*models.AuditPage, error) {
+	err := qry.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Fetch one more than the limit, to find out if there's another page
+	where, args := buildAuditClause(qry)
+	entries := make([]*models.AuditEntry, 0)
+	err = s.handle.Select(&entries, `
+		SELECT `+auditColumns+` FROM audit
+		WHERE `+where+`
+		ORDER BY id
+		LIMIT ?`, append(args, qry.Limit+1)...)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &models.AuditPage{Entries: entries}
+	if len(entries) > qry.Limit {
+		ret.Entries = entries[:qry.Limit]
+		ret.After = ret.Entries[qry.Limit-1].Id
+	}
+	return ret, nil
+}
+
+// StreamAuditEntries writes every entry matching a query into a channel, in
+// batches so that the log is never held in memory all at once.
+func (s *Store) StreamAuditEntries(qry *models.AuditQuery, out chan *models.AuditEntry, done <-chan struct{}) error {
+	defer close(out)
+
+	batchQry := *qry
+	batchQry.Limit = streamBatchSize
+	err := batchQry.Validate()
+	if err != nil {
+		return err
+	}
+
+	for {
+		page, err := s.ListAuditEntries(&batchQry)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range page.Entries {
+			select {
+			case out <- entry:
+			case <-done:
+				return nil
+			}
+		}
+
+		if page.After == 0 {
+			return nil
+		}
+		batchQry.After = page.After
+	}
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Audit(t *testing.T) {
+	Convey("Given a store with some changes recorded...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		before := &models.Blob{Id: 1, Bucket: "photos", Checksum: "aaa", Size: 10}
+		after := &models.Blob{Id: 1, Bucket: "photos", Checksum: "bbb", Size: 20}
+		other := &models.Blob{Id: 2, Bucket: "logs", Checksum: "ccc", Size: 30}
+		entries := []*models.AuditEntry{
+			models.NewAuditEntry("alice", "10.0.0.1", models.AuditCreate, nil, before),
+			models.NewAuditEntry("bob", "10.0.0.2", models.AuditWrite, before, after),
+			models.NewAuditEntry("alice", "10.0.0.1", models.AuditCreate, nil, other),
+			models.NewAuditEntry(models.TrashActor, "", models.AuditPurge, after, nil),
+		}
+		for _, entry := range entries {
+			err := handle.RecordAuditEntry(entry)
+			So(err, ShouldBeNil)
+			So(entry.Id, ShouldBeGreaterThan, 0)
+		}
+
+		Convey("Should list every entry, oldest first...", func() {
+			page, err := handle.ListAuditEntries(&models.AuditQuery{})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 4)
+			So(page.After, ShouldEqual, 0)
+
+			write := page.Entries[1]
+			So(write.Actor, ShouldEqual, "bob")
+			So(write.Address, ShouldEqual, "10.0.0.2")
+			So(write.Action, ShouldEqual, models.AuditWrite)
+			So(write.Blob, ShouldEqual, 1)
+			So(write.Bucket, ShouldEqual, "photos")
+			So(*write.OldChecksum, ShouldEqual, "aaa")
+			So(*write.OldSize, ShouldEqual, 10)
+			So(*write.NewChecksum, ShouldEqual, "bbb")
+			So(*write.NewSize, ShouldEqual, 20)
+
+			So(page.Entries[0].OldChecksum, ShouldBeNil)
+			So(page.Entries[3].NewSize, ShouldBeNil)
+		})
+
+		Convey("Should filter entries...", func() {
+			actor := "alice"
+			page, err := handle.ListAuditEntries(&models.AuditQuery{Actor: &actor})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 2)
+
+			blob := int64(1)
+			action := models.AuditCreate
+			page, err = handle.ListAuditEntries(&models.AuditQuery{Blob: &blob, Action: &action})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 1)
+			So(page.Entries[0].Id, ShouldEqual, entries[0].Id)
+
+			bucket := "logs"
+			page, err = handle.ListAuditEntries(&models.AuditQuery{Bucket: &bucket})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 1)
+			So(page.Entries[0].Blob, ShouldEqual, 2)
+
+			future := time.Now().Add(time.Hour)
+			page, err = handle.ListAuditEntries(&models.AuditQuery{Since: &future})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldBeEmpty)
+			page, err = handle.ListAuditEntries(&models.AuditQuery{Until: &future})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 4)
+		})
+
+		Convey("Should find moves from either bucket...", func() {
+			moved := *other
+			moved.Bucket = "archive"
+			move := models.NewAuditEntry("alice", "", models.AuditUpdate, other, &moved)
+			So(handle.RecordAuditEntry(move), ShouldBeNil)
+
+			for _, bucket := range []string{"logs", "archive"} {
+				page, err := handle.ListAuditEntries(&models.AuditQuery{Bucket: &bucket})
+				So(err, ShouldBeNil)
+				So(page.Entries[len(page.Entries)-1].Id, ShouldEqual, move.Id)
+			}
+			bucket := "archive"
+			page, err := handle.ListAuditEntries(&models.AuditQuery{Bucket: &bucket})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 1)
+			So(page.Entries[0].OldBucket, ShouldEqual, "logs")
+		})
+
+		Convey("Should refuse unknown actions...", func() {
+			action := models.AuditAction("explode")
+			_, err := handle.ListAuditEntries(&models.AuditQuery{Action: &action})
+			So(err, ShouldEqual, models.InvalidAuditActionError)
+		})
+
+		Convey("Should page through entries...", func() {
+			page, err := handle.ListAuditEntries(&models.AuditQuery{Limit: 3})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 3)
+			So(page.After, ShouldEqual, entries[2].Id)
+
+			page, err = handle.ListAuditEntries(&models.AuditQuery{Limit: 3, After: page.After})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 1)
+			So(page.Entries[0].Id, ShouldEqual, entries[3].Id)
+			So(page.After, ShouldEqual, 0)
+		})
+
+		Convey("Should stream every matching entry...", func() {
+			actor := "alice"
+			out := make(chan *models.AuditEntry)
+			result := make(chan error, 1)
+			go func() {
+				result <- handle.StreamAuditEntries(&models.AuditQuery{Actor: &actor}, out, nil)
+			}()
+			streamed := make([]*models.AuditEntry, 0)
+			for entry := range out {
+				streamed = append(streamed, entry)
+			}
+			So(<-result, ShouldBeNil)
+			So(streamed, ShouldHaveLength, 2)
+		})
+
+		Convey("Should not let entries be changed or removed...", func() {
+			_, err := handle.handle.Exec("UPDATE audit SET actor = 'mallory'")
+			So(err, ShouldNotBeNil)
+			_, err = handle.handle.Exec("DELETE FROM audit")
+			So(err, ShouldNotBeNil)
+
+			page, err := handle.ListAuditEntries(&models.AuditQuery{})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 4)
+			So(page.Entries[0].Actor, ShouldEqual, "alice")
+		})
+	})
+}
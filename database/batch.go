@@ -0,0 +1,41 @@
+package database
+
+import (
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// applyBlobChanges updates or trashes several blobs. Must be called inside a
+// transaction, so that the changes are made together.
+func applyBlobChanges(tx *sqlx.Tx, changes []models.BlobChange) ([]*models.Blob, error) {
+	var err error
+	now := time.Now()
+	ret := make([]*models.Blob, len(changes))
+	for i, change := range changes {
+		if change.Trash {
+			err = trashBlob(tx, change.Blob.Id, now, change.Revision)
+		} else {
+			err = updateBlobRecord(tx, change.Blob, change.Revision)
+			if err == nil {
+				ret[i], err = retrieveBlob(tx, change.Blob.Id)
+			}
+		}
+		if err != nil {
+			return nil, &interfaces.BlobChangeError{Index: i, Err: err}
+		}
+	}
+	return ret, nil
+}
+
+// ApplyBlobChanges updates or trashes several blobs in a single transaction.
+func (s *Store) ApplyBlobChanges(changes []models.BlobChange) ([]*models.Blob, error) {
+	var ret []*models.Blob
+	err := s.ChangeBlobs(func(tx interfaces.BlobChanges) (err error) {
+		ret, err = tx.ApplyBlobChanges(changes)
+		return err
+	})
+	return ret, err
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_ApplyBlobChanges(t *testing.T) {
+	Convey("Given a store with some blobs...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		first := insertBlobForTesting(handle, "first", "ci", "alice", models.TemporaryBlob, 10, now)
+		second := insertBlobForTesting(handle, "second", "ci", "alice", models.TemporaryBlob, 10, now)
+
+		renamed := *first
+		renamed.Name = "renamed"
+
+		Convey("Should apply every change together...", func() {
+			updated, err := handle.ApplyBlobChanges([]models.BlobChange{
+				{Blob: &renamed, Revision: first.Revision},
+				{Trash: true, Blob: second},
+			})
+			So(err, ShouldBeNil)
+			So(len(updated), ShouldEqual, 2)
+			So(updated[0].Name, ShouldEqual, "renamed")
+			So(updated[1], ShouldBeNil)
+
+			_, err = handle.RetrieveBlobById(second.Id)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+		})
+
+		Convey("Should apply none of them if one fails...", func() {
+			_, err := handle.SetBlobProtection(second.Id, &models.BlobProtection{LegalHold: true})
+			So(err, ShouldBeNil)
+
+			_, err = handle.ApplyBlobChanges([]models.BlobChange{
+				{Blob: &renamed, Revision: first.Revision},
+				{Trash: true, Blob: second},
+			})
+			So(err, ShouldResemble, &interfaces.BlobChangeError{Index: 1, Err: interfaces.BlobLegalHoldError})
+
+			b, err := handle.RetrieveBlobById(first.Id)
+			So(err, ShouldBeNil)
+			So(b.Name, ShouldEqual, "first")
+		})
+
+		Convey("Should check the revision of blobs being trashed...", func() {
+			_, err := handle.ApplyBlobChanges([]models.BlobChange{
+				{Trash: true, Blob: first, Revision: first.Revision + 1},
+			})
+			So(err, ShouldResemble, &interfaces.BlobChangeError{Index: 0, Err: interfaces.BlobRevisionMismatchError})
+		})
+	})
+}
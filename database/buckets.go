@@ -0,0 +1,194 @@
+package database
+
+import (
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const bucketColumns = `name, created, default_class, max_blob_size, allowed_uploaders, retention_days, versioning, max_versions, immutable, legal_hold, lifecycle`
+
+// bucketDescriptionSql summarises each bucket, ignoring blobs in the trash; the
+// last upload is joined on so that its date is scanned like any other DATETIME column.
+const bucketDescriptionSql = `
+	SELECT
+		b.name, b.created, b.default_class, b.max_blob_size, b.allowed_uploaders, b.retention_days,
+		b.versioning, b.max_versions, b.immutable, b.legal_hold, b.lifecycle,
+		COUNT(x.id) AS blob_count,
+		COALESCE(SUM(x.size), 0) AS total_size,
+		l.date AS last_upload
+	FROM buckets b
+	LEFT JOIN blobs x ON x.bucket = b.name AND x.deleted IS NULL
+	LEFT JOIN blobs l ON l.id = (
+		SELECT id FROM blobs WHERE bucket = b.name AND deleted IS NULL ORDER BY julianday(date) DESC, id DESC LIMIT 1
+	)
+`
+
+// createBucketIfNotExists makes sure that a bucket exists with default settings,
+// giving it the default grants if it's new. Must be called with the lock held.
+func createBucketIfNotExists(e sqlx.Execer, name, creator string) error {
+	result, err := e.Exec(`INSERT OR IGNORE INTO buckets (name, created) VALUES (?, ?)`, name, time.Now())
+	if err != nil {
+		return err
+	}
+	created, err := result.RowsAffected()
+	if err != nil || created == 0 {
+		return err
+	}
+	return applyDefaultGrants(e, name, creator)
+}
+
+func (s *Store) retrieveBucket(name string) (*models.Bucket, error) {
+	ret := make([]models.Bucket, 0)
+	err := s.handle.Select(&ret, "SELECT "+bucketColumns+" FROM buckets WHERE name = ?", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoSuchBucketError
+	}
+	return &ret[0], nil
+}
+
+// CreateBucket stores a new bucket and its settings, along with the default grants.
+func (s *Store) CreateBucket(bucket *models.Bucket, creator string) (*models.Bucket, error) {
+	err := bucket.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err = s.retrieveBucket(bucket.Name)
+	if err == nil {
+		return nil, interfaces.BucketExistsError
+	} else if err != interfaces.NoSuchBucketError {
+		return nil, err
+	}
+
+	b := *bucket
+	b.Created = time.Now()
+	_, err = s.handle.NamedExec(`
+		INSERT INTO buckets (`+bucketColumns+`)
+		VALUES (:name, :created, :default_class, :max_blob_size, :allowed_uploaders, :retention_days,
+			:versioning, :max_versions, :immutable, :legal_hold, :lifecycle)
+	`, &b)
+	if err != nil {
+		return nil, err
+	}
+	err = applyDefaultGrants(s.handle, b.Name, creator)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.retrieveBucket(b.Name)
+}
+
+// RetrieveBucket returns a bucket's settings.
+func (s *Store) RetrieveBucket(name string) (*models.Bucket, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.retrieveBucket(name)
+}
+
+// UpdateBucket replaces the settings of an existing bucket.
+func (s *Store) UpdateBucket(bucket *models.Bucket) (*models.Bucket, error) {
+	err := bucket.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Write-once buckets have to stay that way
+	current, err := s.retrieveBucket(bucket.Name)
+	if err != nil {
+		return nil, err
+	} else if current.Immutable && !bucket.Immutable {
+		return nil, interfaces.WriteOnceSettingError
+	}
+
+	result, err := s.handle.NamedExec(`
+		UPDATE buckets SET
+			default_class = :default_class,
+			max_blob_size = :max_blob_size,
+			allowed_uploaders = :allowed_uploaders,
+			retention_days = :retention_days,
+			versioning = :versioning,
+			max_versions = :max_versions,
+			immutable = :immutable,
+			legal_hold = :legal_hold,
+			lifecycle = :lifecycle
+		WHERE
+			name = :name
+	`, bucket)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, interfaces.NoSuchBucketError
+	}
+
+	return s.retrieveBucket(bucket.Name)
+}
+
+// DeleteBucket removes an empty bucket.
+func (s *Store) DeleteBucket(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+	err := s.handle.Get(&count, "SELECT COUNT(*) FROM blobs WHERE bucket = ?", name)
+	if err != nil {
+		return err
+	} else if count > 0 {
+		return interfaces.BucketNotEmptyError
+	}
+
+	result, err := s.handle.Exec("DELETE FROM buckets WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return interfaces.NoSuchBucketError
+	}
+	_, err = s.handle.Exec("DELETE FROM grants WHERE bucket = ?", name)
+	return err
+}
+
+// DescribeBucket returns a bucket's settings alongside its blob count,
+// total size and the date of its most recent upload.
+func (s *Store) DescribeBucket(name string) (*models.BucketDescription, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.BucketDescription, 0)
+	err := s.handle.Select(&ret, bucketDescriptionSql+" WHERE b.name = ? GROUP BY b.name", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoSuchBucketError
+	}
+	return ret[0], nil
+}
+
+// DescribeAllBuckets summarises every bucket, ordered by name.
+func (s *Store) DescribeAllBuckets() ([]*models.BucketDescription, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.BucketDescription, 0)
+	err := s.handle.Select(&ret, bucketDescriptionSql+" GROUP BY b.name ORDER BY b.name")
+	return ret, err
+}
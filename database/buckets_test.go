@@ -0,0 +1,90 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Buckets(t *testing.T) {
+	Convey("Given a blank store...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		Convey("Should be able to create a bucket with settings...", func() {
+			settings := models.BucketSettings{
+				DefaultClass:     models.PermanentBlob,
+				MaxBlobSize:      1024,
+				AllowedUploaders: models.UploaderList{"alice"},
+				RetentionDays:    30,
+			}
+			created, err := handle.CreateBucket(&models.Bucket{Name: "releases", BucketSettings: settings}, "")
+			So(err, ShouldBeNil)
+			So(created.Name, ShouldEqual, "releases")
+			So(created.BucketSettings, ShouldResemble, settings)
+
+			Convey("Should not be able to create it twice...", func() {
+				_, err := handle.CreateBucket(&models.Bucket{Name: "releases"}, "")
+				So(err, ShouldEqual, interfaces.BucketExistsError)
+			})
+
+			Convey("Should be able to reconfigure it...", func() {
+				created.MaxBlobSize = 0
+				created.AllowedUploaders = nil
+				updated, err := handle.UpdateBucket(created)
+				So(err, ShouldBeNil)
+				So(updated.MaxBlobSize, ShouldEqual, 0)
+				So(updated.AllowedUploaders, ShouldBeEmpty)
+				So(updated.RetentionDays, ShouldEqual, 30)
+			})
+
+			Convey("Should describe it as empty...", func() {
+				description, err := handle.DescribeBucket("releases")
+				So(err, ShouldBeNil)
+				So(description.BlobCount, ShouldEqual, 0)
+				So(description.TotalSize, ShouldEqual, 0)
+				So(description.LastUpload, ShouldBeNil)
+			})
+
+			Convey("Should be able to delete it while it's empty...", func() {
+				err := handle.DeleteBucket("releases")
+				So(err, ShouldBeNil)
+				_, err = handle.RetrieveBucket("releases")
+				So(err, ShouldEqual, interfaces.NoSuchBucketError)
+			})
+		})
+
+		Convey("Should reject invalid settings...", func() {
+			_, err := handle.CreateBucket(&models.Bucket{Name: "bad", BucketSettings: models.BucketSettings{DefaultClass: "forever"}}, "")
+			So(err, ShouldNotBeNil)
+			_, err = handle.UpdateBucket(&models.Bucket{Name: "missing"})
+			So(err, ShouldEqual, interfaces.NoSuchBucketError)
+		})
+
+		Convey("Storing blobs should create and populate buckets implicitly...", func() {
+			now := time.Now()
+			insertBlobForTesting(handle, "a", "implicit", "alice", models.TemporaryBlob, 10, now.Add(-time.Hour))
+			latest := insertBlobForTesting(handle, "b", "implicit", "alice", models.TemporaryBlob, 32, now)
+			insertBlobForTesting(handle, "c", "other", "alice", models.TemporaryBlob, 5, now)
+
+			description, err := handle.DescribeBucket("implicit")
+			So(err, ShouldBeNil)
+			So(description.BlobCount, ShouldEqual, 2)
+			So(description.TotalSize, ShouldEqual, 42)
+			So(description.LastUpload, ShouldNotBeNil)
+			So(description.LastUpload.Sub(latest.Date).Seconds(), ShouldBeLessThan, 1)
+
+			all, err := handle.DescribeAllBuckets()
+			So(err, ShouldBeNil)
+			So(len(all), ShouldEqual, 2)
+			So(all[0].Name, ShouldEqual, "implicit")
+			So(all[1].Name, ShouldEqual, "other")
+
+			err = handle.DeleteBucket("implicit")
+			So(err, ShouldEqual, interfaces.BucketNotEmptyError)
+		})
+	})
+}
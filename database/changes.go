@@ -0,0 +1,86 @@
+package database
+
+import (
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// blobChanges changes blobs inside a transaction.
+type blobChanges struct {
+	tx *sqlx.Tx
+}
+
+// ChangeBlobs calls fn with a transaction, committing it if fn succeeds and
+// rolling it back otherwise. The lock is held throughout, so fn mustn't use
+// the store directly.
+func (s *Store) ChangeBlobs(fn func(changes interfaces.BlobChanges) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, err := s.handle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&blobChanges{tx})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c *blobChanges) RetrieveBlobById(id int64) (*models.Blob, error) {
+	return retrieveBlob(c.tx, id)
+}
+
+func (c *blobChanges) StoreBlobRecord(blob *models.Blob) (*models.Blob, error) {
+	return storeBlobRecord(c.tx, blob)
+}
+
+func (c *blobChanges) FinalizeBlobRecord(blob *models.Blob) (*models.Blob, error) {
+	return finalizeBlobRecord(c.tx, blob)
+}
+
+func (c *blobChanges) UpdateBlobRecord(blob *models.Blob, revision int64) (*models.Blob, error) {
+	err := updateBlobRecord(c.tx, blob, revision)
+	if err != nil {
+		return nil, err
+	}
+	return retrieveBlob(c.tx, blob.Id)
+}
+
+func (c *blobChanges) ApplyBlobChanges(changes []models.BlobChange) ([]*models.Blob, error) {
+	return applyBlobChanges(c.tx, changes)
+}
+
+func (c *blobChanges) DeleteBlobById(id int64) error {
+	return deleteBlob(c.tx, id)
+}
+
+func (c *blobChanges) TrashBlobById(id int64) error {
+	return trashBlob(c.tx, id, time.Now(), 0)
+}
+
+func (c *blobChanges) RestoreBlobById(id int64) (*models.Blob, error) {
+	return restoreBlob(c.tx, id)
+}
+
+func (c *blobChanges) SetBlobProtection(id int64, protection *models.BlobProtection) (*models.Blob, error) {
+	return setBlobProtection(c.tx, id, protection)
+}
+
+func (c *blobChanges) ApplyLifecycleRule(bucket string, rule *models.LifecycleRule, now time.Time) ([]*models.Blob, error) {
+	return applyLifecycleRule(c.tx, bucket, rule, now)
+}
+
+func (c *blobChanges) RecordAuditEntry(entry *models.AuditEntry) error {
+	return recordAuditEntry(c.tx, entry)
+}
+
+func (c *blobChanges) PublishEvent(event *models.Event) error {
+	return publishEvent(c.tx, event)
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_ChangeBlobs(t *testing.T) {
+	Convey("Given a store with a blob...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		blob := insertBlobForTesting(handle, "blob", "bucket", "alice", models.PermanentBlob, 10, time.Now())
+
+		// trash moves the blob into the trash, records it and publishes an
+		// event, then fails with fail
+		trash := func(fail error) error {
+			return handle.ChangeBlobs(func(changes interfaces.BlobChanges) error {
+				err := changes.TrashBlobById(blob.Id)
+				if err != nil {
+					return err
+				}
+				err = changes.RecordAuditEntry(models.NewAuditEntry("alice", "", models.AuditDelete, blob, nil))
+				if err != nil {
+					return err
+				}
+				err = changes.PublishEvent(&models.Event{Type: models.BlobDeleted, Date: time.Now(), Blob: blob})
+				if err != nil {
+					return err
+				}
+				return fail
+			})
+		}
+
+		Convey("Should make the changes, record them and publish their events together...", func() {
+			So(trash(nil), ShouldBeNil)
+
+			_, err := handle.RetrieveTrashedBlob(blob.Id)
+			So(err, ShouldBeNil)
+			page, err := handle.ListAuditEntries(&models.AuditQuery{})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldHaveLength, 1)
+			events, err := handle.ListEvents(0, 10)
+			So(err, ShouldBeNil)
+			So(events, ShouldHaveLength, 1)
+		})
+
+		Convey("Should discard all of them if anything fails...", func() {
+			failure := errors.New("failed")
+			So(trash(failure), ShouldEqual, failure)
+
+			_, err := handle.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			page, err := handle.ListAuditEntries(&models.AuditQuery{})
+			So(err, ShouldBeNil)
+			So(page.Entries, ShouldBeEmpty)
+			events, err := handle.ListEvents(0, 10)
+			So(err, ShouldBeNil)
+			So(events, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,288 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// eventRow is how an event is stored: the blob is kept as JSON, since it
+// may have been removed since.
+type eventRow struct {
+	Id   int64            `db:"id"`
+	Type models.EventType `db:"type"`
+	Date time.Time        `db:"date"`
+	Blob string           `db:"blob"`
+}
+
+func (r *eventRow) toEvent() (*models.Event, error) {
+	ret := &models.Event{Id: r.Id, Type: r.Type, Date: r.Date, Blob: &models.Blob{}}
+	return ret, json.Unmarshal([]byte(r.Blob), ret.Blob)
+}
+
+const webhookColumns = `id, url, secret, events, bucket, created`
+
+// publishEvent stores an event and queues it for each webhook which wants
+// it. Must be called inside a transaction, so that none of them miss it.
+func publishEvent(tx *sqlx.Tx, event *models.Event) error {
+	blob, err := json.Marshal(event.Blob)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`INSERT INTO events (type, date, blob) VALUES (?, ?, ?)`, event.Type, event.Date, string(blob))
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	webhooks := make([]*models.Webhook, 0)
+	err = tx.Select(&webhooks, "SELECT "+webhookColumns+" FROM webhooks")
+	if err != nil {
+		return err
+	}
+	for _, w := range webhooks {
+		if !w.Wants(event) {
+			continue
+		}
+		_, err = tx.Exec(`INSERT INTO webhook_outbox (webhook, event, next_attempt) VALUES (?, ?, ?)`, w.Id, id, event.Date)
+		if err != nil {
+			return err
+		}
+	}
+
+	event.Id = id
+	return nil
+}
+
+// PublishEvent stores an event and queues it for each webhook which wants it,
+// in a single transaction so that none of them miss it.
+func (s *Store) PublishEvent(event *models.Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, err := s.handle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = publishEvent(tx, event)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PruneEvents removes the abandoned deliveries of events published before a
+// given time, and then those events themselves, unless they're still waiting
+// to be delivered. Returns how many events were removed.
+func (s *Store) PruneEvents(before time.Time) (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, err := s.handle.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM webhook_outbox
+		WHERE abandoned AND event IN (SELECT id FROM events WHERE julianday(date) < julianday(?))`, before)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`
+		DELETE FROM events
+		WHERE julianday(date) < julianday(?) AND id NOT IN (SELECT event FROM webhook_outbox)`, before)
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return pruned, tx.Commit()
+}
+
+// ListEvents returns up to limit events published after the given id.
+func (s *Store) ListEvents(after int64, limit int) ([]*models.Event, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rows := make([]eventRow, 0)
+	err := s.handle.Select(&rows, `SELECT id, type, date, blob FROM events WHERE id > ? ORDER BY id LIMIT ?`, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*models.Event, 0, len(rows))
+	for i := range rows {
+		event, err := rows[i].toEvent()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, event)
+	}
+	return ret, nil
+}
+
+// LatestEventId returns the id of the newest event, or zero.
+func (s *Store) LatestEventId() (int64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var ret int64
+	err := s.handle.Get(&ret, `SELECT COALESCE(MAX(id), 0) FROM events`)
+	return ret, err
+}
+
+// CreateWebhook stores a webhook, generating its secret if it doesn't have one.
+func (s *Store) CreateWebhook(webhook *models.Webhook) (*models.Webhook, error) {
+	err := webhook.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := *webhook
+	ret.Created = time.Now()
+	if ret.Secret == "" {
+		ret.Secret, err = models.GenerateTokenSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result, err := s.handle.NamedExec(`
+		INSERT INTO webhooks (url, secret, events, bucket, created)
+		VALUES (:url, :secret, :events, :bucket, :created)
+	`, &ret)
+	if err != nil {
+		return nil, err
+	}
+	ret.Id, err = result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListWebhooks returns every webhook, oldest first, without their secrets.
+func (s *Store) ListWebhooks() ([]*models.Webhook, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Webhook, 0)
+	err := s.handle.Select(&ret, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+	for _, w := range ret {
+		w.Secret = ""
+	}
+	return ret, err
+}
+
+// DeleteWebhook removes a webhook and everything in the outbox for it.
+func (s *Store) DeleteWebhook(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tx, err := s.handle.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM webhooks WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return interfaces.NoSuchWebhookError
+	}
+	_, err = tx.Exec(`DELETE FROM webhook_outbox WHERE webhook = ?`, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListDueDeliveries returns up to limit deliveries which are due by now.
+func (s *Store) ListDueDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	rows := make([]struct {
+		Id       int64          `db:"id"`
+		Attempts int            `db:"attempts"`
+		Webhook  models.Webhook `db:"webhook"`
+		Event    eventRow       `db:"event"`
+	}, 0)
+	err := s.handle.Select(&rows, `
+		SELECT o.id, o.attempts,
+			w.id AS "webhook.id", w.url AS "webhook.url", w.secret AS "webhook.secret",
+			w.events AS "webhook.events", w.bucket AS "webhook.bucket", w.created AS "webhook.created",
+			e.id AS "event.id", e.type AS "event.type", e.date AS "event.date", e.blob AS "event.blob"
+		FROM webhook_outbox o
+		JOIN webhooks w ON w.id = o.webhook
+		JOIN events e ON e.id = o.event
+		WHERE NOT o.abandoned AND julianday(o.next_attempt) <= julianday(?)
+		ORDER BY o.id
+		LIMIT ?`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*models.WebhookDelivery, 0, len(rows))
+	for i := range rows {
+		event, err := rows[i].Event.toEvent()
+		if err != nil {
+			return nil, err
+		}
+		webhook := rows[i].Webhook
+		ret = append(ret, &models.WebhookDelivery{Id: rows[i].Id, Webhook: &webhook, Event: event, Attempts: rows[i].Attempts})
+	}
+	return ret, nil
+}
+
+// CompleteDelivery removes a delivery from the outbox.
+func (s *Store) CompleteDelivery(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.handle.Exec(`DELETE FROM webhook_outbox WHERE id = ?`, id)
+	return err
+}
+
+// RetryDelivery counts a failed attempt, and puts the delivery off until next.
+func (s *Store) RetryDelivery(id int64, next time.Time, reason string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.handle.Exec(`
+		UPDATE webhook_outbox SET attempts = attempts + 1, next_attempt = ?, last_error = ?
+		WHERE id = ?`, next, reason, id)
+	return err
+}
+
+// AbandonDelivery counts a failed attempt, and stops the delivery being retried.
+func (s *Store) AbandonDelivery(id int64, reason string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.handle.Exec(`
+		UPDATE webhook_outbox SET attempts = attempts + 1, abandoned = 1, last_error = ?
+		WHERE id = ?`, reason, id)
+	return err
+}
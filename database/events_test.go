@@ -0,0 +1,169 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Events(t *testing.T) {
+	Convey("Given a store with some webhooks...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		everything, err := handle.CreateWebhook(&models.Webhook{URL: "http://localhost/everything"})
+		So(err, ShouldBeNil)
+		So(everything.Id, ShouldBeGreaterThan, 0)
+		So(everything.Secret, ShouldNotBeEmpty)
+
+		deletions, err := handle.CreateWebhook(&models.Webhook{
+			URL:    "http://localhost/deletions",
+			Secret: "shh",
+			Events: models.EventTypeList{models.BlobDeleted},
+			Bucket: "photos",
+		})
+		So(err, ShouldBeNil)
+		So(deletions.Secret, ShouldEqual, "shh")
+
+		now := time.Now().UTC()
+		publish := func(eventType models.EventType, bucket string) *models.Event {
+			event := &models.Event{Type: eventType, Date: now, Blob: &models.Blob{Id: 1, Bucket: bucket}}
+			err := handle.PublishEvent(event)
+			So(err, ShouldBeNil)
+			So(event.Id, ShouldBeGreaterThan, 0)
+			return event
+		}
+
+		Convey("Should list webhooks without their secrets...", func() {
+			webhooks, err := handle.ListWebhooks()
+			So(err, ShouldBeNil)
+			So(webhooks, ShouldHaveLength, 2)
+			So(webhooks[0].Secret, ShouldBeEmpty)
+			So(webhooks[1].Events, ShouldResemble, models.EventTypeList{models.BlobDeleted})
+			So(webhooks[1].Bucket, ShouldEqual, "photos")
+		})
+
+		Convey("Should list events after a given id...", func() {
+			latest, err := handle.LatestEventId()
+			So(err, ShouldBeNil)
+			So(latest, ShouldEqual, 0)
+
+			first := publish(models.BlobCreated, "photos")
+			second := publish(models.BlobDeleted, "logs")
+
+			latest, err = handle.LatestEventId()
+			So(err, ShouldBeNil)
+			So(latest, ShouldEqual, second.Id)
+
+			events, err := handle.ListEvents(0, 10)
+			So(err, ShouldBeNil)
+			So(events, ShouldHaveLength, 2)
+			So(events[0].Type, ShouldEqual, models.BlobCreated)
+			So(events[0].Blob.Bucket, ShouldEqual, "photos")
+
+			events, err = handle.ListEvents(first.Id, 10)
+			So(err, ShouldBeNil)
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Id, ShouldEqual, second.Id)
+		})
+
+		Convey("Should queue deliveries for the webhooks which want them...", func() {
+			publish(models.BlobCreated, "photos")
+			publish(models.BlobDeleted, "logs")
+			publish(models.BlobDeleted, "photos")
+
+			due, err := handle.ListDueDeliveries(now, 10)
+			So(err, ShouldBeNil)
+			So(due, ShouldHaveLength, 4)
+
+			toDeletions := 0
+			for _, d := range due {
+				So(d.Event.Blob, ShouldNotBeNil)
+				if d.Webhook.Id == deletions.Id {
+					toDeletions++
+					So(d.Webhook.Secret, ShouldEqual, "shh")
+					So(d.Event.Type, ShouldEqual, models.BlobDeleted)
+					So(d.Event.Blob.Bucket, ShouldEqual, "photos")
+				}
+			}
+			So(toDeletions, ShouldEqual, 1)
+
+			Convey("Should stop listing deliveries once they're complete...", func() {
+				So(handle.CompleteDelivery(due[0].Id), ShouldBeNil)
+				remaining, err := handle.ListDueDeliveries(now, 10)
+				So(err, ShouldBeNil)
+				So(remaining, ShouldHaveLength, 3)
+			})
+
+			Convey("Should hold back deliveries which are being retried...", func() {
+				So(handle.RetryDelivery(due[0].Id, now.Add(time.Minute), "refused"), ShouldBeNil)
+				remaining, err := handle.ListDueDeliveries(now, 10)
+				So(err, ShouldBeNil)
+				So(remaining, ShouldHaveLength, 3)
+
+				later, err := handle.ListDueDeliveries(now.Add(2*time.Minute), 10)
+				So(err, ShouldBeNil)
+				So(later, ShouldHaveLength, 4)
+				for _, d := range later {
+					if d.Id == due[0].Id {
+						So(d.Attempts, ShouldEqual, 1)
+					}
+				}
+			})
+
+			Convey("Should never list abandoned deliveries...", func() {
+				So(handle.AbandonDelivery(due[0].Id, "refused"), ShouldBeNil)
+				remaining, err := handle.ListDueDeliveries(now.Add(time.Hour), 10)
+				So(err, ShouldBeNil)
+				So(remaining, ShouldHaveLength, 3)
+			})
+
+			Convey("Should drop a deleted webhook's deliveries...", func() {
+				So(handle.DeleteWebhook(everything.Id), ShouldBeNil)
+				remaining, err := handle.ListDueDeliveries(now, 10)
+				So(err, ShouldBeNil)
+				So(remaining, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("Should only prune old events which aren't waiting to be delivered...", func() {
+			// Neither webhook wants this one
+			unwanted := publish(models.BlobCreated, "logs")
+			So(handle.DeleteWebhook(everything.Id), ShouldBeNil)
+			abandoned := publish(models.BlobDeleted, "photos")
+			pending := publish(models.BlobDeleted, "photos")
+
+			due, err := handle.ListDueDeliveries(now, 10)
+			So(err, ShouldBeNil)
+			So(due, ShouldHaveLength, 2)
+			So(due[0].Event.Id, ShouldEqual, abandoned.Id)
+			So(handle.AbandonDelivery(due[0].Id, "refused"), ShouldBeNil)
+
+			// Nothing was published before now
+			pruned, err := handle.PruneEvents(now)
+			So(err, ShouldBeNil)
+			So(pruned, ShouldEqual, 0)
+
+			pruned, err = handle.PruneEvents(now.Add(time.Minute))
+			So(err, ShouldBeNil)
+			So(pruned, ShouldEqual, 2)
+
+			events, err := handle.ListEvents(0, 10)
+			So(err, ShouldBeNil)
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Id, ShouldEqual, pending.Id)
+			So(events[0].Id, ShouldNotEqual, unwanted.Id)
+
+			// Ids carry on from where they were
+			latest := publish(models.BlobCreated, "logs")
+			So(latest.Id, ShouldBeGreaterThan, pending.Id)
+		})
+
+		Convey("Should refuse to delete a webhook which doesn't exist...", func() {
+			So(handle.DeleteWebhook(everything.Id+100), ShouldEqual, interfaces.NoSuchWebhookError)
+		})
+	})
+}
@@ -0,0 +1,29 @@
+package database
+
+import "errors"
+
+// SchemaOutOfDateError is reported when the database's schema isn't DbSchemaLatest.
+var SchemaOutOfDateError = errors.New("database schema isn't the latest version")
+
+// Ping checks that the database answers a query.
+func (s *Store) Ping() error {
+	var one int
+	return s.handle.Get(&one, "SELECT 1")
+}
+
+// CheckSchemaVersion checks that the database hasn't been changed to a
+// version this server doesn't know about since it was opened.
+func (s *Store) CheckSchemaVersion() error {
+	configValues, err := GetConfigurationValues(s.handle)
+	if err != nil {
+		return err
+	}
+	version, err := readDatabaseSchemaVersion(configValues)
+	if err != nil {
+		return err
+	}
+	if version != DbSchemaLatest {
+		return SchemaOutOfDateError
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestStore_Health(t *testing.T) {
+	Convey("Given a store...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		Convey("Should answer pings...", func() {
+			So(handle.Ping(), ShouldBeNil)
+		})
+
+		Convey("Should have the latest schema...", func() {
+			So(handle.CheckSchemaVersion(), ShouldBeNil)
+		})
+
+		Convey("Should notice the schema changing underneath it...", func() {
+			_, err := handle.handle.Exec(`UPDATE configuration SET value = "v1" WHERE key = "db_schema"`)
+			So(err, ShouldBeNil)
+			So(handle.CheckSchemaVersion(), ShouldEqual, SchemaOutOfDateError)
+
+			_, err = handle.handle.Exec(`UPDATE configuration SET value = "v9999" WHERE key = "db_schema"`)
+			So(err, ShouldBeNil)
+			So(handle.CheckSchemaVersion(), ShouldEqual, SchemaUnsupportedVersionError)
+		})
+
+		Convey("Should fail once it's closed...", func() {
+			So(handle.Close(), ShouldBeNil)
+			So(handle.Ping(), ShouldNotBeNil)
+		})
+	})
+}
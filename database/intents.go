@@ -0,0 +1,66 @@
+package database
+
+import (
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+)
+
+// RecordIntent notes that a content operation is about to start on a blob.
+func (s *Store) RecordIntent(blobId int64, operation models.IntentOperation) (*models.Intent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	intent := &models.Intent{BlobId: blobId, Operation: operation, Created: time.Now()}
+	result, err := s.handle.NamedExec(`
+		INSERT INTO intents (blob, operation, created)
+		VALUES (:blob, :operation, :created)
+	`, intent)
+	if err != nil {
+		return nil, err
+	}
+	intent.Id, err = result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return intent, nil
+}
+
+// CompleteIntent removes an intent once its operation is finished.
+func (s *Store) CompleteIntent(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err := s.handle.Exec(`DELETE FROM intents WHERE id = ?`, id)
+	return err
+}
+
+// ListIntents returns the intents which haven't been completed, oldest first.
+func (s *Store) ListIntents() ([]*models.Intent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Intent, 0)
+	err := s.handle.Select(&ret, `SELECT id, blob, operation, created FROM intents ORDER BY id`)
+	return ret, err
+}
+
+// MarkBlobIncomplete clears a blob's checksum, so that its content has to be
+// uploaded again.
+func (s *Store) MarkBlobIncomplete(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result, err := s.handle.Exec(`UPDATE blobs SET sha1 = '', revision = revision + 1 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return interfaces.NoMatchingBlobsError
+	}
+	return nil
+}
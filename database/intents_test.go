@@ -0,0 +1,61 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Intents(t *testing.T) {
+	Convey("Given a store with a blob...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		blob := insertBlobForTesting(handle, "blob", "bucket", "alice", models.PermanentBlob, 10, time.Now())
+
+		Convey("Should start with no intents...", func() {
+			intents, err := handle.ListIntents()
+			So(err, ShouldBeNil)
+			So(len(intents), ShouldEqual, 0)
+		})
+
+		Convey("Should be able to record and complete intents...", func() {
+			upload, err := handle.RecordIntent(blob.Id, models.IntentUpload)
+			So(err, ShouldBeNil)
+			So(upload.Id, ShouldBeGreaterThan, 0)
+			purge, err := handle.RecordIntent(blob.Id, models.IntentPurge)
+			So(err, ShouldBeNil)
+
+			intents, err := handle.ListIntents()
+			So(err, ShouldBeNil)
+			So(len(intents), ShouldEqual, 2)
+			So(intents[0].Id, ShouldEqual, upload.Id)
+			So(intents[0].BlobId, ShouldEqual, blob.Id)
+			So(intents[0].Operation, ShouldEqual, models.IntentUpload)
+			So(intents[1].Operation, ShouldEqual, models.IntentPurge)
+
+			err = handle.CompleteIntent(upload.Id)
+			So(err, ShouldBeNil)
+			intents, err = handle.ListIntents()
+			So(err, ShouldBeNil)
+			So(len(intents), ShouldEqual, 1)
+			So(intents[0].Id, ShouldEqual, purge.Id)
+		})
+
+		Convey("Should be able to mark a blob as incomplete...", func() {
+			err := handle.MarkBlobIncomplete(blob.Id)
+			So(err, ShouldBeNil)
+
+			b, err := handle.RetrieveBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			So(b.Checksum, ShouldEqual, "")
+			So(b.Revision, ShouldBeGreaterThan, blob.Revision)
+
+			err = handle.MarkBlobIncomplete(blob.Id + 100)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+		})
+	})
+}
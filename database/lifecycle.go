@@ -0,0 +1,112 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// lifecycleRuleQuery builds a query selecting the ids of the blobs in a
+// bucket which a rule applies to. Only completely uploaded blobs are
+// considered, and blobs which the rule's action would violate the protection
+// of are skipped.
+func lifecycleRuleQuery(bucket string, rule *models.LifecycleRule, now time.Time) (string, []interface{}, error) {
+	err := rule.Validate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	conditions := "bucket = ? AND sha1 <> '' AND " + liveBlobsCondition
+	args := []interface{}{bucket}
+
+	if rule.NamePattern != "" {
+		conditions += " AND name GLOB ?"
+		args = append(args, rule.NamePattern)
+	}
+	if rule.Class != "" {
+		conditions += " AND class = ?"
+		args = append(args, rule.Class)
+	}
+	if rule.HasMetadata != "" {
+		conditions += " AND " + metadataExpression("json_type", rule.HasMetadata) + " IS NOT NULL"
+	}
+
+	// The newest blobs are picked out before anything else, so that
+	// e.g. the newest 20 blobs are kept however old they are
+	sql := "SELECT id FROM blobs WHERE " + conditions
+	if rule.KeepNewest > 0 {
+		sql = fmt.Sprintf("SELECT id FROM blobs WHERE id IN (%s ORDER BY julianday(date) DESC, id DESC LIMIT -1 OFFSET ?)", sql)
+		args = append(args, rule.KeepNewest)
+	}
+
+	if cutoff := rule.Cutoff(now); cutoff != nil {
+		sql += " AND julianday(date) < julianday(?)"
+		args = append(args, *cutoff)
+	}
+
+	if rule.Action == models.LifecycleDelete {
+		sql += " AND " + unheldBlobsCondition
+	} else {
+		sql += " AND class <> ? AND " + mutableBlobsCondition
+		args = append(args, models.PermanentBlob)
+	}
+
+	return sql, args, nil
+}
+
+// matchLifecycleRule must be called with the lock held.
+func matchLifecycleRule(q sqlx.Queryer, bucket string, rule *models.LifecycleRule, now time.Time) ([]*models.Blob, error) {
+	sql, args, err := lifecycleRuleQuery(bucket, rule, now)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*models.Blob, 0)
+	err = sqlx.Select(q, &ret, "SELECT "+blobColumns+" FROM blobs WHERE id IN ("+sql+") ORDER BY id", args...)
+	return ret, err
+}
+
+// MatchLifecycleRule returns the blobs in a bucket which a rule would apply to.
+func (s *Store) MatchLifecycleRule(bucket string, rule *models.LifecycleRule, now time.Time) ([]*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return matchLifecycleRule(s.handle, bucket, rule, now)
+}
+
+// applyLifecycleRule moves the blobs matching a delete rule into the trash,
+// or makes the blobs matching a makePermanent rule permanent. Must be called
+// inside a transaction, so that every matching blob is changed together.
+func applyLifecycleRule(tx *sqlx.Tx, bucket string, rule *models.LifecycleRule, now time.Time) ([]*models.Blob, error) {
+	matched, err := matchLifecycleRule(tx, bucket, rule, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range matched {
+		switch rule.Action {
+		case models.LifecycleDelete:
+			_, err = tx.Exec(`UPDATE blobs SET deleted = ?, revision = revision + 1 WHERE id = ?`, now, b.Id)
+		case models.LifecycleMakePermanent:
+			_, err = tx.Exec(`UPDATE blobs SET class = ?, revision = revision + 1 WHERE id = ?`, models.PermanentBlob, b.Id)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return matched, nil
+}
+
+// ApplyLifecycleRule moves the blobs matching a delete rule into the trash,
+// or makes the blobs matching a makePermanent rule permanent.
+func (s *Store) ApplyLifecycleRule(bucket string, rule *models.LifecycleRule, now time.Time) ([]*models.Blob, error) {
+	var ret []*models.Blob
+	err := s.ChangeBlobs(func(tx interfaces.BlobChanges) (err error) {
+		ret, err = tx.ApplyLifecycleRule(bucket, rule, now)
+		return err
+	})
+	return ret, err
+}
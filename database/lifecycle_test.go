@@ -0,0 +1,112 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func blobIdsForTesting(blobs []*models.Blob) []int64 {
+	ret := make([]int64, 0)
+	for _, b := range blobs {
+		ret = append(ret, b.Id)
+	}
+	return ret
+}
+
+func TestStore_Lifecycle(t *testing.T) {
+	Convey("Given a store with blobs of different ages...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		old := insertBlobForTesting(handle, "nightly-1.tar", "builds", "alice", models.TemporaryBlob, 10, now.AddDate(0, 0, -100))
+		older := insertBlobForTesting(handle, "nightly-2.tar", "builds", "alice", models.TemporaryBlob, 10, now.AddDate(0, 0, -95))
+		recent := insertBlobForTesting(handle, "nightly-3.tar", "builds", "alice", models.TemporaryBlob, 10, now.AddDate(0, 0, -1))
+		release := insertBlobForTesting(handle, "release.tar", "builds", "alice", models.TemporaryBlob, 10, now.AddDate(0, 0, -200))
+
+		Convey("Should match blobs older than a number of days...", func() {
+			rule := &models.LifecycleRule{Action: models.LifecycleDelete, OlderThanDays: 90}
+			matched, err := handle.MatchLifecycleRule("builds", rule, now)
+			So(err, ShouldBeNil)
+			So(blobIdsForTesting(matched), ShouldResemble, []int64{old.Id, older.Id, release.Id})
+
+			Convey("Without changing them...", func() {
+				_, err := handle.RetrieveBlobById(old.Id)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("Should keep the newest blobs matching a pattern...", func() {
+			rule := &models.LifecycleRule{Action: models.LifecycleDelete, NamePattern: "nightly-*", KeepNewest: 2}
+			matched, err := handle.MatchLifecycleRule("builds", rule, now)
+			So(err, ShouldBeNil)
+			So(blobIdsForTesting(matched), ShouldResemble, []int64{old.Id})
+		})
+
+		Convey("Should match tagged blobs...", func() {
+			tagged := *recent
+			tagged.Metadata = models.MetadataMap{"keep": true}
+			_, err := handle.UpdateBlobRecord(&tagged, recent.Revision)
+			So(err, ShouldBeNil)
+
+			rule := &models.LifecycleRule{Action: models.LifecycleMakePermanent, HasMetadata: "keep"}
+			matched, err := handle.ApplyLifecycleRule("builds", rule, now)
+			So(err, ShouldBeNil)
+			So(blobIdsForTesting(matched), ShouldResemble, []int64{recent.Id})
+
+			b, err := handle.RetrieveBlobById(recent.Id)
+			So(err, ShouldBeNil)
+			So(b.Class, ShouldEqual, models.PermanentBlob)
+
+			Convey("But only once...", func() {
+				matched, err := handle.MatchLifecycleRule("builds", rule, now)
+				So(err, ShouldBeNil)
+				So(matched, ShouldBeEmpty)
+			})
+		})
+
+		Convey("Applying a delete rule should move blobs into the trash...", func() {
+			_, err := handle.SetBlobProtection(release.Id, &models.BlobProtection{LegalHold: true})
+			So(err, ShouldBeNil)
+
+			rule := &models.LifecycleRule{Action: models.LifecycleDelete, OlderThanDays: 90}
+			matched, err := handle.ApplyLifecycleRule("builds", rule, now)
+			So(err, ShouldBeNil)
+			So(blobIdsForTesting(matched), ShouldResemble, []int64{old.Id, older.Id})
+
+			_, err = handle.RetrieveBlobById(old.Id)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+			_, err = handle.RetrieveTrashedBlob(old.Id)
+			So(err, ShouldBeNil)
+
+			Convey("Except for blobs under legal hold...", func() {
+				_, err := handle.RetrieveBlobById(release.Id)
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("Rules should be stored with the bucket...", func() {
+			bucket, err := handle.RetrieveBucket("builds")
+			So(err, ShouldBeNil)
+			bucket.RetentionDays = 30
+			bucket.Lifecycle = models.LifecycleRules{{Action: models.LifecycleDelete, NamePattern: "nightly-*", KeepNewest: 20}}
+			_, err = handle.UpdateBucket(bucket)
+			So(err, ShouldBeNil)
+
+			bucket, err = handle.RetrieveBucket("builds")
+			So(err, ShouldBeNil)
+			So(bucket.Lifecycle, ShouldResemble, models.LifecycleRules{{Action: models.LifecycleDelete, NamePattern: "nightly-*", KeepNewest: 20}})
+			So(len(bucket.ActiveLifecycleRules()), ShouldEqual, 2)
+
+			Convey("And be checked...", func() {
+				bucket.Lifecycle = models.LifecycleRules{{Action: "explode"}}
+				_, err = handle.UpdateBucket(bucket)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
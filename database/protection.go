@@ -0,0 +1,116 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// unheldBlobsCondition excludes blobs which are under legal hold, either
+// themselves or through their bucket.
+const unheldBlobsCondition = `NOT legal_hold AND NOT COALESCE((SELECT legal_hold FROM buckets WHERE name = blobs.bucket), 0)`
+
+// mutableBlobsCondition excludes blobs which are write-once, either themselves
+// or through their bucket.
+const mutableBlobsCondition = `NOT immutable AND NOT COALESCE((SELECT immutable FROM buckets WHERE name = blobs.bucket), 0)`
+
+// blobProtection is a blob's effective protection, taking its bucket into account.
+type blobProtection struct {
+	// Complete is set once the blob's content has been uploaded.
+	Complete  bool `db:"complete"`
+	Immutable bool `db:"immutable"`
+	LegalHold bool `db:"legal_hold"`
+}
+
+// retrieveBlobProtection works out how a blob is protected, including blobs in
+// the trash. Must be called with the lock held.
+func retrieveBlobProtection(q sqlx.Queryer, id int64) (*blobProtection, error) {
+	ret := make([]blobProtection, 0)
+	err := sqlx.Select(q, &ret, `
+		SELECT
+			b.sha1 <> '' AS complete,
+			b.immutable OR COALESCE(k.immutable, 0) AS immutable,
+			b.legal_hold OR COALESCE(k.legal_hold, 0) AS legal_hold
+		FROM blobs b
+		LEFT JOIN buckets k ON k.name = b.bucket
+		WHERE b.id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	}
+	return &ret[0], nil
+}
+
+// checkBlobModifiable must be called with the lock held.
+func checkBlobModifiable(q sqlx.Queryer, id int64) error {
+	p, err := retrieveBlobProtection(q, id)
+	if err != nil {
+		return err
+	}
+	// Write-once blobs can still be written the first time around
+	if p.Immutable && p.Complete {
+		return interfaces.BlobImmutableError
+	}
+	return nil
+}
+
+// checkBlobDeletable must be called with the lock held.
+func checkBlobDeletable(q sqlx.Queryer, id int64) error {
+	p, err := retrieveBlobProtection(q, id)
+	if err != nil {
+		return err
+	}
+	// Abandoned uploads can always be cleaned up
+	if p.LegalHold && p.Complete {
+		return interfaces.BlobLegalHoldError
+	}
+	return nil
+}
+
+// CheckBlobModifiable returns BlobImmutableError if a blob or its bucket is
+// write-once and its content has already been uploaded.
+func (s *Store) CheckBlobModifiable(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return checkBlobModifiable(s.handle, id)
+}
+
+// CheckBlobDeletable returns BlobLegalHoldError if a blob or its bucket is
+// under legal hold and its content has been uploaded.
+func (s *Store) CheckBlobDeletable(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return checkBlobDeletable(s.handle, id)
+}
+
+// setBlobProtection changes a blob's write-once and legal hold flags. Must be
+// called with the lock held.
+func setBlobProtection(e sqlx.Ext, id int64, protection *models.BlobProtection) (*models.Blob, error) {
+	current := make([]models.Blob, 0)
+	err := sqlx.Select(e, &current, "SELECT "+blobColumns+" FROM blobs WHERE id = ? AND "+liveBlobsCondition, id)
+	if err != nil {
+		return nil, err
+	} else if len(current) == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	} else if current[0].Immutable && !protection.Immutable {
+		return nil, interfaces.WriteOnceSettingError
+	}
+
+	_, err = e.Exec(`
+		UPDATE blobs SET immutable = ?, legal_hold = ?, revision = revision + 1
+		WHERE id = ?`, protection.Immutable, protection.LegalHold, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return retrieveBlob(e, id)
+}
+
+// SetBlobProtection changes a blob's write-once and legal hold flags.
+func (s *Store) SetBlobProtection(id int64, protection *models.BlobProtection) (*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return setBlobProtection(s.handle, id, protection)
+}
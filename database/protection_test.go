@@ -0,0 +1,101 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Protection(t *testing.T) {
+	Convey("Given a store with a blob...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		blob := insertBlobForTesting(handle, "release.tar", "releases", "alice", models.PermanentBlob, 10, time.Now())
+
+		Convey("Unprotected blobs can be changed and deleted...", func() {
+			So(handle.CheckBlobModifiable(blob.Id), ShouldBeNil)
+			So(handle.CheckBlobDeletable(blob.Id), ShouldBeNil)
+		})
+
+		Convey("Write-once blobs can't be changed...", func() {
+			protected, err := handle.SetBlobProtection(blob.Id, &models.BlobProtection{Immutable: true})
+			So(err, ShouldBeNil)
+			So(protected.Immutable, ShouldBeTrue)
+
+			So(handle.CheckBlobModifiable(blob.Id), ShouldEqual, interfaces.BlobImmutableError)
+			So(handle.CheckBlobDeletable(blob.Id), ShouldBeNil)
+
+			d := *protected
+			d.Name = "renamed.tar"
+			_, err = handle.UpdateBlobRecord(&d, protected.Revision)
+			So(err, ShouldEqual, interfaces.BlobImmutableError)
+
+			Convey("And can't stop being write-once...", func() {
+				_, err := handle.SetBlobProtection(blob.Id, &models.BlobProtection{})
+				So(err, ShouldEqual, interfaces.WriteOnceSettingError)
+			})
+		})
+
+		Convey("Blobs under legal hold can't be deleted...", func() {
+			_, err := handle.SetBlobProtection(blob.Id, &models.BlobProtection{LegalHold: true})
+			So(err, ShouldBeNil)
+
+			So(handle.TrashBlobById(blob.Id), ShouldEqual, interfaces.BlobLegalHoldError)
+			So(handle.DeleteBlobById(blob.Id), ShouldEqual, interfaces.BlobLegalHoldError)
+
+			Convey("Until the hold is released...", func() {
+				_, err := handle.SetBlobProtection(blob.Id, &models.BlobProtection{})
+				So(err, ShouldBeNil)
+				So(handle.TrashBlobById(blob.Id), ShouldBeNil)
+			})
+		})
+
+		Convey("Bucket settings should protect every blob in the bucket...", func() {
+			bucket, err := handle.RetrieveBucket("releases")
+			So(err, ShouldBeNil)
+			bucket.Immutable = true
+			bucket.LegalHold = true
+			_, err = handle.UpdateBucket(bucket)
+			So(err, ShouldBeNil)
+
+			So(handle.CheckBlobModifiable(blob.Id), ShouldEqual, interfaces.BlobImmutableError)
+			So(handle.CheckBlobDeletable(blob.Id), ShouldEqual, interfaces.BlobLegalHoldError)
+
+			Convey("But new uploads can still be written once...", func() {
+				pending, err := handle.StoreBlobRecord(&models.Blob{
+					Name:     "next.tar",
+					Bucket:   "releases",
+					Date:     time.Now(),
+					Class:    models.PermanentBlob,
+					Uploader: "alice",
+					Metadata: models.MetadataMap{},
+					Size:     -1,
+				})
+				So(err, ShouldBeNil)
+				So(handle.CheckBlobModifiable(pending.Id), ShouldBeNil)
+				So(handle.DeleteBlobById(pending.Id), ShouldBeNil)
+			})
+
+			Convey("And the bucket can't stop being write-once...", func() {
+				bucket.Immutable = false
+				_, err := handle.UpdateBucket(bucket)
+				So(err, ShouldEqual, interfaces.WriteOnceSettingError)
+			})
+		})
+
+		Convey("Held blobs shouldn't expire from the trash...", func() {
+			err := handle.TrashBlobById(blob.Id)
+			So(err, ShouldBeNil)
+			_, err = handle.UpdateBucket(&models.Bucket{Name: "releases", BucketSettings: models.BucketSettings{LegalHold: true}})
+			So(err, ShouldBeNil)
+
+			expired, err := handle.ListExpiredTrash(time.Now().Add(time.Hour))
+			So(err, ShouldBeNil)
+			So(expired, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+)
+
+const quotaColumns = `scope, name, max_bytes, max_blobs`
+
+// ListQuotas returns every quota, ordered by scope and name.
+func (s *Store) ListQuotas() ([]*models.Quota, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Quota, 0)
+	err := s.handle.Select(&ret, "SELECT "+quotaColumns+" FROM quotas ORDER BY scope, name")
+	return ret, err
+}
+
+// RetrieveQuota returns an uploader's or bucket's own quota, falling back to
+// the default for its scope.
+func (s *Store) RetrieveQuota(scope models.QuotaScope, name string) (*models.Quota, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Quota, 0)
+	err := s.handle.Select(&ret, `
+		SELECT `+quotaColumns+` FROM quotas
+		WHERE scope = ? AND name IN (?, ?)
+		ORDER BY name = ?
+		LIMIT 1
+	`, scope, name, models.DefaultQuotaName, models.DefaultQuotaName)
+	if err != nil || len(ret) == 0 {
+		return nil, err
+	}
+	return ret[0], nil
+}
+
+// SetQuota creates or replaces a quota.
+func (s *Store) SetQuota(quota *models.Quota) (*models.Quota, error) {
+	err := quota.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, err = s.handle.NamedExec(`
+		INSERT OR REPLACE INTO quotas (`+quotaColumns+`)
+		VALUES (:scope, :name, :max_bytes, :max_blobs)
+	`, quota)
+	if err != nil {
+		return nil, err
+	}
+	return quota, nil
+}
+
+// DeleteQuota removes a quota.
+func (s *Store) DeleteQuota(scope models.QuotaScope, name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result, err := s.handle.Exec(`DELETE FROM quotas WHERE scope = ? AND name = ?`, scope, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return interfaces.NoSuchQuotaError
+	}
+	return nil
+}
+
+// RetrieveUsage adds up the blobs an uploader has uploaded, or which are in
+// a bucket. Blobs in the trash still take up space, so they're included.
+func (s *Store) RetrieveUsage(scope models.QuotaScope, name string) (*models.QuotaUsage, error) {
+	column := "uploader"
+	if scope == models.QuotaBucket {
+		column = "bucket"
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := &models.QuotaUsage{Scope: scope, Name: name}
+	err := s.handle.QueryRowx(`
+		SELECT COALESCE(SUM(size), 0), COUNT(*) FROM blobs WHERE `+column+` = ?
+	`, name).Scan(&ret.Bytes, &ret.Blobs)
+	return ret, err
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Quotas(t *testing.T) {
+	Convey("Given a store with some blobs...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		insertBlobForTesting(handle, "a", "photos", "alice", models.PermanentBlob, 10, time.Now())
+		insertBlobForTesting(handle, "b", "photos", "bob", models.PermanentBlob, 20, time.Now())
+		insertBlobForTesting(handle, "c", "logs", "alice", models.PermanentBlob, 40, time.Now())
+
+		Convey("Should be able to add up what uploaders and buckets store...", func() {
+			usage, err := handle.RetrieveUsage(models.QuotaUploader, "alice")
+			So(err, ShouldBeNil)
+			So(usage.Bytes, ShouldEqual, 50)
+			So(usage.Blobs, ShouldEqual, 2)
+
+			usage, err = handle.RetrieveUsage(models.QuotaBucket, "photos")
+			So(err, ShouldBeNil)
+			So(usage.Bytes, ShouldEqual, 30)
+			So(usage.Blobs, ShouldEqual, 2)
+
+			usage, err = handle.RetrieveUsage(models.QuotaBucket, "empty")
+			So(err, ShouldBeNil)
+			So(usage.Bytes, ShouldEqual, 0)
+			So(usage.Blobs, ShouldEqual, 0)
+		})
+
+		Convey("Should start without quotas...", func() {
+			quotas, err := handle.ListQuotas()
+			So(err, ShouldBeNil)
+			So(len(quotas), ShouldEqual, 0)
+
+			quota, err := handle.RetrieveQuota(models.QuotaUploader, "alice")
+			So(err, ShouldBeNil)
+			So(quota, ShouldBeNil)
+		})
+
+		Convey("Should be able to set quotas...", func() {
+			_, err := handle.SetQuota(&models.Quota{Scope: models.QuotaUploader, Name: "alice", MaxBytes: 100})
+			So(err, ShouldBeNil)
+			_, err = handle.SetQuota(&models.Quota{Scope: models.QuotaUploader, Name: models.DefaultQuotaName, MaxBlobs: 5})
+			So(err, ShouldBeNil)
+
+			quota, err := handle.RetrieveQuota(models.QuotaUploader, "alice")
+			So(err, ShouldBeNil)
+			So(quota.MaxBytes, ShouldEqual, 100)
+
+			Convey("Others should get the default...", func() {
+				quota, err := handle.RetrieveQuota(models.QuotaUploader, "bob")
+				So(err, ShouldBeNil)
+				So(quota.Name, ShouldEqual, models.DefaultQuotaName)
+				So(quota.MaxBlobs, ShouldEqual, 5)
+
+				quota, err = handle.RetrieveQuota(models.QuotaBucket, "photos")
+				So(err, ShouldBeNil)
+				So(quota, ShouldBeNil)
+			})
+
+			Convey("Should be able to replace them...", func() {
+				_, err := handle.SetQuota(&models.Quota{Scope: models.QuotaUploader, Name: "alice", MaxBytes: 200})
+				So(err, ShouldBeNil)
+				quotas, err := handle.ListQuotas()
+				So(err, ShouldBeNil)
+				So(len(quotas), ShouldEqual, 2)
+				So(quotas[1].MaxBytes, ShouldEqual, 200)
+			})
+
+			Convey("Should be able to remove them...", func() {
+				err := handle.DeleteQuota(models.QuotaUploader, "alice")
+				So(err, ShouldBeNil)
+				quota, err := handle.RetrieveQuota(models.QuotaUploader, "alice")
+				So(err, ShouldBeNil)
+				So(quota.Name, ShouldEqual, models.DefaultQuotaName)
+
+				err = handle.DeleteQuota(models.QuotaUploader, "alice")
+				So(err, ShouldEqual, interfaces.NoSuchQuotaError)
+			})
+		})
+
+		Convey("Should not be able to set invalid quotas...", func() {
+			_, err := handle.SetQuota(&models.Quota{Scope: "everyone", Name: "alice"})
+			So(err, ShouldNotBeNil)
+			_, err = handle.SetQuota(&models.Quota{Scope: models.QuotaBucket, Name: "photos", MaxBytes: -1})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -2,6 +2,7 @@ package database
 
 import (
 	"errors"
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"log"
 	"os"
@@ -13,6 +14,25 @@ type DatabaseSchemaVersion int
 const (
 	DbSchemaInvalid DatabaseSchemaVersion = 0
 	DbSchemaV1      DatabaseSchemaVersion = 1
+	DbSchemaV2      DatabaseSchemaVersion = 2
+	DbSchemaV3      DatabaseSchemaVersion = 3
+	DbSchemaV4      DatabaseSchemaVersion = 4
+	DbSchemaV5      DatabaseSchemaVersion = 5
+	DbSchemaV6      DatabaseSchemaVersion = 6
+	DbSchemaV7      DatabaseSchemaVersion = 7
+	DbSchemaV8      DatabaseSchemaVersion = 8
+	DbSchemaV9      DatabaseSchemaVersion = 9
+	DbSchemaV10     DatabaseSchemaVersion = 10
+	DbSchemaV11     DatabaseSchemaVersion = 11
+	DbSchemaV12     DatabaseSchemaVersion = 12
+	DbSchemaV13     DatabaseSchemaVersion = 13
+	DbSchemaV14     DatabaseSchemaVersion = 14
+	DbSchemaV15     DatabaseSchemaVersion = 15
+	DbSchemaV16     DatabaseSchemaVersion = 16
+	DbSchemaV17     DatabaseSchemaVersion = 17
+
+	// DbSchemaLatest is the version that CreateStore upgrades databases to.
+	DbSchemaLatest = DbSchemaV17
 )
 
 var SchemaUnknownVersionError = errors.New("unable to find the version key")
@@ -41,6 +61,264 @@ CREATE INDEX name_index ON blobs(name);
 CREATE INDEX bucket_index ON blobs(bucket);
 `
 
+// V2SchemaUpgrade stores metadata as TEXT so that it can be queried with
+// SQLite's JSON functions.
+const V2SchemaUpgrade = `
+UPDATE blobs SET metadata = CAST(metadata AS TEXT) WHERE typeof(metadata) = 'blob';
+`
+
+// V3SchemaUpgrade adds a full-text index over blob names and metadata values,
+// which is kept up to date by triggers.
+const V3SchemaUpgrade = `
+CREATE VIRTUAL TABLE blobs_fts USING fts4(name, metadata, tokenize=unicode61);
+
+CREATE TRIGGER blobs_fts_insert AFTER INSERT ON blobs BEGIN
+	INSERT INTO blobs_fts(docid, name, metadata) VALUES (
+		new.id, new.name,
+		(SELECT group_concat(value, ' ') FROM json_tree(new.metadata) WHERE type NOT IN ('object', 'array'))
+	);
+END;
+
+CREATE TRIGGER blobs_fts_update AFTER UPDATE OF name, metadata ON blobs BEGIN
+	UPDATE blobs_fts SET
+		name = new.name,
+		metadata = (SELECT group_concat(value, ' ') FROM json_tree(new.metadata) WHERE type NOT IN ('object', 'array'))
+	WHERE docid = new.id;
+END;
+
+CREATE TRIGGER blobs_fts_delete AFTER DELETE ON blobs BEGIN
+	DELETE FROM blobs_fts WHERE docid = old.id;
+END;
+
+INSERT INTO blobs_fts(docid, name, metadata)
+	SELECT id, name, (SELECT group_concat(value, ' ') FROM json_tree(blobs.metadata) WHERE type NOT IN ('object', 'array'))
+	FROM blobs;
+`
+
+// V4SchemaUpgrade makes buckets first-class, with per-bucket settings.
+const V4SchemaUpgrade = `
+CREATE TABLE buckets (
+	name TEXT NOT NULL PRIMARY KEY,
+	created DATETIME NOT NULL,
+	default_class TEXT NOT NULL DEFAULT '',
+	max_blob_size INTEGER NOT NULL DEFAULT 0,
+	allowed_uploaders TEXT NOT NULL DEFAULT '[]',
+	retention_days INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO buckets (name, created)
+	SELECT bucket, MIN(date) FROM blobs GROUP BY bucket;
+`
+
+// V5SchemaUpgrade adds a revision counter to each blob, which is incremented
+// whenever its record changes.
+const V5SchemaUpgrade = `
+ALTER TABLE blobs ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
+`
+
+// V6SchemaUpgrade adds opt-in versioning: blobs uploaded to a versioned
+// bucket are numbered within their (bucket, name), and zero otherwise.
+const V6SchemaUpgrade = `
+ALTER TABLE blobs ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE buckets ADD COLUMN versioning BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE buckets ADD COLUMN max_versions INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX blobs_bucket_name_version_index ON blobs(bucket, name, version);
+`
+
+// V7SchemaUpgrade adds aliases, which are stable names pointing at blobs,
+// along with a history of where they've pointed.
+const V7SchemaUpgrade = `
+CREATE TABLE aliases (
+	name TEXT NOT NULL PRIMARY KEY,
+	blob INTEGER NOT NULL,
+	updated DATETIME NOT NULL
+);
+
+CREATE TABLE alias_history (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	alias TEXT NOT NULL,
+	previous INTEGER,
+	blob INTEGER NOT NULL,
+	date DATETIME NOT NULL
+);
+
+CREATE INDEX alias_history_alias_index ON alias_history(alias, id);
+`
+
+// V8SchemaUpgrade adds a trash: deleted blobs are marked with the time they
+// were deleted, and only removed for good once they've been there long enough.
+const V8SchemaUpgrade = `
+ALTER TABLE blobs ADD COLUMN deleted DATETIME;
+
+CREATE INDEX blobs_deleted_index ON blobs(deleted);
+`
+
+// V9SchemaUpgrade adds write-once and legal hold flags to blobs and buckets.
+const V9SchemaUpgrade = `
+ALTER TABLE blobs ADD COLUMN immutable BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE blobs ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE buckets ADD COLUMN immutable BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE buckets ADD COLUMN legal_hold BOOLEAN NOT NULL DEFAULT 0;
+`
+
+// V10SchemaUpgrade adds lifecycle rules to buckets, stored as a JSON array.
+const V10SchemaUpgrade = `
+ALTER TABLE buckets ADD COLUMN lifecycle TEXT NOT NULL DEFAULT '[]';
+`
+
+// V11SchemaUpgrade adds an intent log, which records content operations
+// until the blobs they affect are consistent again.
+const V11SchemaUpgrade = `
+CREATE TABLE intents (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	blob INTEGER NOT NULL,
+	operation TEXT NOT NULL,
+	created DATETIME NOT NULL
+);
+`
+
+// V12SchemaUpgrade adds API tokens. Only a hash of each token is stored.
+const V12SchemaUpgrade = `
+CREATE TABLE tokens (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	principal TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	created DATETIME NOT NULL,
+	revoked DATETIME
+);
+`
+
+// V13SchemaUpgrade adds per-bucket grants, groups, and the grants which new
+// buckets start with (by default, their creator is an admin). Every existing
+// bucket is given a row, and everyone can still read and write its blobs,
+// but nobody is made an admin of it: run the server with -add-admin after
+// upgrading to let someone delete blobs and manage buckets.
+const V13SchemaUpgrade = `
+CREATE TABLE grants (
+	bucket TEXT NOT NULL,
+	user_name TEXT NOT NULL DEFAULT '',
+	group_name TEXT NOT NULL DEFAULT '',
+	permission TEXT NOT NULL,
+	PRIMARY KEY (bucket, user_name, group_name, permission)
+);
+CREATE TABLE default_grants (
+	user_name TEXT NOT NULL DEFAULT '',
+	group_name TEXT NOT NULL DEFAULT '',
+	permission TEXT NOT NULL,
+	PRIMARY KEY (user_name, group_name, permission)
+);
+CREATE TABLE group_members (
+	name TEXT NOT NULL,
+	member TEXT NOT NULL,
+	PRIMARY KEY (name, member)
+);
+CREATE INDEX group_members_member ON group_members (member);
+INSERT INTO default_grants (user_name, permission) VALUES ('@creator', 'admin');
+INSERT OR IGNORE INTO buckets (name, created) SELECT DISTINCT bucket, CURRENT_TIMESTAMP FROM blobs;
+INSERT INTO grants (bucket, group_name, permission) SELECT name, '*', 'read' FROM buckets;
+INSERT INTO grants (bucket, group_name, permission) SELECT name, '*', 'write' FROM buckets;
+`
+
+// V14SchemaUpgrade adds quotas on uploaders and buckets, and indexes blobs by
+// uploader so that their usage can be added up.
+const V14SchemaUpgrade = `
+CREATE TABLE quotas (
+	scope TEXT NOT NULL,
+	name TEXT NOT NULL,
+	max_bytes INTEGER NOT NULL DEFAULT 0,
+	max_blobs INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (scope, name)
+);
+CREATE INDEX uploader_index ON blobs(uploader);
+`
+
+// V15SchemaUpgrade adds the audit log. Triggers stop its entries from being
+// changed or removed once they've been recorded.
+const V15SchemaUpgrade = `
+CREATE TABLE audit (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	date DATETIME NOT NULL,
+	actor TEXT NOT NULL,
+	address TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	blob INTEGER NOT NULL,
+	bucket TEXT NOT NULL,
+	old_sha1 TEXT,
+	old_size INTEGER,
+	new_sha1 TEXT,
+	new_size INTEGER
+);
+CREATE INDEX audit_blob_index ON audit(blob);
+CREATE INDEX audit_bucket_index ON audit(bucket);
+CREATE INDEX audit_actor_index ON audit(actor);
+CREATE TRIGGER audit_no_update BEFORE UPDATE ON audit
+BEGIN
+	SELECT RAISE(ABORT, 'the audit log is append-only');
+END;
+CREATE TRIGGER audit_no_delete BEFORE DELETE ON audit
+BEGIN
+	SELECT RAISE(ABORT, 'the audit log is append-only');
+END;
+`
+
+// V16SchemaUpgrade adds published events, webhooks, and an outbox of the
+// deliveries owed to them.
+const V16SchemaUpgrade = `
+CREATE TABLE events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	date DATETIME NOT NULL,
+	blob TEXT NOT NULL
+);
+CREATE TABLE webhooks (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	events TEXT NOT NULL DEFAULT '[]',
+	bucket TEXT NOT NULL DEFAULT '',
+	created DATETIME NOT NULL
+);
+CREATE TABLE webhook_outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	webhook INTEGER NOT NULL,
+	event INTEGER NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	next_attempt DATETIME NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	abandoned BOOLEAN NOT NULL DEFAULT 0
+);
+CREATE INDEX webhook_outbox_due_index ON webhook_outbox(abandoned, next_attempt);
+`
+
+// V17SchemaUpgrade records which bucket a blob was moved out of, so that
+// moves can be found from either bucket.
+const V17SchemaUpgrade = `
+ALTER TABLE audit ADD COLUMN old_bucket TEXT NOT NULL DEFAULT '';
+CREATE INDEX audit_old_bucket_index ON audit(old_bucket);
+`
+
+// schemaUpgrades maps each version onto the statements which upgrade a
+// database from the version immediately before it.
+var schemaUpgrades = map[DatabaseSchemaVersion]string{
+	DbSchemaV2:  V2SchemaUpgrade,
+	DbSchemaV3:  V3SchemaUpgrade,
+	DbSchemaV4:  V4SchemaUpgrade,
+	DbSchemaV5:  V5SchemaUpgrade,
+	DbSchemaV6:  V6SchemaUpgrade,
+	DbSchemaV7:  V7SchemaUpgrade,
+	DbSchemaV8:  V8SchemaUpgrade,
+	DbSchemaV9:  V9SchemaUpgrade,
+	DbSchemaV10: V10SchemaUpgrade,
+	DbSchemaV11: V11SchemaUpgrade,
+	DbSchemaV12: V12SchemaUpgrade,
+	DbSchemaV13: V13SchemaUpgrade,
+	DbSchemaV14: V14SchemaUpgrade,
+	DbSchemaV15: V15SchemaUpgrade,
+	DbSchemaV16: V16SchemaUpgrade,
+	DbSchemaV17: V17SchemaUpgrade,
+}
+
 type KeyValueConfig struct {
 	Key   string `db_name:"key"`
 	Value string `db_name:"value"`
@@ -79,17 +357,66 @@ func GetDatabaseSchemaVersion(path string) (DatabaseSchemaVersion, error) {
 	if err != nil {
 		return DbSchemaInvalid, err
 	}
+	return readDatabaseSchemaVersion(configValues)
+}
+
+func readDatabaseSchemaVersion(configValues []KeyValueConfig) (DatabaseSchemaVersion, error) {
 	for _, c := range configValues {
 		if c.Key == "db_schema" {
-			if c.Value == "v1" {
-				return DbSchemaV1, nil
+			var version DatabaseSchemaVersion
+			_, err := fmt.Sscanf(c.Value, "v%d", &version)
+			if err != nil || version <= DbSchemaInvalid {
+				return DbSchemaInvalid, SchemaUnknownVersionError
 			}
+			if version > DbSchemaLatest {
+				return version, SchemaUnsupportedVersionError
+			}
+			return version, nil
 		}
 	}
 
 	return DbSchemaInvalid, SchemaUnknownVersionError
 }
 
+// UpgradeDatabaseSchema applies each outstanding schema upgrade in turn,
+// bringing the database up to DbSchemaLatest.
+func UpgradeDatabaseSchema(db *sqlx.DB) error {
+	configValues, err := GetConfigurationValues(db)
+	if err != nil {
+		return err
+	}
+	version, err := readDatabaseSchemaVersion(configValues)
+	if err != nil {
+		return err
+	}
+
+	for version < DbSchemaLatest {
+		version++
+		log.Printf("Upgrading database schema to v%d...", version)
+
+		tx, err := db.Beginx()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(schemaUpgrades[version])
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("schema upgrade to v%d: %w", version, err)
+		}
+		_, err = tx.Exec(`UPDATE configuration SET value = ? WHERE key = "db_schema"`, fmt.Sprintf("v%d", version))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func GetConfigurationValues(db *sqlx.DB) ([]KeyValueConfig, error) {
 	ret := []KeyValueConfig{}
 	err := db.Select(&ret, "SELECT key, value FROM configuration")
@@ -1,6 +1,9 @@
 package database
 
 import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
 	. "github.com/smartystreets/goconvey/convey"
 	"io/ioutil"
 	"log"
@@ -28,3 +31,58 @@ func TestCreateDatabaseIfNotExists(t *testing.T) {
 		})
 	})
 }
+
+func TestUpgradeDatabaseSchema(t *testing.T) {
+	Convey("Given a freshly created database...", t, func() {
+		tmpFile, err := ioutil.TempFile("", "repo")
+		So(err, ShouldBeNil)
+		os.Remove(tmpFile.Name())
+
+		err = CreateDatabaseIfNotExists(tmpFile.Name())
+		So(err, ShouldBeNil)
+
+		Convey("Opening it as a store should upgrade it to the latest version", func() {
+			handle, err := CreateStore(tmpFile.Name())
+			So(err, ShouldBeNil)
+			handle.Close()
+
+			version, err := GetDatabaseSchemaVersion(tmpFile.Name())
+			So(err, ShouldBeNil)
+			So(version, ShouldEqual, DbSchemaLatest)
+		})
+	})
+}
+
+func TestUpgradeDatabaseSchema_Grants(t *testing.T) {
+	Convey("Given a database with a bucket from before grants...", t, func() {
+		tmpFile, err := ioutil.TempFile("", "repo")
+		So(err, ShouldBeNil)
+		os.Remove(tmpFile.Name())
+		defer os.Remove(tmpFile.Name())
+
+		err = CreateDatabaseIfNotExists(tmpFile.Name())
+		So(err, ShouldBeNil)
+		db, err := sqlx.Open("sqlite3", tmpFile.Name())
+		So(err, ShouldBeNil)
+		for version := DbSchemaV2; version < DbSchemaV13; version++ {
+			_, err = db.Exec(schemaUpgrades[version])
+			So(err, ShouldBeNil)
+		}
+		_, err = db.Exec(`UPDATE configuration SET value = "v12" WHERE key = "db_schema"`)
+		So(err, ShouldBeNil)
+		_, err = db.Exec(`INSERT INTO buckets (name, created) VALUES ('legacy', CURRENT_TIMESTAMP)`)
+		So(err, ShouldBeNil)
+		db.Close()
+
+		Convey("Everyone should still be able to read and write it, but not administer it...", func() {
+			handle, err := CreateStore(tmpFile.Name())
+			So(err, ShouldBeNil)
+			defer handle.Close()
+
+			So(handle.CheckPermission("bob", "legacy", models.PermissionRead), ShouldBeNil)
+			So(handle.CheckPermission("bob", "legacy", models.PermissionWrite), ShouldBeNil)
+			So(handle.CheckPermission("bob", "legacy", models.PermissionDelete), ShouldEqual, interfaces.AccessDeniedError)
+			So(handle.CheckPermission("bob", "legacy", models.PermissionAdmin), ShouldEqual, interfaces.AccessDeniedError)
+		})
+	})
+}
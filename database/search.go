@@ -0,0 +1,338 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+)
+
+// searchClause accumulates the WHERE conditions and arguments of a search.
+type searchClause struct {
+	conditions []string
+	args       []interface{}
+}
+
+func (c *searchClause) add(condition string, args ...interface{}) {
+	c.conditions = append(c.conditions, condition)
+	c.args = append(c.args, args...)
+}
+
+// escapeGlob quotes GLOB's special characters so that they match literally.
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[':
+			b.WriteRune('[')
+			b.WriteRune(r)
+			b.WriteRune(']')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// metadataExpression returns the SQL expression which extracts a top-level
+// metadata key. Keys must have been validated, since they're inlined so that
+// the expression can match the ones used by CreateMetadataIndex.
+func metadataExpression(function, key string) string {
+	return fmt.Sprintf(`%s(metadata, '$."%s"')`, function, key)
+}
+
+// addMetadataPredicate converts a MetadataPredicate into a condition.
+func (c *searchClause) addMetadataPredicate(p *models.MetadataPredicate) {
+	value := metadataExpression("json_extract", p.Key)
+	valueType := metadataExpression("json_type", p.Key)
+
+	var arg interface{} = p.Value
+	if b, ok := p.Value.(bool); ok {
+		// json_extract returns booleans as integers
+		arg = 0
+		if b {
+			arg = 1
+		}
+	}
+
+	switch p.Op {
+	case models.MetadataExists:
+		c.add(valueType + " IS NOT NULL")
+	case models.MetadataMissing:
+		c.add(valueType + " IS NULL")
+	case models.MetadataEquals:
+		if p.Value == nil {
+			c.add(valueType + " = 'null'")
+		} else {
+			c.add(value+" = ?", arg)
+		}
+	case models.MetadataNotEquals:
+		if p.Value == nil {
+			c.add("COALESCE(" + valueType + " != 'null', 1)")
+		} else {
+			c.add("COALESCE("+value+" != ?, 1)", arg)
+		}
+	default:
+		operators := map[models.MetadataOperator]string{
+			models.MetadataLessThan:       "<",
+			models.MetadataLessOrEqual:    "<=",
+			models.MetadataGreaterThan:    ">",
+			models.MetadataGreaterOrEqual: ">=",
+		}
+		c.add(fmt.Sprintf("(%s IN ('integer', 'real') AND %s %s ?)", valueType, value, operators[p.Op]), arg)
+	}
+}
+
+// checkSearchError reports SQLite rejecting a full-text query, e.g. one with
+// unbalanced quotes or a bare AND, as the search's fault rather than the store's.
+func checkSearchError(err error) error {
+	if err != nil && strings.Contains(err.Error(), "malformed MATCH expression") {
+		return models.InvalidSearchTextError
+	}
+	return err
+}
+
+// buildSearchClause converts a BlobSearch into a SQL WHERE clause (without the
+// WHERE keyword) and its positional arguments. Only blobs which aren't in the
+// trash are matched.
+func buildSearchClause(qry *models.BlobSearch) (string, []interface{}) {
+	c := &searchClause{}
+
+	if qry.Name != nil {
+		c.add("name = ?", *qry.Name)
+	}
+	if qry.NamePrefix != nil {
+		c.add("name GLOB ?", escapeGlob(*qry.NamePrefix)+"*")
+	}
+	if qry.NameGlob != nil {
+		c.add("name GLOB ?", *qry.NameGlob)
+	}
+	if qry.Text != nil {
+		c.add("id IN (SELECT docid FROM blobs_fts WHERE blobs_fts MATCH ?)", *qry.Text)
+	}
+	if qry.Bucket != nil {
+		c.add("bucket = ?", *qry.Bucket)
+	}
+	if qry.Checksum != nil {
+		c.add("sha1 = ?", *qry.Checksum)
+	}
+	if qry.Uploader != nil {
+		c.add("uploader = ?", *qry.Uploader)
+	}
+	if qry.Class != nil {
+		c.add("class = ?", string(*qry.Class))
+	}
+	if qry.UploadedAfter != nil {
+		c.add("julianday(date) >= julianday(?)", *qry.UploadedAfter)
+	}
+	if qry.UploadedBefore != nil {
+		c.add("julianday(date) <= julianday(?)", *qry.UploadedBefore)
+	}
+	if qry.MinSize != nil {
+		c.add("size >= ?", *qry.MinSize)
+	}
+	if qry.MaxSize != nil {
+		c.add("size <= ?", *qry.MaxSize)
+	}
+	for i := range qry.Metadata {
+		c.addMetadataPredicate(&qry.Metadata[i])
+	}
+
+	// Blobs in the trash are never listed or searched, and nor are blobs
+	// in buckets which the searcher can't read
+	base, args := liveBlobsCondition, []interface{}{}
+	if qry.VisibleTo != nil {
+		condition, conditionArgs := readableBlobsCondition(*qry.VisibleTo)
+		base += " AND " + condition
+		args = append(args, conditionArgs...)
+	}
+	if len(c.conditions) == 0 {
+		return base, args
+	}
+
+	separator := " AND "
+	if qry.Mode == models.MatchAny {
+		separator = " OR "
+	}
+	return base + " AND (" + strings.Join(c.conditions, separator) + ")", append(args, c.args...)
+}
+
+// SearchBlobs retrieves the ids of blobs matching all (or any) of the
+// criteria specified in a BlobSearch.
+func (s *Store) SearchBlobs(qry *models.BlobSearch) ([]int64, error) {
+	err := qry.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := buildSearchClause(qry)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := make([]int64, 0)
+	err = s.handle.Select(&ret, "SELECT id FROM blobs WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, checkSearchError(err)
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	}
+	return ret, nil
+}
+
+// CreateMetadataIndex indexes a frequently-queried metadata key, so that
+// searches on it don't need to scan every blob.
+func (s *Store) CreateMetadataIndex(key string) error {
+	p := models.MetadataPredicate{Key: key, Op: models.MetadataExists}
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+
+	sql := fmt.Sprintf("CREATE INDEX IF NOT EXISTS metadata_%x_index ON blobs(%s)",
+		key, metadataExpression("json_extract", key))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	_, err = s.handle.Exec(sql)
+	return err
+}
+
+// sortExpressions maps each SortField onto the SQL expression it orders by.
+var sortExpressions = map[models.SortField]string{
+	models.SortById:   "id",
+	models.SortByDate: "julianday(date)",
+	models.SortBySize: "size",
+	models.SortByName: "name",
+}
+
+// pagedBlobRow is a blob alongside the bookkeeping needed to page through results.
+type pagedBlobRow struct {
+	models.Blob
+	Total     int64       `db:"total"`
+	SortValue interface{} `db:"sort_value"`
+}
+
+// ListBlobs retrieves a single page of blobs matching a BlobSearch (or every
+// blob, if the search is empty), using a single query.
+func (s *Store) ListBlobs(qry *models.BlobSearch, page *models.PageRequest) (*models.BlobPage, error) {
+	if !qry.IsEmpty() {
+		err := qry.Validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := page.Normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	where, whereArgs := buildSearchClause(qry)
+	sortExpression := sortExpressions[page.Sort]
+	direction, comparison := "ASC", ">"
+	if page.Order == models.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	// The total is counted over the whole search, the rows start after the cursor
+	args := append([]interface{}{}, whereArgs...)
+	args = append(args, whereArgs...)
+	pageCondition := "1"
+	if page.Cursor != "" {
+		cursor, err := page.DecodeCursor()
+		if err != nil {
+			return nil, err
+		}
+		pageCondition = fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortExpression, comparison)
+		args = append(args, cursor.Value, cursor.Value, cursor.Id)
+	}
+	// Retrieve one more row than needed to find out if there's another page
+	args = append(args, page.Limit+1)
+
+	sql := fmt.Sprintf(`
+		SELECT %[5]s,
+			(SELECT COUNT(*) FROM blobs WHERE %[1]s) AS total,
+			%[2]s AS sort_value
+		FROM blobs
+		WHERE %[1]s AND %[3]s
+		ORDER BY %[2]s %[4]s, id %[4]s
+		LIMIT ?`, where, sortExpression, pageCondition, direction, blobColumns)
+
+	s.lock.Lock()
+	rows := make([]pagedBlobRow, 0)
+	err = s.handle.Select(&rows, sql, args...)
+	s.lock.Unlock()
+	if err != nil {
+		return nil, checkSearchError(err)
+	}
+
+	ret := &models.BlobPage{Blobs: make([]*models.Blob, 0, len(rows))}
+	for i := range rows {
+		if i == page.Limit {
+			last := rows[i-1]
+			ret.NextCursor, err = page.EncodeCursor(last.SortValue, last.Id)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		ret.Total = rows[i].Total
+		ret.Blobs = append(ret.Blobs, &rows[i].Blob)
+	}
+
+	return ret, nil
+}
+
+// streamBatchSize is how many rows StreamBlobs reads while holding the lock.
+const streamBatchSize = 500
+
+// StreamBlobs writes every blob matching a BlobSearch (or every blob, if the
+// search is empty) into out in id order, then closes it. Blobs are read in
+// batches so that memory use stays flat and other queries can interleave.
+// Returns early, without error, if done is closed.
+func (s *Store) StreamBlobs(qry *models.BlobSearch, out chan *models.Blob, done <-chan struct{}) error {
+	defer close(out)
+
+	if !qry.IsEmpty() {
+		err := qry.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	where, whereArgs := buildSearchClause(qry)
+	sql := `
+		SELECT ` + blobColumns + `
+		FROM blobs
+		WHERE ` + where + ` AND id > ?
+		ORDER BY id
+		LIMIT ?`
+
+	lastId := int64(0)
+	for {
+		args := append([]interface{}{}, whereArgs...)
+		args = append(args, lastId, streamBatchSize)
+
+		batch := make([]models.Blob, 0, streamBatchSize)
+		s.lock.Lock()
+		err := s.handle.Select(&batch, sql, args...)
+		s.lock.Unlock()
+		if err != nil {
+			return checkSearchError(err)
+		}
+
+		for i := range batch {
+			select {
+			case out <- &batch[i]:
+			case <-done:
+				return nil
+			}
+		}
+
+		if len(batch) < streamBatchSize {
+			return nil
+		}
+		lastId = batch[len(batch)-1].Id
+	}
+}
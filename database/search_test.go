@@ -0,0 +1,390 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func insertBlobForTesting(handle *Store, name, bucket, uploader string, class models.BlobType, size int64, date time.Time) *models.Blob {
+	metadata := make(map[string]interface{})
+	metadata["some"] = "val"
+
+	b := &models.Blob{
+		Name:     name,
+		Bucket:   bucket,
+		Date:     date,
+		Class:    class,
+		Uploader: uploader,
+		Metadata: metadata,
+		Size:     -1,
+	}
+
+	inserted, err := handle.StoreBlobRecord(b)
+	So(err, ShouldBeNil)
+
+	c := *inserted
+	c.Checksum = "checksum_" + name
+	c.Size = size
+
+	updated, err := handle.FinalizeBlobRecord(&c)
+	So(err, ShouldBeNil)
+	return updated
+}
+
+func TestStore_SearchBlobs(t *testing.T) {
+	Convey("Given a store with some blobs...", t, func() {
+
+		tmpFile, err := ioutil.TempFile("", "repo")
+		So(err, ShouldBeNil)
+		log.Printf("Creating temporary file at: %s", tmpFile.Name())
+		os.Remove(tmpFile.Name())
+
+		handle, err := CreateStore(tmpFile.Name())
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		b1 := insertBlobForTesting(handle, "foo", "bar", "alice", models.TemporaryBlob, 10, now.Add(-48*time.Hour))
+		b2 := insertBlobForTesting(handle, "foo", "baz", "bob", models.PermanentBlob, 20, now.Add(-24*time.Hour))
+		b3 := insertBlobForTesting(handle, "qux", "bar", "alice", models.PermanentBlob, 30, now)
+
+		Convey("Criteria should be intersected by default...", func() {
+			name, bucket := "foo", "bar"
+			ids, err := handle.SearchBlobs(&models.BlobSearch{Name: &name, Bucket: &bucket})
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []int64{b1.Id})
+		})
+
+		Convey("Criteria should be unioned if asked...", func() {
+			name, bucket := "foo", "bar"
+			ids, err := handle.SearchBlobs(&models.BlobSearch{Name: &name, Bucket: &bucket, Mode: models.MatchAny})
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []int64{b1.Id, b2.Id, b3.Id})
+		})
+
+		Convey("Should be able to filter by uploader and class...", func() {
+			uploader := "alice"
+			class := models.PermanentBlob
+			ids, err := handle.SearchBlobs(&models.BlobSearch{Uploader: &uploader, Class: &class})
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []int64{b3.Id})
+		})
+
+		Convey("Should be able to filter by date range...", func() {
+			after := now.Add(-36 * time.Hour)
+			before := now.Add(-12 * time.Hour)
+			ids, err := handle.SearchBlobs(&models.BlobSearch{UploadedAfter: &after, UploadedBefore: &before})
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []int64{b2.Id})
+		})
+
+		Convey("Should be able to filter by size range...", func() {
+			minSize, maxSize := int64(15), int64(30)
+			ids, err := handle.SearchBlobs(&models.BlobSearch{MinSize: &minSize, MaxSize: &maxSize})
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []int64{b2.Id, b3.Id})
+		})
+
+		Convey("Should return the right error if nothing matches...", func() {
+			name, bucket := "qux", "baz"
+			ids, err := handle.SearchBlobs(&models.BlobSearch{Name: &name, Bucket: &bucket})
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+			So(ids, ShouldBeNil)
+		})
+
+		Convey("Should reject empty or inverted searches...", func() {
+			_, err := handle.SearchBlobs(&models.BlobSearch{})
+			So(err, ShouldEqual, models.EmptySearchError)
+
+			minSize, maxSize := int64(30), int64(15)
+			_, err = handle.SearchBlobs(&models.BlobSearch{MinSize: &minSize, MaxSize: &maxSize})
+			So(err, ShouldEqual, models.InvalidSearchRangeError)
+		})
+	})
+}
+
+func TestStore_SearchBlobsByMetadata(t *testing.T) {
+	Convey("Given a store with some tagged blobs...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		tag := func(b *models.Blob, metadata models.MetadataMap) {
+			b.Metadata = metadata
+			_, err := handle.FinalizeBlobRecord(b)
+			So(err, ShouldBeNil)
+		}
+
+		now := time.Now()
+		b1 := insertBlobForTesting(handle, "build", "ci", "alice", models.TemporaryBlob, 10, now)
+		tag(b1, models.MetadataMap{"commit": "abc", "branch": "master", "build": 41, "green": true})
+		b2 := insertBlobForTesting(handle, "build", "ci", "alice", models.TemporaryBlob, 10, now)
+		tag(b2, models.MetadataMap{"commit": "def", "branch": "master", "build": 42, "green": false})
+		b3 := insertBlobForTesting(handle, "build", "ci", "alice", models.TemporaryBlob, 10, now)
+		tag(b3, models.MetadataMap{"commit": "123", "branch": nil, "build": "43"})
+
+		search := func(predicates ...models.MetadataPredicate) []int64 {
+			ids, err := handle.SearchBlobs(&models.BlobSearch{Metadata: predicates})
+			if err == interfaces.NoMatchingBlobsError {
+				return []int64{}
+			}
+			So(err, ShouldBeNil)
+			return ids
+		}
+
+		Convey("Should be able to read the metadata back...", func() {
+			cur, err := handle.RetrieveBlobById(b1.Id)
+			So(err, ShouldBeNil)
+			So(cur.Metadata["commit"], ShouldEqual, "abc")
+		})
+
+		Convey("Should be able to match on equality...", func() {
+			So(search(models.MetadataPredicate{Key: "commit", Op: models.MetadataEquals, Value: "def"}), ShouldResemble, []int64{b2.Id})
+			So(search(models.MetadataPredicate{Key: "green", Op: models.MetadataEquals, Value: true}), ShouldResemble, []int64{b1.Id})
+			So(search(models.MetadataPredicate{Key: "branch", Op: models.MetadataEquals, Value: nil}), ShouldResemble, []int64{b3.Id})
+			So(search(models.MetadataPredicate{Key: "branch", Op: models.MetadataNotEquals, Value: "master"}), ShouldResemble, []int64{b3.Id})
+		})
+
+		Convey("Should be able to match on existence...", func() {
+			So(search(models.MetadataPredicate{Key: "green", Op: models.MetadataExists}), ShouldResemble, []int64{b1.Id, b2.Id})
+			So(search(models.MetadataPredicate{Key: "green", Op: models.MetadataMissing}), ShouldResemble, []int64{b3.Id})
+		})
+
+		Convey("Should only compare numbers numerically...", func() {
+			So(search(models.MetadataPredicate{Key: "build", Op: models.MetadataGreaterThan, Value: 41.0}), ShouldResemble, []int64{b2.Id})
+			So(search(models.MetadataPredicate{Key: "build", Op: models.MetadataLessOrEqual, Value: 42.0}), ShouldResemble, []int64{b1.Id, b2.Id})
+		})
+
+		Convey("Should combine metadata with other criteria...", func() {
+			So(search(
+				models.MetadataPredicate{Key: "branch", Op: models.MetadataEquals, Value: "master"},
+				models.MetadataPredicate{Key: "build", Op: models.MetadataGreaterOrEqual, Value: 42.0},
+			), ShouldResemble, []int64{b2.Id})
+		})
+
+		Convey("Should be able to index a metadata key...", func() {
+			err := handle.CreateMetadataIndex("commit")
+			So(err, ShouldBeNil)
+			So(search(models.MetadataPredicate{Key: "commit", Op: models.MetadataEquals, Value: "abc"}), ShouldResemble, []int64{b1.Id})
+
+			err = handle.CreateMetadataIndex("bad'key")
+			So(err, ShouldEqual, models.InvalidMetadataKeyError)
+		})
+	})
+}
+
+func TestStore_SearchBlobsByNamePatternAndText(t *testing.T) {
+	Convey("Given a store with some release artifacts...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		b1 := insertBlobForTesting(handle, "release-2026-01.tar.gz", "releases", "alice", models.PermanentBlob, 10, now)
+		b2 := insertBlobForTesting(handle, "release-2026-02.zip", "releases", "alice", models.PermanentBlob, 10, now)
+		b3 := insertBlobForTesting(handle, "release-2025-12.tar.gz", "releases", "alice", models.PermanentBlob, 10, now)
+		b4 := insertBlobForTesting(handle, "odd*name", "releases", "alice", models.PermanentBlob, 10, now)
+		b4.Metadata = models.MetadataMap{"notes": "Contains the hotfix for widgets", "nested": map[string]interface{}{"owner": "platform"}}
+		_, err = handle.FinalizeBlobRecord(b4)
+		So(err, ShouldBeNil)
+
+		search := func(qry *models.BlobSearch) []int64 {
+			ids, err := handle.SearchBlobs(qry)
+			if err == interfaces.NoMatchingBlobsError {
+				return []int64{}
+			}
+			So(err, ShouldBeNil)
+			return ids
+		}
+
+		Convey("Should be able to match on a name prefix...", func() {
+			prefix := "release-2026"
+			So(search(&models.BlobSearch{NamePrefix: &prefix}), ShouldResemble, []int64{b1.Id, b2.Id})
+		})
+
+		Convey("Prefixes should match glob characters literally...", func() {
+			prefix := "odd*"
+			So(search(&models.BlobSearch{NamePrefix: &prefix}), ShouldResemble, []int64{b4.Id})
+			prefix = "odd?"
+			So(search(&models.BlobSearch{NamePrefix: &prefix}), ShouldResemble, []int64{})
+		})
+
+		Convey("Should be able to match on a name glob...", func() {
+			glob := "release-2026-*.tar.gz"
+			So(search(&models.BlobSearch{NameGlob: &glob}), ShouldResemble, []int64{b1.Id})
+			glob = "release-*.tar.gz"
+			So(search(&models.BlobSearch{NameGlob: &glob}), ShouldResemble, []int64{b1.Id, b3.Id})
+		})
+
+		Convey("Should be able to search names and metadata values by text...", func() {
+			text := "zip"
+			So(search(&models.BlobSearch{Text: &text}), ShouldResemble, []int64{b2.Id})
+			text = "hotfix widgets"
+			So(search(&models.BlobSearch{Text: &text}), ShouldResemble, []int64{b4.Id})
+			text = "platform"
+			So(search(&models.BlobSearch{Text: &text}), ShouldResemble, []int64{b4.Id})
+		})
+
+		Convey("Should reject malformed full-text queries...", func() {
+			for _, text := range []string{"AND", "\"hotfix", "hotfix OR", "(widgets"} {
+				query := text
+				_, err := handle.SearchBlobs(&models.BlobSearch{Text: &query})
+				So(err, ShouldEqual, models.InvalidSearchTextError)
+				_, err = handle.ListBlobs(&models.BlobSearch{Text: &query}, &models.PageRequest{})
+				So(err, ShouldEqual, models.InvalidSearchTextError)
+			}
+		})
+
+		Convey("Full-text results should follow deletions...", func() {
+			err := handle.DeleteBlobById(b2.Id)
+			So(err, ShouldBeNil)
+			text := "zip"
+			So(search(&models.BlobSearch{Text: &text}), ShouldResemble, []int64{})
+		})
+	})
+}
+
+func TestStore_ListBlobs(t *testing.T) {
+	Convey("Given a store with some blobs...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		b1 := insertBlobForTesting(handle, "c", "bar", "alice", models.TemporaryBlob, 30, now.Add(-time.Hour))
+		b2 := insertBlobForTesting(handle, "a", "bar", "alice", models.TemporaryBlob, 10, now)
+		b3 := insertBlobForTesting(handle, "b", "baz", "alice", models.TemporaryBlob, 20, now.Add(-2*time.Hour))
+		b4 := insertBlobForTesting(handle, "d", "bar", "alice", models.TemporaryBlob, 20, now.Add(time.Hour))
+
+		// Walks through every page, returning the ids in order.
+		listAll := func(qry *models.BlobSearch, page models.PageRequest) ([]int64, int) {
+			ids := make([]int64, 0)
+			pages := 0
+			for {
+				cur, err := handle.ListBlobs(qry, &page)
+				So(err, ShouldBeNil)
+				So(cur.Total, ShouldEqual, 4)
+				pages++
+				for _, b := range cur.Blobs {
+					ids = append(ids, b.Id)
+				}
+				if cur.NextCursor == "" {
+					return ids, pages
+				}
+				page.Cursor = cur.NextCursor
+			}
+		}
+
+		Convey("Should list everything by id by default...", func() {
+			ids, pages := listAll(&models.BlobSearch{}, models.PageRequest{})
+			So(ids, ShouldResemble, []int64{b1.Id, b2.Id, b3.Id, b4.Id})
+			So(pages, ShouldEqual, 1)
+		})
+
+		Convey("Should be able to page by name...", func() {
+			ids, pages := listAll(&models.BlobSearch{}, models.PageRequest{Limit: 1, Sort: models.SortByName})
+			So(ids, ShouldResemble, []int64{b2.Id, b3.Id, b1.Id, b4.Id})
+			So(pages, ShouldEqual, 4)
+		})
+
+		Convey("Should be able to page by descending size, breaking ties by id...", func() {
+			ids, pages := listAll(&models.BlobSearch{}, models.PageRequest{Limit: 2, Sort: models.SortBySize, Order: models.Descending})
+			So(ids, ShouldResemble, []int64{b1.Id, b4.Id, b3.Id, b2.Id})
+			So(pages, ShouldEqual, 2)
+		})
+
+		Convey("Should be able to page by date...", func() {
+			ids, _ := listAll(&models.BlobSearch{}, models.PageRequest{Limit: 3, Sort: models.SortByDate})
+			So(ids, ShouldResemble, []int64{b3.Id, b1.Id, b2.Id, b4.Id})
+		})
+
+		Convey("Should only count and list matching blobs when searching...", func() {
+			bucket := "bar"
+			page, err := handle.ListBlobs(&models.BlobSearch{Bucket: &bucket}, &models.PageRequest{Limit: 2})
+			So(err, ShouldBeNil)
+			So(page.Total, ShouldEqual, 3)
+			So(len(page.Blobs), ShouldEqual, 2)
+			So(page.NextCursor, ShouldNotBeEmpty)
+		})
+
+		Convey("Should reject cursors for a different sort order...", func() {
+			page, err := handle.ListBlobs(&models.BlobSearch{}, &models.PageRequest{Limit: 1, Sort: models.SortByName})
+			So(err, ShouldBeNil)
+			_, err = handle.ListBlobs(&models.BlobSearch{}, &models.PageRequest{Limit: 1, Cursor: page.NextCursor})
+			So(err, ShouldEqual, models.InvalidCursorError)
+		})
+
+		Convey("Should be able to project fields...", func() {
+			page, err := handle.ListBlobs(&models.BlobSearch{}, &models.PageRequest{Limit: 1})
+			So(err, ShouldBeNil)
+			projected, err := page.Project([]string{"id", "size"})
+			So(err, ShouldBeNil)
+			So(projected.Blobs[0], ShouldResemble, map[string]interface{}{"id": float64(b1.Id), "size": float64(30)})
+
+			_, err = handle.ListBlobs(&models.BlobSearch{}, &models.PageRequest{Fields: []string{"password"}})
+			So(err, ShouldEqual, models.InvalidFieldError)
+		})
+	})
+}
+
+func TestStore_StreamBlobs(t *testing.T) {
+	Convey("Given a store with more blobs than fit in a batch...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		count := streamBatchSize*2 + 10
+		for i := 0; i < count; i++ {
+			bucket := "even"
+			if i%2 == 1 {
+				bucket = "odd"
+			}
+			insertBlobForTesting(handle, "blob", bucket, "alice", models.TemporaryBlob, 10, now)
+		}
+
+		Convey("Should stream every blob in order...", func() {
+			out := make(chan *models.Blob)
+			result := make(chan error, 1)
+			go func() {
+				result <- handle.StreamBlobs(&models.BlobSearch{}, out, nil)
+			}()
+
+			received := int64(0)
+			for b := range out {
+				received++
+				So(b.Id, ShouldEqual, received)
+			}
+			So(received, ShouldEqual, count)
+			So(<-result, ShouldBeNil)
+		})
+
+		Convey("Should only stream matching blobs...", func() {
+			bucket := "odd"
+			out := make(chan *models.Blob, count)
+			err := handle.StreamBlobs(&models.BlobSearch{Bucket: &bucket}, out, nil)
+			So(err, ShouldBeNil)
+			So(len(out), ShouldEqual, count/2)
+		})
+
+		Convey("Should stop when asked to...", func() {
+			out := make(chan *models.Blob)
+			done := make(chan struct{})
+			result := make(chan error, 1)
+			go func() {
+				result <- handle.StreamBlobs(&models.BlobSearch{}, out, done)
+			}()
+
+			<-out
+			close(done)
+			So(<-result, ShouldBeNil)
+			_, open := <-out
+			So(open, ShouldBeFalse)
+		})
+	})
+}
@@ -11,6 +11,21 @@ import (
 	"sync"
 )
 
+// blobColumns lists the columns which are scanned into a models.Blob.
+const blobColumns = `id, name, bucket, date, class, sha1, uploader, metadata, size, revision, version, deleted, immutable, legal_hold`
+
+// liveBlobsCondition excludes blobs which are in the trash.
+const liveBlobsCondition = `deleted IS NULL`
+
+// nextVersionSql numbers a blob called :name in :bucket, if that bucket has
+// versioning enabled. The bucket must already exist.
+const nextVersionSql = `(
+	SELECT CASE WHEN versioning
+		THEN (SELECT COALESCE(MAX(version), 0) + 1 FROM blobs WHERE bucket = :bucket AND name = :name)
+		ELSE 0
+	END FROM buckets WHERE name = :bucket
+)`
+
 type Store struct {
 	path   string
 	handle *sqlx.DB
@@ -44,12 +59,21 @@ func CreateStore(path string) (*Store, error) {
 	}
 
 	if path == ":memory:" {
+		// Each connection to :memory: gets its own database, so only use one.
+		db.SetMaxOpenConns(1)
 		_, err = db.Exec(V1Schema)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// Bring older databases up to date
+	err = UpgradeDatabaseSchema(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &Store{path, db, sync.Mutex{}}, nil
 }
 
@@ -63,51 +87,56 @@ func (s *Store) EstimateSizeOfManagedContent() (int64, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	sql := `SELECT SUM(size) FROM blobs`
-	result, err := s.handle.Query(sql)
+	sql := `SELECT COALESCE(SUM(size), 0) FROM blobs`
+	ret := int64(0)
+	err := s.handle.Get(&ret, sql)
 	if err != nil {
 		log.Printf("EstimateSizeOfManagedContent: SQL error: %s", err)
 		return int64(0), err
 	}
 
-	ret := int64(0)
-	for {
-		err = result.Scan(&ret)
-		break
-	}
-
-	return ret, err
+	return ret, nil
 
 }
 
-// StoreBlobRecord inserts a WIP-blob into the database and allocates an id.
-// Specifically, it stores the name, bucket, class, uploader, and metadata.
-func (s *Store) StoreBlobRecord(blob *models.Blob) (*models.Blob, error) {
+// storeBlobRecord inserts a WIP-blob and allocates an id. Must be called
+// with the lock held.
+func storeBlobRecord(e sqlx.Ext, blob *models.Blob) (*models.Blob, error) {
 
-	s.lock.Lock()
+	// Buckets are created implicitly by the first blob stored in them
+	err := createBucketIfNotExists(e, blob.Bucket, blob.Uploader)
+	if err != nil {
+		return nil, err
+	}
 
 	sql := `
-		INSERT INTO blobs (name, bucket, class, uploader, metadata, date, sha1, size) 
-		VALUES (:name, :bucket, :class, :uploader, :metadata, :date, :sha1, :size)
+		INSERT INTO blobs (name, bucket, class, uploader, metadata, date, sha1, size, immutable, legal_hold, version)
+		VALUES (:name, :bucket, :class, :uploader, :metadata, :date, :sha1, :size, :immutable, :legal_hold, ` + nextVersionSql + `)
 `
-	result, err := s.handle.NamedExec(sql, blob)
+	result, err := sqlx.NamedExec(e, sql, blob)
 	if err != nil {
-		s.lock.Unlock()
 		return nil, err
 	}
 
 	newId, err := result.LastInsertId()
 	if err != nil {
-		s.lock.Unlock()
 		return nil, err
 	}
 
-	s.lock.Unlock()
-	return s.RetrieveBlobById(newId)
+	return retrieveBlob(e, newId)
 }
 
-// FinalizeBlobRecord completes a blob and records all fields.
-func (s *Store) FinalizeBlobRecord(blob *models.Blob) (*models.Blob, error) {
+// StoreBlobRecord inserts a WIP-blob into the database and allocates an id.
+// Specifically, it stores the name, bucket, class, uploader, and metadata.
+func (s *Store) StoreBlobRecord(blob *models.Blob) (*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return storeBlobRecord(s.handle, blob)
+}
+
+// finalizeBlobRecord completes a blob and records all fields. Must be called
+// with the lock held.
+func finalizeBlobRecord(e sqlx.Ext, blob *models.Blob) (*models.Blob, error) {
 
 	sql := `
 		UPDATE blobs SET 
@@ -118,7 +147,8 @@ func (s *Store) FinalizeBlobRecord(blob *models.Blob) (*models.Blob, error) {
 			sha1 = :sha1, 
 			uploader = :uploader, 
 			metadata = :metadata,
-			size = :size
+			size = :size,
+			revision = revision + 1
 		WHERE
 			id = :id
 	`
@@ -150,26 +180,95 @@ func (s *Store) FinalizeBlobRecord(blob *models.Blob) (*models.Blob, error) {
 	}
 
 	// Process the update
-	s.lock.Lock()
-	_, err := s.handle.NamedExec(sql, blob)
+	err := createBucketIfNotExists(e, blob.Bucket, blob.Uploader)
+	if err != nil {
+		return nil, err
+	}
+	_, err = sqlx.NamedExec(e, sql, blob)
 	if err != nil {
-		s.lock.Unlock()
 		return nil, err
 	}
-	s.lock.Unlock()
 
 	// Retrieve the new blob
-	return s.RetrieveBlobById(blob.Id)
+	return retrieveBlob(e, blob.Id)
 }
 
-// RetrieveBlobById returns a blob record from the database with a given ID.
-func (s *Store) RetrieveBlobById(id int64) (*models.Blob, error) {
+// FinalizeBlobRecord completes a blob and records all fields.
+func (s *Store) FinalizeBlobRecord(blob *models.Blob) (*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return finalizeBlobRecord(s.handle, blob)
+}
+
+// updateBlobRecord changes a blob's name, bucket and metadata. Must be called
+// with the lock held.
+func updateBlobRecord(e sqlx.Ext, blob *models.Blob, revision int64) error {
+
+	// Blobs which are renamed or moved become the newest version of their new name
+	sql := `
+		UPDATE blobs SET
+			version = CASE WHEN bucket = :bucket AND name = :name THEN version ELSE ` + nextVersionSql + ` END,
+			name = :name,
+			bucket = :bucket,
+			metadata = :metadata,
+			revision = revision + 1
+		WHERE
+			id = :id AND revision = :revision AND ` + liveBlobsCondition + `
+	`
+	args := map[string]interface{}{
+		"id":       blob.Id,
+		"name":     blob.Name,
+		"bucket":   blob.Bucket,
+		"metadata": blob.Metadata,
+		"revision": revision,
+	}
+
+	err := checkBlobModifiable(e, blob.Id)
+	if err != nil {
+		return err
+	}
+	err = createBucketIfNotExists(e, blob.Bucket, "")
+	if err != nil {
+		return err
+	}
+	result, err := sqlx.NamedExec(e, sql, args)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Work out whether the blob is missing or has just moved on
+	_, err = retrieveBlob(e, blob.Id)
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return interfaces.BlobRevisionMismatchError
+	}
+	return nil
+}
+
+// UpdateBlobRecord changes a blob's name, bucket and metadata. It fails with
+// BlobRevisionMismatchError if the blob is no longer at the given revision.
+func (s *Store) UpdateBlobRecord(blob *models.Blob, revision int64) (*models.Blob, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	err := updateBlobRecord(s.handle, blob, revision)
+	if err != nil {
+		return nil, err
+	}
+	return retrieveBlob(s.handle, blob.Id)
+}
+
+// retrieveBlob returns a blob which isn't in the trash. Must be called with the lock held.
+func retrieveBlob(q sqlx.Queryer, id int64) (*models.Blob, error) {
 	ret := make([]models.Blob, 0)
-	err := s.handle.Select(&ret, "SELECT id, name, bucket, date, class, sha1, uploader, metadata, size FROM blobs WHERE id = :id", id)
+	err := sqlx.Select(q, &ret, "SELECT "+blobColumns+" FROM blobs WHERE id = ? AND "+liveBlobsCondition, id)
 	if err != nil {
-		return nil, fmt.Errorf("RetrieveBlobsById: %v", err)
+		return nil, fmt.Errorf("RetrieveBlobsById: %w", err)
 	}
 	if len(ret) == 0 {
 		return nil, interfaces.NoMatchingBlobsError
@@ -177,12 +276,20 @@ func (s *Store) RetrieveBlobById(id int64) (*models.Blob, error) {
 	return &ret[0], nil
 }
 
+// RetrieveBlobById returns a blob record from the database with a given ID,
+// unless it's in the trash.
+func (s *Store) RetrieveBlobById(id int64) (*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return retrieveBlob(s.handle, id)
+}
+
 // GetBlobIdsMatchingChecksum retrieves a list of blobs which match a given SHA1.
 func (s *Store) GetBlobIdsMatchingChecksum(checksum string) ([]int64, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	ret := make([]int64, 0)
-	err := s.handle.Select(&ret, "SELECT id FROM blobs WHERE sha1 = $1", checksum)
+	err := s.handle.Select(&ret, "SELECT id FROM blobs WHERE sha1 = $1 AND "+liveBlobsCondition, checksum)
 	if err != nil {
 		return nil, err
 	}
@@ -197,7 +304,7 @@ func (s *Store) GetBlobIdsMatchingName(name string) ([]int64, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	ret := make([]int64, 0)
-	err := s.handle.Select(&ret, "SELECT id FROM blobs WHERE name = $1", name)
+	err := s.handle.Select(&ret, "SELECT id FROM blobs WHERE name = $1 AND "+liveBlobsCondition, name)
 	if err != nil {
 		return nil, err
 	}
@@ -212,7 +319,7 @@ func (s *Store) GetBlobIdsMatchingBucket(bucket string) ([]int64, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	ret := make([]int64, 0)
-	err := s.handle.Select(&ret, "SELECT id FROM blobs WHERE bucket = $1", bucket)
+	err := s.handle.Select(&ret, "SELECT id FROM blobs WHERE bucket = $1 AND "+liveBlobsCondition, bucket)
 	if err != nil {
 		return nil, err
 	}
@@ -222,13 +329,25 @@ func (s *Store) GetBlobIdsMatchingBucket(bucket string) ([]int64, error) {
 	return ret, nil
 }
 
-// DeleteBlobById deletes a record.
+// deleteBlob deletes a record, unless it's under legal hold. Must be called
+// with the lock held.
+func deleteBlob(e sqlx.Ext, id int64) error {
+	err := checkBlobDeletable(e, id)
+	if err == interfaces.NoMatchingBlobsError {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	// Process the update
+	_, err = e.Exec(`DELETE FROM blobs WHERE id = $1`, id)
+	return err
+}
+
+// DeleteBlobById deletes a record, unless it's under legal hold.
 func (s *Store) DeleteBlobById(id int64) error {
 	s.lock.Lock()
 	defer s.lock.Unlock()
-	// Process the update
-	_, err := s.handle.Exec(`DELETE FROM blobs WHERE id = $1`, id)
-	return err
+	return deleteBlob(s.handle, id)
 }
 
 // GetAllBuckets retrieves a list of all the available buckets
@@ -236,6 +355,6 @@ func (s *Store) GetAllBuckets() ([]string, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	ret := make([]string, 0)
-	err := s.handle.Select(&ret, "SELECT DISTINCT bucket FROM blobs")
+	err := s.handle.Select(&ret, "SELECT name FROM buckets UNION SELECT DISTINCT bucket FROM blobs")
 	return ret, err
 }
@@ -84,15 +84,13 @@ func TestStore_StoreBlobRecord(t *testing.T) {
 			metadata["some"] = "val"
 
 			b := &models.Blob{
-				0,
-				"my_test_file",
-				"test_bucket",
-				time.Now(),
-				models.TemporaryBlob,
-				"",
-				"default",
-				metadata,
-				-1,
+				Name:     "my_test_file",
+				Bucket:   "test_bucket",
+				Date:     time.Now(),
+				Class:    models.TemporaryBlob,
+				Uploader: "default",
+				Metadata: metadata,
+				Size:     -1,
 			}
 
 			inserted, err := handle.StoreBlobRecord(b)
@@ -150,6 +148,42 @@ func TestStore_StoreBlobRecord(t *testing.T) {
 					So(cur.Date.Sub(c.Date).Seconds(), ShouldBeLessThan, 1)
 				})
 
+				Convey("Should be able to rename and move it...", func() {
+					d := *updated
+					d.Name = "my_renamed_file"
+					d.Bucket = "another_bucket"
+					d.Metadata = map[string]interface{}{"other": "val"}
+
+					moved, err := handle.UpdateBlobRecord(&d, updated.Revision)
+					So(err, ShouldBeNil)
+					So(moved.Name, ShouldEqual, "my_renamed_file")
+					So(moved.Bucket, ShouldEqual, "another_bucket")
+					So(moved.Metadata, ShouldResemble, d.Metadata)
+					So(moved.Checksum, ShouldEqual, updated.Checksum)
+					So(moved.Revision, ShouldEqual, updated.Revision+1)
+
+					Convey("But not from a stale revision...", func() {
+						_, err := handle.UpdateBlobRecord(&d, updated.Revision)
+						So(err, ShouldEqual, interfaces.BlobRevisionMismatchError)
+					})
+				})
+
+				Convey("Should be able to remove all of its metadata...", func() {
+					d := *updated
+					d.Metadata = models.MetadataMap{}
+
+					cleared, err := handle.UpdateBlobRecord(&d, updated.Revision)
+					So(err, ShouldBeNil)
+					So(cleared.Metadata, ShouldBeEmpty)
+				})
+
+				Convey("Should not be able to update a missing blob...", func() {
+					d := *updated
+					d.Id = updated.Id + 100
+					_, err := handle.UpdateBlobRecord(&d, updated.Revision)
+					So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+				})
+
 			})
 
 		})
@@ -172,15 +206,13 @@ func TestStore_RetrieveAllBuckets(t *testing.T) {
 			metadata["some"] = "val"
 
 			b1 := &models.Blob{
-				0,
-				"my_test_file",
-				"test_bucket",
-				time.Now(),
-				models.TemporaryBlob,
-				"",
-				"default",
-				metadata,
-				-1,
+				Name:     "my_test_file",
+				Bucket:   "test_bucket",
+				Date:     time.Now(),
+				Class:    models.TemporaryBlob,
+				Uploader: "default",
+				Metadata: metadata,
+				Size:     -1,
 			}
 
 			inserted, err := handle.StoreBlobRecord(b1)
@@ -188,15 +220,13 @@ func TestStore_RetrieveAllBuckets(t *testing.T) {
 			So(inserted, ShouldNotBeNil)
 
 			b2 := &models.Blob{
-				0,
-				"my_test_file",
-				"test_bucket_2",
-				time.Now(),
-				models.TemporaryBlob,
-				"",
-				"default",
-				metadata,
-				-1,
+				Name:     "my_test_file",
+				Bucket:   "test_bucket_2",
+				Date:     time.Now(),
+				Class:    models.TemporaryBlob,
+				Uploader: "default",
+				Metadata: metadata,
+				Size:     -1,
 			}
 
 			inserted, err = handle.StoreBlobRecord(b2)
@@ -230,15 +260,13 @@ func TestStore_DeleteById(t *testing.T) {
 			metadata["some"] = "val"
 
 			b := &models.Blob{
-				0,
-				"my_test_file",
-				"test_bucket",
-				time.Now(),
-				models.TemporaryBlob,
-				"",
-				"default",
-				metadata,
-				-1,
+				Name:     "my_test_file",
+				Bucket:   "test_bucket",
+				Date:     time.Now(),
+				Class:    models.TemporaryBlob,
+				Uploader: "default",
+				Metadata: metadata,
+				Size:     -1,
 			}
 
 			inserted, err := handle.StoreBlobRecord(b)
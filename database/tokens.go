@@ -0,0 +1,79 @@
+package database
+
+import (
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+)
+
+const tokenColumns = `id, principal, hash, created, revoked`
+
+// IssueToken creates a token for a principal, storing only its hash.
+func (s *Store) IssueToken(principal string) (*models.Token, string, error) {
+	secret, err := models.GenerateTokenSecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	token := &models.Token{Principal: principal, Hash: models.HashTokenSecret(secret), Created: time.Now()}
+	result, err := s.handle.NamedExec(`
+		INSERT INTO tokens (principal, hash, created)
+		VALUES (:principal, :hash, :created)
+	`, token)
+	if err != nil {
+		return nil, "", err
+	}
+	token.Id, err = result.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+	return token, secret, nil
+}
+
+// RevokeToken stops a token from being used.
+func (s *Store) RevokeToken(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result, err := s.handle.Exec(`UPDATE tokens SET revoked = ? WHERE id = ? AND revoked IS NULL`, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	} else if affected == 0 {
+		return interfaces.NoSuchTokenError
+	}
+	return nil
+}
+
+// ListTokens returns every token which has been issued, oldest first.
+func (s *Store) ListTokens() ([]*models.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Token, 0)
+	err := s.handle.Select(&ret, "SELECT "+tokenColumns+" FROM tokens ORDER BY id")
+	return ret, err
+}
+
+// AuthenticateToken looks a token up by its hash, provided it hasn't been revoked.
+func (s *Store) AuthenticateToken(secret string) (*models.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]models.Token, 0)
+	err := s.handle.Select(&ret, "SELECT "+tokenColumns+" FROM tokens WHERE hash = ? AND revoked IS NULL", models.HashTokenSecret(secret))
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.InvalidTokenError
+	}
+	return &ret[0], nil
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestStore_Tokens(t *testing.T) {
+	Convey("Given a store with a token...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		token, secret, err := handle.IssueToken("alice")
+		So(err, ShouldBeNil)
+		So(token.Principal, ShouldEqual, "alice")
+		So(secret, ShouldNotEqual, "")
+
+		Convey("Only the token's hash should be stored...", func() {
+			tokens, err := handle.ListTokens()
+			So(err, ShouldBeNil)
+			So(len(tokens), ShouldEqual, 1)
+			So(tokens[0].Hash, ShouldNotEqual, "")
+			So(tokens[0].Hash, ShouldNotEqual, secret)
+		})
+
+		Convey("Should be able to authenticate with the token...", func() {
+			authenticated, err := handle.AuthenticateToken(secret)
+			So(err, ShouldBeNil)
+			So(authenticated.Id, ShouldEqual, token.Id)
+			So(authenticated.Principal, ShouldEqual, "alice")
+
+			_, err = handle.AuthenticateToken("not" + secret)
+			So(err, ShouldEqual, interfaces.InvalidTokenError)
+		})
+
+		Convey("Each token should be different...", func() {
+			_, other, err := handle.IssueToken("alice")
+			So(err, ShouldBeNil)
+			So(other, ShouldNotEqual, secret)
+		})
+
+		Convey("Revoked tokens should stop working...", func() {
+			err := handle.RevokeToken(token.Id)
+			So(err, ShouldBeNil)
+
+			_, err = handle.AuthenticateToken(secret)
+			So(err, ShouldEqual, interfaces.InvalidTokenError)
+
+			tokens, err := handle.ListTokens()
+			So(err, ShouldBeNil)
+			So(tokens[0].Revoked, ShouldNotBeNil)
+
+			err = handle.RevokeToken(token.Id)
+			So(err, ShouldEqual, interfaces.NoSuchTokenError)
+		})
+	})
+}
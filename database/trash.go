@@ -0,0 +1,103 @@
+package database
+
+import (
+	"time"
+
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// trashBlob moves a blob into the trash, unless it's under legal hold. If
+// revision isn't zero, the blob must still be at that revision. Must be
+// called with the lock held.
+func trashBlob(e sqlx.Ext, id int64, now time.Time, revision int64) error {
+	err := checkBlobDeletable(e, id)
+	if err != nil {
+		return err
+	}
+	current, err := retrieveBlob(e, id)
+	if err != nil {
+		return err
+	} else if revision != 0 && current.Revision != revision {
+		return interfaces.BlobRevisionMismatchError
+	}
+	_, err = e.Exec(`UPDATE blobs SET deleted = ?, revision = revision + 1 WHERE id = ?`, now, id)
+	return err
+}
+
+// TrashBlobById moves a blob into the trash, unless it's under legal hold.
+func (s *Store) TrashBlobById(id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return trashBlob(s.handle, id, time.Now(), 0)
+}
+
+// restoreBlob moves a blob out of the trash. Must be called with the lock held.
+func restoreBlob(e sqlx.Ext, id int64) (*models.Blob, error) {
+	result, err := e.Exec(`
+		UPDATE blobs SET deleted = NULL, revision = revision + 1
+		WHERE id = ? AND deleted IS NOT NULL`, id)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	}
+
+	return retrieveBlob(e, id)
+}
+
+// RestoreBlobById moves a blob out of the trash.
+func (s *Store) RestoreBlobById(id int64) (*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return restoreBlob(s.handle, id)
+}
+
+// RetrieveTrashedBlob returns a blob which is in the trash.
+func (s *Store) RetrieveTrashedBlob(id int64) (*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]models.Blob, 0)
+	err := s.handle.Select(&ret, "SELECT "+blobColumns+" FROM blobs WHERE id = ? AND deleted IS NOT NULL", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	}
+	return &ret[0], nil
+}
+
+// ListTrash returns every blob in the trash, most recently deleted first.
+func (s *Store) ListTrash() ([]*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Blob, 0)
+	err := s.handle.Select(&ret, `
+		SELECT `+blobColumns+` FROM blobs
+		WHERE deleted IS NOT NULL
+		ORDER BY julianday(deleted) DESC, id DESC`)
+	return ret, err
+}
+
+// ListExpiredTrash returns the blobs which were moved to the trash before a
+// given time, skipping any which are under legal hold or which an alias
+// points at.
+func (s *Store) ListExpiredTrash(before time.Time) ([]*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Blob, 0)
+	err := s.handle.Select(&ret, `
+		SELECT `+blobColumns+` FROM blobs
+		WHERE julianday(deleted) < julianday(?) AND `+unheldBlobsCondition+` AND `+unaliasedBlobsCondition+`
+		ORDER BY id`, before)
+	return ret, err
+}
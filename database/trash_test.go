@@ -0,0 +1,81 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Trash(t *testing.T) {
+	Convey("Given a store with some blobs...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		kept := insertBlobForTesting(handle, "kept", "bucket", "alice", models.PermanentBlob, 10, now)
+		trashed := insertBlobForTesting(handle, "trashed", "bucket", "alice", models.PermanentBlob, 20, now)
+
+		err = handle.TrashBlobById(trashed.Id)
+		So(err, ShouldBeNil)
+
+		Convey("Trashed blobs should be hidden...", func() {
+			_, err := handle.RetrieveBlobById(trashed.Id)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+
+			ids, err := handle.GetBlobIdsMatchingBucket("bucket")
+			So(err, ShouldBeNil)
+			So(ids, ShouldResemble, []int64{kept.Id})
+
+			page, err := handle.ListBlobs(&models.BlobSearch{}, &models.PageRequest{Limit: 10})
+			So(err, ShouldBeNil)
+			So(page.Total, ShouldEqual, 1)
+
+			description, err := handle.DescribeBucket("bucket")
+			So(err, ShouldBeNil)
+			So(description.BlobCount, ShouldEqual, 1)
+		})
+
+		Convey("Trashed blobs should be listed in the trash...", func() {
+			trash, err := handle.ListTrash()
+			So(err, ShouldBeNil)
+			So(len(trash), ShouldEqual, 1)
+			So(trash[0].Id, ShouldEqual, trashed.Id)
+			So(trash[0].Deleted, ShouldNotBeNil)
+
+			b, err := handle.RetrieveTrashedBlob(trashed.Id)
+			So(err, ShouldBeNil)
+			So(b.Name, ShouldEqual, "trashed")
+
+			_, err = handle.RetrieveTrashedBlob(kept.Id)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+		})
+
+		Convey("Should not be able to trash a blob twice...", func() {
+			err := handle.TrashBlobById(trashed.Id)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+		})
+
+		Convey("Should be able to restore it...", func() {
+			restored, err := handle.RestoreBlobById(trashed.Id)
+			So(err, ShouldBeNil)
+			So(restored.Deleted, ShouldBeNil)
+
+			_, err = handle.RestoreBlobById(kept.Id)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+		})
+
+		Convey("Should only find expired blobs once the grace period is over...", func() {
+			expired, err := handle.ListExpiredTrash(now.Add(-time.Hour))
+			So(err, ShouldBeNil)
+			So(expired, ShouldBeEmpty)
+
+			expired, err = handle.ListExpiredTrash(time.Now().Add(time.Hour))
+			So(err, ShouldBeNil)
+			So(len(expired), ShouldEqual, 1)
+			So(expired[0].Id, ShouldEqual, trashed.Id)
+		})
+	})
+}
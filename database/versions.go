@@ -0,0 +1,88 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+)
+
+// versionOrder puts the newest version of a name first. Blobs uploaded before
+// versioning was enabled have version zero, so they're ordered by id.
+const versionOrder = `ORDER BY version DESC, id DESC`
+
+// RetrieveLatestBlob returns the newest completely uploaded blob with a given name in a bucket.
+func (s *Store) RetrieveLatestBlob(bucket, name string) (*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]models.Blob, 0)
+	err := s.handle.Select(&ret, `
+		SELECT `+blobColumns+` FROM blobs
+		WHERE bucket = ? AND name = ? AND sha1 <> '' AND `+liveBlobsCondition+`
+		`+versionOrder+` LIMIT 1`, bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	}
+	return &ret[0], nil
+}
+
+// RetrieveBlobVersion returns a specific version of a blob.
+func (s *Store) RetrieveBlobVersion(bucket, name string, version int64) (*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]models.Blob, 0)
+	err := s.handle.Select(&ret, `
+		SELECT `+blobColumns+` FROM blobs
+		WHERE bucket = ? AND name = ? AND version = ? AND `+liveBlobsCondition, bucket, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	}
+	return &ret[0], nil
+}
+
+// ListBlobVersions returns every blob with a given name in a bucket, newest first.
+func (s *Store) ListBlobVersions(bucket, name string) ([]*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Blob, 0)
+	err := s.handle.Select(&ret, `
+		SELECT `+blobColumns+` FROM blobs
+		WHERE bucket = ? AND name = ? AND `+liveBlobsCondition+`
+		`+versionOrder, bucket, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return nil, interfaces.NoMatchingBlobsError
+	}
+	return ret, nil
+}
+
+// ListPrunableBlobVersions returns all but the newest keep versions of a
+// name, oldest first, so that they can be purged. Versions under legal hold,
+// or which an alias points at, are left out.
+func (s *Store) ListPrunableBlobVersions(bucket, name string, keep int) ([]*models.Blob, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ret := make([]*models.Blob, 0)
+	err := s.handle.Select(&ret, `
+		SELECT `+blobColumns+` FROM blobs
+		WHERE id IN (
+			SELECT id FROM blobs
+			WHERE bucket = ? AND name = ? AND `+liveBlobsCondition+`
+			`+versionOrder+` LIMIT -1 OFFSET ?
+		) AND `+unheldBlobsCondition+` AND `+unaliasedBlobsCondition+`
+		ORDER BY version, id`, bucket, name, keep)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestStore_Versions(t *testing.T) {
+	Convey("Given a versioned bucket...", t, func() {
+
+		handle, err := CreateStore(":memory:")
+		So(err, ShouldBeNil)
+
+		_, err = handle.CreateBucket(&models.Bucket{
+			Name:           "configs",
+			BucketSettings: models.BucketSettings{Versioning: true},
+		}, "")
+		So(err, ShouldBeNil)
+
+		now := time.Now()
+		v1 := insertBlobForTesting(handle, "config.json", "configs", "alice", models.PermanentBlob, 10, now)
+		v2 := insertBlobForTesting(handle, "config.json", "configs", "alice", models.PermanentBlob, 20, now)
+		v3 := insertBlobForTesting(handle, "config.json", "configs", "alice", models.PermanentBlob, 30, now)
+		other := insertBlobForTesting(handle, "other.json", "configs", "alice", models.PermanentBlob, 40, now)
+
+		Convey("Each upload of a name should be numbered...", func() {
+			So(v1.Version, ShouldEqual, 1)
+			So(v2.Version, ShouldEqual, 2)
+			So(v3.Version, ShouldEqual, 3)
+			So(other.Version, ShouldEqual, 1)
+		})
+
+		Convey("Should be able to retrieve the latest...", func() {
+			latest, err := handle.RetrieveLatestBlob("configs", "config.json")
+			So(err, ShouldBeNil)
+			So(latest.Id, ShouldEqual, v3.Id)
+		})
+
+		Convey("Should be able to retrieve an older version...", func() {
+			older, err := handle.RetrieveBlobVersion("configs", "config.json", 2)
+			So(err, ShouldBeNil)
+			So(older.Id, ShouldEqual, v2.Id)
+
+			_, err = handle.RetrieveBlobVersion("configs", "config.json", 4)
+			So(err, ShouldEqual, interfaces.NoMatchingBlobsError)
+		})
+
+		Convey("Should be able to list the versions, newest first...", func() {
+			versions, err := handle.ListBlobVersions("configs", "config.json")
+			So(err, ShouldBeNil)
+			So(len(versions), ShouldEqual, 3)
+			So(versions[0].Id, ShouldEqual, v3.Id)
+			So(versions[2].Id, ShouldEqual, v1.Id)
+		})
+
+		Convey("Should be able to list the versions to prune...", func() {
+			prunable, err := handle.ListPrunableBlobVersions("configs", "config.json", 1)
+			So(err, ShouldBeNil)
+			So(len(prunable), ShouldEqual, 2)
+			So(prunable[0].Id, ShouldEqual, v1.Id)
+			So(prunable[1].Id, ShouldEqual, v2.Id)
+
+			_, err = handle.SetBlobProtection(v1.Id, &models.BlobProtection{LegalHold: true})
+			So(err, ShouldBeNil)
+			prunable, err = handle.ListPrunableBlobVersions("configs", "config.json", 1)
+			So(err, ShouldBeNil)
+			So(len(prunable), ShouldEqual, 1)
+			So(prunable[0].Id, ShouldEqual, v2.Id)
+
+			_, err = handle.SetAlias("config/previous", v2.Id, nil)
+			So(err, ShouldBeNil)
+			prunable, err = handle.ListPrunableBlobVersions("configs", "config.json", 1)
+			So(err, ShouldBeNil)
+			So(prunable, ShouldBeEmpty)
+		})
+
+		Convey("A blob renamed onto a name should become its newest version...", func() {
+			renamed := *other
+			renamed.Name = "config.json"
+			updated, err := handle.UpdateBlobRecord(&renamed, other.Revision)
+			So(err, ShouldBeNil)
+			So(updated.Version, ShouldEqual, 4)
+		})
+
+		Convey("Blobs in unversioned buckets shouldn't be numbered...", func() {
+			b := insertBlobForTesting(handle, "config.json", "plain", "alice", models.PermanentBlob, 10, now)
+			So(b.Version, ShouldEqual, 0)
+
+			latest, err := handle.RetrieveLatestBlob("plain", "config.json")
+			So(err, ShouldBeNil)
+			So(latest.Id, ShouldEqual, b.Id)
+		})
+	})
+}
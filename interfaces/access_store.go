@@ -0,0 +1,41 @@
+package interfaces
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+)
+
+var AccessDeniedError = errors.New("permission denied")
+var InvalidGroupError = errors.New("groups must be named, and everyone is already in the '*' group")
+var NoSuchGroupMemberError = errors.New("no such group member")
+
+// AccessStore decides who can do what to each bucket. Principals are granted
+// permissions directly or through the groups they belong to; members of
+// models.AdminGroup can do anything. Nobody else has any permissions on a
+// bucket which doesn't exist yet.
+type AccessStore interface {
+	// CheckPermission returns AccessDeniedError unless a principal has been
+	// granted a permission (or one which implies it) on a bucket, or
+	// NoSuchBucketError if the bucket doesn't exist and they aren't an admin.
+	CheckPermission(principal, bucket string, permission models.Permission) error
+	// IsAdministrator reports whether a principal is in models.AdminGroup.
+	IsAdministrator(principal string) (bool, error)
+
+	// ListGrants returns the grants on a bucket.
+	ListGrants(bucket string) ([]*models.Grant, error)
+	// SetGrants replaces the grants on a bucket.
+	SetGrants(bucket string, grants []*models.Grant) ([]*models.Grant, error)
+	// ListDefaultGrants returns the grants copied onto new buckets.
+	ListDefaultGrants() ([]*models.Grant, error)
+	// SetDefaultGrants replaces the grants copied onto new buckets.
+	SetDefaultGrants(grants []*models.Grant) ([]*models.Grant, error)
+
+	// ListGroups returns the name of every group with at least one member.
+	ListGroups() ([]string, error)
+	// ListGroupMembers returns the members of a group.
+	ListGroupMembers(group string) ([]string, error)
+	// AddGroupMember adds a principal to a group.
+	AddGroupMember(group, member string) error
+	// RemoveGroupMember removes a principal from a group.
+	RemoveGroupMember(group, member string) error
+}
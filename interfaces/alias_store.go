@@ -0,0 +1,28 @@
+package interfaces
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+)
+
+var NoSuchAliasError = errors.New("no such alias")
+var AliasConflictError = errors.New("alias does not point at the expected blob")
+var BlobAliasedError = errors.New("blob is pointed at by an alias and can't be purged")
+
+// AliasStore manages stable names which point at blobs.
+type AliasStore interface {
+	// SetAlias points an alias at a blob, creating the alias if needed.
+	// If expected isn't nil, it fails with AliasConflictError unless the alias
+	// currently points at *expected (or doesn't exist, if *expected is zero).
+	SetAlias(name string, blobId int64, expected *int64) (*models.Alias, error)
+	// ResolveAlias returns the blob an alias points at.
+	ResolveAlias(name string) (*models.Alias, error)
+	// ListAliases returns every alias, ordered by name.
+	ListAliases() ([]*models.Alias, error)
+	// AliasHistory returns every change made to an alias, newest first.
+	AliasHistory(name string) ([]*models.AliasChange, error)
+	// DeleteAlias removes an alias and its history.
+	DeleteAlias(name string) error
+	// CheckBlobUnaliased returns BlobAliasedError if an alias points at a blob.
+	CheckBlobUnaliased(id int64) error
+}
@@ -0,0 +1,44 @@
+package interfaces
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	"time"
+)
+
+// BlobChanges changes blobs inside a transaction, so that the changes can be
+// recorded in the audit log, and the events they cause published, alongside
+// them. The methods behave like their MetadataStore counterparts.
+type BlobChanges interface {
+	RetrieveBlobById(id int64) (*models.Blob, error)
+	StoreBlobRecord(blob *models.Blob) (*models.Blob, error)
+	FinalizeBlobRecord(blob *models.Blob) (*models.Blob, error)
+	UpdateBlobRecord(blob *models.Blob, revision int64) (*models.Blob, error)
+	ApplyBlobChanges(changes []models.BlobChange) ([]*models.Blob, error)
+	DeleteBlobById(id int64) error
+	TrashBlobById(id int64) error
+	RestoreBlobById(id int64) (*models.Blob, error)
+	SetBlobProtection(id int64, protection *models.BlobProtection) (*models.Blob, error)
+	ApplyLifecycleRule(bucket string, rule *models.LifecycleRule, now time.Time) ([]*models.Blob, error)
+
+	// RecordAuditEntry adds an entry to the log, filling in its id.
+	RecordAuditEntry(entry *models.AuditEntry) error
+	// PublishEvent stores an event, filling in its id, and queues a delivery
+	// for every webhook which wants it.
+	PublishEvent(event *models.Event) error
+}
+
+// AuditStore keeps an append-only log of changes to blobs.
+type AuditStore interface {
+	// RecordAuditEntry adds an entry to the log, filling in its id.
+	RecordAuditEntry(entry *models.AuditEntry) error
+	// ChangeBlobs calls fn with a transaction, which is committed if fn
+	// succeeds and rolled back if it returns an error. Nothing else in the
+	// store can be used until fn returns.
+	ChangeBlobs(fn func(changes BlobChanges) error) error
+	// ListAuditEntries returns a page of the entries matching a query,
+	// oldest first.
+	ListAuditEntries(qry *models.AuditQuery) (*models.AuditPage, error)
+	// StreamAuditEntries writes every entry matching a query into a channel,
+	// oldest first, closing it afterwards. Stops early if done is closed.
+	StreamAuditEntries(qry *models.AuditQuery, out chan *models.AuditEntry, done <-chan struct{}) error
+}
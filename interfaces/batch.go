@@ -0,0 +1,18 @@
+package interfaces
+
+import "fmt"
+
+// BlobChangeError says which of a list of changes couldn't be applied.
+type BlobChangeError struct {
+	Index int
+	Err   error
+}
+
+func (e *BlobChangeError) Error() string {
+	return fmt.Sprintf("change %d: %v", e.Index, e.Err)
+}
+
+// Unwrap returns the error which stopped the change.
+func (e *BlobChangeError) Unwrap() error {
+	return e.Err
+}
@@ -24,7 +24,7 @@ type BlobStore interface {
 	// Adds content at an arbitrary position within the file
 	InsertBlobContent(*models.Blob, int64, io.Reader) (*models.Blob, int64, error)
 	// Retrieves a URL to access the blob's content
-	RetrieveURLForBlobContent(*models.Blob, *mux.Router) (string, error)
+	RetrieveURLForBlobContent(*models.Blob, *models.URLScope, *mux.Router) (string, error)
 	// Retrieves a blob's content
 	RetrieveBlobContent(*models.Blob, io.Writer) (int64, error)
 }
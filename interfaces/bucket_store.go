@@ -0,0 +1,32 @@
+package interfaces
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+)
+
+var NoSuchBucketError = errors.New("no such bucket")
+var BucketExistsError = errors.New("bucket already exists")
+var BucketNotEmptyError = errors.New("bucket is not empty")
+
+// BucketStore manages buckets and their settings. Buckets are created
+// automatically when a blob is first stored in them, in which case the
+// blob's uploader is treated as their creator.
+type BucketStore interface {
+	// CreateBucket stores a new bucket, returning BucketExistsError if it's
+	// already present. The default grants are copied onto the bucket, with
+	// creator standing in for models.CreatorUser.
+	CreateBucket(bucket *models.Bucket, creator string) (*models.Bucket, error)
+	// RetrieveBucket returns a bucket's settings, or NoSuchBucketError.
+	RetrieveBucket(name string) (*models.Bucket, error)
+	// UpdateBucket replaces a bucket's settings.
+	UpdateBucket(bucket *models.Bucket) (*models.Bucket, error)
+	// DeleteBucket removes a bucket and its grants, returning
+	// BucketNotEmptyError if it still contains blobs.
+	DeleteBucket(name string) error
+
+	// DescribeBucket summarises a bucket's contents.
+	DescribeBucket(name string) (*models.BucketDescription, error)
+	// DescribeAllBuckets summarises every bucket.
+	DescribeAllBuckets() ([]*models.BucketDescription, error)
+}
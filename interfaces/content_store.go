@@ -30,12 +30,45 @@ type ContentStore interface {
 	AppendBlobContent(*models.Blob, io.Reader) (*models.Blob, error)
 	// Adds content at an arbitrary position within the file
 	InsertBlobContent(*models.Blob, int64, io.Reader) (*models.Blob, error)
-	// Retrieves a URL to access the blob's content
-	RetrieveURLForBlobContent(*models.Blob, *mux.Router) (string, error)
+	// Retrieves a URL which can be used, without an API token, to do what
+	// the scope allows to the blob's content
+	RetrieveURLForBlobContent(*models.Blob, *models.URLScope, *mux.Router) (string, error)
 	// Retrieves a blob's content
 	RetrieveBlobContent(*models.Blob, io.Writer) (int64, error)
 }
 
+// CopyableContentStore can duplicate content more efficiently than reading
+// it out and writing it back in.
+type CopyableContentStore interface {
+	ContentStore
+	// CopyBlobContent makes the content of dst identical to src,
+	// returning dst with its updated size.
+	CopyBlobContent(src *models.Blob, dst *models.Blob) (*models.Blob, error)
+}
+
+// TruncatableContentStore can cut a blob's content short, e.g. to undo an
+// append which didn't finish.
+type TruncatableContentStore interface {
+	ContentStore
+	// TruncateBlobContent discards everything after the first size bytes
+	// of a blob's content.
+	TruncateBlobContent(b *models.Blob, size int64) error
+}
+
+// StagingContentStore can write new content for a blob alongside its current
+// content, and swap it in later, so that a failed upload leaves the current
+// content alone.
+type StagingContentStore interface {
+	ContentStore
+	// StageBlobContent writes content for a blob without touching its
+	// current content, returning the blob with the staged size.
+	StageBlobContent(*models.Blob, io.Reader) (*models.Blob, error)
+	// CommitStagedContent replaces a blob's content with what was staged.
+	CommitStagedContent(*models.Blob) error
+	// DiscardStagedContent removes whatever was staged for a blob, if anything.
+	DiscardStagedContent(*models.Blob) error
+}
+
 type EstimatableContentStore interface {
 	ContentStore
 	// EstimateSizeOfManagedContent returns a size estimate of the
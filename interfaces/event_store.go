@@ -0,0 +1,46 @@
+package interfaces
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+	"time"
+)
+
+var NoSuchWebhookError = errors.New("no such webhook")
+
+// EventStore keeps the events which have been published, and an outbox of
+// the deliveries owed to webhooks.
+type EventStore interface {
+	// PublishEvent stores an event, filling in its id, and queues a delivery
+	// for every webhook which wants it.
+	PublishEvent(event *models.Event) error
+	// ListEvents returns up to limit events published after the given id,
+	// oldest first.
+	ListEvents(after int64, limit int) ([]*models.Event, error)
+	// LatestEventId returns the id of the newest event, or zero if none
+	// have been published.
+	LatestEventId() (int64, error)
+
+	// CreateWebhook starts sending events to a URL.
+	CreateWebhook(webhook *models.Webhook) (*models.Webhook, error)
+	// ListWebhooks returns every webhook, without its secret.
+	ListWebhooks() ([]*models.Webhook, error)
+	// DeleteWebhook stops sending events to a webhook, discarding any
+	// deliveries which haven't been made yet.
+	DeleteWebhook(id int64) error
+
+	// ListDueDeliveries returns up to limit deliveries which should be tried
+	// at the given time, oldest first.
+	ListDueDeliveries(now time.Time, limit int) ([]*models.WebhookDelivery, error)
+	// CompleteDelivery removes a delivery from the outbox once it's been made.
+	CompleteDelivery(id int64) error
+	// RetryDelivery records that a delivery failed, and when to try it again.
+	RetryDelivery(id int64, next time.Time, reason string) error
+	// AbandonDelivery records that a delivery failed for the last time. It's
+	// kept in the outbox, but never tried again.
+	AbandonDelivery(id int64, reason string) error
+	// PruneEvents removes the events published before a given time, along
+	// with their abandoned deliveries. Events which are still waiting to be
+	// delivered are kept. Returns how many events were removed.
+	PruneEvents(before time.Time) (int64, error)
+}
@@ -0,0 +1,19 @@
+package interfaces
+
+// HealthStore can check that it's usable.
+type HealthStore interface {
+	// Ping checks that the store answers queries.
+	Ping() error
+	// CheckSchemaVersion checks that the store's schema is the one this
+	// server expects.
+	CheckSchemaVersion() error
+}
+
+// CheckableContentStore can check that content can be written to it.
+type CheckableContentStore interface {
+	ContentStore
+	// CheckWritable writes and removes some content which isn't a blob's.
+	CheckWritable() error
+	// FreeSpace returns how many bytes more content could take up.
+	FreeSpace() (int64, error)
+}
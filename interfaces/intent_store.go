@@ -0,0 +1,21 @@
+package interfaces
+
+import (
+	"github.com/Sentimentron/repositron/models"
+)
+
+// IntentStore is a write-ahead log of content operations. An intent is
+// recorded before a blob's content is touched, and completed once the blob's
+// record matches its content, so that operations interrupted part-way through
+// can be replayed or rolled back.
+type IntentStore interface {
+	// RecordIntent notes that a content operation is about to start.
+	RecordIntent(blobId int64, operation models.IntentOperation) (*models.Intent, error)
+	// CompleteIntent removes an intent once its operation is finished.
+	CompleteIntent(id int64) error
+	// ListIntents returns the intents which haven't been completed, oldest first.
+	ListIntents() ([]*models.Intent, error)
+	// MarkBlobIncomplete clears a blob's checksum, so that its content has
+	// to be uploaded again.
+	MarkBlobIncomplete(id int64) error
+}
@@ -0,0 +1,17 @@
+package interfaces
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	"time"
+)
+
+// LifecycleStore evaluates a bucket's lifecycle rules. Blobs which are under
+// legal hold are never deleted, and write-once blobs are never changed.
+type LifecycleStore interface {
+	// MatchLifecycleRule returns the blobs in a bucket which a rule would
+	// apply to at a given time, without changing anything.
+	MatchLifecycleRule(bucket string, rule *models.LifecycleRule, now time.Time) ([]*models.Blob, error)
+	// ApplyLifecycleRule applies a rule to the blobs it matches at a given
+	// time, returning them as they were beforehand.
+	ApplyLifecycleRule(bucket string, rule *models.LifecycleRule, now time.Time) ([]*models.Blob, error)
+}
@@ -0,0 +1,33 @@
+package interfaces
+
+import "time"
+
+// RateLimiter decides whether a client can make another request.
+type RateLimiter interface {
+	// Allow uses up one of a client's requests, or returns how long the
+	// client has to wait before it can make another.
+	Allow(client string) (bool, time.Duration)
+	// Wait returns how long a client has to wait before it can make another
+	// request, without using one up.
+	Wait(client string) time.Duration
+}
+
+// TransferKind says which way content is going.
+type TransferKind int
+
+const (
+	Upload TransferKind = iota
+	Download
+)
+
+// TransferLimiter caps how many uploads and downloads run at once, and how
+// fast they go altogether.
+type TransferLimiter interface {
+	// StartTransfer reserves a slot for an upload or download, returning
+	// false if they're all in use.
+	StartTransfer(kind TransferKind) bool
+	// FinishTransfer frees a slot reserved by StartTransfer.
+	FinishTransfer(kind TransferKind)
+	// WaitForBandwidth blocks until n more bytes can be transferred.
+	WaitForBandwidth(n int)
+}
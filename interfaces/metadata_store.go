@@ -6,17 +6,42 @@ import (
 )
 
 var NoMatchingBlobsError = errors.New("no matching blobs")
+var BlobRevisionMismatchError = errors.New("blob has been modified since it was retrieved")
 
 type MetadataStore interface {
+	BucketStore
+	VersionStore
+	AliasStore
+	TrashStore
+	ProtectionStore
+	LifecycleStore
+	IntentStore
+	TokenStore
+	AccessStore
+	QuotaStore
+	AuditStore
+	EventStore
+	HealthStore
+
 	// StoreBlobRecord commit WIP metadata to the database, returns a new Blob
 	StoreBlobRecord(blob *models.Blob) (*models.Blob, error)
 	// FinalizeBlobRecord stores the final file size,
 	FinalizeBlobRecord(blob *models.Blob) (*models.Blob, error)
+	// UpdateBlobRecord stores a blob's name, bucket and metadata, provided
+	// that it is still at the given revision.
+	UpdateBlobRecord(blob *models.Blob, revision int64) (*models.Blob, error)
+	// ApplyBlobChanges updates or trashes several blobs in a single
+	// transaction, so either all of the changes are made or none of them
+	// are. If one fails, a *BlobChangeError says which. The updated blobs
+	// are returned in order, with nil for those moved into the trash.
+	ApplyBlobChanges(changes []models.BlobChange) ([]*models.Blob, error)
 
 	// EstimateSizeOfManagedContent returns an overall size estimate for the
 	// amount of stuff stored in the database.
 	EstimateSizeOfManagedContent() (int64, error)
 
+	// DeleteBlobById removes a blob's record immediately, whether or not
+	// it's in the trash.
 	DeleteBlobById(id int64) error
 	RetrieveBlobById(id int64) (*models.Blob, error)
 
@@ -24,6 +49,16 @@ type MetadataStore interface {
 	GetBlobIdsMatchingName(name string) ([]int64, error)
 	GetBlobIdsMatchingBucket(name string) ([]int64, error)
 
+	// SearchBlobs retrieves the ids of blobs matching a BlobSearch.
+	// By default, every specified criterion must match.
+	SearchBlobs(qry *models.BlobSearch) ([]int64, error)
+	// ListBlobs retrieves a page of blobs matching a BlobSearch, or of every
+	// blob if the search is empty.
+	ListBlobs(qry *models.BlobSearch, page *models.PageRequest) (*models.BlobPage, error)
+	// StreamBlobs writes every blob matching a BlobSearch into a channel,
+	// closing it afterwards. Stops early if done is closed.
+	StreamBlobs(qry *models.BlobSearch, out chan *models.Blob, done <-chan struct{}) error
+
 	// Retrieves each distinct bucket name.
 	GetAllBuckets() ([]string, error)
 
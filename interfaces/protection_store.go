@@ -0,0 +1,23 @@
+package interfaces
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+)
+
+var BlobImmutableError = errors.New("blob is write-once and can't be changed")
+var BlobLegalHoldError = errors.New("blob is under legal hold and can't be deleted")
+var WriteOnceSettingError = errors.New("write-once mode can't be turned off")
+
+// ProtectionStore decides whether blobs can be changed or deleted. A blob is
+// write-once if it or its bucket is marked immutable, and can't be deleted or
+// expired if it or its bucket is under legal hold.
+type ProtectionStore interface {
+	// SetBlobProtection changes a blob's flags. Write-once mode can't be turned off.
+	SetBlobProtection(id int64, protection *models.BlobProtection) (*models.Blob, error)
+	// CheckBlobModifiable returns BlobImmutableError if a blob's content
+	// has been uploaded and can't be changed.
+	CheckBlobModifiable(id int64) error
+	// CheckBlobDeletable returns BlobLegalHoldError if a blob can't be deleted.
+	CheckBlobDeletable(id int64) error
+}
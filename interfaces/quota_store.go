@@ -0,0 +1,39 @@
+package interfaces
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+)
+
+var NoSuchQuotaError = errors.New("no such quota")
+
+// QuotaStore keeps the quotas on uploaders and buckets, and works out how much
+// they're storing.
+type QuotaStore interface {
+	// ListQuotas returns every quota, ordered by scope and name.
+	ListQuotas() ([]*models.Quota, error)
+	// RetrieveQuota returns the quota which applies to an uploader or bucket:
+	// its own, or otherwise the default for its scope. Returns nil if
+	// neither exists.
+	RetrieveQuota(scope models.QuotaScope, name string) (*models.Quota, error)
+	// SetQuota creates or replaces a quota.
+	SetQuota(quota *models.Quota) (*models.Quota, error)
+	// DeleteQuota removes a quota, returning NoSuchQuotaError if it doesn't exist.
+	DeleteQuota(scope models.QuotaScope, name string) error
+	// RetrieveUsage returns the size and number of the blobs an uploader has
+	// uploaded, or which are in a bucket, including those in the trash.
+	RetrieveUsage(scope models.QuotaScope, name string) (*models.QuotaUsage, error)
+}
+
+// AccountableContentStore keeps track of how much each uploader and bucket
+// is storing, and refuses writes which would exceed their quotas.
+type AccountableContentStore interface {
+	ContentStore
+	// CheckQuotas returns a *models.QuotaExceededError if storing another
+	// size bytes in count more blobs would exceed the quota of a blob's
+	// uploader or bucket.
+	CheckQuotas(b *models.Blob, size int64, count int64) error
+	// RetrieveUsage returns how much an uploader or bucket is storing,
+	// including anything being written right now, and its quota.
+	RetrieveUsage(scope models.QuotaScope, name string) (*models.QuotaUsage, error)
+}
@@ -10,7 +10,9 @@ import (
 )
 
 // CombinedStore takes a content store and metadata store and updates one after another.
-// It complies the with the BlobStore interface
+// It complies the with the BlobStore interface. Each change is recorded as an intent,
+// which is only completed if it succeeds, so that interrupted changes are recovered
+// when the server next starts.
 type CombinedStore struct {
 	m MetadataStore
 	c ContentStore
@@ -30,19 +32,32 @@ func (c *CombinedStore) DeleteBlobContent(blob *models.Blob) error {
 		return err
 	}
 
-	// Delete the metadata record first
-	err = c.m.DeleteBlobById(blob.Id)
+	intent, err := c.m.RecordIntent(info.Id, models.IntentPurge)
 	if err != nil {
 		return err
 	}
 
-	// Delete the disk content
+	// Delete the disk content first, so that a record never outlives it
 	err = c.c.DeleteBlobContent(info)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// Then delete the metadata record
+	err = c.m.DeleteBlobById(blob.Id)
+	if err != nil {
+		return err
+	}
+
+	return c.m.CompleteIntent(intent.Id)
+}
+
+// completeIntent marks an intent as done if the change it covers succeeded.
+func (c *CombinedStore) completeIntent(intent *models.Intent, b *models.Blob, read int64, err error) (*models.Blob, int64, error) {
+	if err != nil {
+		return b, read, err
+	}
+	return b, read, c.m.CompleteIntent(intent.Id)
 }
 
 func (c *CombinedStore) retrieveOrStoreMetadataIfNeeded(b *models.Blob) (*models.Blob, error) {
@@ -69,6 +84,11 @@ func (c *CombinedStore) WriteBlobContent(b *models.Blob, in io.Reader) (*models.
 		return nil, -1, err
 	}
 
+	intent, err := c.m.RecordIntent(info.Id, models.IntentUpload)
+	if err != nil {
+		return nil, -1, err
+	}
+
 	// Write the blob's content
 	written, err := c.c.WriteBlobContent(info, in)
 	if err != nil {
@@ -78,7 +98,8 @@ func (c *CombinedStore) WriteBlobContent(b *models.Blob, in io.Reader) (*models.
 	}
 
 	info.Size = written.Size
-	return c.computeAndStoreChecksum(info)
+	ret, read, err := c.computeAndStoreChecksum(info)
+	return c.completeIntent(intent, ret, read, err)
 }
 
 func (c *CombinedStore) computeAndStoreChecksum(b *models.Blob) (*models.Blob, int64, error) {
@@ -112,6 +133,11 @@ func (c *CombinedStore) AppendBlobContent(b *models.Blob, reader io.Reader) (*mo
 		return nil, -1, err
 	}
 
+	intent, err := c.m.RecordIntent(info.Id, models.IntentAppend)
+	if err != nil {
+		return nil, -1, err
+	}
+
 	// Append the content
 	written, err := c.c.AppendBlobContent(info, reader)
 	if err != nil {
@@ -119,7 +145,8 @@ func (c *CombinedStore) AppendBlobContent(b *models.Blob, reader io.Reader) (*mo
 	}
 
 	info.Size += written.Size
-	return c.computeAndStoreChecksum(info)
+	ret, read, err := c.computeAndStoreChecksum(info)
+	return c.completeIntent(intent, ret, read, err)
 }
 
 func (c *CombinedStore) InsertBlobContent(b *models.Blob, offset int64, buf io.Reader) (*models.Blob, int64, error) {
@@ -130,6 +157,11 @@ func (c *CombinedStore) InsertBlobContent(b *models.Blob, offset int64, buf io.R
 		return nil, -1, err
 	}
 
+	intent, err := c.m.RecordIntent(info.Id, models.IntentAppend)
+	if err != nil {
+		return nil, -1, err
+	}
+
 	// Insert the content into storage
 	written, err := c.c.InsertBlobContent(info, offset, buf)
 	if err != nil {
@@ -141,11 +173,12 @@ func (c *CombinedStore) InsertBlobContent(b *models.Blob, offset int64, buf io.R
 		info.Size = newMaxOffset
 	}
 
-	return c.computeAndStoreChecksum(info)
+	ret, read, err := c.computeAndStoreChecksum(info)
+	return c.completeIntent(intent, ret, read, err)
 }
 
-func (c *CombinedStore) RetrieveURLForBlobContent(b *models.Blob, r *mux.Router) (string, error) {
-	return c.c.RetrieveURLForBlobContent(b, r)
+func (c *CombinedStore) RetrieveURLForBlobContent(b *models.Blob, scope *models.URLScope, r *mux.Router) (string, error) {
+	return c.c.RetrieveURLForBlobContent(b, scope, r)
 }
 
 func (c *CombinedStore) RetrieveBlobContent(b *models.Blob, w io.Writer) (int64, error) {
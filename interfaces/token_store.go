@@ -0,0 +1,23 @@
+package interfaces
+
+import (
+	"errors"
+	"github.com/Sentimentron/repositron/models"
+)
+
+var InvalidTokenError = errors.New("token is missing, invalid or revoked")
+var NoSuchTokenError = errors.New("no such token")
+
+// TokenStore issues and checks API tokens.
+type TokenStore interface {
+	// IssueToken creates a token for a principal, returning the token itself
+	// alongside its record. The token can't be retrieved again.
+	IssueToken(principal string) (*models.Token, string, error)
+	// RevokeToken stops a token from being used.
+	RevokeToken(id int64) error
+	// ListTokens returns every token which has been issued, oldest first.
+	ListTokens() ([]*models.Token, error)
+	// AuthenticateToken returns the record for a token, or InvalidTokenError
+	// if it's unknown or has been revoked.
+	AuthenticateToken(secret string) (*models.Token, error)
+}
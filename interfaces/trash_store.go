@@ -0,0 +1,22 @@
+package interfaces
+
+import (
+	"github.com/Sentimentron/repositron/models"
+	"time"
+)
+
+// TrashStore lets blobs be deleted reversibly. Blobs in the trash are hidden
+// from everything else until they're restored or removed for good.
+type TrashStore interface {
+	// TrashBlobById moves a blob into the trash.
+	TrashBlobById(id int64) error
+	// RestoreBlobById moves a blob out of the trash.
+	RestoreBlobById(id int64) (*models.Blob, error)
+	// RetrieveTrashedBlob returns a blob which is in the trash.
+	RetrieveTrashedBlob(id int64) (*models.Blob, error)
+	// ListTrash returns every blob in the trash, most recently deleted first.
+	ListTrash() ([]*models.Blob, error)
+	// ListExpiredTrash returns the blobs which were moved to the trash before
+	// a given time, leaving out any which can't be purged.
+	ListExpiredTrash(before time.Time) ([]*models.Blob, error)
+}
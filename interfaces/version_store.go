@@ -0,0 +1,21 @@
+package interfaces
+
+import (
+	"github.com/Sentimentron/repositron/models"
+)
+
+// VersionStore looks up blobs by bucket and name. In buckets with versioning,
+// each blob uploaded under the same name is a new version of it.
+type VersionStore interface {
+	// RetrieveLatestBlob returns the newest completely uploaded blob with a
+	// given name in a bucket.
+	RetrieveLatestBlob(bucket, name string) (*models.Blob, error)
+	// RetrieveBlobVersion returns a specific version of a blob.
+	RetrieveBlobVersion(bucket, name string, version int64) (*models.Blob, error)
+	// ListBlobVersions returns every blob with a given name in a bucket,
+	// newest first.
+	ListBlobVersions(bucket, name string) ([]*models.Blob, error)
+	// ListPrunableBlobVersions returns all but the newest keep versions,
+	// oldest first, leaving out any which can't be purged.
+	ListPrunableBlobVersions(bucket, name string, keep int) ([]*models.Blob, error)
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"io"
+	"math"
+	"sync"
+)
+
+// DefaultDurationBuckets suit how long requests take, in seconds.
+var DefaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Counter is a value which only goes up.
+type Counter struct {
+	lock  sync.Mutex
+	value float64
+}
+
+// Add increases the counter, ignoring negative amounts.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.value += v
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Value() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.value
+}
+
+// CounterVec is a counter for each combination of its labels' values.
+type CounterVec struct {
+	family
+}
+
+// With returns the counter for the given label values, in order.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.value(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (v *CounterVec) Collect(w io.Writer) error {
+	return v.collect(w, func(key string, value interface{}) error {
+		return sample(w, v.name, key, value.(*Counter).Value())
+	})
+}
+
+// Gauge is a value which can go up and down.
+type Gauge struct {
+	lock  sync.Mutex
+	value float64
+}
+
+func (g *Gauge) Set(v float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.value = v
+}
+
+func (g *Gauge) Add(v float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.value += v
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.value
+}
+
+// GaugeVec is a gauge for each combination of its labels' values.
+type GaugeVec struct {
+	family
+}
+
+// With returns the gauge for the given label values, in order.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.value(values, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+func (v *GaugeVec) Collect(w io.Writer) error {
+	return v.collect(w, func(key string, value interface{}) error {
+		return sample(w, v.name, key, value.(*Gauge).Value())
+	})
+}
+
+// Histogram counts observations into buckets by their size.
+type Histogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Observe records a single observation.
+func (h *Histogram) Observe(v float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// HistogramVec is a histogram for each combination of its labels' values.
+type HistogramVec struct {
+	family
+	buckets []float64
+}
+
+// With returns the histogram for the given label values, in order.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.value(values, func() interface{} {
+		return &Histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets))}
+	}).(*Histogram)
+}
+
+func (v *HistogramVec) Collect(w io.Writer) error {
+	return v.collect(w, func(key string, value interface{}) error {
+		h := value.(*Histogram)
+		h.lock.Lock()
+		counts := make([]uint64, len(h.counts))
+		copy(counts, h.counts)
+		count, sum := h.count, h.sum
+		h.lock.Unlock()
+
+		prefix := key
+		if prefix != "" {
+			prefix += ","
+		}
+		for i, bound := range v.buckets {
+			err := sample(w, v.name+"_bucket", prefix+`le="`+formatValue(bound)+`"`, float64(counts[i]))
+			if err != nil {
+				return err
+			}
+		}
+		err := sample(w, v.name+"_bucket", prefix+`le="`+formatValue(math.Inf(1))+`"`, float64(count))
+		if err != nil {
+			return err
+		}
+		err = sample(w, v.name+"_sum", key, sum)
+		if err != nil {
+			return err
+		}
+		return sample(w, v.name+"_count", key, float64(count))
+	})
+}
@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format written by a Registry.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector writes one or more metrics, in the text exposition format.
+type Collector interface {
+	Collect(w io.Writer) error
+}
+
+// CollectorFunc computes metrics each time they're collected.
+type CollectorFunc func(w io.Writer) error
+
+func (f CollectorFunc) Collect(w io.Writer) error {
+	return f(w)
+}
+
+// Registry holds every metric which is exposed.
+type Registry struct {
+	lock       sync.Mutex
+	names      map[string]bool
+	collectors []Collector
+}
+
+// CreateRegistry returns an empty registry.
+func CreateRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// DefaultRegistry holds the metrics created by NewCounterVec, NewGaugeVec
+// and NewHistogramVec.
+var DefaultRegistry = CreateRegistry()
+
+// Register adds a collector, which is written out after everything
+// registered before it. Metrics' names must be unique.
+func (r *Registry) Register(name string, c Collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: %s is already registered", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// Write writes every registered metric to w.
+func (r *Registry) Write(w io.Writer) error {
+	r.lock.Lock()
+	collectors := make([]Collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.lock.Unlock()
+
+	for _, c := range collectors {
+		err := c.Collect(w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP lets Prometheus scrape the registry.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	err := r.Write(w)
+	if err != nil {
+		fmt.Fprintf(w, "# Error: %v\n", err)
+	}
+}
+
+// CounterVec creates a counter with the given labels, and registers it.
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	ret := &CounterVec{family: newFamily(name, help, "counter", labels)}
+	r.Register(name, ret)
+	return ret
+}
+
+// GaugeVec creates a gauge with the given labels, and registers it.
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	ret := &GaugeVec{family: newFamily(name, help, "gauge", labels)}
+	r.Register(name, ret)
+	return ret
+}
+
+// HistogramVec creates a histogram with the given upper bounds and labels,
+// and registers it.
+func (r *Registry) HistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	ret := &HistogramVec{family: newFamily(name, help, "histogram", labels), buckets: buckets}
+	r.Register(name, ret)
+	return ret
+}
+
+// NewCounterVec creates a counter in the DefaultRegistry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return DefaultRegistry.CounterVec(name, help, labels...)
+}
+
+// NewGaugeVec creates a gauge in the DefaultRegistry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return DefaultRegistry.GaugeVec(name, help, labels...)
+}
+
+// NewHistogramVec creates a histogram in the DefaultRegistry.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return DefaultRegistry.HistogramVec(name, help, buckets, labels...)
+}
+
+// labelEscaper escapes label values for the text format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// family is what every type of metric has in common: a set of values, one
+// for each combination of its labels' values.
+type family struct {
+	lock   sync.Mutex
+	name   string
+	help   string
+	kind   string
+	labels []string
+	values map[string]interface{}
+}
+
+func newFamily(name, help, kind string, labels []string) family {
+	return family{name: name, help: help, kind: kind, labels: labels, values: make(map[string]interface{})}
+}
+
+// key formats label values, e.g. `method="GET",route="/v1/info"`.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d label(s), got %d", f.name, len(f.labels), len(values)))
+	}
+	pairs := make([]string, len(values))
+	for i, v := range values {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, f.labels[i], labelEscaper.Replace(v))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// value returns the value for some labels, creating it if it's new.
+func (f *family) value(values []string, create func() interface{}) interface{} {
+	key := f.key(values)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	ret, ok := f.values[key]
+	if !ok {
+		ret = create()
+		f.values[key] = ret
+	}
+	return ret
+}
+
+// Reset forgets every value.
+func (f *family) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.values = make(map[string]interface{})
+}
+
+// collect writes the family's header, then calls write with each value,
+// ordered by their labels.
+func (f *family) collect(w io.Writer, write func(key string, value interface{}) error) error {
+	f.lock.Lock()
+	keys := make([]string, 0, len(f.values))
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	values := make(map[string]interface{}, len(f.values))
+	for key, value := range f.values {
+		values[key] = value
+	}
+	f.lock.Unlock()
+	sort.Strings(keys)
+
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		err = write(key, values[key])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sample writes a single line, e.g. `name{labels} 1`.
+func sample(w io.Writer, name, labels string, value float64) error {
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	_, err := fmt.Fprintf(w, "%s%s %s\n", name, labels, formatValue(value))
+	return err
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	. "github.com/smartystreets/goconvey/convey"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("Given a registry with some metrics...", t, func() {
+
+		registry := CreateRegistry()
+		requests := registry.CounterVec("requests_total", "Requests served.", "method", "status")
+		active := registry.GaugeVec("active", "Things in progress.")
+		durations := registry.HistogramVec("duration_seconds", "How long things took.", []float64{0.1, 1}, "route")
+
+		output := func() string {
+			var buf bytes.Buffer
+			So(registry.Write(&buf), ShouldBeNil)
+			return buf.String()
+		}
+
+		Convey("Should count by label...", func() {
+			requests.With("GET", "200").Inc()
+			requests.With("GET", "200").Add(2)
+			requests.With("PUT", "404").Inc()
+			requests.With("PUT", "404").Add(-5)
+
+			So(output(), ShouldContainSubstring, `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 3
+requests_total{method="PUT",status="404"} 1
+`)
+		})
+
+		Convey("Should escape label values...", func() {
+			requests.With(`a"b\c`, "line\nbreak").Inc()
+			So(output(), ShouldContainSubstring, `requests_total{method="a\"b\\c",status="line\nbreak"} 1`)
+		})
+
+		Convey("Should let gauges go down...", func() {
+			gauge := active.With()
+			gauge.Inc()
+			gauge.Inc()
+			gauge.Dec()
+			So(output(), ShouldContainSubstring, "# TYPE active gauge\nactive 1\n")
+
+			gauge.Set(7.5)
+			So(output(), ShouldContainSubstring, "active 7.5\n")
+
+			active.Reset()
+			So(output(), ShouldNotContainSubstring, "active 7.5\n")
+		})
+
+		Convey("Should count observations into cumulative buckets...", func() {
+			h := durations.With("/v1/info")
+			h.Observe(0.05)
+			h.Observe(0.5)
+			h.Observe(5)
+
+			So(output(), ShouldContainSubstring, `# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/v1/info",le="0.1"} 1
+duration_seconds_bucket{route="/v1/info",le="1"} 2
+duration_seconds_bucket{route="/v1/info",le="+Inf"} 3
+duration_seconds_sum{route="/v1/info"} 5.55
+duration_seconds_count{route="/v1/info"} 3
+`)
+		})
+
+		Convey("Should include metrics computed when they're collected...", func() {
+			calls := 0
+			registry.Register("computed", CollectorFunc(func(w io.Writer) error {
+				calls++
+				_, err := fmt.Fprintf(w, "computed %d\n", calls)
+				return err
+			}))
+			So(output(), ShouldContainSubstring, "computed 1\n")
+			So(output(), ShouldContainSubstring, "computed 2\n")
+		})
+
+		Convey("Should refuse metrics with the same name...", func() {
+			So(func() { registry.CounterVec("active", "Again.") }, ShouldPanic)
+		})
+
+		Convey("Should refuse the wrong number of labels...", func() {
+			So(func() { requests.With("GET") }, ShouldPanic)
+		})
+
+		Convey("Should serve the text format...", func() {
+			requests.With("GET", "200").Inc()
+			w := httptest.NewRecorder()
+			registry.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+			So(w.Header().Get("Content-Type"), ShouldEqual, ContentType)
+			So(strings.Contains(w.Body.String(), `requests_total{method="GET",status="200"} 1`), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var InvalidAliasNameError = errors.New("alias names are made of letters, digits, '_', '.' and '-', separated by '/', can't be numeric, and can't end in '/history'")
+
+var aliasNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]+(/[A-Za-z0-9_.\-]+)*$`)
+var numericPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// Alias is a stable name, like "myapp/stable", which points at a blob.
+type Alias struct {
+	Name    string    `json:"name" db:"name"`
+	BlobId  int64     `json:"blob" db:"blob"`
+	Updated time.Time `json:"updated" db:"updated"`
+}
+
+// AliasChange records an alias being pointed at a blob.
+type AliasChange struct {
+	Alias string `json:"alias" db:"alias"`
+	// Previous is the blob the alias pointed at beforehand, if any.
+	Previous *int64    `json:"previous,omitempty" db:"previous"`
+	BlobId   int64     `json:"blob" db:"blob"`
+	Date     time.Time `json:"date" db:"date"`
+}
+
+// AliasUpdate repoints an alias. If Expected is set, the update only
+// succeeds if the alias currently points at that blob (or, if it's zero,
+// if the alias doesn't exist yet).
+type AliasUpdate struct {
+	BlobId   int64  `json:"blob"`
+	Expected *int64 `json:"expected,omitempty"`
+}
+
+// ValidateAliasName checks that a name can be used as an alias. Numeric names
+// aren't allowed, so that aliases can be used in place of blob ids, and nor
+// are names ending in "/history", which is where an alias's history is found.
+func ValidateAliasName(name string) error {
+	if !aliasNamePattern.MatchString(name) || numericPattern.MatchString(name) || strings.HasSuffix(name, "/history") {
+		return InvalidAliasNameError
+	}
+	return nil
+}
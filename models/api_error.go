@@ -0,0 +1,40 @@
+package models
+
+// ErrorCode classifies an APIError, so that clients don't need to parse its message.
+type ErrorCode string
+
+const (
+	ErrorBadRequest          ErrorCode = "bad_request"
+	ErrorValidationFailed    ErrorCode = "validation_failed"
+	ErrorUnauthorized        ErrorCode = "unauthorized"
+	ErrorForbidden           ErrorCode = "forbidden"
+	ErrorNotFound            ErrorCode = "not_found"
+	ErrorMethodNotAllowed    ErrorCode = "method_not_allowed"
+	ErrorConflict            ErrorCode = "conflict"
+	ErrorPreconditionFailed  ErrorCode = "precondition_failed"
+	ErrorTooLarge            ErrorCode = "too_large"
+	ErrorRangeNotSatisfiable ErrorCode = "range_not_satisfiable"
+	ErrorTooManyRequests     ErrorCode = "too_many_requests"
+	ErrorInternal            ErrorCode = "internal"
+	ErrorNotImplemented      ErrorCode = "not_implemented"
+	ErrorUnavailable         ErrorCode = "unavailable"
+	ErrorInsufficientStorage ErrorCode = "insufficient_storage"
+)
+
+// APIError is the body of every error response from the API.
+type APIError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	// RequestId is also sent in the X-Request-Id header, and logged.
+	RequestId string `json:"requestId,omitempty"`
+	// Details depend on the code, e.g. which fields failed validation.
+	Details interface{} `json:"details,omitempty"`
+}
+
+// ValidationFailure says which field of a request was invalid, and why.
+type ValidationFailure struct {
+	Field string `json:"field"`
+	// Rule is the validation which failed, e.g. "required" or "max".
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
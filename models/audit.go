@@ -0,0 +1,125 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AuditAction says what a change to a blob did.
+type AuditAction string
+
+const (
+	// AuditCreate is recorded when a blob is described or copied.
+	AuditCreate AuditAction = "create"
+	// AuditWrite is recorded when a blob's content is replaced.
+	AuditWrite AuditAction = "write"
+	// AuditAppend is recorded when content is added to the end of a blob.
+	AuditAppend AuditAction = "append"
+	// AuditUpdate is recorded when a blob's name, bucket or metadata changes.
+	AuditUpdate AuditAction = "update"
+	// AuditProtect is recorded when a blob is made write-once or put under
+	// legal hold, or released from either.
+	AuditProtect AuditAction = "protect"
+	// AuditDelete is recorded when a blob is moved into the trash.
+	AuditDelete AuditAction = "delete"
+	// AuditRestore is recorded when a blob is moved out of the trash.
+	AuditRestore AuditAction = "restore"
+	// AuditPurge is recorded when a blob and its content are removed for good.
+	AuditPurge AuditAction = "purge"
+)
+
+// Changes made by the server itself are recorded against these actors.
+const (
+	LifecycleActor = "@lifecycle"
+	TrashActor     = "@trash"
+)
+
+const (
+	DefaultAuditLimit = 100
+	MaximumAuditLimit = 1000
+)
+
+var InvalidAuditActionError = errors.New("action must be one of: create, write, append, update, protect, delete, restore, purge")
+var InvalidAuditLimitError = fmt.Errorf("limit must be between 1 and %d", MaximumAuditLimit)
+
+// AuditEntry records who changed a blob, when, and how its content changed.
+// Old values are missing for blobs which have just been created, and new
+// values for those which have been deleted. OldBucket is only set when the
+// change moved the blob out of it.
+type AuditEntry struct {
+	Id          int64       `json:"id" db:"id"`
+	Date        time.Time   `json:"date" db:"date"`
+	Actor       string      `json:"actor" db:"actor"`
+	Address     string      `json:"address,omitempty" db:"address"`
+	Action      AuditAction `json:"action" db:"action"`
+	Blob        int64       `json:"blob" db:"blob"`
+	Bucket      string      `json:"bucket" db:"bucket"`
+	OldBucket   string      `json:"oldBucket,omitempty" db:"old_bucket"`
+	OldChecksum *string     `json:"oldSha1,omitempty" db:"old_sha1"`
+	OldSize     *int64      `json:"oldSize,omitempty" db:"old_size"`
+	NewChecksum *string     `json:"newSha1,omitempty" db:"new_sha1"`
+	NewSize     *int64      `json:"newSize,omitempty" db:"new_size"`
+}
+
+// NewAuditEntry describes a change to a blob, given how it looked before and
+// after. before is nil if the blob was just created, and after is nil if it
+// was deleted.
+func NewAuditEntry(actor string, address string, action AuditAction, before *Blob, after *Blob) *AuditEntry {
+	ret := &AuditEntry{Date: time.Now(), Actor: actor, Address: address, Action: action}
+	if before != nil {
+		ret.Blob, ret.Bucket = before.Id, before.Bucket
+		checksum, size := before.Checksum, before.Size
+		ret.OldChecksum, ret.OldSize = &checksum, &size
+	}
+	if after != nil {
+		ret.Blob, ret.Bucket = after.Id, after.Bucket
+		checksum, size := after.Checksum, after.Size
+		ret.NewChecksum, ret.NewSize = &checksum, &size
+	}
+	if before != nil && after != nil && before.Bucket != after.Bucket {
+		ret.OldBucket = before.Bucket
+	}
+	return ret
+}
+
+// AuditQuery picks out audit entries. Every criterion which is set must match.
+type AuditQuery struct {
+	Actor  *string      `json:"actor,omitempty"`
+	Action *AuditAction `json:"action,omitempty"`
+	Bucket *string      `json:"bucket,omitempty"`
+	Blob   *int64       `json:"blob,omitempty"`
+	// Since and Until restrict entries to those made in [Since, Until).
+	Since *time.Time `json:"since,omitempty"`
+	Until *time.Time `json:"until,omitempty"`
+	// After skips every entry up to and including this id.
+	After int64 `json:"after,omitempty"`
+	// Limit is the maximum number of entries to list (DefaultAuditLimit if
+	// zero). It's ignored when exporting.
+	Limit int `json:"limit,omitempty"`
+}
+
+// AuditPage is a page of audit entries, oldest first.
+type AuditPage struct {
+	Entries []*AuditEntry `json:"entries"`
+	// After retrieves the next page, and is zero on the last page.
+	After int64 `json:"after,omitempty"`
+}
+
+// Validate fills in the default limit and checks the query is well-formed.
+func (q *AuditQuery) Validate() error {
+	if q.Action != nil {
+		switch *q.Action {
+		case AuditCreate, AuditWrite, AuditAppend, AuditUpdate, AuditProtect, AuditDelete, AuditRestore, AuditPurge:
+		default:
+			return InvalidAuditActionError
+		}
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultAuditLimit
+	}
+	if q.Limit < 0 || q.Limit > MaximumAuditLimit {
+		return InvalidAuditLimitError
+	}
+	return nil
+}
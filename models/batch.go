@@ -0,0 +1,94 @@
+package models
+
+import (
+	"errors"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+var BatchNotAtomicError = errors.New("only delete, patch and move operations can be applied atomically")
+
+// BatchOperationType says what a BatchOperation does.
+type BatchOperationType string
+
+const (
+	// BatchDelete moves a blob into the trash.
+	BatchDelete BatchOperationType = "delete"
+	// BatchPatch applies a merge patch to a blob.
+	BatchPatch BatchOperationType = "patch"
+	// BatchCopy copies a blob and its content to Destination.
+	BatchCopy BatchOperationType = "copy"
+	// BatchMove moves a blob to Destination.
+	BatchMove BatchOperationType = "move"
+)
+
+// BatchOperation is one of the operations in a BatchRequest.
+type BatchOperation struct {
+	Op BatchOperationType `json:"op" validate:"required,oneof=delete patch copy move"`
+	Id int64              `json:"id" validate:"required"`
+	// Patch is applied by patch operations.
+	Patch BlobPatch `json:"patch,omitempty"`
+	// Destination is where copy and move operations put the blob.
+	Destination *BlobDestination `json:"destination,omitempty"`
+	// IfMatch, if set, must match the blob's ETag for the operation to succeed.
+	IfMatch string `json:"ifMatch,omitempty"`
+}
+
+// BatchRequest is a list of operations to run in order.
+type BatchRequest struct {
+	// Atomic makes the operations succeed or fail together. Only delete,
+	// patch and move operations can be run atomically.
+	Atomic     bool             `json:"atomic,omitempty"`
+	Operations []BatchOperation `json:"operations" validate:"required,max=1000,dive"`
+}
+
+// BatchResult reports the outcome of one operation, using HTTP status codes.
+type BatchResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Blob   *Blob  `json:"blob,omitempty"`
+}
+
+// BatchResponse has a result for each operation in a BatchRequest, in order.
+type BatchResponse struct {
+	Results []BatchResult `json:"results"`
+}
+
+// BlobChange is a change to a blob's record, which can be applied alongside
+// others with MetadataStore.ApplyBlobChanges.
+type BlobChange struct {
+	// Trash moves the blob into the trash, rather than updating it.
+	Trash bool
+	// Blob is the blob's new name, bucket and metadata.
+	Blob *Blob
+	// Revision is the revision the blob must be at, which is optional when
+	// moving it into the trash.
+	Revision int64
+}
+
+func (r *BatchRequest) Validate() error {
+
+	validate := validator.New()
+	err := validate.Struct(r)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range r.Operations {
+		if op.Op == BatchPatch && op.Patch == nil {
+			return errors.New("patch operations need a patch")
+		}
+		if op.Op == BatchCopy || op.Op == BatchMove {
+			if op.Destination == nil {
+				return errors.New("copy and move operations need a destination")
+			}
+			err = op.Destination.Validate()
+			if err != nil {
+				return err
+			}
+		}
+		if r.Atomic && op.Op == BatchCopy {
+			return BatchNotAtomicError
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"gopkg.in/go-playground/validator.v9"
 	"time"
 )
@@ -14,6 +15,9 @@ const (
 	TemporaryBlob BlobType = "temp"
 )
 
+// RecalculatingChecksum is stored while an append's checksum is worked out.
+const RecalculatingChecksum = "<recalculating>"
+
 type Blob struct {
 	Id       int64       `db:"id" json:"id"`
 	Name     string      `json:"name" validate:"required" db:"name"`
@@ -24,6 +28,28 @@ type Blob struct {
 	Uploader string      `json:"owner" validate:"required" db:"uploader"`
 	Metadata MetadataMap `json:"metadata" db:"metadata"`
 	Size     int64       `json:"size" db:"size"`
+	// Revision is incremented every time the blob's record changes.
+	Revision int64 `json:"revision" db:"revision"`
+	// Version numbers blobs with the same name in a versioned bucket,
+	// starting from one. It's zero in buckets without versioning.
+	Version int64 `json:"version,omitempty" db:"version"`
+	// Deleted is when the blob was moved to the trash, if it has been.
+	Deleted *time.Time `json:"deleted,omitempty" db:"deleted"`
+	BlobProtection
+}
+
+// BlobProtection stops a blob from being changed or deleted. Its bucket's
+// settings can also protect it.
+type BlobProtection struct {
+	// Immutable blobs can't be changed once their content has been uploaded.
+	Immutable bool `json:"immutable,omitempty" db:"immutable"`
+	// LegalHold stops a blob from being deleted or expired.
+	LegalHold bool `json:"legalHold,omitempty" db:"legal_hold"`
+}
+
+// ETag identifies the current revision of a blob, for use with If-Match.
+func (b *Blob) ETag() string {
+	return fmt.Sprintf(`"%d"`, b.Revision)
 }
 
 func (b *Blob) Validate() error {
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// BlobDestination says where a blob should be copied or moved to.
+type BlobDestination struct {
+	Bucket string `json:"bucket" validate:"required"`
+	// Name defaults to the source blob's name.
+	Name string `json:"name,omitempty"`
+}
+
+func (d *BlobDestination) Validate() error {
+
+	validate := validator.New()
+
+	return validate.Struct(d)
+
+}
+
+// Patch returns the merge patch which moves a blob to this destination.
+func (d *BlobDestination) Patch() BlobPatch {
+	patch := BlobPatch{"bucket": d.Bucket}
+	if d.Name != "" {
+		patch["name"] = d.Name
+	}
+	return patch
+}
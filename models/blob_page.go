@@ -0,0 +1,167 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// SortField determines the order in which blobs are listed.
+type SortField string
+
+// SortOrder is either ascending or descending.
+type SortOrder string
+
+const (
+	SortById   SortField = "id"
+	SortByDate SortField = "date"
+	SortBySize SortField = "size"
+	SortByName SortField = "name"
+
+	Ascending  SortOrder = "asc"
+	Descending SortOrder = "desc"
+)
+
+const (
+	DefaultPageLimit = 100
+	MaximumPageLimit = 1000
+)
+
+var InvalidSortError = errors.New("sort must be one of: id, date, size, name")
+var InvalidSortOrderError = errors.New("order must be one of: asc, desc")
+var InvalidPageLimitError = fmt.Errorf("limit must be between 1 and %d", MaximumPageLimit)
+var InvalidCursorError = errors.New("cursor is invalid or does not match the sort order")
+var InvalidFieldError = errors.New("unknown field requested")
+
+// PageRequest describes which page of a listing to return.
+type PageRequest struct {
+	// Limit is the maximum number of blobs in the page (DefaultPageLimit if zero).
+	Limit int `json:"limit,omitempty"`
+	// Cursor is the NextCursor of the previous page, or empty for the first page.
+	Cursor string `json:"cursor,omitempty"`
+	// Sort and Order control the order of the results (id, ascending by default).
+	Sort  SortField `json:"sort,omitempty"`
+	Order SortOrder `json:"order,omitempty"`
+	// Fields lists the JSON fields to return for each blob (all if empty).
+	Fields []string `json:"fields,omitempty"`
+}
+
+// PageCursor records where the previous page finished.
+type PageCursor struct {
+	Sort  SortField   `json:"s"`
+	Order SortOrder   `json:"o"`
+	Value interface{} `json:"v"`
+	Id    int64       `json:"i"`
+}
+
+// BlobPage is a single page of a listing or search.
+type BlobPage struct {
+	Blobs []*Blob `json:"blobs"`
+	// Total is the number of blobs matching the listing across all pages.
+	Total int64 `json:"total"`
+	// NextCursor retrieves the next page, and is empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ProjectedBlobPage is a BlobPage which only contains some fields of each blob.
+type ProjectedBlobPage struct {
+	Blobs      []map[string]interface{} `json:"blobs"`
+	Total      int64                    `json:"total"`
+	NextCursor string                   `json:"nextCursor,omitempty"`
+}
+
+var blobFields = map[string]bool{
+	"id": true, "name": true, "bucket": true, "uploaded": true, "type": true,
+	"sha1": true, "owner": true, "metadata": true, "size": true,
+	"revision": true, "version": true, "deleted": true,
+	"immutable": true, "legalHold": true,
+}
+
+// Normalize fills in defaults and checks the request is well-formed.
+func (p *PageRequest) Normalize() error {
+	if p.Limit == 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit < 0 || p.Limit > MaximumPageLimit {
+		return InvalidPageLimitError
+	}
+	if p.Sort == "" {
+		p.Sort = SortById
+	}
+	switch p.Sort {
+	case SortById, SortByDate, SortBySize, SortByName:
+	default:
+		return InvalidSortError
+	}
+	if p.Order == "" {
+		p.Order = Ascending
+	}
+	if p.Order != Ascending && p.Order != Descending {
+		return InvalidSortOrderError
+	}
+	for _, f := range p.Fields {
+		if !blobFields[f] {
+			return InvalidFieldError
+		}
+	}
+	if p.Cursor != "" {
+		c, err := p.DecodeCursor()
+		if err != nil {
+			return err
+		}
+		if c.Sort != p.Sort || c.Order != p.Order {
+			return InvalidCursorError
+		}
+	}
+	return nil
+}
+
+// EncodeCursor serializes a cursor pointing after the given sort value and id.
+func (p *PageRequest) EncodeCursor(value interface{}, id int64) (string, error) {
+	data, err := json.Marshal(PageCursor{p.Sort, p.Order, value, id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor deserializes this request's Cursor.
+func (p *PageRequest) DecodeCursor() (*PageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, InvalidCursorError
+	}
+	var c PageCursor
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, InvalidCursorError
+	}
+	return &c, nil
+}
+
+// Project returns a copy of the page containing only the requested fields.
+func (p *BlobPage) Project(fields []string) (*ProjectedBlobPage, error) {
+	ret := &ProjectedBlobPage{
+		Blobs:      make([]map[string]interface{}, 0, len(p.Blobs)),
+		Total:      p.Total,
+		NextCursor: p.NextCursor,
+	}
+	for _, b := range p.Blobs {
+		data, err := json.Marshal(b)
+		if err != nil {
+			return nil, err
+		}
+		all := make(map[string]interface{})
+		err = json.Unmarshal(data, &all)
+		if err != nil {
+			return nil, err
+		}
+		projected := make(map[string]interface{})
+		for _, f := range fields {
+			projected[f] = all[f]
+		}
+		ret.Blobs = append(ret.Blobs, projected)
+	}
+	return ret, nil
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ImmutableFieldError = errors.New("only name, bucket and metadata can be patched")
+var InvalidPatchValueError = errors.New("name and bucket must be patched with a string")
+var InvalidMetadataPatchError = errors.New("metadata must be patched with an object, or null to remove it")
+
+// BlobPatch is a JSON merge patch (RFC 7396) describing changes to a blob's
+// name, bucket and metadata.
+type BlobPatch map[string]interface{}
+
+// MergePatch applies an RFC 7396 merge patch to a decoded JSON document,
+// returning the patched document. Members of patch which are null are removed
+// from target, objects are merged recursively, and anything else replaces the
+// target outright.
+func MergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok || targetObject == nil {
+		targetObject = make(map[string]interface{})
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = MergePatch(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
+
+// Apply modifies the blob according to the patch. The blob should be
+// validated afterwards, since a patch can remove required fields.
+func (p BlobPatch) Apply(b *Blob) error {
+	for key, value := range p {
+		switch key {
+		case "name", "bucket":
+			s, ok := value.(string)
+			if !ok && value != nil {
+				return InvalidPatchValueError
+			}
+			if key == "name" {
+				b.Name = s
+			} else {
+				b.Bucket = s
+			}
+		case "metadata":
+			if _, ok := value.(map[string]interface{}); !ok && value != nil {
+				return InvalidMetadataPatchError
+			}
+			patched, _ := MergePatch(map[string]interface{}(b.Metadata), value).(map[string]interface{})
+			if patched == nil {
+				patched = make(map[string]interface{})
+			}
+			b.Metadata = patched
+		default:
+			return fmt.Errorf("%w: '%s'", ImmutableFieldError, key)
+		}
+	}
+	return nil
+}
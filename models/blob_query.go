@@ -1,7 +1,140 @@
 package models
 
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// SearchMode determines how the criteria in a BlobSearch are combined.
+type SearchMode string
+
+const (
+	// MatchAll only returns blobs which satisfy every criterion (the default).
+	MatchAll SearchMode = "all"
+	// MatchAny returns blobs which satisfy at least one criterion.
+	MatchAny SearchMode = "any"
+)
+
+var EmptySearchError = errors.New("no search criteria specified")
+var InvalidSearchModeError = errors.New("search mode must be one of: all, any")
+var InvalidSearchRangeError = errors.New("search range lower bound exceeds upper bound")
+var InvalidSearchTextError = errors.New("search text isn't a valid full-text query")
+var InvalidMetadataKeyError = errors.New("metadata keys may only contain letters, digits, '.', '-' and '_'")
+var InvalidMetadataOperatorError = errors.New("unsupported metadata operator")
+var InvalidMetadataValueError = errors.New("metadata operator requires a different type of value")
+
+// MetadataOperator describes how a MetadataPredicate compares a metadata value.
+type MetadataOperator string
+
+const (
+	MetadataEquals         MetadataOperator = "eq"
+	MetadataNotEquals      MetadataOperator = "ne"
+	MetadataExists         MetadataOperator = "exists"
+	MetadataMissing        MetadataOperator = "missing"
+	MetadataLessThan       MetadataOperator = "lt"
+	MetadataLessOrEqual    MetadataOperator = "le"
+	MetadataGreaterThan    MetadataOperator = "gt"
+	MetadataGreaterOrEqual MetadataOperator = "ge"
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// MetadataPredicate matches blobs on a single top-level key of their metadata.
+type MetadataPredicate struct {
+	Key   string           `json:"key"`
+	Op    MetadataOperator `json:"op"`
+	Value interface{}      `json:"value,omitempty"`
+}
+
+// Validate checks that the key, operator and value are compatible.
+func (p *MetadataPredicate) Validate() error {
+	if !metadataKeyPattern.MatchString(p.Key) {
+		return InvalidMetadataKeyError
+	}
+	switch p.Op {
+	case MetadataEquals, MetadataNotEquals:
+		switch p.Value.(type) {
+		case nil, string, bool, float64, int, int64:
+			return nil
+		}
+		return InvalidMetadataValueError
+	case MetadataExists, MetadataMissing:
+		return nil
+	case MetadataLessThan, MetadataLessOrEqual, MetadataGreaterThan, MetadataGreaterOrEqual:
+		switch p.Value.(type) {
+		case float64, int, int64:
+			return nil
+		}
+		return InvalidMetadataValueError
+	}
+	return InvalidMetadataOperatorError
+}
+
+// BlobSearch describes which blobs should be returned from a search.
+// Unspecified (nil) criteria are ignored.
 type BlobSearch struct {
-	Name     *string `json:"name"`
-	Checksum *string `json:"checksum"`
-	Bucket   *string `json:"bucket"`
+	Name     *string   `json:"name"`
+	Checksum *string   `json:"checksum"`
+	Bucket   *string   `json:"bucket"`
+	Uploader *string   `json:"uploader,omitempty"`
+	Class    *BlobType `json:"type,omitempty"`
+
+	// Name matching: NamePrefix matches the start of the name literally,
+	// NameGlob uses SQLite GLOB syntax (e.g. "release-2026-*.tar.gz").
+	NamePrefix *string `json:"namePrefix,omitempty"`
+	NameGlob   *string `json:"nameGlob,omitempty"`
+
+	// Text is a full-text query over blob names and metadata values.
+	Text *string `json:"text,omitempty"`
+
+	// Restricts the search to blobs uploaded within a date range (inclusive).
+	UploadedAfter  *time.Time `json:"uploadedAfter,omitempty"`
+	UploadedBefore *time.Time `json:"uploadedBefore,omitempty"`
+
+	// Restricts the search to blobs within a size range (inclusive).
+	MinSize *int64 `json:"minSize,omitempty"`
+	MaxSize *int64 `json:"maxSize,omitempty"`
+
+	// Metadata restricts the search to blobs with matching metadata keys.
+	Metadata []MetadataPredicate `json:"metadata,omitempty"`
+
+	// Mode is either "all" (the default) or "any".
+	Mode SearchMode `json:"mode,omitempty"`
+
+	// VisibleTo restricts the search to buckets a principal can read. It's
+	// set by the server, rather than the client.
+	VisibleTo *string `json:"-"`
+}
+
+// IsEmpty returns true if no search criteria have been specified.
+func (s *BlobSearch) IsEmpty() bool {
+	return s.Name == nil && s.Checksum == nil && s.Bucket == nil &&
+		s.Uploader == nil && s.Class == nil &&
+		s.NamePrefix == nil && s.NameGlob == nil && s.Text == nil &&
+		s.UploadedAfter == nil && s.UploadedBefore == nil &&
+		s.MinSize == nil && s.MaxSize == nil && len(s.Metadata) == 0
+}
+
+// Validate checks that the search is well-formed.
+func (s *BlobSearch) Validate() error {
+	if s.IsEmpty() {
+		return EmptySearchError
+	}
+	if s.Mode != "" && s.Mode != MatchAll && s.Mode != MatchAny {
+		return InvalidSearchModeError
+	}
+	if s.UploadedAfter != nil && s.UploadedBefore != nil && s.UploadedAfter.After(*s.UploadedBefore) {
+		return InvalidSearchRangeError
+	}
+	if s.MinSize != nil && s.MaxSize != nil && *s.MinSize > *s.MaxSize {
+		return InvalidSearchRangeError
+	}
+	for i := range s.Metadata {
+		err := s.Metadata[i].Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/go-playground/validator.v9"
+	"time"
+)
+
+var BlobTooLargeError = errors.New("blob exceeds the bucket's maximum blob size")
+var UploaderNotAllowedError = errors.New("uploader is not allowed to upload to this bucket")
+
+// UploaderList is a list of uploaders, stored as a JSON array.
+type UploaderList []string
+
+func (u UploaderList) Value() (driver.Value, error) {
+	if u == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(u)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (u *UploaderList) Scan(src interface{}) error {
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(data, u)
+	case string:
+		return json.Unmarshal([]byte(data), u)
+	}
+	return fmt.Errorf("Could not not decode type %T -> %T", src, u)
+}
+
+// BucketSettings controls what can be uploaded into a bucket.
+type BucketSettings struct {
+	// DefaultClass is used for blobs uploaded without a type.
+	DefaultClass BlobType `json:"defaultType,omitempty" validate:"omitempty,oneof=permanent temp" db:"default_class"`
+	// MaxBlobSize is the largest blob that can be stored, or zero for no limit.
+	MaxBlobSize int64 `json:"maxBlobSize,omitempty" validate:"gte=0" db:"max_blob_size"`
+	// AllowedUploaders restricts who can upload, or allows anyone if empty.
+	AllowedUploaders UploaderList `json:"allowedUploaders,omitempty" db:"allowed_uploaders"`
+	// RetentionDays is how long blobs are kept for, or zero to keep them forever.
+	RetentionDays int `json:"retentionDays,omitempty" validate:"gte=0" db:"retention_days"`
+	// Versioning numbers each blob uploaded under the same name, so that
+	// the latest can be retrieved by name.
+	Versioning bool `json:"versioning,omitempty" db:"versioning"`
+	// MaxVersions is how many versions of each name are kept, or zero to keep them all.
+	MaxVersions int `json:"maxVersions,omitempty" validate:"gte=0" db:"max_versions"`
+	// Immutable makes every blob in the bucket write-once. It can't be turned off.
+	Immutable bool `json:"immutable,omitempty" db:"immutable"`
+	// LegalHold stops every blob in the bucket from being deleted or expired.
+	LegalHold bool `json:"legalHold,omitempty" db:"legal_hold"`
+	// Lifecycle rules are applied to the bucket's blobs in the background.
+	Lifecycle LifecycleRules `json:"lifecycle,omitempty" validate:"dive" db:"lifecycle"`
+}
+
+// Bucket is a named collection of blobs.
+type Bucket struct {
+	Name    string    `json:"name" validate:"required" db:"name"`
+	Created time.Time `json:"created" db:"created"`
+	BucketSettings
+}
+
+// BucketDescription summarises a bucket's contents.
+type BucketDescription struct {
+	Bucket
+	BlobCount  int64      `json:"blobCount" db:"blob_count"`
+	TotalSize  int64      `json:"totalSize" db:"total_size"`
+	LastUpload *time.Time `json:"lastUpload,omitempty" db:"last_upload"`
+}
+
+func (b *Bucket) Validate() error {
+
+	validate := validator.New()
+
+	err := validate.Struct(b)
+	if err != nil {
+		return err
+	}
+	for i := range b.Lifecycle {
+		err = b.Lifecycle[i].Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+
+}
+
+// ActiveLifecycleRules returns the bucket's lifecycle rules, along with a
+// rule which deletes blobs once they're older than RetentionDays.
+func (b *Bucket) ActiveLifecycleRules() []LifecycleRule {
+	rules := make([]LifecycleRule, 0, len(b.Lifecycle)+1)
+	rules = append(rules, b.Lifecycle...)
+	if b.RetentionDays > 0 {
+		rules = append(rules, LifecycleRule{Action: LifecycleDelete, OlderThanDays: b.RetentionDays})
+	}
+	return rules
+}
+
+// ApplyDefaults fills in any fields of a blob that the bucket provides defaults for.
+func (b *Bucket) ApplyDefaults(blob *Blob) {
+	if blob.Class == "" {
+		blob.Class = b.DefaultClass
+	}
+}
+
+// CheckBlob returns an error if the blob isn't allowed in this bucket.
+func (b *Bucket) CheckBlob(blob *Blob) error {
+	if b.MaxBlobSize > 0 && blob.Size > b.MaxBlobSize {
+		return BlobTooLargeError
+	}
+	if len(b.AllowedUploaders) == 0 {
+		return nil
+	}
+	for _, u := range b.AllowedUploaders {
+		if u == blob.Uploader {
+			return nil
+		}
+	}
+	return UploaderNotAllowedError
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EventType says what happened to a blob.
+type EventType string
+
+const (
+	// BlobCreated is published when a blob is described or copied.
+	BlobCreated EventType = "blob.created"
+	// BlobFinalized is published when a blob's content has been written,
+	// and its checksum is known.
+	BlobFinalized EventType = "blob.finalized"
+	// BlobAppended is published when content is added to the end of a blob.
+	BlobAppended EventType = "blob.appended"
+	// BlobDeleted is published when a blob is moved into the trash, or
+	// removed without going through it.
+	BlobDeleted EventType = "blob.deleted"
+)
+
+var InvalidEventTypeError = errors.New("event type must be one of: blob.created, blob.finalized, blob.appended, blob.deleted")
+
+// Validate checks the event type is one which is published.
+func (t EventType) Validate() error {
+	switch t {
+	case BlobCreated, BlobFinalized, BlobAppended, BlobDeleted:
+		return nil
+	}
+	return InvalidEventTypeError
+}
+
+// EventTypeList is a list of event types, stored as a JSON array.
+type EventTypeList []EventType
+
+func (l EventTypeList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (l *EventTypeList) Scan(src interface{}) error {
+	var err error
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		err = json.Unmarshal(data, l)
+	case string:
+		err = json.Unmarshal([]byte(data), l)
+	default:
+		return fmt.Errorf("Could not not decode type %T -> %T", src, l)
+	}
+	if len(*l) == 0 {
+		*l = nil
+	}
+	return err
+}
+
+// Contains returns whether t is in the list. Empty lists contain everything.
+func (l EventTypeList) Contains(t EventType) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, each := range l {
+		if each == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is something which happened to a blob.
+type Event struct {
+	Id   int64     `json:"id"`
+	Type EventType `json:"type"`
+	Date time.Time `json:"date"`
+	// Blob is the blob as it was after the event, or just before it was
+	// deleted.
+	Blob *Blob `json:"blob"`
+}
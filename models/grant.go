@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+var InvalidGranteeError = errors.New("a grant must name either a user or a group")
+
+// Permission is something a principal can be allowed to do to a bucket.
+type Permission string
+
+const (
+	// PermissionRead allows a bucket's blobs to be listed, described and downloaded.
+	PermissionRead Permission = "read"
+	// PermissionWrite allows blobs to be uploaded, changed and moved.
+	PermissionWrite Permission = "write"
+	// PermissionAppend allows content to be appended to existing blobs.
+	PermissionAppend Permission = "append"
+	// PermissionDelete allows blobs to be trashed, restored and purged.
+	PermissionDelete Permission = "delete"
+	// PermissionAdmin allows everything, including changing the bucket's
+	// settings, grants and blobs' protection.
+	PermissionAdmin Permission = "admin"
+)
+
+const (
+	// EveryoneGroup contains every authenticated principal.
+	EveryoneGroup = "*"
+	// AdminGroup's members have admin permission on every bucket, and can
+	// manage groups and the default grants.
+	AdminGroup = "admins"
+	// CreatorUser stands for whoever creates a bucket in the default grants.
+	CreatorUser = "@creator"
+)
+
+// PermissionsImplying returns the permissions which include p: a bucket's
+// admins can do anything, and anyone who can write can also append.
+func PermissionsImplying(p Permission) []Permission {
+	switch p {
+	case PermissionAdmin:
+		return []Permission{PermissionAdmin}
+	case PermissionAppend:
+		return []Permission{PermissionAppend, PermissionWrite, PermissionAdmin}
+	}
+	return []Permission{p, PermissionAdmin}
+}
+
+// Grant gives a user, or the members of a group, permission on a bucket.
+type Grant struct {
+	Bucket     string     `json:"bucket,omitempty" db:"bucket"`
+	User       string     `json:"user,omitempty" db:"user_name"`
+	Group      string     `json:"group,omitempty" db:"group_name"`
+	Permission Permission `json:"permission" validate:"oneof=read write append delete admin" db:"permission"`
+}
+
+// Validate checks that a grant names one grantee and a known permission.
+func (g *Grant) Validate() error {
+	if (g.User == "") == (g.Group == "") {
+		return InvalidGranteeError
+	}
+	validate := validator.New()
+	return validate.Struct(g)
+}
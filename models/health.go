@@ -0,0 +1,27 @@
+package models
+
+// HealthStatus says whether a check, or a whole report, passed.
+type HealthStatus string
+
+const (
+	HealthOK      HealthStatus = "ok"
+	HealthFailing HealthStatus = "failing"
+	// HealthSkipped is for checks which this server's stores can't run.
+	HealthSkipped HealthStatus = "skipped"
+)
+
+// HealthCheck is the outcome of checking one thing the server depends on.
+type HealthCheck struct {
+	Name   string       `json:"name"`
+	Status HealthStatus `json:"status"`
+	// Message explains a failure, or gives some detail, e.g. the free space.
+	Message string `json:"message,omitempty"`
+	// Duration is how long the check took, in seconds.
+	Duration float64 `json:"duration"`
+}
+
+// HealthReport is failing if any of its checks are.
+type HealthReport struct {
+	Status HealthStatus   `json:"status"`
+	Checks []*HealthCheck `json:"checks"`
+}
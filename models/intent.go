@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// IntentOperation is a content operation which an Intent was recorded for.
+type IntentOperation string
+
+const (
+	// IntentUpload replaces a blob's content.
+	IntentUpload IntentOperation = "upload"
+	// IntentAppend adds to the end of a blob's content.
+	IntentAppend IntentOperation = "append"
+	// IntentCopy fills a newly created blob with another blob's content.
+	IntentCopy IntentOperation = "copy"
+	// IntentPurge removes a blob's content and then its record.
+	IntentPurge IntentOperation = "purge"
+)
+
+// Intent is written before a blob's content is changed, and removed once its
+// record has been brought into line. Any left over after a crash describe
+// blobs whose content and record might disagree.
+type Intent struct {
+	Id        int64           `json:"id" db:"id"`
+	BlobId    int64           `json:"blob" db:"blob"`
+	Operation IntentOperation `json:"operation" db:"operation"`
+	Created   time.Time       `json:"created" db:"created"`
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/go-playground/validator.v9"
+	"time"
+)
+
+// LifecycleAction is what happens to the blobs matched by a LifecycleRule.
+type LifecycleAction string
+
+const (
+	// LifecycleDelete moves matching blobs into the trash.
+	LifecycleDelete LifecycleAction = "delete"
+	// LifecycleMakePermanent turns matching temporary blobs into permanent ones.
+	LifecycleMakePermanent LifecycleAction = "makePermanent"
+)
+
+// LifecycleRule describes a set of blobs within a bucket, and what should
+// happen to them. A blob must meet every condition which is set to match.
+type LifecycleRule struct {
+	Action LifecycleAction `json:"action" validate:"required,oneof=delete makePermanent"`
+	// NamePattern is a glob (e.g. "nightly-*.tar") which blob names must match.
+	NamePattern string `json:"namePattern,omitempty"`
+	// Class restricts the rule to blobs of one type.
+	Class BlobType `json:"type,omitempty" validate:"omitempty,oneof=permanent temp"`
+	// HasMetadata restricts the rule to blobs tagged with this metadata key.
+	HasMetadata string `json:"hasMetadata,omitempty"`
+	// OlderThanDays restricts the rule to blobs uploaded at least this many days ago.
+	OlderThanDays int `json:"olderThanDays,omitempty" validate:"gte=0"`
+	// KeepNewest leaves this many of the newest blobs matching the other
+	// conditions alone.
+	KeepNewest int `json:"keepNewest,omitempty" validate:"gte=0"`
+}
+
+// Validate checks the rule's action and conditions.
+func (r *LifecycleRule) Validate() error {
+	err := validator.New().Struct(r)
+	if err != nil {
+		return err
+	}
+	if r.HasMetadata != "" && !metadataKeyPattern.MatchString(r.HasMetadata) {
+		return InvalidMetadataKeyError
+	}
+	return nil
+}
+
+// Cutoff returns the upload date that blobs must be older than to match, or
+// nil if the rule doesn't care how old they are.
+func (r *LifecycleRule) Cutoff(now time.Time) *time.Time {
+	if r.OlderThanDays <= 0 {
+		return nil
+	}
+	cutoff := now.AddDate(0, 0, -r.OlderThanDays)
+	return &cutoff
+}
+
+// LifecycleRules is a bucket's list of rules, stored as a JSON array.
+type LifecycleRules []LifecycleRule
+
+func (l LifecycleRules) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan leaves buckets without any rules with a nil list, like ones which
+// haven't been stored yet.
+func (l *LifecycleRules) Scan(src interface{}) error {
+	var err error
+	switch data := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		err = json.Unmarshal(data, l)
+	case string:
+		err = json.Unmarshal([]byte(data), l)
+	default:
+		return fmt.Errorf("Could not not decode type %T -> %T", src, l)
+	}
+	if len(*l) == 0 {
+		*l = nil
+	}
+	return err
+}
+
+// LifecycleMatch is a blob which a rule applies to.
+type LifecycleMatch struct {
+	Bucket string        `json:"bucket"`
+	Rule   LifecycleRule `json:"rule"`
+	Blob   *Blob         `json:"blob"`
+}
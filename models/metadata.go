@@ -10,19 +10,27 @@ import (
 type MetadataMap map[string]interface{}
 
 func (m MetadataMap) Value() (driver.Value, error) {
-	if len(m) == 0 {
+	if m == nil {
 		return nil, nil
 	}
-	return json.Marshal(m)
+	// Stored as TEXT so that SQLite's JSON functions can query it.
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
 }
 
-func (m MetadataMap) Scan(src interface{}) error {
+func (m *MetadataMap) Scan(src interface{}) error {
 	v := reflect.ValueOf(src)
-	if !v.IsValid() || v.IsNil() {
+	if !v.IsValid() || (v.Kind() == reflect.Slice && v.IsNil()) {
 		return nil
 	}
-	if data, ok := src.([]byte); ok {
-		return json.Unmarshal(data, &m)
+	switch data := src.(type) {
+	case []byte:
+		return json.Unmarshal(data, m)
+	case string:
+		return json.Unmarshal([]byte(data), m)
 	}
 	return fmt.Errorf("Could not not decode type %T -> %T", src, m)
 }
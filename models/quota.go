@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"gopkg.in/go-playground/validator.v9"
+	"strings"
+)
+
+// QuotaScope is what a quota limits: everything uploaded by someone, or
+// everything in a bucket.
+type QuotaScope string
+
+const (
+	QuotaUploader QuotaScope = "uploader"
+	QuotaBucket   QuotaScope = "bucket"
+)
+
+// DefaultQuotaName is the name of the quota which applies to every uploader
+// or bucket without one of its own.
+const DefaultQuotaName = "*"
+
+// Quota limits how much can be stored by an uploader, or in a bucket.
+// Trashed blobs count until they're purged.
+type Quota struct {
+	Scope QuotaScope `json:"scope" db:"scope" validate:"oneof=uploader bucket"`
+	Name  string     `json:"name" db:"name" validate:"required"`
+	// MaxBytes is the most content which can be stored, or 0 for no limit.
+	MaxBytes int64 `json:"maxBytes" db:"max_bytes" validate:"gte=0"`
+	// MaxBlobs is the most blobs which can be stored, or 0 for no limit.
+	MaxBlobs int64 `json:"maxBlobs" db:"max_blobs" validate:"gte=0"`
+}
+
+// Validate checks that the quota has a scope, a name and sensible limits.
+func (q *Quota) Validate() error {
+	validate := validator.New()
+	return validate.Struct(q)
+}
+
+// QuotaUsage is how much an uploader or bucket is storing, including
+// anything being written right now, and the quota which applies to it.
+type QuotaUsage struct {
+	Scope QuotaScope `json:"scope"`
+	Name  string     `json:"name"`
+	Bytes int64      `json:"bytes"`
+	Blobs int64      `json:"blobs"`
+	// Quota is nil if nothing is limited.
+	Quota *Quota `json:"quota,omitempty"`
+}
+
+// QuotaExceededError says which quota would have been exceeded.
+type QuotaExceededError struct {
+	Quota *Quota
+	Name  string
+}
+
+func (e *QuotaExceededError) Error() string {
+	limits := make([]string, 0)
+	if e.Quota.MaxBytes > 0 {
+		limits = append(limits, fmt.Sprintf("%d byte(s)", e.Quota.MaxBytes))
+	}
+	if e.Quota.MaxBlobs > 0 {
+		limits = append(limits, fmt.Sprintf("%d blob(s)", e.Quota.MaxBlobs))
+	}
+	return fmt.Sprintf("%s %s can't store more than %s", e.Quota.Scope, e.Name, strings.Join(limits, " or "))
+}
+
+// Exceeds reports whether storing usage would go over the quota.
+func (q *Quota) Exceeds(bytes, blobs int64) bool {
+	return (q.MaxBytes > 0 && bytes > q.MaxBytes) || (q.MaxBlobs > 0 && blobs > q.MaxBlobs)
+}
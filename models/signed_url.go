@@ -0,0 +1,111 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"time"
+)
+
+var InvalidByteRangeError = errors.New("byte ranges look like start-end, where start <= end")
+var RangeNotDownloadableError = errors.New("only download urls can be limited to a byte range")
+var SignedURLExpiryError = errors.New("signed urls can't last longer than a week")
+
+// DefaultSignedURLExpiry is how long signed URLs last if nothing else is asked for.
+const DefaultSignedURLExpiry = 15 * time.Minute
+
+// MaxSignedURLExpiry is the longest a signed URL can last.
+const MaxSignedURLExpiry = 7 * 24 * time.Hour
+
+// ByteRange is an inclusive range of byte offsets within a blob's content.
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// ParseByteRange reads a range written as "start-end".
+func ParseByteRange(s string) (*ByteRange, error) {
+	ret := &ByteRange{}
+	_, err := fmt.Sscanf(s, "%d-%d", &ret.Start, &ret.End)
+	if err != nil || ret.Validate() != nil {
+		return nil, InvalidByteRangeError
+	}
+	return ret, nil
+}
+
+// Validate checks that the range isn't empty or backwards.
+func (r *ByteRange) Validate() error {
+	if r.Start < 0 || r.End < r.Start {
+		return InvalidByteRangeError
+	}
+	return nil
+}
+
+// Length returns the number of bytes in the range.
+func (r *ByteRange) Length() int64 {
+	return r.End - r.Start + 1
+}
+
+func (r *ByteRange) String() string {
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// URLScope is what a signed URL allows: a single HTTP method, until it
+// expires, optionally on only part of a blob's content.
+type URLScope struct {
+	Method  string
+	Expires time.Time
+	Range   *ByteRange
+}
+
+// SignedURLRequest asks for a URL which can download (GET) or upload (PUT)
+// a blob's content without an API token.
+type SignedURLRequest struct {
+	Method string `json:"method" validate:"oneof=GET PUT"`
+	// Expiry is how many seconds the URL should last for. Defaults
+	// to DefaultSignedURLExpiry.
+	Expiry int64      `json:"expiry" validate:"gte=0"`
+	Range  *ByteRange `json:"range,omitempty"`
+}
+
+// Validate checks the request, filling in a default method and expiry.
+func (s *SignedURLRequest) Validate() error {
+	if s.Method == "" {
+		s.Method = http.MethodGet
+	}
+	validate := validator.New()
+	err := validate.Struct(s)
+	if err != nil {
+		return err
+	}
+	if s.Expiry == 0 {
+		s.Expiry = int64(DefaultSignedURLExpiry / time.Second)
+	} else if s.Expiry > int64(MaxSignedURLExpiry/time.Second) {
+		return SignedURLExpiryError
+	}
+	if s.Range != nil {
+		if s.Method != http.MethodGet {
+			return RangeNotDownloadableError
+		}
+		return s.Range.Validate()
+	}
+	return nil
+}
+
+// Scope returns what a URL satisfying the request allows, starting from now.
+func (s *SignedURLRequest) Scope(now time.Time) *URLScope {
+	return &URLScope{
+		Method:  s.Method,
+		Expires: now.Add(time.Duration(s.Expiry) * time.Second).Truncate(time.Second),
+		Range:   s.Range,
+	}
+}
+
+// SignedURL can be used by anyone to do what its scope allows.
+type SignedURL struct {
+	URL     string     `json:"url"`
+	Method  string     `json:"method"`
+	Expires time.Time  `json:"expires"`
+	Range   *ByteRange `json:"range,omitempty"`
+}
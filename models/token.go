@@ -0,0 +1,37 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// tokenSecretBytes is how much randomness goes into each token.
+const tokenSecretBytes = 32
+
+// Token lets a principal use the API. The token itself is only shown when
+// it's issued: just its hash is stored.
+type Token struct {
+	Id        int64      `json:"id" db:"id"`
+	Principal string     `json:"principal" db:"principal"`
+	Hash      string     `json:"-" db:"hash"`
+	Created   time.Time  `json:"created" db:"created"`
+	Revoked   *time.Time `json:"revoked,omitempty" db:"revoked"`
+}
+
+// GenerateTokenSecret returns a new, random token.
+func GenerateTokenSecret() (string, error) {
+	buf := make([]byte, tokenSecretBytes)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashTokenSecret returns the hash which is stored in place of a token.
+func HashTokenSecret(secret string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(secret)))
+}
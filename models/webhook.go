@@ -0,0 +1,98 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"gopkg.in/go-playground/validator.v9"
+	"time"
+)
+
+// Webhooks are sent with these headers. The signature is the hex-encoded
+// HMAC-SHA256, keyed with the webhook's secret, of the timestamp, a full stop
+// and the body.
+const (
+	WebhookEventHeader     = "X-Repositron-Event"
+	WebhookDeliveryHeader  = "X-Repositron-Delivery"
+	WebhookTimestampHeader = "X-Repositron-Timestamp"
+	WebhookSignatureHeader = "X-Repositron-Signature"
+)
+
+const (
+	// MaxWebhookAttempts is how many times a delivery is tried before it's
+	// given up on.
+	MaxWebhookAttempts = 10
+	// webhookRetryBase is how long the first retry waits, doubling each time.
+	webhookRetryBase = 10 * time.Second
+	// webhookRetryMax is the longest a retry waits.
+	webhookRetryMax = time.Hour
+)
+
+// Webhook sends events to a URL as they're published.
+type Webhook struct {
+	Id  int64  `json:"id" db:"id"`
+	URL string `json:"url" validate:"required,url" db:"url"`
+	// Secret signs each delivery. It's generated if it isn't given, and only
+	// shown when the webhook is created.
+	Secret string `json:"secret,omitempty" db:"secret"`
+	// Events lists the events which are sent, or every event if empty.
+	Events EventTypeList `json:"events,omitempty" db:"events"`
+	// Bucket restricts the webhook to events in one bucket, if it's set.
+	Bucket  string    `json:"bucket,omitempty" db:"bucket"`
+	Created time.Time `json:"created" db:"created"`
+}
+
+func (w *Webhook) Validate() error {
+	validate := validator.New()
+	err := validate.Struct(w)
+	if err != nil {
+		return err
+	}
+	for _, t := range w.Events {
+		err = t.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wants returns whether an event should be sent to this webhook.
+func (w *Webhook) Wants(e *Event) bool {
+	if w.Bucket != "" && (e.Blob == nil || e.Blob.Bucket != w.Bucket) {
+		return false
+	}
+	return w.Events.Contains(e.Type)
+}
+
+// WebhookDelivery is an event waiting to be sent to a webhook.
+type WebhookDelivery struct {
+	Id      int64
+	Webhook *Webhook
+	Event   *Event
+	// Attempts is how many times sending it has already failed.
+	Attempts int
+}
+
+// WebhookRetryDelay is how long to wait before trying a delivery again,
+// after it's failed a number of times.
+func WebhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// SignWebhookPayload returns the signature for a delivery's body, sent at
+// a given Unix time.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -12,20 +12,169 @@ import (
 	"github.com/Sentimentron/repositron/utils"
 	"github.com/Sentimentron/repositron/content"
 	"github.com/Sentimentron/repositron/database"
+	"github.com/Sentimentron/repositron/interfaces"
+	"github.com/Sentimentron/repositron/models"
 	"github.com/Sentimentron/repositron/synchronization"
 	"github.com/gorilla/mux"
+	"strings"
 )
 
+// trashReapInterval is the longest a blob stays in the trash after its grace period.
+const trashReapInterval = time.Hour
+
+func reapTrash(metadataStore interfaces.MetadataStore, contentStore interfaces.ContentStore, gracePeriod time.Duration) {
+	interval := trashReapInterval
+	if gracePeriod > 0 && gracePeriod < interval {
+		interval = gracePeriod
+	}
+	for {
+		purged, err := api.ReapTrash(metadataStore, contentStore, gracePeriod)
+		if err != nil {
+			log.Printf("Unable to empty the trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Removed %d blob(s) from the trash", purged)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// runLifecycleRules applies every bucket's lifecycle rules once per interval.
+func runLifecycleRules(metadataStore interfaces.MetadataStore, interval time.Duration) {
+	for {
+		applied, err := api.RunLifecycleRules(metadataStore, time.Now(), false)
+		if err != nil {
+			log.Printf("Unable to apply lifecycle rules: %v", err)
+		} else if len(applied) > 0 {
+			log.Printf("Lifecycle rules applied to %d blob(s)", len(applied))
+		}
+		time.Sleep(interval)
+	}
+}
+
+// webhookTimeout is how long a webhook's receiver has to respond.
+const webhookTimeout = 10 * time.Second
+
+// eventPruneInterval is how often events older than the retention period
+// are removed.
+const eventPruneInterval = time.Hour
+
+// deliverWebhooks sends events to webhooks once per interval. Events older
+// than retention are removed once their deliveries have succeeded or been
+// abandoned, unless retention is 0.
+func deliverWebhooks(metadataStore interfaces.MetadataStore, interval time.Duration, retention time.Duration) {
+	client := &http.Client{Timeout: webhookTimeout}
+	var pruned time.Time
+	for {
+		now := time.Now()
+		delivered, err := content.DeliverWebhooks(metadataStore, client, now)
+		if err != nil {
+			log.Printf("Unable to deliver webhooks: %v", err)
+		} else if delivered > 0 {
+			log.Printf("Delivered %d webhook(s)", delivered)
+		}
+
+		if retention > 0 && now.Sub(pruned) >= eventPruneInterval {
+			removed, err := metadataStore.PruneEvents(now.Add(-retention))
+			if err != nil {
+				log.Printf("Unable to remove old events: %v", err)
+			} else if removed > 0 {
+				log.Printf("Removed %d old event(s)", removed)
+			}
+			pruned = now
+		}
+		time.Sleep(interval)
+	}
+}
+
+// manageTokens issues, revokes or lists API tokens.
+func manageTokens(metadataStore interfaces.MetadataStore, issue string, revoke int64, list bool) error {
+	if issue != "" {
+		token, secret, err := metadataStore.IssueToken(issue)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Issued token %d for %s (it won't be shown again):\n%s\n", token.Id, token.Principal, secret)
+	}
+	if revoke != 0 {
+		err := metadataStore.RevokeToken(revoke)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Revoked token %d\n", revoke)
+	}
+	if list {
+		tokens, err := metadataStore.ListTokens()
+		if err != nil {
+			return err
+		}
+		for _, token := range tokens {
+			status := "active"
+			if token.Revoked != nil {
+				status = "revoked " + token.Revoked.Format(time.RFC3339)
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\n", token.Id, token.Principal, token.Created.Format(time.RFC3339), status)
+		}
+	}
+	return nil
+}
+
 func main() {
 
 	// Configure some information about this whole thing
-	var dir, store string
+	var dir, store, metadataIndexes, signingKey string
 	var quota int
-	flag.StringVar(&dir, "dir", "static/", "The directory to serve files from. Defaults to static/.")
+	var trashGracePeriod, lifecycleInterval, webhookInterval, eventRetention time.Duration
+	var requireTokens, listTokens bool
+	var issueToken, addAdmin string
+	var revokeToken int64
+	var rateLimit float64
+	var rateBurst, maxUploads, maxDownloads int
+	var maxBandwidth, minFreeSpace int64
+	flag.StringVar(&dir, "dir", "static/", "The directory to store blobs' content in. Defaults to static/.")
 	flag.StringVar(&store, "store", "const/v1.sqlite", "The Sqlite3 file containing the store.")
+	flag.StringVar(&signingKey, "signing-key", "const/signing.key", "The file containing the key which signs content URLs. Generated if it doesn't exist.")
 	flag.IntVar(&quota, "quota", 1, "Maximum temporary file quota")
+	flag.StringVar(&metadataIndexes, "index-metadata", "", "Comma-separated metadata keys to index for searching.")
+	flag.DurationVar(&trashGracePeriod, "trash-grace-period", 7*24*time.Hour, "How long deleted blobs stay in the trash before being removed for good.")
+	flag.DurationVar(&lifecycleInterval, "lifecycle-interval", time.Hour, "How often buckets' lifecycle rules are applied, or 0 to never apply them.")
+	flag.BoolVar(&requireTokens, "require-tokens", true, "Require an API token for the /v1 API.")
+	flag.StringVar(&issueToken, "issue-token", "", "Issue an API token for the given principal, print it and exit.")
+	flag.DurationVar(&webhookInterval, "webhook-interval", time.Second, "How often events are sent to webhooks, or 0 to never send them.")
+	flag.DurationVar(&eventRetention, "event-retention", 7*24*time.Hour, "How long events are kept for event streams to replay, or 0 to keep them forever.")
+	flag.Int64Var(&revokeToken, "revoke-token", 0, "Revoke the API token with the given id and exit.")
+	flag.BoolVar(&listTokens, "list-tokens", false, "List the API tokens which have been issued and exit.")
+	flag.StringVar(&addAdmin, "add-admin", "", "Let the given principal do anything to any bucket, and manage groups and default grants, then exit.")
+	flag.Float64Var(&rateLimit, "rate-limit", 0, "Requests per second each client can make to the /v1 API, or 0 for no limit.")
+	flag.IntVar(&rateBurst, "rate-burst", 20, "Requests each client can make at once before -rate-limit applies.")
+	flag.IntVar(&maxUploads, "max-concurrent-uploads", 0, "Uploads which can be in progress at once, or 0 for no limit.")
+	flag.IntVar(&maxDownloads, "max-concurrent-downloads", 0, "Downloads which can be in progress at once, or 0 for no limit.")
+	flag.Int64Var(&maxBandwidth, "max-bandwidth", 0, "Bytes per second shared between every upload and download, or 0 for no limit.")
+	flag.Int64Var(&minFreeSpace, "min-free-space", 1<<30, "Bytes which must be free in -dir for /readyz to report the server is ready.")
 	flag.Parse()
 
+	// Manage API tokens and administrators, rather than serving anything
+	if issueToken != "" || revokeToken != 0 || listTokens || addAdmin != "" {
+		metadataStore, err := database.CreateStore(store)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = manageTokens(metadataStore, issueToken, revokeToken, listTokens)
+		if err == nil && addAdmin != "" {
+			err = metadataStore.AddGroupMember(models.AdminGroup, addAdmin)
+			if err == nil {
+				fmt.Printf("Added %s to the %s group\n", addAdmin, models.AdminGroup)
+			}
+		}
+		metadataStore.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if !requireTokens {
+		log.Printf("Warning: API tokens aren't required, so anyone can change anything")
+	}
+
 	dir, err := filepath.Abs(dir)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to determine the absolute path of %s", dir)
@@ -44,11 +193,36 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Create the on-disk store
-	contentStore, err := content.CreateStore(dir)
+	// Index frequently-searched metadata keys
+	for _, key := range strings.Split(metadataIndexes, ",") {
+		if key == "" {
+			continue
+		}
+		err = metadataStore.CreateMetadataIndex(strings.TrimSpace(key))
+		if err != nil {
+			log.Fatalf("Unable to index metadata key '%s': %v", key, err)
+		}
+	}
+
+	// Create the on-disk store, which hands out signed URLs for its content
+	diskStore, err := content.CreateStore(dir)
 	if err != nil {
 		log.Fatal(err)
 	}
+	signer, err := content.LoadURLSigner(signingKey)
+	if err != nil {
+		log.Fatalf("Unable to load the signing key: %v", err)
+	}
+	diskStore.Signer = signer
+
+	// Stop write-once blobs changing and held blobs being deleted, however they're reached
+	protectedStore := content.CreateProtectedContentStore(diskStore, metadataStore)
+
+	// Keep track of how much is stored, and cut off writes which go over quota
+	contentStore, err := content.CreateAccountingContentStore(protectedStore, metadataStore)
+	if err != nil {
+		log.Printf("Unable to estimate how much content is stored: %v", err)
+	}
 
 	// Create the synchronization store, which stops stuff colliding on append
 	syncStore, err := synchronization.CreateMemorySynchronizationStore()
@@ -56,6 +230,37 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Replay or roll back anything which was interrupted last time
+	recovered, err := content.RecoverIntents(metadataStore, contentStore)
+	if err != nil {
+		log.Fatalf("Unable to recover interrupted operations: %v", err)
+	} else if recovered > 0 {
+		log.Printf("Recovered %d interrupted operation(s)", recovered)
+	}
+
+	// Remove blobs for good once they've been in the trash long enough
+	go reapTrash(metadataStore, contentStore, trashGracePeriod)
+
+	// Apply lifecycle rules in the background
+	if lifecycleInterval > 0 {
+		go runLifecycleRules(metadataStore, lifecycleInterval)
+	}
+
+	// Send events to webhooks, retrying the ones which failed, and remove old ones
+	if webhookInterval > 0 {
+		go deliverWebhooks(metadataStore, webhookInterval, eventRetention)
+	}
+
+	// Slow down clients which make too many requests or transfers
+	var rateLimiter interfaces.RateLimiter
+	if rateLimit > 0 {
+		rateLimiter = synchronization.CreateMemoryRateLimiter(rateLimit, rateBurst)
+	}
+	var transferLimiter interfaces.TransferLimiter
+	if maxUploads > 0 || maxDownloads > 0 || maxBandwidth > 0 {
+		transferLimiter = synchronization.CreateMemoryTransferLimiter(maxUploads, maxDownloads, maxBandwidth)
+	}
+
 	// Configure the URLs
 	r := mux.NewRouter()
 
@@ -66,7 +271,7 @@ func main() {
 	}
 
 	// Configure all the URLs on this server
-	api.AttachAPIMethods(syncStore, contentStore, metadataStore, uiDir, dir,true, r)
+	api.AttachAPIMethods(syncStore, contentStore, metadataStore, uiDir, signer, rateLimiter, transferLimiter, minFreeSpace, true, requireTokens, r)
 
 	srv := &http.Server{
 		Handler:      r,
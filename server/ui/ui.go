@@ -2,8 +2,11 @@ package ui
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"github.com/Sentimentron/repositron/api/httpstatus"
+	"github.com/Sentimentron/repositron/content"
 	"github.com/Sentimentron/repositron/interfaces"
 	"github.com/Sentimentron/repositron/models"
 	"github.com/Sentimentron/repositron/utils"
@@ -28,8 +31,14 @@ type UIBucket struct {
 	Contents []UIFile
 }
 
+type UISearch struct {
+	Name string
+	Text string
+}
+
 type UIData struct {
 	Buckets []UIBucket
+	Search  UISearch
 }
 
 type UIUploadData struct {
@@ -60,15 +69,68 @@ func formatJSON(d map[string]interface{}) string {
 	return string(s)
 }
 
+// checkPermission returns AccessDeniedError unless the request's principal
+// can do something to a bucket. Nothing is checked if tokens aren't required.
+func checkPermission(store interfaces.AccessStore, r *http.Request, bucket string, permission models.Permission) error {
+	principal := utils.RequestPrincipal(r)
+	if principal == "" {
+		return nil
+	}
+	return store.CheckPermission(principal, bucket, permission)
+}
+
+// writeError reports why a request can't go ahead, with the status the API
+// would respond with for the same error.
+func writeError(w http.ResponseWriter, prefix string, err error) {
+	w.WriteHeader(httpstatus.ForError(err))
+	fmt.Fprintf(w, "%s: %v", prefix, err)
+}
+
+// renderTemplate only sends a page once it has rendered completely, so that
+// errors can still be reported with the right status.
+func renderTemplate(w http.ResponseWriter, t *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	err := t.Execute(&buf, data)
+	if err != nil {
+		writeError(w, "Error", err)
+		return
+	}
+	buf.WriteTo(w)
+}
+
 func IndexEndpointFactory(store interfaces.MetadataStore, uiDir string) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
+		// Restrict the listing if the search form was used
+		search := UISearch{
+			Name: r.URL.Query().Get("name"),
+			Text: r.URL.Query().Get("text"),
+		}
+		var matching map[int64]struct{}
+		if search.Name != "" || search.Text != "" {
+			qry := &models.BlobSearch{}
+			if search.Name != "" {
+				qry.NameGlob = &search.Name
+			}
+			if search.Text != "" {
+				qry.Text = &search.Text
+			}
+			ids, err := store.SearchBlobs(qry)
+			if err != nil && err != interfaces.NoMatchingBlobsError {
+				writeError(w, "Error", err)
+				return
+			}
+			matching = make(map[int64]struct{})
+			for _, v := range ids {
+				matching[v] = struct{}{}
+			}
+		}
+
 		// Retrieve a list of all buckets that are in this system.
 		buckets, err := store.GetAllBuckets()
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error", err)
 			return
 		}
 
@@ -80,16 +142,29 @@ func IndexEndpointFactory(store interfaces.MetadataStore, uiDir string) http.Han
 				Contents: make([]UIFile, 0),
 			}
 
+			// Skip the buckets which can't be read
+			err = checkPermission(store, r, b, models.PermissionRead)
+			if err == interfaces.AccessDeniedError {
+				continue
+			} else if err != nil {
+				writeError(w, "Error", err)
+				return
+			}
+
 			// Retrieve all the files inside this bucket
 			allIds, err := store.GetBlobIdsMatchingBucket(b)
 			if err != nil {
-				fmt.Fprintf(w, "Error: %v", err)
-				w.WriteHeader(http.StatusInternalServerError)
+				writeError(w, "Error", err)
 				return
 			}
 
 			allBlobs := make([]UIFile, 0)
 			for _, v := range allIds {
+				if matching != nil {
+					if _, ok := matching[v]; !ok {
+						continue
+					}
+				}
 				blob, err := store.RetrieveBlobById(v)
 				if err != nil {
 					log.Printf("Error retrieving blob with id %d: %v", v, err)
@@ -97,6 +172,9 @@ func IndexEndpointFactory(store interfaces.MetadataStore, uiDir string) http.Han
 					allBlobs = append(allBlobs, UIFile{*blob})
 				}
 			}
+			if len(allBlobs) == 0 {
+				continue
+			}
 
 			cur.Contents = allBlobs
 			displayData = append(displayData, cur)
@@ -112,12 +190,7 @@ func IndexEndpointFactory(store interfaces.MetadataStore, uiDir string) http.Han
 		}
 		t := template.Must(template.New("index.html").Funcs(fmap).ParseFiles(path.Join(uiDir, "index.html")))
 
-		err = t.Execute(w, UIData{displayData})
-		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		renderTemplate(w, t, UIData{displayData, search})
 	})
 
 }
@@ -133,16 +206,19 @@ func DeleteConfirmEndpointFactory(store interfaces.MetadataStore, uiDir string)
 		vars := mux.Vars(r)
 		id, err := strconv.ParseInt(vars["id"], 10, 64)
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error", err)
 			return
 		}
 
 		// Retrieve the blob
 		blob, err := store.RetrieveBlobById(id)
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error", err)
+			return
+		}
+		err = checkPermission(store, r, blob.Bucket, models.PermissionDelete)
+		if err != nil {
+			writeError(w, "Error", err)
 			return
 		}
 
@@ -151,52 +227,167 @@ func DeleteConfirmEndpointFactory(store interfaces.MetadataStore, uiDir string)
 		}
 
 		t := template.Must(template.New("delete.html").Funcs(fmap).ParseFiles(path.Join(uiDir, "delete.html")))
-		err = t.Execute(w, UIFile{*blob})
+		renderTemplate(w, t, UIFile{*blob})
+	})
+}
+
+func DeleteEndpointFactory(store interfaces.MetadataStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Convert URL parameter
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error", err)
+			return
+		}
+
+		// Move the blob into the trash, where it can be restored from
+		blob, err := store.RetrieveBlobById(id)
+		if err == nil {
+			err = checkPermission(store, r, blob.Bucket, models.PermissionDelete)
+		}
+		if err != nil {
+			writeError(w, "Error", err)
+			return
+		}
+		err = content.RequestAuditTrail(store, r).Change(func(tx *content.AuditedChanges) error {
+			err := tx.TrashBlobById(id)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditDelete, blob, nil)
+		})
+		if err != nil {
+			writeError(w, "Error", err)
 			return
 		}
+
+		http.Redirect(w, r, "/", 301)
 	})
 }
 
-func DeleteEndpointFactory(store interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+type UITrashData struct {
+	Contents []UIFile
+}
+
+func createRestoreLink(id int64) string {
+	return fmt.Sprintf("/trash/restore/%d", id)
+}
+
+func createPurgeLink(id int64) string {
+	return fmt.Sprintf("/trash/purge/%d", id)
+}
+
+func formatDeleted(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatDate(*t)
+}
+
+func TrashEndpointFactory(store interfaces.MetadataStore, uiDir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		trash, err := store.ListTrash()
+		if err != nil {
+			writeError(w, "Error", err)
+			return
+		}
+
+		contents := make([]UIFile, 0)
+		for _, b := range trash {
+			err = checkPermission(store, r, b.Bucket, models.PermissionRead)
+			if err == interfaces.AccessDeniedError {
+				continue
+			} else if err != nil {
+				writeError(w, "Error", err)
+				return
+			}
+			contents = append(contents, UIFile{*b})
+		}
+
+		fmap := template.FuncMap{
+			"createRestoreLink": createRestoreLink,
+			"createPurgeLink":   createPurgeLink,
+			"formatDeleted":     formatDeleted,
+			"formatJSON":        formatJSON,
+		}
+		t := template.Must(template.New("trash.html").Funcs(fmap).ParseFiles(path.Join(uiDir, "trash.html")))
+		renderTemplate(w, t, UITrashData{contents})
+	})
+}
+
+func RestoreEndpointFactory(store interfaces.MetadataStore) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		// Convert URL parameter
 		vars := mux.Vars(r)
 		id, err := strconv.ParseInt(vars["id"], 10, 64)
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error", err)
 			return
 		}
 
-		blob, err := store.RetrieveBlobById(id)
+		blob, err := store.RetrieveTrashedBlob(id)
+		if err == nil {
+			err = checkPermission(store, r, blob.Bucket, models.PermissionDelete)
+		}
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error", err)
 			return
 		}
 
-		err = store.DeleteBlobById(id)
+		err = content.RequestAuditTrail(store, r).Change(func(tx *content.AuditedChanges) error {
+			restored, err := tx.RestoreBlobById(id)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditRestore, blob, restored)
+		})
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error", err)
+			return
 		}
 
-		err = contentStore.DeleteBlobContent(blob)
+		http.Redirect(w, r, "/trash", 301)
+	})
+}
+
+func PurgeEndpointFactory(store interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// Convert URL parameter
+		vars := mux.Vars(r)
+		id, err := strconv.ParseInt(vars["id"], 10, 64)
 		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error", err)
 			return
 		}
 
-		http.Redirect(w, r, "/", 301)
+		// Only blobs which are already in the trash can be purged
+		blob, err := store.RetrieveTrashedBlob(id)
+		if err != nil {
+			writeError(w, "Error", err)
+			return
+		}
+		err = checkPermission(store, r, blob.Bucket, models.PermissionDelete)
+		if err != nil {
+			writeError(w, "Error", err)
+			return
+		}
+
+		err = content.PurgeBlob(store, contentStore, content.RequestAuditTrail(store, r), blob)
+		if err != nil {
+			writeError(w, "Error", err)
+			return
+		}
+
+		http.Redirect(w, r, "/trash", 301)
 	})
 }
 
-func ProcessUploadEndpointFactory(store interfaces.MetadataStore, contentStore interfaces.ContentStore) http.Handler {
+func ProcessUploadEndpointFactory(store interfaces.MetadataStore, contentStore interfaces.ContentStore, synchronizationStore interfaces.SynchronizationStore) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		var currentBlob models.Blob
@@ -205,12 +396,14 @@ func ProcessUploadEndpointFactory(store interfaces.MetadataStore, contentStore i
 		metadata := make(map[string]interface{})
 		err := json.Unmarshal([]byte(r.FormValue("metadata")), &metadata)
 		if err != nil {
-			fmt.Fprintf(w, "Error interpreting metadata: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Error interpreting metadata", err)
 			return
 		}
 
 		currentBlob.Uploader = "Default User"
+		if principal := utils.RequestPrincipal(r); principal != "" {
+			currentBlob.Uploader = principal
+		}
 		currentBlob.Metadata = metadata
 		currentBlob.Date = time.Now()
 		currentBlob.Name = r.FormValue("name")
@@ -221,8 +414,8 @@ func ProcessUploadEndpointFactory(store interfaces.MetadataStore, contentStore i
 		// Retrieve the form
 		file, header, err := r.FormFile("upload")
 		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
 			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 		defer file.Close()
@@ -230,55 +423,97 @@ func ProcessUploadEndpointFactory(store interfaces.MetadataStore, contentStore i
 
 		currentBlob.Size = header.Size
 
+		// Check the uploader can write to the bucket
+		err = checkPermission(store, r, currentBlob.Bucket, models.PermissionWrite)
+		if err != nil {
+			writeError(w, "Error", err)
+			return
+		}
+
+		// Apply the bucket's defaults and restrictions
+		bucket, err := store.RetrieveBucket(currentBlob.Bucket)
+		if err == nil {
+			bucket.ApplyDefaults(&currentBlob)
+			err = bucket.CheckBlob(&currentBlob)
+		}
+		if err != nil && err != interfaces.NoSuchBucketError {
+			writeError(w, "Bucket error", err)
+			return
+		}
+
 		// Process validation
 		validate := validator.New()
 		err = validate.Struct(currentBlob)
 		if err != nil {
-			fmt.Fprintf(w, "Validation error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Validation error", err)
 			return
 		}
 
+		// Check there's room for the upload
+		if accountable, ok := contentStore.(interfaces.AccountableContentStore); ok {
+			err = accountable.CheckQuotas(&currentBlob, currentBlob.Size, 1)
+			if err != nil {
+				writeError(w, "Quota error", err)
+				return
+			}
+		}
+
 		// Send the item to the store
 		newBlob, err := store.StoreBlobRecord(&currentBlob)
 		if err != nil {
-			fmt.Fprintf(w, "Blob storage error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Blob storage error", err)
 			return
 		}
 
-		// Write the blob's content
-		written, err := contentStore.AppendBlobContent(newBlob, &buf)
-		if written.Size != newBlob.Size {
-			fmt.Fprintf(w, "Did not write enough: %d out of %d byte(s), error: %v", written.Size, newBlob.Size, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		} else if err != nil {
-			fmt.Fprintf(w, "Write error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+		err = synchronizationStore.Lock(newBlob.Id)
+		if err != nil {
+			writeError(w, "Blob storage error", err)
 			return
 		}
+		defer synchronizationStore.Unlock(newBlob.Id)
 
-		// Read the blob's content back
-		checksumBuffer := new(bytes.Buffer)
-		read, err := contentStore.RetrieveBlobContent(newBlob, checksumBuffer)
-		if read != newBlob.Size {
-			fmt.Fprintf(w, "Did not read enough: %d out of %d byte(s), error: %v",
-				read, newBlob.Size, err)
+		// The content is staged until the upload has been recorded. Anything
+		// left behind is rolled back if the upload fails.
+		intent, err := store.RecordIntent(newBlob.Id, models.IntentUpload)
+		if err != nil {
+			writeError(w, "Blob storage error", err)
+			return
+		}
+		succeeded := false
+		defer func() {
+			content.FinishIntent(store, contentStore, intent, succeeded)
+		}()
+
+		// Write the blob's content, computing its checksum on the way
+		h := sha256.New()
+		written, err := content.StageBlobContent(contentStore, newBlob, io.TeeReader(&buf, h))
+		if err != nil {
+			writeError(w, "Write error", err)
+			return
+		} else if written.Size != newBlob.Size {
 			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Did not write enough: %d out of %d byte(s)", written.Size, newBlob.Size)
 			return
 		}
 
-		// Compute the checksum of the item
-		newBlob.Checksum = utils.ComputeSHA256Checksum(checksumBuffer)
+		newBlob.Checksum = fmt.Sprintf("%x", h.Sum(nil))
 
 		// Finalize the store
-		_, err = store.FinalizeBlobRecord(newBlob)
+		err = content.RequestAuditTrail(store, r).Change(func(tx *content.AuditedChanges) error {
+			finalized, err := tx.FinalizeBlobRecord(newBlob)
+			if err != nil {
+				return err
+			}
+			return tx.Record(models.AuditCreate, nil, finalized)
+		})
+		if err == nil {
+			err = content.CommitStagedContent(contentStore, newBlob)
+		}
 		if err != nil {
-			fmt.Fprintf(w, "Write error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, "Write error", err)
 			return
 		}
+		succeeded = true
 
 		http.Redirect(w, r, "/", 301)
 
@@ -290,11 +525,6 @@ func UploadEndpointFactory(uiDir string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmap := template.FuncMap{}
 		t := template.Must(template.New("upload.html").Funcs(fmap).ParseFiles(path.Join(uiDir, "upload.html")))
-		err := t.Execute(w, UIUploadData{time.Now()})
-		if err != nil {
-			fmt.Fprintf(w, "Error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
+		renderTemplate(w, t, UIUploadData{time.Now()})
 	})
 }
@@ -0,0 +1,181 @@
+package synchronization
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	"sync"
+	"time"
+)
+
+// tokenBucket refills at a steady rate, up to a limit. Taking more tokens
+// than it holds leaves it in debt, which has to be refilled before anything
+// else can be taken.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate, burst, burst, now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait returns how long it'll be until n tokens are available.
+func (b *tokenBucket) wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket would be full by now.
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// MemoryRateLimiter gives each client a token bucket, so that they can make
+// a burst of requests, but only keep making them at a steady rate.
+type MemoryRateLimiter struct {
+	rate     float64
+	burst    float64
+	buckets  map[string]*tokenBucket
+	lastTidy time.Time
+	lock     sync.Mutex
+	// now is replaced when testing
+	now func() time.Time
+}
+
+// CreateMemoryRateLimiter lets each client make rate requests per second,
+// and up to burst at once.
+func CreateMemoryRateLimiter(rate float64, burst int) *MemoryRateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &MemoryRateLimiter{
+		rate:     rate,
+		burst:    float64(burst),
+		buckets:  make(map[string]*tokenBucket),
+		lastTidy: time.Now(),
+		now:      time.Now,
+	}
+}
+
+// tidy forgets clients whose buckets have filled up again, since they'd be
+// recreated full. Must be called with the lock held.
+func (m *MemoryRateLimiter) tidy(now time.Time) {
+	if now.Sub(m.lastTidy) < time.Minute {
+		return
+	}
+	m.lastTidy = now
+	for client, bucket := range m.buckets {
+		if bucket.full(now) {
+			delete(m.buckets, client)
+		}
+	}
+}
+
+// Allow takes a token from a client's bucket, or returns how long it'll be
+// until there's one to take.
+func (m *MemoryRateLimiter) Allow(client string) (bool, time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.now()
+	m.tidy(now)
+	bucket, ok := m.buckets[client]
+	if !ok {
+		bucket = newTokenBucket(m.rate, m.burst, now)
+		m.buckets[client] = bucket
+	}
+	bucket.refill(now)
+	if wait := bucket.wait(1); wait > 0 {
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// Wait returns how long it'll be until there's a token in a client's bucket,
+// without taking it.
+func (m *MemoryRateLimiter) Wait(client string) time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	bucket, ok := m.buckets[client]
+	if !ok {
+		return 0
+	}
+	bucket.refill(m.now())
+	return bucket.wait(1)
+}
+
+// MemoryTransferLimiter caps the number of uploads and downloads running at
+// once, and shares out a fixed amount of bandwidth between them.
+type MemoryTransferLimiter struct {
+	slots     map[interfaces.TransferKind]chan struct{}
+	bandwidth *tokenBucket
+	lock      sync.Mutex
+}
+
+// CreateMemoryTransferLimiter allows up to maxUploads uploads and maxDownloads
+// downloads at once, transferring at most bandwidth bytes per second between
+// them. Zero means no limit.
+func CreateMemoryTransferLimiter(maxUploads, maxDownloads int, bandwidth int64) *MemoryTransferLimiter {
+	ret := &MemoryTransferLimiter{slots: make(map[interfaces.TransferKind]chan struct{})}
+	if maxUploads > 0 {
+		ret.slots[interfaces.Upload] = make(chan struct{}, maxUploads)
+	}
+	if maxDownloads > 0 {
+		ret.slots[interfaces.Download] = make(chan struct{}, maxDownloads)
+	}
+	if bandwidth > 0 {
+		// Allow up to a second's worth at once
+		ret.bandwidth = newTokenBucket(float64(bandwidth), float64(bandwidth), time.Now())
+	}
+	return ret
+}
+
+// StartTransfer takes a slot for a transfer, if one's free.
+func (m *MemoryTransferLimiter) StartTransfer(kind interfaces.TransferKind) bool {
+	slots, ok := m.slots[kind]
+	if !ok {
+		return true
+	}
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// FinishTransfer gives back a slot taken by StartTransfer.
+func (m *MemoryTransferLimiter) FinishTransfer(kind interfaces.TransferKind) {
+	if slots, ok := m.slots[kind]; ok {
+		<-slots
+	}
+}
+
+// WaitForBandwidth reserves n bytes of bandwidth, sleeping until they've been
+// paid for. Transfers which reserve more than a second's worth at once put the
+// bandwidth into debt, so everyone else waits for them.
+func (m *MemoryTransferLimiter) WaitForBandwidth(n int) {
+	if m.bandwidth == nil {
+		return
+	}
+	m.lock.Lock()
+	m.bandwidth.refill(time.Now())
+	wait := m.bandwidth.wait(float64(n))
+	m.bandwidth.tokens -= float64(n)
+	m.lock.Unlock()
+
+	time.Sleep(wait)
+}
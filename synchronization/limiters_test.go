@@ -0,0 +1,98 @@
+package synchronization
+
+import (
+	"github.com/Sentimentron/repositron/interfaces"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimiter(t *testing.T) {
+	Convey("Given a rate limiter allowing 2 requests per second, 3 at once...", t, func() {
+
+		limiter := CreateMemoryRateLimiter(2, 3)
+		now := time.Now()
+		limiter.now = func() time.Time { return now }
+
+		Convey("Should allow a burst, then make the client wait...", func() {
+			for i := 0; i < 3; i++ {
+				ok, _ := limiter.Allow("alice")
+				So(ok, ShouldBeTrue)
+			}
+			ok, wait := limiter.Allow("alice")
+			So(ok, ShouldBeFalse)
+			So(wait, ShouldEqual, 500*time.Millisecond)
+
+			// Other clients have their own buckets
+			ok, _ = limiter.Allow("bob")
+			So(ok, ShouldBeTrue)
+
+			now = now.Add(500 * time.Millisecond)
+			ok, _ = limiter.Allow("alice")
+			So(ok, ShouldBeTrue)
+			ok, _ = limiter.Allow("alice")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Should say how long a client has to wait without using a request up...", func() {
+			So(limiter.Wait("alice"), ShouldEqual, 0)
+			for i := 0; i < 3; i++ {
+				limiter.Allow("alice")
+			}
+			So(limiter.Wait("alice"), ShouldEqual, 500*time.Millisecond)
+
+			now = now.Add(500 * time.Millisecond)
+			So(limiter.Wait("alice"), ShouldEqual, 0)
+			So(limiter.Wait("alice"), ShouldEqual, 0)
+			ok, _ := limiter.Allow("alice")
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("Should forget clients which have been idle...", func() {
+			limiter.Allow("alice")
+			So(limiter.buckets, ShouldContainKey, "alice")
+			now = now.Add(2 * time.Minute)
+			limiter.Allow("bob")
+			So(limiter.buckets, ShouldNotContainKey, "alice")
+			So(limiter.buckets, ShouldContainKey, "bob")
+		})
+	})
+}
+
+func TestMemoryTransferLimiter(t *testing.T) {
+	Convey("Given a transfer limiter allowing one upload and two downloads...", t, func() {
+
+		limiter := CreateMemoryTransferLimiter(1, 2, 0)
+
+		Convey("Should refuse transfers once every slot's taken...", func() {
+			So(limiter.StartTransfer(interfaces.Upload), ShouldBeTrue)
+			So(limiter.StartTransfer(interfaces.Upload), ShouldBeFalse)
+			So(limiter.StartTransfer(interfaces.Download), ShouldBeTrue)
+			So(limiter.StartTransfer(interfaces.Download), ShouldBeTrue)
+			So(limiter.StartTransfer(interfaces.Download), ShouldBeFalse)
+
+			limiter.FinishTransfer(interfaces.Upload)
+			So(limiter.StartTransfer(interfaces.Upload), ShouldBeTrue)
+		})
+
+		Convey("Should not wait for bandwidth if there's no limit...", func() {
+			start := time.Now()
+			limiter.WaitForBandwidth(1 << 30)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+	})
+
+	Convey("Given a transfer limiter with limited bandwidth...", t, func() {
+
+		limiter := CreateMemoryTransferLimiter(0, 0, 1000)
+
+		Convey("Should allow a second's worth straight away, then throttle...", func() {
+			So(limiter.StartTransfer(interfaces.Upload), ShouldBeTrue)
+			start := time.Now()
+			limiter.WaitForBandwidth(1000)
+			So(time.Since(start), ShouldBeLessThan, 100*time.Millisecond)
+			limiter.WaitForBandwidth(200)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 150*time.Millisecond)
+		})
+	})
+}
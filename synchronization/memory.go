@@ -1,6 +1,7 @@
 package synchronization
 
 import (
+	"github.com/Sentimentron/repositron/metrics"
 	"log"
 	"sync"
 	"time"
@@ -8,6 +9,10 @@ import (
 
 const tidyDuration = 5 * time.Second
 
+// lockWaitSeconds is how long callers block in MemorySynchronizationStore.Lock.
+var lockWaitSeconds = metrics.NewHistogramVec("repositron_lock_wait_seconds",
+	"How long it took to acquire a lock on a blob.", metrics.DefaultDurationBuckets)
+
 type syncRecord struct {
 	lastAcquired time.Time
 	mutex        *sync.Mutex
@@ -53,7 +58,9 @@ func (m *MemorySynchronizationStore) Lock(id int64) error {
 	m.lockMap[id].lastAcquired = time.Now()
 
 	// Acquire the lock or block trying
+	started := time.Now()
 	m.lockMap[id].mutex.Lock()
+	lockWaitSeconds.With().Observe(time.Since(started).Seconds())
 	m.lockMap[id].lastAcquired = time.Now()
 
 	return nil
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// principalKey is the context key the authenticated principal is stored under.
+type principalKey struct{}
+
+// WithPrincipal records who a request has been authenticated as.
+func WithPrincipal(r *http.Request, principal string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// RequestPrincipal returns who a request was authenticated as, or "" if it
+// wasn't (because tokens aren't required).
+func RequestPrincipal(r *http.Request) string {
+	principal, _ := r.Context().Value(principalKey{}).(string)
+	return principal
+}
+
+// RequestAddress returns the address a request came from, without its port.
+func RequestAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+)
+
+// RequestIdHeader carries a request's id, so that it can be found in logs.
+const RequestIdHeader = "X-Request-Id"
+
+// requestIdKey is the context key a request's id is stored under.
+type requestIdKey struct{}
+
+// validRequestId matches ids which are safe to accept from clients.
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// GenerateRequestId returns a new random id.
+func GenerateRequestId() string {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// WithRequestId records a request's id, using the one the client sent if it's
+// reasonable, or a new one otherwise.
+func WithRequestId(r *http.Request) (*http.Request, string) {
+	id := r.Header.Get(RequestIdHeader)
+	if !validRequestId.MatchString(id) {
+		id = GenerateRequestId()
+	}
+	return r.WithContext(context.WithValue(r.Context(), requestIdKey{}, id)), id
+}
+
+// RequestId returns a request's id, or "" if it hasn't been given one.
+func RequestId(r *http.Request) string {
+	id, _ := r.Context().Value(requestIdKey{}).(string)
+	return id
+}